@@ -227,3 +227,15 @@ func Ping(host string) (bool, error) {
 		strings.Join(params, " "), string(stdOutput), string(errOutput))
 	return true, err
 }
+
+// PingVia 通过指定网卡 ping, 用于检测各条链路是否能访问互联网
+func PingVia(iface, host string) (bool, error) {
+	params := []string{"-c", "2", "-W", "3", "-I", iface, host}
+	logger.CheckLogger().Debugf("PingVia, running cmd: ping %v", strings.Join(params, " "))
+	stdOutput, errOutput, err := run.RunExe("ping", params)
+	if err != nil {
+		return false, fmt.Errorf("failed run Ping %v, err is :%v, stdOutput is :%v, errOutput is :%v",
+			params, err, string(stdOutput), string(errOutput))
+	}
+	return true, nil
+}
@@ -85,6 +85,11 @@ func disposeComposeFile() {
 	if err != nil {
 		logger.AppLogger().Warnf("failed ProcessVolumes, file:%v, err1:%v", config.Config.Docker.ComposeFile, err)
 	}
+
+	err = ProcessInternalClientCertVolumes(config.Config.Docker.ComposeFile)
+	if err != nil {
+		logger.AppLogger().Warnf("failed ProcessInternalClientCertVolumes, file:%v, err:%v", config.Config.Docker.ComposeFile, err)
+	}
 }
 
 func writeDefaultDockerComposeFile() {
@@ -115,6 +120,10 @@ func writeUpgradeComposeFile() {
 		logger.AppLogger().Errorf("write upgrade ComposeFile err:%v", err)
 		return
 	}
+	err = ProcessInternalClientCertVolumes(f)
+	if err != nil {
+		logger.AppLogger().Errorf("ProcessInternalClientCertVolumes of upgrade ComposeFile err:%v", err)
+	}
 }
 
 func replaceRandomPasswordAndPortPlaceholder(composeFileContent []byte) []byte {
@@ -23,10 +23,12 @@ package docker
 
 import (
 	"agent/biz/model/device"
+	"agent/biz/model/internalca"
 	"agent/config"
 	"agent/utils/version"
 	"fmt"
 	"path"
+	"strings"
 
 	"agent/biz/model/device_ability"
 
@@ -112,6 +114,11 @@ func putEnvIntoGateway(ret map[string]map[string]string) {
 	}
 	envs["APP_ACCOUNT_SYSTEM_AGENT_URL_DEVICE_INFO"] = config.Config.EnvDefaultVal.SYSTEM_AGENT_URL_DEVICE_INFO
 	envs["APP_SYSTEM_AGENT_URL_BASE"] = config.Config.EnvDefaultVal.SYSTEM_AGENT_URL_BASE
+	if internalca.Enabled() {
+		envs["APP_ACCOUNT_SYSTEM_AGENT_URL_DEVICE_INFO"] = strings.Replace(envs["APP_ACCOUNT_SYSTEM_AGENT_URL_DEVICE_INFO"], "http://", "https://", 1)
+		envs["APP_SYSTEM_AGENT_URL_BASE"] = strings.Replace(envs["APP_SYSTEM_AGENT_URL_BASE"], "http://", "https://", 1)
+	}
+	internalAgentEnvs(envs)
 	envs["APP_BOX_KEYFINGERPRINT"] = fingerPrint
 
 	envs["APP_BOX_SUPPORT_SECURITY_CHIP"] = fmt.Sprintf("%v", device_ability.GetAbilityModel().SecurityChipSupport) // 是否支持加密芯片, APP_BOX_SUPPORT_SECURITY_CHIP="true"
@@ -146,9 +153,18 @@ func putEnvIntoClient(ret map[string]map[string]string) {
 	ret["aonetwork-client.env"] = envs
 }
 
+// nginxCertMountDir 证书目录(config.Config.Box.Cert.CertDir)在 nginx 容器中的挂载路径.
+const nginxCertMountDir = "/etc/nginx/certs"
+
 func putEnvIntoNginx(ret map[string]map[string]string) {
 	envs := map[string]string{}
 
 	envs["CONFIG_WEBURL"] = config.Config.Platform.WebBase.Url
+	if config.Config.Box.Cert.ACME.Enable {
+		// 与 certificate.ACMEManager 写入的 acme/live/ 目录对应
+		envs["ACME_CERT_FILE"] = path.Join(nginxCertMountDir, "acme", "live", "fullchain.pem")
+		envs["ACME_KEY_FILE"] = path.Join(nginxCertMountDir, "acme", "live", "privkey.pem")
+	}
+	internalAgentEnvs(envs)
 	ret["aospace-nginx.env"] = envs
 }
@@ -0,0 +1,142 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"agent/biz/model/internalca"
+	"agent/config"
+	"agent/res"
+	"agent/utils/logger"
+	"agent/utils/tools"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/dungeonsnd/gocom/file/fileutil"
+)
+
+// ProcessInternalClientCertVolumes 启用内部接口双向 TLS 时, 签发各容器的客户端证书,
+// 并在 docker-compose.yml 中把证书目录只读挂载到对应容器.
+func ProcessInternalClientCertVolumes(composeFile string) error {
+	if !internalca.Enabled() {
+		return nil
+	}
+	if err := internalca.EnsureClientCerts(); err != nil {
+		return err
+	}
+
+	content, err := fileutil.ReadFromFile(composeFile)
+	if err != nil {
+		return err
+	}
+	volumes := map[string]string{}
+	for _, name := range internalca.ClientNames() {
+		volumes[name] = fmt.Sprintf("%v:%v:ro", res.GetVolumeHostPath(internalca.ClientCertDirOf(name)),
+			config.Config.Web.InternalMTLS.ClientMountPath)
+	}
+	newContent := addServiceVolumes(string(content), volumes)
+	logger.AppLogger().Debugf("ProcessInternalClientCertVolumes, volumes:%+v", volumes)
+	return fileutil.WriteToFile(composeFile, []byte(newContent), true)
+}
+
+// addServiceVolumes 在 compose 文件内容中给指定服务追加一条 volume. 服务没有 volumes 时新增该字段,
+// 已挂载的跳过. volumes 的 key 为服务名.
+func addServiceVolumes(content string, volumes map[string]string) string {
+	existing := serviceVolumes(content)
+	pending := map[string]string{}
+	for name, v := range volumes {
+		found := false
+		for _, e := range existing[name] {
+			found = found || e == v
+		}
+		if !found {
+			pending[name] = v
+		}
+	}
+	volumes = pending
+
+	newContent := ""
+	inServices := false
+	service := ""
+	added := false
+
+	finishService := func() {
+		if v, ok := volumes[service]; ok && !added {
+			newContent += fmt.Sprintf("    volumes:\n      - %v\n", v)
+		}
+		service = ""
+		added = false
+	}
+
+	for _, line := range tools.StringToLines(strings.TrimSuffix(content, "\n")) {
+		trimmed := strings.TrimSpace(line)
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		if len(trimmed) > 0 && !strings.HasPrefix(trimmed, "#") {
+			if indent == 0 {
+				finishService()
+				inServices = trimmed == "services:"
+			} else if inServices && indent == 2 && strings.HasSuffix(trimmed, ":") {
+				finishService()
+				service = strings.TrimSuffix(trimmed, ":")
+			}
+		}
+
+		newContent += line + "\n"
+
+		if v, ok := volumes[service]; ok && !added && indent == 4 && trimmed == "volumes:" {
+			newContent += fmt.Sprintf("      - %v\n", v)
+			added = true
+		}
+	}
+	finishService()
+	return newContent
+}
+
+// serviceVolumes 返回 compose 文件内容中各服务已有的 volume, key 为服务名.
+func serviceVolumes(content string) map[string][]string {
+	result := map[string][]string{}
+	inServices, inVolumes := false, false
+	service := ""
+	for _, line := range tools.StringToLines(content) {
+		trimmed := strings.TrimSpace(line)
+		if len(trimmed) < 1 || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		indent := len(line) - len(strings.TrimLeft(line, " "))
+		switch {
+		case indent == 0:
+			inServices, service, inVolumes = trimmed == "services:", "", false
+		case inServices && indent == 2:
+			service, inVolumes = strings.TrimSuffix(trimmed, ":"), false
+		case len(service) > 0 && indent == 4:
+			inVolumes = trimmed == "volumes:"
+		case inVolumes && strings.HasPrefix(trimmed, "- "):
+			v := strings.Trim(strings.TrimSpace(strings.TrimPrefix(trimmed, "- ")), `"'`)
+			result[service] = append(result[service], v)
+		}
+	}
+	return result
+}
+
+// internalAgentEnvs 启用内部接口双向 TLS 时, 提供给容器的 agent 地址及客户端证书路径.
+func internalAgentEnvs(envs map[string]string) {
+	if !internalca.Enabled() {
+		return
+	}
+	mountPath := config.Config.Web.InternalMTLS.ClientMountPath
+	envs["APP_SYSTEM_AGENT_CLIENT_CERT"] = path.Join(mountPath, internalca.ClientCertFile)
+	envs["APP_SYSTEM_AGENT_CLIENT_KEY"] = path.Join(mountPath, internalca.ClientKeyFile)
+	envs["APP_SYSTEM_AGENT_CA_CERT"] = path.Join(mountPath, internalca.ClientCAFile)
+}
@@ -0,0 +1,75 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package docker
+
+import (
+	"testing"
+)
+
+func TestAddServiceVolumes(t *testing.T) {
+	content := `version: '2.4'
+services:
+  aospace-gateway:
+    container_name: aospace-gateway
+    volumes:
+      - /etc/ao-space:/etc/ao-space
+
+  aonetwork-client:
+    container_name: aonetwork-client
+    restart: always
+  aospace-redis:
+    container_name: aospace-redis
+networks:
+  default:
+    external:
+      name: ao-space
+`
+	expected := `version: '2.4'
+services:
+  aospace-gateway:
+    container_name: aospace-gateway
+    volumes:
+      - /ca/aospace-gateway:/client:ro
+      - /etc/ao-space:/etc/ao-space
+
+  aonetwork-client:
+    container_name: aonetwork-client
+    restart: always
+    volumes:
+      - /ca/aonetwork-client:/client:ro
+  aospace-redis:
+    container_name: aospace-redis
+networks:
+  default:
+    external:
+      name: ao-space
+`
+	got := addServiceVolumes(content, map[string]string{
+		"aospace-gateway":  "/ca/aospace-gateway:/client:ro",
+		"aonetwork-client": "/ca/aonetwork-client:/client:ro",
+	})
+	if got != expected {
+		t.Errorf("addServiceVolumes got:\n%v\nexpected:\n%v", got, expected)
+	}
+
+	// 重复处理同一文件时不再追加
+	again := addServiceVolumes(got, map[string]string{
+		"aospace-gateway":  "/ca/aospace-gateway:/client:ro",
+		"aonetwork-client": "/ca/aonetwork-client:/client:ro",
+	})
+	if again != expected {
+		t.Errorf("addServiceVolumes should skip existing volumes, got:\n%v", again)
+	}
+}
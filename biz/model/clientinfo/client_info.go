@@ -24,6 +24,7 @@ package clientinfo
 
 import (
 	"agent/config"
+	"agent/utils/keystore"
 	"fmt"
 	"strings"
 
@@ -52,7 +53,7 @@ func (ck *ClientKey) SaveKey() {
 		logger.AppLogger().Debugf("Write ClientKey.RsaPubKeyFile file succ, file:%v",
 			config.Config.Box.ClientKey.RsaPubKeyFile)
 	}
-	err = fileutil.WriteToFile(config.Config.Box.ClientKey.RsaPriKeyFile, ck.PrivKey, true)
+	err = keystore.WriteFile(config.Config.Box.ClientKey.RsaPriKeyFile, ck.PrivKey, keystore.Enabled())
 	if err != nil {
 		logger.AppLogger().Errorf("Write ClientKey.RsaPriKeyFile file failed, file:%v, err:%v",
 			config.Config.Box.ClientKey.RsaPriKeyFile, err)
@@ -78,7 +79,7 @@ func SetClientPubKey(theClientPubKey string) {
 
 func SetClientPriKey(theClientPriKey string) {
 	clientPriKey = theClientPriKey
-	err := fileutil.WriteToFile(config.Config.Box.ClientKey.RsaPriKeyFile, []byte(clientPriKey), true)
+	err := keystore.WriteFile(config.Config.Box.ClientKey.RsaPriKeyFile, []byte(clientPriKey), keystore.Enabled())
 	if err != nil {
 		logger.AppLogger().Errorf("Write ClientKey.RsaPriKeyFile file failed, file:%v, err:%v",
 			config.Config.Box.ClientKey.RsaPriKeyFile, err)
@@ -95,7 +96,7 @@ func GetClientPriKey() string {
 func SetSharedSecret(theSharedSecret string) error {
 	sharedSecret = theSharedSecret
 
-	err := fileutil.WriteToFile(config.Config.Box.ClientKey.SharedSecret, []byte(sharedSecret), true)
+	err := keystore.WriteFile(config.Config.Box.ClientKey.SharedSecret, []byte(sharedSecret), keystore.Enabled())
 	if err != nil {
 		logger.AppLogger().Errorf("Write ClientKey.SharedSecret file failed, file:%v, err:%v",
 			config.Config.Box.ClientKey.SharedSecret, err)
@@ -140,7 +141,7 @@ func InitClientInfo() {
 	}
 
 	if fileutil.IsFileExist(config.Config.Box.ClientKey.RsaPriKeyFile) {
-		k, err := fileutil.ReadFromFile(config.Config.Box.ClientKey.RsaPriKeyFile)
+		k, err := keystore.ReadFile(config.Config.Box.ClientKey.RsaPriKeyFile, keystore.Enabled())
 		if err != nil {
 			logger.AppLogger().Errorf("Read config.Config.Box.ClientKey.RsaPriKeyFile file failed, file:%v, err:%v",
 				config.Config.Box.ClientKey.RsaPriKeyFile, err)
@@ -155,7 +156,7 @@ func InitClientInfo() {
 	}
 
 	if fileutil.IsFileExist(config.Config.Box.ClientKey.SharedSecret) {
-		k, err := fileutil.ReadFromFile(config.Config.Box.ClientKey.SharedSecret)
+		k, err := keystore.ReadFile(config.Config.Box.ClientKey.SharedSecret, keystore.Enabled())
 		if err != nil {
 			logger.AppLogger().Debugf("Read config.Config.Box.ClientKey.SharedSecret file failed, file:%v, err:%v",
 				config.Config.Box.ClientKey.SharedSecret, err)
@@ -16,6 +16,7 @@ package device
 
 import (
 	"agent/biz/model/device_ability"
+	"agent/biz/model/lanca"
 	"agent/config"
 	"agent/utils/deviceid"
 	"agent/utils/hardware"
@@ -68,14 +69,12 @@ func InitDeviceInfo() {
 		logger.AppLogger().Debugf("InitdeviceInfo, deviceInfoFile read succ.")
 		deviceInfo = b
 		writeSharedInfoFile()
-		//UpdateMdns()
 	} else {
 		logger.AppLogger().Debugf("InitdeviceInfo, read error. write new to file")
 		err1 := setDeviceInitData()
 		if err1 == nil {
 			writeDeviceInfoToFile(deviceInfo)
 			writeSharedInfoFile()
-			//UpdateMdns()
 		}
 	}
 
@@ -160,7 +159,6 @@ func UpdateSnNumber(snNumber string) error {
 	if err == nil {
 		writeDeviceInfoToFile(deviceInfo)
 		writeSharedInfoFile()
-		//UpdateMdns()
 	}
 	return err
 }
@@ -185,7 +183,16 @@ func GetApplyEmail() (string, error) {
 	return string(applyEmail), err
 }
 
+// GetQrCode 返回配对二维码内容. 局域网根证书存在时附加指纹(cafp), 客户端配对时固定该根证书.
 func GetQrCode() string {
+	qrCode := getQrCode()
+	if fp := lanca.RootFingerprint(); len(fp) > 0 && strings.HasPrefix(qrCode, UrlQrCodeDomain+"?") {
+		qrCode += "&cafp=" + fp
+	}
+	return qrCode
+}
+
+func getQrCode() string {
 	logger.AppLogger().Debugf("GetQrCode, device_ability.GetAbilityModel().DeviceModelNumber:%v", device_ability.GetAbilityModel().DeviceModelNumber)
 	if device_ability.GetAbilityModel().DeviceModelNumber >= device_ability.SN_SUPPORTED_FROM_MODEL_NUMBER {
 		snNumber, err := deviceid.GetSnNumber(config.Config.Box.SnNumberStoreFile)
@@ -17,6 +17,7 @@ package device
 import (
 	"agent/biz/model/device_ability"
 	"agent/config"
+	"agent/utils/keystore"
 	"agent/utils/unixsock/http"
 	"crypto/md5"
 	"crypto/rsa"
@@ -32,6 +33,7 @@ import (
 
 	"github.com/dungeonsnd/gocom/encrypt/encoding"
 	gocomRsa "github.com/dungeonsnd/gocom/encrypt/rsa"
+	"github.com/dungeonsnd/gocom/file/fileutil"
 )
 
 var devicePriKeyBytes []byte
@@ -91,6 +93,10 @@ func InitDeviceKey() {
 	logger.AppLogger().Debugf("InitdeviceKey")
 	if device_ability.GetAbilityModel().SecurityChipSupport {
 		logger.AppLogger().Debugf("HasSecurityChip")
+		// 有加密芯片时, 本地保存的密钥材料使用芯片派生的密钥加密.
+		if err := keystore.SetChipSigner(signBytesFromSecurityChip); err != nil {
+			logger.AppLogger().Warnf("InitdeviceKey, security chip not ready for keystore, will retry on use, err:%v", err)
+		}
 	} else {
 		InitDeviceKeyNormal()
 	}
@@ -98,7 +104,7 @@ func InitDeviceKey() {
 
 func InitDeviceKeyNormal() {
 	var err error
-	err, devicePriKeyBytes, devicePublicKey = gocomRsa.ReadRsaKeys(config.Config.Box.BoxKey.RsaKeyFile, config.Config.Box.BoxKey.RsaPubKeyFile)
+	devicePriKeyBytes, devicePublicKey, err = readDeviceKeys(config.Config.Box.BoxKey.RsaKeyFile, config.Config.Box.BoxKey.RsaPubKeyFile)
 	if err != nil || VerifyKeys(devicePriKeyBytes, devicePublicKey) != nil {
 		logger.AppLogger().Debugf("InitdeviceKey, ReadRsaKeys err: %v, devicePriKeyBytes length:%v, devicePublicKey length:%v",
 			err, len(devicePriKeyBytes), len(devicePublicKey))
@@ -115,7 +121,7 @@ func InitDeviceKeyNormal() {
 			time.Sleep(time.Duration(1) * time.Second)
 		}
 	}
-	err, devicePriKeyBytes, devicePublicKey = gocomRsa.ReadRsaKeys(config.Config.Box.BoxKey.RsaKeyFile, config.Config.Box.BoxKey.RsaPubKeyFile)
+	devicePriKeyBytes, devicePublicKey, err = readDeviceKeys(config.Config.Box.BoxKey.RsaKeyFile, config.Config.Box.BoxKey.RsaPubKeyFile)
 	if err != nil {
 		logger.AppLogger().Errorf("InitdeviceKey, readRsaKey err=%v", err) // 致命错误!
 	}
@@ -125,6 +131,20 @@ func InitDeviceKeyNormal() {
 	logger.AppLogger().Debugf("InitdeviceKey, devicePublicKey=%v", devicePublicKey)
 }
 
+// readDeviceKeys 读取设备密钥. 开启 Keystore.SealDeviceKey 时私钥文件加密保存, 明文私钥文件会被迁移.
+func readDeviceKeys(keyFile, pubKeyFile string) ([]byte, []byte, error) {
+	priKeyBytes, err := keystore.ReadFile(keyFile, keystore.Enabled() && config.Config.Box.Keystore.SealDeviceKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	pubKeyBytes, err := fileutil.ReadFromFile(pubKeyFile)
+	if err != nil {
+		keystore.Zeroize(priKeyBytes)
+		return nil, nil, err
+	}
+	return priKeyBytes, pubKeyBytes, nil
+}
+
 func GetDevicePriKey() []byte {
 	logger.AppLogger().Debugf("GetDevicePriKey")
 	if device_ability.GetAbilityModel().SecurityChipSupport {
@@ -158,6 +178,14 @@ func SignFromSecurityChip(data []byte) (string, error) {
 		data)
 }
 
+func signBytesFromSecurityChip(data []byte) ([]byte, error) {
+	sign, err := SignFromSecurityChip(data)
+	if err != nil {
+		return nil, err
+	}
+	return encoding.Base64Decode(sign)
+}
+
 func postFromSecurityChip(sockAddr, path string, data []byte) (string, error) {
 
 	type Request struct {
@@ -0,0 +1,175 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package device
+
+import (
+	"agent/biz/model/device_ability"
+	"agent/config"
+	"agent/utils/logger"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/dungeonsnd/gocom/encrypt/encoding"
+	gocomRsa "github.com/dungeonsnd/gocom/encrypt/rsa"
+	"github.com/dungeonsnd/gocom/file/fileutil"
+)
+
+// PreviousKeyInfo 轮换前的设备公钥. 宽限期内用旧密钥签发的 token、签名仍然认为有效.
+type PreviousKeyInfo struct {
+	PubKey      string    `json:"pubKey"`
+	Fingerprint string    `json:"fingerprint"`
+	RotatedAt   time.Time `json:"rotatedAt"`
+	GraceUntil  time.Time `json:"graceUntil"`
+}
+
+// KeyRotationResult 设备密钥轮换结果.
+type KeyRotationResult struct {
+	NewPubKey   []byte
+	OldPubKey   []byte
+	Attestation string // 旧私钥对新公钥的签名(base64), 用于向平台证明新密钥由原设备生成.
+	GraceUntil  time.Time
+}
+
+var keyRotationLock sync.Mutex
+
+// RotateDeviceKey 生成新的设备密钥并替换 box_key.pem/box_key_pub.pem, 旧公钥在宽限期内保留.
+// 使用加密芯片时密钥不可导出, 不支持轮换.
+func RotateDeviceKey(grace time.Duration) (*KeyRotationResult, error) {
+	if device_ability.GetAbilityModel().SecurityChipSupport {
+		return nil, fmt.Errorf("device key is kept in security chip, rotation unsupported")
+	}
+
+	keyRotationLock.Lock()
+	defer keyRotationLock.Unlock()
+
+	oldPri, err := testGetPrivateKey(devicePriKeyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load current device key, err:%v", err)
+	}
+	oldPub := devicePublicKey
+	oldFingerprint, err := calRsaKeyFingerprint(string(oldPub))
+	if err != nil {
+		return nil, fmt.Errorf("failed to calculate fingerprint of current device key, err:%v", err)
+	}
+
+	keyFile := config.Config.Box.BoxKey.RsaKeyFile
+	pubKeyFile := config.Config.Box.BoxKey.RsaPubKeyFile
+	newKeyFile := keyFile + ".new"
+	newPubKeyFile := pubKeyFile + ".new"
+	if err := gocomRsa.GenRsaKey(newKeyFile, newPubKeyFile, 2048); err != nil {
+		return nil, fmt.Errorf("failed to generate new device key, err:%v", err)
+	}
+	newPriBytes, newPubBytes, err := readDeviceKeys(newKeyFile, newPubKeyFile)
+	if err == nil {
+		err = VerifyKeys(newPriBytes, newPubBytes)
+	}
+	if err != nil {
+		os.Remove(newKeyFile)
+		os.Remove(newPubKeyFile)
+		return nil, fmt.Errorf("failed to verify new device key, err:%v", err)
+	}
+
+	digest := sha256.Sum256(newPubBytes)
+	sig, err := rsa.SignPKCS1v15(rand.Reader, oldPri, crypto.SHA256, digest[:])
+	if err != nil {
+		os.Remove(newKeyFile)
+		os.Remove(newPubKeyFile)
+		return nil, fmt.Errorf("failed to sign new device key with current key, err:%v", err)
+	}
+
+	now := time.Now()
+	previous := &PreviousKeyInfo{PubKey: string(oldPub), Fingerprint: oldFingerprint,
+		RotatedAt: now, GraceUntil: now.Add(grace)}
+	if err := savePreviousKeyInfo(previous); err != nil {
+		os.Remove(newKeyFile)
+		os.Remove(newPubKeyFile)
+		return nil, err
+	}
+
+	// 先替换公钥再替换私钥, 私钥文件替换成功即认为轮换完成.
+	if err := os.Rename(newPubKeyFile, pubKeyFile); err != nil {
+		return nil, fmt.Errorf("failed to replace %v, err:%v", pubKeyFile, err)
+	}
+	if err := os.Rename(newKeyFile, keyFile); err != nil {
+		return nil, fmt.Errorf("failed to replace %v, err:%v", keyFile, err)
+	}
+
+	devicePriKeyBytes = newPriBytes
+	devicePublicKey = newPubBytes
+	logger.AppLogger().Infof("RotateDeviceKey, device key rotated, previous fingerprint:%v, grace until:%v",
+		oldFingerprint, previous.GraceUntil)
+
+	return &KeyRotationResult{NewPubKey: newPubBytes, OldPubKey: oldPub,
+		Attestation: encoding.Base64Encode(sig), GraceUntil: previous.GraceUntil}, nil
+}
+
+// GetPreviousDevicePubKey 返回宽限期内的旧设备公钥. 宽限期已过时删除旧密钥记录.
+func GetPreviousDevicePubKey() ([]byte, bool) {
+	info, err := loadPreviousKeyInfo()
+	if err != nil || info == nil {
+		return nil, false
+	}
+	if time.Now().After(info.GraceUntil) {
+		logger.AppLogger().Infof("GetPreviousDevicePubKey, grace period of %v expired at %v, removing",
+			info.Fingerprint, info.GraceUntil)
+		os.Remove(config.Config.Box.BoxKey.PreviousKeyInfoFile)
+		return nil, false
+	}
+	return []byte(info.PubKey), true
+}
+
+// GetPreviousDeviceKeyInfo 返回旧设备密钥信息, 没有轮换过时返回 nil.
+func GetPreviousDeviceKeyInfo() *PreviousKeyInfo {
+	info, err := loadPreviousKeyInfo()
+	if err != nil {
+		return nil
+	}
+	return info
+}
+
+func loadPreviousKeyInfo() (*PreviousKeyInfo, error) {
+	f := config.Config.Box.BoxKey.PreviousKeyInfoFile
+	if fileutil.IsFileNotExist(f) {
+		return nil, nil
+	}
+	b, err := fileutil.ReadFromFile(f)
+	if err != nil {
+		return nil, err
+	}
+	info := &PreviousKeyInfo{}
+	if err := json.Unmarshal(b, info); err != nil {
+		return nil, fmt.Errorf("failed to parse %v, err:%v", f, err)
+	}
+	return info, nil
+}
+
+func savePreviousKeyInfo(info *PreviousKeyInfo) error {
+	b, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	f := config.Config.Box.BoxKey.PreviousKeyInfoFile
+	if err := fileutil.WriteToFile(f, b, true); err != nil {
+		return fmt.Errorf("failed to write %v, err:%v", f, err)
+	}
+	return nil
+}
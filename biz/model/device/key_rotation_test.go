@@ -0,0 +1,56 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package device
+
+import (
+	"agent/config"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRotateDeviceKey(t *testing.T) {
+	dir := t.TempDir()
+	config.Config.Box.BoxKey.RsaKeyFile = filepath.Join(dir, "box_key.pem")
+	config.Config.Box.BoxKey.RsaPubKeyFile = filepath.Join(dir, "box_key_pub.pem")
+	config.Config.Box.BoxKey.PreviousKeyInfoFile = filepath.Join(dir, "box_key_previous.json")
+	InitDeviceKeyNormal()
+	oldPub := string(GetDevicePubKey())
+
+	result, err := RotateDeviceKey(time.Hour)
+	if err != nil {
+		t.Fatalf("failed RotateDeviceKey, err:%v", err)
+	}
+	if string(result.OldPubKey) != oldPub || string(GetDevicePubKey()) == oldPub {
+		t.Fatalf("device public key not rotated")
+	}
+	previous, ok := GetPreviousDevicePubKey()
+	if !ok || string(previous) != oldPub {
+		t.Errorf("previous key not kept in grace period")
+	}
+
+	// 重新加载时读取的是新密钥.
+	InitDeviceKeyNormal()
+	if string(GetDevicePubKey()) != string(result.NewPubKey) {
+		t.Errorf("reloaded key differs from rotated key")
+	}
+
+	if _, err := RotateDeviceKey(-time.Second); err != nil {
+		t.Fatalf("failed RotateDeviceKey, err:%v", err)
+	}
+	if _, ok := GetPreviousDevicePubKey(); ok {
+		t.Errorf("previous key still valid after grace period")
+	}
+}
@@ -104,6 +104,9 @@ func supportUSBDisk() bool {
 
 // 是否支持加密芯片
 func supportSecurityChip() bool {
+	if config.Config.Box.SecurityChipEmulator.Enable {
+		return true
+	}
 	if getDeviceModelNumber() >= SN_GEN_2 {
 		return true
 	}
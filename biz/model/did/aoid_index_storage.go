@@ -91,7 +91,7 @@ func GetAoIdByDid(levelDBTrans *leveldb.Trans, did string) (string, bool, error)
 			return "", false, err
 		}
 
-		return string(aoId), false, err
+		return string(aoId), true, err
 	} else {
 		return "", false, nil
 	}
@@ -0,0 +1,361 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package did
+
+import (
+	"agent/biz/model/did/leveldb"
+	aospacedid "agent/deps/did/aospace/did"
+	"agent/deps/did/aospace/rsa"
+	"agent/utils/keystore"
+	"agent/utils/logger"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// 备份文件为 JSON: 文件头(format、version、createdAt)以明文保存并作为 AES-GCM 的附加认证数据,
+// 其余内容(BackupPayload)使用恢复口令派生的密钥加密. 空间密钥以明文放入加密内容, 恢复时按本机 Keystore 重新保护,
+// 因此备份可以恢复到更换硬件后的设备.
+const (
+	BackupFormat  = "aospace-did-backup"
+	BackupVersion = 1
+
+	minBackupPassphraseLen = 8
+)
+
+// BackupArchive 备份文件.
+type BackupArchive struct {
+	Format    string `json:"format"`
+	Version   int    `json:"version"`
+	CreatedAt string `json:"createdAt"`
+	keystore.PassphraseSealed
+}
+
+// BackupPayload 备份的明文内容.
+type BackupPayload struct {
+	Entries []*BackupEntry `json:"entries"`
+}
+
+// BackupEntry 一个用户的 DID 文档、历史版本和密钥.
+type BackupEntry struct {
+	AoId             string             `json:"aoId"`
+	DID              string             `json:"did"`
+	Document         []byte             `json:"document"`
+	Metadata         *DocumentMetadata  `json:"metadata,omitempty"`
+	Versions         []*DocumentVersion `json:"versions,omitempty"`
+	SpaceKey         []byte             `json:"spaceKey"`
+	PreviousSpaceKey []byte             `json:"previousSpaceKey,omitempty"`
+	PasswordKey      []byte             `json:"passwordKey,omitempty"` // 由空间密码加密
+}
+
+func (a *BackupArchive) aad() []byte {
+	return []byte(fmt.Sprintf("%v|%v|%v", a.Format, a.Version, a.CreatedAt))
+}
+
+// ExportBackup 导出所有未注销用户的 DID 和密钥, 使用 passphrase 加密.
+func ExportBackup(levelDBTrans *leveldb.Trans, passphrase string) ([]byte, int, error) {
+	if len(passphrase) < minBackupPassphraseLen {
+		return nil, 0, fmt.Errorf("passphrase must be at least %v characters", minBackupPassphraseLen)
+	}
+	aoIds, err := ListAoIds(levelDBTrans)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	payload := &BackupPayload{Entries: make([]*BackupEntry, 0, len(aoIds))}
+	defer zeroizeBackupPayload(payload)
+	for _, aoId := range aoIds {
+		entry, err := exportBackupEntry(levelDBTrans, aoId)
+		if err != nil {
+			return nil, 0, fmt.Errorf("failed to export %v, err:%v", aoId, err)
+		}
+		payload.Entries = append(payload.Entries, entry)
+	}
+	plain, err := json.Marshal(payload)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer keystore.Zeroize(plain)
+
+	kdf, err := keystore.DefaultArgon2idKDF()
+	if err != nil {
+		return nil, 0, err
+	}
+	archive := &BackupArchive{Format: BackupFormat, Version: BackupVersion,
+		CreatedAt: time.Now().UTC().Format(time.RFC3339)}
+	sealed, err := keystore.SealWithPassphrase(kdf, []byte(passphrase), archive.aad(), plain)
+	if err != nil {
+		return nil, 0, err
+	}
+	archive.PassphraseSealed = *sealed
+	b, err := json.Marshal(archive)
+	if err != nil {
+		return nil, 0, err
+	}
+	logger.AppLogger().Infof("ExportBackup, exported %v dids", len(payload.Entries))
+	return b, len(payload.Entries), nil
+}
+
+// RestoreBackup 解密备份并校验所有文档后导入, 任一文档校验失败时不导入. 本机已有同一 DID 时,
+// overwrite 为 false 返回错误, 为 true 时把备份的当前文档作为新版本追加到本机版本链之后并替换密钥,
+// 本机的历史版本保留. 本机已注销的 DID 不能通过恢复备份重新启用.
+func RestoreBackup(levelDBTrans *leveldb.Trans, data []byte, passphrase string, overwrite bool) ([]string, error) {
+	archive := &BackupArchive{}
+	if err := json.Unmarshal(data, archive); err != nil {
+		return nil, fmt.Errorf("invalid backup archive, err:%v", err)
+	}
+	if archive.Format != BackupFormat {
+		return nil, fmt.Errorf("invalid backup format %v", archive.Format)
+	}
+	if archive.Version != BackupVersion {
+		return nil, fmt.Errorf("unsupported backup version %v", archive.Version)
+	}
+	plain, err := keystore.OpenWithPassphrase(&archive.PassphraseSealed, []byte(passphrase), archive.aad())
+	if err != nil {
+		return nil, err
+	}
+	defer keystore.Zeroize(plain)
+	payload := &BackupPayload{}
+	if err := json.Unmarshal(plain, payload); err != nil {
+		return nil, fmt.Errorf("invalid backup payload, err:%v", err)
+	}
+	defer zeroizeBackupPayload(payload)
+
+	for _, entry := range payload.Entries {
+		if err := validateBackupEntry(entry); err != nil {
+			return nil, fmt.Errorf("invalid backup of %v, err:%v", entry.AoId, err)
+		}
+		exist, err := leveldb.Has(levelDBTrans, []byte(leveldb.KNameOfDidDoc(entry.DID)))
+		if err != nil {
+			return nil, err
+		}
+		if meta, found, err := getDidDocMeta(levelDBTrans, entry.DID); err != nil {
+			return nil, err
+		} else if found && meta.Deactivated {
+			return nil, fmt.Errorf("%v is deactivated", entry.DID)
+		}
+		if exist && !overwrite {
+			return nil, fmt.Errorf("%v already exists", entry.DID)
+		}
+		if current, found, err := GetDidByAoId(levelDBTrans, entry.AoId); err != nil {
+			return nil, err
+		} else if found && current != entry.DID && !overwrite {
+			return nil, fmt.Errorf("aoId %v already bound to %v", entry.AoId, current)
+		}
+	}
+
+	dids := make([]string, 0, len(payload.Entries))
+	for _, entry := range payload.Entries {
+		if err := importBackupEntry(levelDBTrans, entry); err != nil {
+			return nil, fmt.Errorf("failed to import %v, err:%v", entry.DID, err)
+		}
+		dids = append(dids, entry.DID)
+	}
+	logger.AppLogger().Infof("RestoreBackup, restored dids:%v", dids)
+	return dids, nil
+}
+
+func exportBackupEntry(levelDBTrans *leveldb.Trans, aoId string) (*BackupEntry, error) {
+	didStr, found, err := GetDidByAoId(levelDBTrans, aoId)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("did not found by aoId(%v)", aoId)
+	}
+	didStr = stripDidURL(didStr)
+	entry := &BackupEntry{AoId: aoId, DID: didStr}
+	if entry.Document, err = getDidDoc(levelDBTrans, didStr); err != nil {
+		return nil, err
+	}
+	if meta, found, err := getDidDocMeta(levelDBTrans, didStr); err != nil {
+		return nil, err
+	} else if found {
+		entry.Metadata = meta
+	}
+	if entry.Versions, err = ListDocumentVersions(levelDBTrans, didStr); err != nil {
+		return nil, err
+	}
+	if entry.SpaceKey, err = getPrivateKey(levelDBTrans, leveldb.KNameOfSpaceRSAPri(aoId)); err != nil {
+		return nil, fmt.Errorf("getPrivateKey:%v err:%v", leveldb.KNameOfSpaceRSAPri(aoId), err)
+	}
+	if exist, err := leveldb.Has(levelDBTrans, []byte(leveldb.KNameOfSpaceRSAPriPrevious(aoId))); err != nil {
+		return nil, err
+	} else if exist {
+		if entry.PreviousSpaceKey, err = getPrivateKey(levelDBTrans, leveldb.KNameOfSpaceRSAPriPrevious(aoId)); err != nil {
+			return nil, err
+		}
+	}
+	if entry.PasswordKey, err = getOptionalKey(levelDBTrans, leveldb.KNameOfPasswordRSAPri(aoId)); err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// validateBackupEntry 校验文档 id 与标识符一致: 标识符由首个版本(没有历史版本时为当前文档)的第一个公钥计算,
+// 历史版本的哈希链完整且指向当前文档, 空间密钥与当前文档的设备验证方法匹配.
+func validateBackupEntry(entry *BackupEntry) error {
+	if len(entry.AoId) < 1 || entry.DID != stripDidURL(entry.DID) {
+		return fmt.Errorf("invalid aoId(%v) or did(%v)", entry.AoId, entry.DID)
+	}
+	didDoc, err := parseBackupDocument(entry.Document, entry.DID)
+	if err != nil {
+		return err
+	}
+
+	genesis := didDoc
+	if len(entry.Versions) > 0 {
+		if err := verifyVersionChain(entry.DID, entry.Versions, entry.Document); err != nil {
+			return err
+		}
+		if entry.Metadata == nil || entry.Metadata.Hash != docHash(entry.Document) || entry.Metadata.Deactivated {
+			return fmt.Errorf("metadata does not match document")
+		}
+		if genesis, err = parseBackupDocument(entry.Versions[0].Document, entry.DID); err != nil {
+			return fmt.Errorf("version 1, err:%v", err)
+		}
+	}
+	idString := ""
+	for _, vm := range genesis.VerificationMethod {
+		if len(vm.PublicKeyPem) > 0 {
+			idString = aospacedid.CalAOSpaceIdString(vm.PublicKeyPem)
+			break
+		}
+	}
+	if len(idString) < 1 || "did:aospace:"+idString != entry.DID {
+		return fmt.Errorf("document id does not match identifier %v", idString)
+	}
+
+	vm, found := findDocumentMethod(didDoc, "#"+fragmentOfDevice)
+	if !found {
+		return fmt.Errorf("device verification method not found")
+	}
+	if err := matchKeyPair(entry.SpaceKey, vm.PublicKeyPem); err != nil {
+		return fmt.Errorf("space key does not match %v, err:%v", fragmentOfDevice, err)
+	}
+	if len(entry.PreviousSpaceKey) > 0 {
+		vm, found := findDocumentMethod(didDoc, "#"+fragmentOfPreviousDevice)
+		if !found {
+			return fmt.Errorf("previous device verification method not found")
+		}
+		if err := matchKeyPair(entry.PreviousSpaceKey, vm.PublicKeyPem); err != nil {
+			return fmt.Errorf("previous space key does not match %v, err:%v", fragmentOfPreviousDevice, err)
+		}
+	}
+	return nil
+}
+
+func parseBackupDocument(doc []byte, did string) (*aospacedid.Document, error) {
+	didDoc := &aospacedid.Document{}
+	if err := json.Unmarshal(doc, didDoc); err != nil {
+		return nil, err
+	}
+	if stripDidURL(didDoc.Subject) != did {
+		return nil, fmt.Errorf("document id %v does not match %v", didDoc.Subject, did)
+	}
+	if _, err := aospacedid.Parse(didDoc.Subject); err != nil {
+		return nil, err
+	}
+	return didDoc, nil
+}
+
+func matchKeyPair(priKeyBytes []byte, publicKeyPem string) error {
+	priKey, err := rsa.GetPrivateKey(priKeyBytes)
+	if err != nil {
+		return err
+	}
+	pub, err := rsa.GetPublicKey([]byte(publicKeyPem))
+	if err != nil {
+		return err
+	}
+	if priKey.PublicKey.N.Cmp(pub.N) != 0 || priKey.PublicKey.E != pub.E {
+		return fmt.Errorf("key mismatch")
+	}
+	return nil
+}
+
+func importBackupEntry(levelDBTrans *leveldb.Trans, entry *BackupEntry) error {
+	exist, err := leveldb.Has(levelDBTrans, []byte(leveldb.KNameOfDidDoc(entry.DID)))
+	if err != nil {
+		return err
+	}
+	if exist {
+		if err := appendBackupDocument(levelDBTrans, entry); err != nil {
+			return err
+		}
+	} else {
+		for i, v := range entry.Versions {
+			if err := putDidDocVersion(levelDBTrans, entry.DID, uint64(i+1), v); err != nil {
+				return err
+			}
+		}
+		if entry.Metadata != nil {
+			if err := putDidDocMeta(levelDBTrans, entry.DID, entry.Metadata); err != nil {
+				return err
+			}
+		}
+		if err := leveldb.Put(levelDBTrans, []byte(leveldb.KNameOfDidDoc(entry.DID)), entry.Document); err != nil {
+			return err
+		}
+	}
+
+	if err := putPrivateKey(levelDBTrans, leveldb.KNameOfSpaceRSAPri(entry.AoId), entry.SpaceKey); err != nil {
+		return err
+	}
+	if len(entry.PreviousSpaceKey) > 0 {
+		if err := putPrivateKey(levelDBTrans, leveldb.KNameOfSpaceRSAPriPrevious(entry.AoId), entry.PreviousSpaceKey); err != nil {
+			return err
+		}
+	} else if err := leveldb.Delete(levelDBTrans, []byte(leveldb.KNameOfSpaceRSAPriPrevious(entry.AoId))); err != nil {
+		return err
+	}
+	if len(entry.PasswordKey) > 0 {
+		if err := leveldb.Put(levelDBTrans, []byte(leveldb.KNameOfPasswordRSAPri(entry.AoId)), entry.PasswordKey); err != nil {
+			return err
+		}
+	}
+	if err := deleteLegacyClientKey(levelDBTrans, entry.AoId); err != nil {
+		return err
+	}
+	if current, found, err := GetDidByAoId(levelDBTrans, entry.AoId); err != nil {
+		return err
+	} else if found && current != entry.DID {
+		if err := leveldb.Delete(levelDBTrans, []byte(leveldb.KNameOfDidToAoId(current))); err != nil {
+			return err
+		}
+	}
+	return SaveAoIdToDid(levelDBTrans, entry.AoId, entry.DID)
+}
+
+// appendBackupDocument 本机已有该 DID 时, 备份的当前文档与本机当前文档不同则作为新版本追加,
+// 版本号和哈希链从本机的最新版本继续.
+func appendBackupDocument(levelDBTrans *leveldb.Trans, entry *BackupEntry) error {
+	current, err := getDidDoc(levelDBTrans, entry.DID)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(current, entry.Document) {
+		return nil
+	}
+	return saveDidDoc(levelDBTrans, entry.DID, entry.Document)
+}
+
+func zeroizeBackupPayload(payload *BackupPayload) {
+	for _, entry := range payload.Entries {
+		keystore.Zeroize(entry.SpaceKey)
+		keystore.Zeroize(entry.PreviousSpaceKey)
+	}
+}
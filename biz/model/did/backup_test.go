@@ -0,0 +1,222 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package did
+
+import (
+	"agent/biz/model/did/leveldb"
+	"agent/utils/keystore"
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const testBackupPassphrase = "backup-passphrase"
+
+func TestBackupRoundTrip(t *testing.T) {
+	openTestDB(t)
+	didStr, _ := createTestDocument(t, "aoid-1", "123456")
+	spaceKey, err := getPrivateKey(nil, leveldb.KNameOfSpaceRSAPri("aoid-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, err := getDidDoc(nil, didStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, n, err := ExportBackup(nil, testBackupPassphrase)
+	if err != nil || n != 1 {
+		t.Fatalf("ExportBackup, n:%v, err:%v", n, err)
+	}
+	if bytes.Contains(data, spaceKey) {
+		t.Fatal("space key exported in plain text")
+	}
+
+	// 恢复到新的数据库
+	leveldb.CloseDB()
+	openTestDB(t)
+	dids, err := RestoreBackup(nil, data, testBackupPassphrase, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dids) != 1 || dids[0] != didStr {
+		t.Fatalf("unexpected dids %v", dids)
+	}
+	if restored, found, err := GetDidByAoId(nil, "aoid-1"); err != nil || !found || restored != didStr {
+		t.Fatalf("GetDidByAoId, did:%v, found:%v, err:%v", restored, found, err)
+	}
+	restoredDoc, err := getDidDoc(nil, didStr)
+	if err != nil || !bytes.Equal(restoredDoc, doc) {
+		t.Fatalf("restored document mismatch, err:%v", err)
+	}
+	restoredKey, err := getPrivateKey(nil, leveldb.KNameOfSpaceRSAPri("aoid-1"))
+	if err != nil || !bytes.Equal(restoredKey, spaceKey) {
+		t.Fatalf("restored space key mismatch, err:%v", err)
+	}
+	if err := VerifyDocumentVersions(nil, didStr); err != nil {
+		t.Fatal(err)
+	}
+
+	// 已存在时不覆盖, 除非 overwrite 为 true
+	if _, err := RestoreBackup(nil, data, testBackupPassphrase, false); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Fatalf("restore over existing did, err:%v", err)
+	}
+	if _, err := RestoreBackup(nil, data, testBackupPassphrase, true); err != nil {
+		t.Fatalf("restore with overwrite, err:%v", err)
+	}
+}
+
+func TestRestoreBackupWrongPassphrase(t *testing.T) {
+	openTestDB(t)
+	createTestDocument(t, "aoid-1", "123456")
+	data, _, err := ExportBackup(nil, testBackupPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leveldb.CloseDB()
+	openTestDB(t)
+	if _, err := RestoreBackup(nil, data, "wrong-passphrase", false); err == nil {
+		t.Fatal("restored with wrong passphrase")
+	}
+	if _, found, _ := GetDidByAoId(nil, "aoid-1"); found {
+		t.Fatal("did imported with wrong passphrase")
+	}
+}
+
+func TestRestoreBackupTampered(t *testing.T) {
+	openTestDB(t)
+	createTestDocument(t, "aoid-1", "123456")
+	createTestDocument(t, "aoid-2", "654321")
+	data, _, err := ExportBackup(nil, testBackupPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leveldb.CloseDB()
+	openTestDB(t)
+
+	// 修改密文或文件头, 认证失败
+	archive := &BackupArchive{}
+	if err := json.Unmarshal(data, archive); err != nil {
+		t.Fatal(err)
+	}
+	archive.Ciphertext[len(archive.Ciphertext)/2] ^= 0xff
+	b, _ := json.Marshal(archive)
+	if _, err := RestoreBackup(nil, b, testBackupPassphrase, false); err == nil {
+		t.Fatal("restored tampered ciphertext")
+	}
+	archive.Ciphertext[len(archive.Ciphertext)/2] ^= 0xff
+	archive.CreatedAt = "2000-01-01T00:00:00Z"
+	b, _ = json.Marshal(archive)
+	if _, err := RestoreBackup(nil, b, testBackupPassphrase, false); err == nil {
+		t.Fatal("restored tampered header")
+	}
+
+	// 用正确口令重新加密但替换了第二个用户的空间密钥, 校验失败且不导入任何用户
+	if err := json.Unmarshal(data, archive); err != nil {
+		t.Fatal(err)
+	}
+	plain, err := keystore.OpenWithPassphrase(&archive.PassphraseSealed, []byte(testBackupPassphrase), archive.aad())
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := &BackupPayload{}
+	if err := json.Unmarshal(plain, payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload.Entries) != 2 {
+		t.Fatalf("unexpected entries %v", len(payload.Entries))
+	}
+	payload.Entries[1].SpaceKey = payload.Entries[0].SpaceKey
+	plain, _ = json.Marshal(payload)
+	sealed, err := keystore.SealWithPassphrase(archive.KDF, []byte(testBackupPassphrase), archive.aad(), plain)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive.PassphraseSealed = *sealed
+	b, _ = json.Marshal(archive)
+	if _, err := RestoreBackup(nil, b, testBackupPassphrase, false); err == nil || !strings.Contains(err.Error(), "space key does not match") {
+		t.Fatalf("restored tampered entry, err:%v", err)
+	}
+	for _, aoId := range []string{"aoid-1", "aoid-2"} {
+		if _, found, _ := GetDidByAoId(nil, aoId); found {
+			t.Fatalf("%v imported from tampered backup", aoId)
+		}
+	}
+}
+
+func TestRestoreBackupOverwrite(t *testing.T) {
+	openTestDB(t)
+	didStr, _ := createTestDocument(t, "aoid-1", "123456")
+	backupDoc, err := getDidDoc(nil, didStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _, err := ExportBackup(nil, testBackupPassphrase)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 备份之后本机又有新版本, 覆盖恢复时在本机版本链之后追加备份的文档
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, backupDoc, "", " "); err != nil {
+		t.Fatal(err)
+	}
+	if err := saveDidDoc(nil, didStr, indented.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	local, err := ListDocumentVersions(nil, didStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RestoreBackup(nil, data, testBackupPassphrase, true); err != nil {
+		t.Fatal(err)
+	}
+	versions, err := ListDocumentVersions(nil, didStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(versions) != len(local)+1 {
+		t.Fatalf("versions %v, want %v", len(versions), len(local)+1)
+	}
+	for i, v := range local {
+		if versions[i].Hash != v.Hash {
+			t.Fatalf("local version %v replaced", v.VersionId)
+		}
+	}
+	last := versions[len(versions)-1]
+	if last.PreviousHash != local[len(local)-1].Hash || !bytes.Equal(last.Document, backupDoc) {
+		t.Fatalf("restored version does not continue local chain")
+	}
+	if err := VerifyDocumentVersions(nil, didStr); err != nil {
+		t.Fatal(err)
+	}
+
+	// 本机已注销的 DID 不能通过恢复备份重新启用
+	tombstone, _, err := DeactivateDocument(nil, didStr, "aoid-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RestoreBackup(nil, data, testBackupPassphrase, true); err == nil || !strings.Contains(err.Error(), "deactivated") {
+		t.Fatalf("restored over deactivated did, err:%v", err)
+	}
+	if doc, err := getDidDoc(nil, didStr); err != nil || !bytes.Equal(doc, tombstone) {
+		t.Fatalf("deactivated document replaced, err:%v", err)
+	}
+	if _, found, _ := GetDidByAoId(nil, "aoid-1"); found {
+		t.Fatal("aoId of deactivated did restored")
+	}
+}
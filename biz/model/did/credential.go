@@ -0,0 +1,256 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package did
+
+import (
+	"agent/biz/model/did/leveldb"
+	aospacedid "agent/deps/did/aospace/did"
+	"agent/deps/did/aospace/rsa"
+	"agent/utils/keystore"
+	"agent/utils/logger"
+	"crypto"
+	"crypto/rand"
+	cryptorsa "crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// IssueCredential 以 issuerAoId 的 DID 为签发者签发凭证, 使用其设备验证方法(key-0)对应的空间私钥签名.
+// expiration 为零值时凭证不过期.
+func IssueCredential(levelDBTrans *leveldb.Trans, issuerAoId string, types []string,
+	subject map[string]interface{}, expiration time.Time) (*aospacedid.Credential, error) {
+	logger.AppLogger().Debugf("IssueCredential, issuerAoId:%v, types:%v", issuerAoId, types)
+
+	issuer, found, err := GetDidByAoId(levelDBTrans, issuerAoId)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, fmt.Errorf("did not found by aoId(%v)", issuerAoId)
+	}
+	priKeyBytes, err := getPrivateKey(levelDBTrans, leveldb.KNameOfSpaceRSAPri(issuerAoId))
+	if err != nil {
+		return nil, fmt.Errorf("getPrivateKey:%v err:%v", leveldb.KNameOfSpaceRSAPri(issuerAoId), err)
+	}
+	priKey, err := rsa.GetPrivateKey(priKeyBytes)
+	keystore.Zeroize(priKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	vc := &aospacedid.Credential{
+		Context:           []interface{}{aospacedid.CredentialsContext, aospacedid.AOSpaceCredentialsContext},
+		Type:              append([]string{aospacedid.TypeVerifiableCredential}, types...),
+		Issuer:            issuer,
+		IssuanceDate:      now.Format(time.RFC3339),
+		CredentialSubject: subject,
+	}
+	if !expiration.IsZero() {
+		vc.ExpirationDate = expiration.UTC().Format(time.RFC3339)
+	}
+	proof := &aospacedid.Proof{
+		Type:               aospacedid.ProofTypeRsaSignature2018,
+		Created:            now.Format(time.RFC3339),
+		VerificationMethod: issuer + "#" + fragmentOfDevice,
+		ProofPurpose:       aospacedid.ProofPurposeAssertionMethod,
+	}
+	err = vc.Sign(proof, func(data []byte) ([]byte, error) {
+		sum := sha256.Sum256(data)
+		return cryptorsa.SignPKCS1v15(rand.Reader, priKey, crypto.SHA256, sum[:])
+	})
+	if err != nil {
+		return nil, err
+	}
+	return vc, nil
+}
+
+// VerifyCredential 离线校验凭证: 签发者 DID 必须保存在本机且未注销, proof 由其设备验证方法签名, 且在有效期内.
+func VerifyCredential(levelDBTrans *leveldb.Trans, raw []byte) (*aospacedid.Credential, error) {
+	doc := make(map[string]interface{})
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("invalid credential, err:%v", err)
+	}
+	return verifyCredentialDoc(levelDBTrans, doc, time.Now())
+}
+
+// VerifyPresentation 离线校验展示: proof 由持有者 DID 中客户端持有的验证方法签名, challenge、domain 与期望一致,
+// 包含的每个凭证都通过 VerifyCredential 校验且凭证主体为持有者. challenge 必须由校验方下发且不能为空, 防止重放.
+func VerifyPresentation(levelDBTrans *leveldb.Trans, raw []byte, challenge, domain string) (*aospacedid.Presentation, error) {
+	doc := make(map[string]interface{})
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return nil, fmt.Errorf("invalid presentation, err:%v", err)
+	}
+	vp := &aospacedid.Presentation{}
+	if err := json.Unmarshal(raw, vp); err != nil {
+		return nil, fmt.Errorf("invalid presentation, err:%v", err)
+	}
+	if !containsString(vp.Type, aospacedid.TypeVerifiablePresentation) {
+		return nil, fmt.Errorf("type %v not found", aospacedid.TypeVerifiablePresentation)
+	}
+
+	proof, unsigned, err := aospacedid.SplitProof(doc)
+	if err != nil {
+		return nil, err
+	}
+	if proof.ProofPurpose != aospacedid.ProofPurposeAuthentication {
+		return nil, fmt.Errorf("unexpected proof purpose %v", proof.ProofPurpose)
+	}
+	if len(challenge) < 1 {
+		return nil, fmt.Errorf("challenge is required")
+	}
+	if proof.Challenge != challenge {
+		return nil, fmt.Errorf("challenge mismatch")
+	}
+	if len(domain) > 0 && proof.Domain != domain {
+		return nil, fmt.Errorf("domain mismatch")
+	}
+	if !strings.HasPrefix(proof.VerificationMethod, vp.Holder+"#") {
+		return nil, fmt.Errorf("verification method %v not controlled by holder %v", proof.VerificationMethod, vp.Holder)
+	}
+	pub, err := lookupVerificationKey(levelDBTrans, proof.VerificationMethod, false, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if err := aospacedid.VerifyProof(unsigned, proof, pub); err != nil {
+		return nil, err
+	}
+
+	credentials, _ := doc["verifiableCredential"].([]interface{})
+	for i, v := range credentials {
+		vcDoc, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("invalid credential at %v", i)
+		}
+		vc, err := verifyCredentialDoc(levelDBTrans, vcDoc, time.Now())
+		if err != nil {
+			return nil, fmt.Errorf("credential at %v, err:%v", i, err)
+		}
+		if id, _ := vc.CredentialSubject["id"].(string); id != vp.Holder {
+			return nil, fmt.Errorf("credential at %v, subject %v is not holder %v", i, id, vp.Holder)
+		}
+	}
+	return vp, nil
+}
+
+func verifyCredentialDoc(levelDBTrans *leveldb.Trans, doc map[string]interface{}, now time.Time) (*aospacedid.Credential, error) {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+	vc := &aospacedid.Credential{}
+	if err := json.Unmarshal(b, vc); err != nil {
+		return nil, fmt.Errorf("invalid credential, err:%v", err)
+	}
+	if !containsString(vc.Type, aospacedid.TypeVerifiableCredential) {
+		return nil, fmt.Errorf("type %v not found", aospacedid.TypeVerifiableCredential)
+	}
+	issuanceDate, err := time.Parse(time.RFC3339, vc.IssuanceDate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid issuanceDate, err:%v", err)
+	}
+	if now.Before(issuanceDate) {
+		return nil, fmt.Errorf("credential not yet valid")
+	}
+	if len(vc.ExpirationDate) > 0 {
+		expirationDate, err := time.Parse(time.RFC3339, vc.ExpirationDate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid expirationDate, err:%v", err)
+		}
+		if now.After(expirationDate) {
+			return nil, fmt.Errorf("credential expired at %v", vc.ExpirationDate)
+		}
+	}
+
+	proof, unsigned, err := aospacedid.SplitProof(doc)
+	if err != nil {
+		return nil, err
+	}
+	if proof.ProofPurpose != aospacedid.ProofPurposeAssertionMethod {
+		return nil, fmt.Errorf("unexpected proof purpose %v", proof.ProofPurpose)
+	}
+	if !strings.HasPrefix(proof.VerificationMethod, vc.Issuer+"#") {
+		return nil, fmt.Errorf("verification method %v not controlled by issuer %v", proof.VerificationMethod, vc.Issuer)
+	}
+	pub, err := lookupVerificationKey(levelDBTrans, proof.VerificationMethod, true, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := aospacedid.VerifyProof(unsigned, proof, pub); err != nil {
+		return nil, err
+	}
+	return vc, nil
+}
+
+// lookupVerificationKey 按 DID URL(did#fragment)从本机解析验证方法的公钥.
+// device 为 true 时只接受设备验证方法(包括宽限期内的旧设备密钥), 否则只接受客户端持有的验证方法.
+func lookupVerificationKey(levelDBTrans *leveldb.Trans, didURL string, device bool, now time.Time) (*cryptorsa.PublicKey, error) {
+	i := strings.Index(didURL, "#")
+	if i < 0 {
+		return nil, fmt.Errorf("invalid verification method %v", didURL)
+	}
+	didStr, fragment := didURL[:i], didURL[i:]
+	doc, meta, err := ResolveDocument(levelDBTrans, didStr, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %v, err:%v", didStr, err)
+	}
+	if meta.Deactivated {
+		return nil, fmt.Errorf("%v deactivated", didStr)
+	}
+	didDoc := &aospacedid.Document{}
+	if err := json.Unmarshal(doc, didDoc); err != nil {
+		return nil, err
+	}
+
+	for _, vm := range didDoc.VerificationMethod {
+		if vm.Fragment() != fragment {
+			continue
+		}
+		if len(vm.PublicKeyPem) < 1 {
+			return nil, fmt.Errorf("verification method %v has no public key", didURL)
+		}
+		query := ""
+		if j := strings.Index(vm.ID, "?"); j > 0 {
+			query = strings.TrimSuffix(vm.ID[j+1:], vm.Fragment())
+		}
+		values, _ := url.ParseQuery(query)
+		credentialType := values.Get(queryKeyNameOfCredentialType)
+		isDevice := credentialType == CredentialTypeDevice || credentialType == CredentialTypePreviousDevice
+		if device != isDevice {
+			return nil, fmt.Errorf("verification method %v of type %v not allowed", didURL, credentialType)
+		}
+		if credentialType == CredentialTypePreviousDevice {
+			expires, err := time.Parse(time.RFC3339, values.Get(queryKeyNameOfExpires))
+			if err != nil || now.After(expires) {
+				return nil, fmt.Errorf("verification method %v expired", didURL)
+			}
+		}
+		return rsa.GetPublicKey([]byte(vm.PublicKeyPem))
+	}
+	return nil, fmt.Errorf("verification method %v not found", didURL)
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package did
+
+import (
+	aospacedid "agent/deps/did/aospace/did"
+	"crypto"
+	"crypto/rand"
+	cryptorsa "crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signWith(key *cryptorsa.PrivateKey) aospacedid.SignFunc {
+	return func(data []byte) ([]byte, error) {
+		sum := sha256.Sum256(data)
+		return cryptorsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, sum[:])
+	}
+}
+
+func TestIssueVerifyCredential(t *testing.T) {
+	openTestDB(t)
+	createTestDocument(t, AdminAoId, "123456")
+	memberDid, _ := createTestDocument(t, "aoid-2", "654321")
+
+	vc, err := IssueCredential(nil, AdminAoId, []string{"AOSpaceMemberCredential"},
+		map[string]interface{}{"id": memberDid, "aoId": "aoid-2"}, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, err := json.Marshal(vc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	verified, err := VerifyCredential(nil, raw)
+	if err != nil {
+		t.Fatalf("VerifyCredential err:%v", err)
+	}
+	if verified.CredentialSubject["id"] != memberDid {
+		t.Fatalf("unexpected subject %v", verified.CredentialSubject)
+	}
+
+	// 篡改凭证主体、有效期后校验失败
+	for _, tamper := range []func(doc map[string]interface{}){
+		func(doc map[string]interface{}) { doc["credentialSubject"].(map[string]interface{})["aoId"] = "aoid-3" },
+		func(doc map[string]interface{}) {
+			doc["expirationDate"] = time.Now().Add(24 * time.Hour).UTC().Format(time.RFC3339)
+		},
+		func(doc map[string]interface{}) { doc["issuer"] = memberDid },
+	} {
+		doc := make(map[string]interface{})
+		if err := json.Unmarshal(raw, &doc); err != nil {
+			t.Fatal(err)
+		}
+		tamper(doc)
+		b, _ := json.Marshal(doc)
+		if _, err := VerifyCredential(nil, b); err == nil {
+			t.Fatalf("tampered credential verified: %s", b)
+		}
+	}
+
+	// 已过期
+	expired, err := IssueCredential(nil, AdminAoId, []string{"AOSpaceMemberCredential"},
+		map[string]interface{}{"id": memberDid}, time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	raw, _ = json.Marshal(expired)
+	if _, err := VerifyCredential(nil, raw); err == nil || !strings.Contains(err.Error(), "expired") {
+		t.Fatalf("expired credential, err:%v", err)
+	}
+}
+
+func TestVerifyPresentation(t *testing.T) {
+	openTestDB(t)
+	createTestDocument(t, AdminAoId, "123456")
+	memberDid, memberKey := createTestDocument(t, "aoid-2", "654321")
+
+	vc, err := IssueCredential(nil, AdminAoId, []string{"AOSpaceMemberCredential"},
+		map[string]interface{}{"id": memberDid}, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	present := func(challenge string, key *cryptorsa.PrivateKey) []byte {
+		vp := &aospacedid.Presentation{
+			Context:              []interface{}{aospacedid.CredentialsContext},
+			Type:                 []string{aospacedid.TypeVerifiablePresentation},
+			Holder:               memberDid,
+			VerifiableCredential: []*aospacedid.Credential{vc},
+		}
+		proof := &aospacedid.Proof{
+			Type:               aospacedid.ProofTypeRsaSignature2018,
+			Created:            time.Now().UTC().Format(time.RFC3339),
+			VerificationMethod: memberDid + "#key-1",
+			ProofPurpose:       aospacedid.ProofPurposeAuthentication,
+			Challenge:          challenge,
+			Domain:             "ao.space",
+		}
+		if err := vp.Sign(proof, signWith(key)); err != nil {
+			t.Fatal(err)
+		}
+		b, err := json.Marshal(vp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	raw := present("nonce-1", memberKey)
+	vp, err := VerifyPresentation(nil, raw, "nonce-1", "ao.space")
+	if err != nil {
+		t.Fatalf("VerifyPresentation err:%v", err)
+	}
+	if vp.Holder != memberDid || len(vp.VerifiableCredential) != 1 {
+		t.Fatalf("unexpected presentation %+v", vp)
+	}
+
+	// challenge 必须提供且一致
+	if _, err := VerifyPresentation(nil, raw, "", "ao.space"); err == nil {
+		t.Fatal("presentation verified without challenge")
+	}
+	if _, err := VerifyPresentation(nil, present("", memberKey), "", ""); err == nil {
+		t.Fatal("presentation without challenge verified")
+	}
+	if _, err := VerifyPresentation(nil, raw, "nonce-2", "ao.space"); err == nil {
+		t.Fatal("replayed presentation verified")
+	}
+	if _, err := VerifyPresentation(nil, raw, "nonce-1", "evil.example"); err == nil {
+		t.Fatal("presentation verified for another domain")
+	}
+
+	// 非持有者密钥签名
+	otherKey, err := cryptorsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyPresentation(nil, present("nonce-1", otherKey), "nonce-1", "ao.space"); err == nil {
+		t.Fatal("presentation signed by another key verified")
+	}
+
+	// 篡改包含的凭证
+	doc := make(map[string]interface{})
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		t.Fatal(err)
+	}
+	doc["verifiableCredential"].([]interface{})[0].(map[string]interface{})["credentialSubject"].(map[string]interface{})["id"] = "did:aospace:evil"
+	b, _ := json.Marshal(doc)
+	if _, err := VerifyPresentation(nil, b, "nonce-1", "ao.space"); err == nil {
+		t.Fatal("tampered presentation verified")
+	}
+}
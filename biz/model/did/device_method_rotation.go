@@ -0,0 +1,212 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package did
+
+import (
+	"agent/biz/model/did/leveldb"
+	aospacedid "agent/deps/did/aospace/did"
+	"agent/deps/did/aospace/rsa"
+	"agent/utils/keystore"
+	"agent/utils/logger"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gibson042/canonicaljson-go"
+)
+
+const (
+	queryKeyNameOfExpires = "expires"
+
+	// CredentialTypePreviousDevice 轮换前的设备公钥, 宽限期内仍可用于验证签名.
+	// 不能以 "device" 开头, 否则会被 credentialType=device 的查询匹配到.
+	CredentialTypePreviousDevice = "previousdevice"
+
+	fragmentOfDevice         = "key-0"
+	fragmentOfPreviousDevice = "key-4"
+)
+
+// ListAoIds 返回所有已创建 DID 的 aoId.
+func ListAoIds(levelDBTrans *leveldb.Trans) ([]string, error) {
+	prefix := leveldb.KNamePrefixOfAoIdToDid()
+	aoIds := make([]string, 0)
+	err := leveldb.Iterate(levelDBTrans, []byte(prefix), func(key, value []byte) bool {
+		aoIds = append(aoIds, strings.TrimPrefix(string(key), prefix))
+		return true
+	})
+	return aoIds, err
+}
+
+// rotateDeviceMethod 为 aoId 生成新的空间密钥并替换文档中的设备验证方法(key-0).
+// 旧公钥以 previousdevice 类型(key-4)保留到 graceUntil, DID 保持不变.
+// 结果只用于生成提议(ProposeDeviceMethodRotation), 调用方需要回滚 levelDBTrans.
+func rotateDeviceMethod(levelDBTrans *leveldb.Trans, aoId string, graceUntil time.Time) ([]byte, string, error) {
+	logger.AppLogger().Debugf("rotateDeviceMethod, aoId:%v, graceUntil:%v", aoId, graceUntil)
+
+	didStr, found, err := GetDidByAoId(levelDBTrans, aoId)
+	if err != nil {
+		return nil, "", err
+	}
+	if !found {
+		return nil, "", fmt.Errorf("did not found by aoId(%v)", aoId)
+	}
+	did, err := loadIdentifier(levelDBTrans, didStr)
+	if err != nil {
+		return nil, "", err
+	}
+	subject := did.DID()
+
+	oldPriKeyBytes, err := getPrivateKey(levelDBTrans, leveldb.KNameOfSpaceRSAPri(aoId))
+	if err != nil {
+		return nil, "", fmt.Errorf("getPrivateKey:%v err:%v", leveldb.KNameOfSpaceRSAPri(aoId), err)
+	}
+	defer keystore.Zeroize(oldPriKeyBytes)
+	oldPubKeyBytes, err := rsa.GetRsaPubKeyByPriKeyBytes(oldPriKeyBytes)
+	if err != nil {
+		return nil, "", fmt.Errorf("GetRsaPubKeyByPriKeyBytes err:%v", err)
+	}
+	newPriKeyBytes, newPubKeyBytes, err := rsa.GenRsaKey(2048)
+	if err != nil {
+		return nil, "", fmt.Errorf("GenRsaKey err:%v", err)
+	}
+	defer keystore.Zeroize(newPriKeyBytes)
+	if err := putPrivateKey(levelDBTrans, leveldb.KNameOfSpaceRSAPriPrevious(aoId), oldPriKeyBytes); err != nil {
+		return nil, "", err
+	}
+	if err := putPrivateKey(levelDBTrans, leveldb.KNameOfSpaceRSAPri(aoId), newPriKeyBytes); err != nil {
+		return nil, "", err
+	}
+
+	if _, err := did.RemoveVerificationMethodByFragment("#" + fragmentOfDevice); err != nil {
+		return nil, "", err
+	}
+	if _, err := did.RemoveVerificationMethodByFragment("#" + fragmentOfPreviousDevice); err != nil {
+		return nil, "", err
+	}
+
+	timeNow := time.Now().UTC().Format(time.RFC3339)
+	keyType := aospacedid.KeyTypeRSA.String()
+	query := fmt.Sprintf("%v=%v&%v=%v", queryKeyNameOfVersionTime, timeNow,
+		queryKeyNameOfCredentialType, CredentialTypeDevice)
+	keyId, err := did.AddNewVerificationMethodWithIndex(0, keyType, string(newPubKeyBytes), query, fragmentOfDevice)
+	if err != nil {
+		return nil, "", fmt.Errorf("AddNewVerificationMethod err:%v", err)
+	}
+	logger.AppLogger().Debugf("rotateDeviceMethod, AddNewVerificationMethod, query:%v, keyId:%v", query, keyId)
+
+	query = fmt.Sprintf("%v=%v&%v=%v&%v=%v", queryKeyNameOfVersionTime, timeNow,
+		queryKeyNameOfCredentialType, CredentialTypePreviousDevice,
+		queryKeyNameOfExpires, graceUntil.UTC().Format(time.RFC3339))
+	keyId, err = did.AddNewVerificationMethod(keyType, string(oldPubKeyBytes), query, fragmentOfPreviousDevice)
+	if err != nil {
+		return nil, "", fmt.Errorf("AddNewVerificationMethod err:%v", err)
+	}
+	logger.AppLogger().Debugf("rotateDeviceMethod, AddNewVerificationMethod, query:%v, keyId:%v", query, keyId)
+
+	didDocBytes, err := saveIdentifier(levelDBTrans, did, subject)
+	if err != nil {
+		return nil, "", err
+	}
+	return didDocBytes, didStr, nil
+}
+
+// PruneExpiredDeviceMethods 删除宽限期已过的旧空间私钥. 文档中的 previousdevice 验证方法(key-4)不在这里删除:
+// 修改文档需要多重签名授权, 过期的 key-4 在校验时会被拒绝, 下次轮换设备验证方法时移除.
+func PruneExpiredDeviceMethods(levelDBTrans *leveldb.Trans, aoId string) (bool, error) {
+	didStr, found, err := GetDidByAoId(levelDBTrans, aoId)
+	if err != nil || !found {
+		return false, err
+	}
+	did, err := loadIdentifier(levelDBTrans, didStr)
+	if err != nil {
+		return false, err
+	}
+
+	vm, found := findVerificationMethodByFragment(did, fragmentOfPreviousDevice)
+	if !found {
+		return false, nil
+	}
+	expires, err := queryTimeOf(vm.ID, queryKeyNameOfExpires)
+	if err != nil {
+		return false, err
+	}
+	if time.Now().Before(expires) {
+		return false, nil
+	}
+
+	key := []byte(leveldb.KNameOfSpaceRSAPriPrevious(aoId))
+	if exist, err := leveldb.Has(levelDBTrans, key); err != nil || !exist {
+		return false, err
+	}
+	if err := leveldb.Delete(levelDBTrans, key); err != nil {
+		return false, err
+	}
+	logger.AppLogger().Infof("PruneExpiredDeviceMethods, removed previous space key of %v, expired at %v",
+		didStr, expires)
+	return true, nil
+}
+
+func loadIdentifier(levelDBTrans *leveldb.Trans, didStr string) (*aospacedid.Identifier, error) {
+	doc, err := getDidDoc(levelDBTrans, didStr)
+	if err != nil {
+		return nil, err
+	}
+	didDoc := &aospacedid.Document{}
+	if err := json.Unmarshal(doc, didDoc); err != nil {
+		return nil, err
+	}
+	return aospacedid.FromDocument(didDoc)
+}
+
+// saveIdentifier 保存文档. 标识符由第一个公钥计算, 替换 key-0 后需要保留原文档的 id(subject).
+func saveIdentifier(levelDBTrans *leveldb.Trans, did *aospacedid.Identifier, subject string) ([]byte, error) {
+	didDoc := did.Document(true)
+	didDoc.Subject = subject
+	didDocBytes, err := canonicaljson.Marshal(didDoc)
+	if err != nil {
+		return nil, fmt.Errorf("MarshalIndent err:%v", err)
+	}
+	if err := saveDidDoc(levelDBTrans, subject, didDocBytes); err != nil {
+		return nil, fmt.Errorf("saveDidDoc err:%v", err)
+	}
+	return didDocBytes, nil
+}
+
+func findVerificationMethodByFragment(did *aospacedid.Identifier, fragment string) (*aospacedid.VerificationKey, bool) {
+	for _, vm := range did.VerificationMethods() {
+		if vm.Fragment() == "#"+fragment {
+			return vm, true
+		}
+	}
+	return nil, false
+}
+
+func queryTimeOf(id, name string) (time.Time, error) {
+	i := strings.Index(id, "?")
+	if i < 0 {
+		return time.Time{}, fmt.Errorf("no query in %v", id)
+	}
+	query := id[i+1:]
+	if j := strings.Index(query, "#"); j >= 0 {
+		query = query[:j]
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.Parse(time.RFC3339, values.Get(name))
+}
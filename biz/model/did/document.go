@@ -18,6 +18,7 @@ import (
 	"agent/biz/model/did/leveldb"
 	"agent/biz/model/dto/did/document"
 	aospacedid "agent/deps/did/aospace/did"
+	"agent/utils/keystore"
 	"agent/utils/logger"
 	"encoding/json"
 	"fmt"
@@ -34,14 +35,26 @@ const (
 	CredentialTypeBinder           = "binder"
 	CredentialTypePasswordOnDevice = "passwordondevice"
 	CredentialTypePasswordOnBinder = "passwordonbinder"
+
+	AdminAoId = "aoid-1" // 管理员的 aoId, 创建空间时使用
 )
 
+// GetEncryptedPriKeyBytes 返回给客户端的密码私钥密文.
 func GetEncryptedPriKeyBytes(levelDBTrans *leveldb.Trans, aoId string) ([]byte, bool, error) {
 	logger.AppLogger().Debugf("GetEncryptedPriKeyBytes, aoId:%v",
 		aoId)
 	return getEncryptedPrivatePasswordKey(levelDBTrans, aoId)
 }
 
+// VerifyPasswordKey 用空间密码解密密码私钥并校验, 旧格式的数据同时升级为最新格式. 空间密码校验通过后调用.
+func VerifyPasswordKey(levelDBTrans *leveldb.Trans, aoId, password string) error {
+	logger.AppLogger().Debugf("VerifyPasswordKey, aoId:%v",
+		aoId)
+	priKeyBytes, _, err := unlockPasswordKey(levelDBTrans, aoId, password)
+	keystore.Zeroize(priKeyBytes)
+	return err
+}
+
 // 如果不需要开启事务，levelDBTrans 传入 nil.
 func GetDocumentFromFile(levelDBTrans *leveldb.Trans, aoId, didStr string) ([]byte, error) {
 	logger.AppLogger().Debugf("GetDocumentFromFile, didStr:%v, aoId:%v",
@@ -150,6 +163,7 @@ func ResetPasswordVerficationMethod(levelDBTrans *leveldb.Trans, didStr, aoId, n
 	if err != nil {
 		return nil, "", err
 	}
+	subject := did.DID()
 
 	// add CredentialTypePasswordOnSpace method
 	fragment := "key-2"
@@ -169,18 +183,13 @@ func ResetPasswordVerficationMethod(levelDBTrans *leveldb.Trans, didStr, aoId, n
 	// logger.AppLogger().Debugf("AddNewVerificationMethod, query:%v, keyId:%v, found:%v",
 	// 	query, keyId, found)
 
-	// create new document
-	didDoc = did.Document(true)
-	didDocBytes, err := canonicaljson.Marshal(didDoc)
+	// create new document. 设备密钥轮换后 key-0 已替换, 需要保留原 DID.
+	didDocBytes, err := saveIdentifier(levelDBTrans, did, subject)
 	if err != nil {
-		return nil, "", fmt.Errorf("MarshalIndent err:%v", err)
-	}
-
-	if err := saveDidDoc(levelDBTrans, did.DID(), didDocBytes); err != nil {
-		return nil, "", fmt.Errorf("saveDidDoc err:%v", err)
+		return nil, "", err
 	}
 
-	return didDocBytes, did.DID(), nil
+	return didDocBytes, subject, nil
 }
 
 func CreateDocument(levelDBTrans *leveldb.Trans, aoId, password string, verificationMethods []*document.VerificationMethod) ([]byte, []byte, string, error) {
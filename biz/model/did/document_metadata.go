@@ -0,0 +1,57 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package did
+
+import (
+	"agent/biz/model/did/leveldb"
+	"encoding/json"
+	"fmt"
+)
+
+// DocumentMetadata DID 文档元数据, 对应 W3C DID Resolution 的 didDocumentMetadata.
+type DocumentMetadata struct {
+	Created       string `json:"created,omitempty"`
+	Updated       string `json:"updated,omitempty"`
+	VersionId     string `json:"versionId,omitempty"`
+	NextUpdate    string `json:"nextUpdate,omitempty"`
+	NextVersionId string `json:"nextVersionId,omitempty"`
+	Deactivated   bool   `json:"deactivated,omitempty"`
+	Hash          string `json:"hash,omitempty"` // 当前版本文档的 SHA256, 下一版本的 previousHash
+}
+
+func putDidDocMeta(levelDBTrans *leveldb.Trans, did string, meta *DocumentMetadata) error {
+	b, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	return leveldb.Put(levelDBTrans, []byte(leveldb.KNameOfDidDocMeta(did)), b)
+}
+
+// getDidDocMeta 读取文档元数据. 旧版本创建的文档没有元数据, found 为 false.
+func getDidDocMeta(levelDBTrans *leveldb.Trans, did string) (*DocumentMetadata, bool, error) {
+	exist, err := leveldb.Has(levelDBTrans, []byte(leveldb.KNameOfDidDocMeta(did)))
+	if err != nil || !exist {
+		return nil, false, err
+	}
+	b, err := leveldb.Get(levelDBTrans, []byte(leveldb.KNameOfDidDocMeta(did)))
+	if err != nil {
+		return nil, false, err
+	}
+	meta := &DocumentMetadata{}
+	if err := json.Unmarshal(b, meta); err != nil {
+		return nil, false, fmt.Errorf("failed to parse metadata of %v, err:%v", did, err)
+	}
+	return meta, true, nil
+}
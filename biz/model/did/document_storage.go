@@ -17,14 +17,17 @@ package did
 import (
 	"agent/biz/model/did/leveldb"
 	"agent/deps/did/aospace/rsa"
+	"agent/utils/keystore"
 	"agent/utils/logger"
 	cryptosha256 "crypto/sha256"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/dungeonsnd/gocom/encrypt/aes"
 	"github.com/dungeonsnd/gocom/encrypt/hash/sha256"
-	"github.com/dungeonsnd/gocom/encrypt/random"
 	"golang.org/x/crypto/pbkdf2"
 )
 
@@ -78,9 +81,9 @@ func getSpaceKey(levelDBTrans *leveldb.Trans, aoId string) ([]byte, []byte, erro
 	var priKeyBytes []byte
 	var pubKeyBytes []byte
 	if exist {
-		priKeyBytes, err = leveldb.Get(levelDBTrans, []byte(leveldb.KNameOfSpaceRSAPri(aoId)))
+		priKeyBytes, err = getPrivateKey(levelDBTrans, leveldb.KNameOfSpaceRSAPri(aoId))
 		if err != nil { // error
-			logger.AppLogger().Debugf("getSpaceKey, leveldb.Get:%v, err:%v",
+			logger.AppLogger().Debugf("getSpaceKey, getPrivateKey:%v, err:%v",
 				leveldb.KNameOfSpaceRSAPri(aoId), err)
 			return nil, nil, err
 		}
@@ -110,7 +113,7 @@ func getSpaceKey(levelDBTrans *leveldb.Trans, aoId string) ([]byte, []byte, erro
 				leveldb.KNameOfSpaceRSAPri(aoId))
 		}
 
-		err = leveldb.Put(levelDBTrans, []byte(leveldb.KNameOfSpaceRSAPri(aoId)), priKeyBytes)
+		err = putPrivateKey(levelDBTrans, leveldb.KNameOfSpaceRSAPri(aoId), priKeyBytes)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -119,6 +122,50 @@ func getSpaceKey(levelDBTrans *leveldb.Trans, aoId string) ([]byte, []byte, erro
 	return priKeyBytes, pubKeyBytes, nil
 }
 
+// putPrivateKey 保存私钥, 开启 Keystore 时加密保存.
+// 密码私钥已由空间密码加密, 并且需要原样返回给客户端, 不经过这里.
+func putPrivateKey(levelDBTrans *leveldb.Trans, key string, priKeyBytes []byte) error {
+	value := priKeyBytes
+	if keystore.Enabled() {
+		var err error
+		value, err = keystore.Protect(priKeyBytes)
+		if err != nil {
+			return fmt.Errorf("keystore.Protect err:%v", err)
+		}
+	}
+	return leveldb.Put(levelDBTrans, []byte(key), value)
+}
+
+// getPrivateKey 读取私钥. 旧版本保存的明文私钥在开启 Keystore 时重新加密保存.
+func getPrivateKey(levelDBTrans *leveldb.Trans, key string) ([]byte, error) {
+	value, err := leveldb.Get(levelDBTrans, []byte(key))
+	if err != nil {
+		return nil, err
+	}
+	priKeyBytes, protected, err := keystore.Open(value)
+	if err != nil {
+		return nil, fmt.Errorf("keystore.Open err:%v", err)
+	}
+	if !protected && keystore.Enabled() {
+		if err := putPrivateKey(levelDBTrans, key, priKeyBytes); err != nil {
+			logger.AppLogger().Warnf("getPrivateKey, failed to migrate plaintext key %v, err:%v", key, err)
+		} else {
+			logger.AppLogger().Infof("getPrivateKey, plaintext key %v migrated", key)
+		}
+	}
+	return priKeyBytes, nil
+}
+
+// 密码私钥加密格式: version(4 字节, 大端) | 数据.
+// version 0 为旧格式: iv(16) | AES-CBC 密文, 密钥由密码和固定 salt 经 PBKDF2 派生.
+// version 1: keystore.PassphraseSealed 的 JSON(每个条目随机 salt, argon2id 派生密钥, AES-256-GCM), version 作为附加认证数据.
+// 密码私钥总是保存为最新格式, 旧格式只用于读取, 在密码校验成功(VerifyPasswordKey)时升级.
+// 之前版本另外保存的旧格式客户端副本在用密码重新加密或解密成功时删除.
+const (
+	passwordKeyVersionLegacy = 0
+	passwordKeyVersion1      = 1
+)
+
 func aesDerivedKey(password string) []byte {
 	logger.AppLogger().Debugf("aesDerivedKey")
 
@@ -127,26 +174,56 @@ func aesDerivedKey(password string) []byte {
 	return dk
 }
 
-func aesEncrypt(origData []byte, password string) ([]byte, error) {
-	logger.AppLogger().Debugf("aesEncrypt")
+// wrapPasswordKey 使用密码加密私钥, 总是使用最新格式.
+func wrapPasswordKey(priKeyBytes []byte, password string) ([]byte, error) {
+	logger.AppLogger().Debugf("wrapPasswordKey")
 
-	key := aesDerivedKey(password)
-	iv := random.Random(passwordKeyIVLen)
-	encbuf, err := aes.AesEncryptByPkcs5Padding(origData, key, iv)
+	kdf, err := keystore.DefaultArgon2idKDF()
 	if err != nil {
-		err1 := fmt.Errorf("AesEncryptByPkcs5Padding failed, err:%+v", err)
-		logger.AppLogger().Warnf("%+v", err1)
-		return nil, err1
+		return nil, err
+	}
+	version := make([]byte, passwordKeyVersionLen)
+	binary.BigEndian.PutUint32(version, passwordKeyVersion1)
+	sealed, err := keystore.SealWithPassphrase(kdf, []byte(password), version, priKeyBytes)
+	if err != nil {
+		return nil, fmt.Errorf("SealWithPassphrase failed, err:%+v", err)
 	}
-	encData := make([]byte, passwordKeyVersionLen)
-	encData = append(encData, iv...)
-	encData = append(encData, encbuf...)
-	return encData, nil
+	b, err := json.Marshal(sealed)
+	if err != nil {
+		return nil, err
+	}
+	return append(version, b...), nil
 }
 
-func aesDecrypt(origData []byte, password string) ([]byte, error) {
-	logger.AppLogger().Debugf("aesDecrypt")
+// unwrapPasswordKey 使用密码解密私钥. legacy 为 true 表示数据为旧格式, 调用方应重新加密保存.
+func unwrapPasswordKey(data []byte, password string) ([]byte, bool, error) {
+	logger.AppLogger().Debugf("unwrapPasswordKey")
+
+	if len(data) < passwordKeyVersionLen {
+		return nil, false, fmt.Errorf("invalid password key")
+	}
+	switch version := binary.BigEndian.Uint32(data[:passwordKeyVersionLen]); version {
+	case passwordKeyVersionLegacy:
+		plain, err := legacyAesDecrypt(data, password)
+		return plain, true, err
+	case passwordKeyVersion1:
+		sealed := &keystore.PassphraseSealed{}
+		if err := json.Unmarshal(data[passwordKeyVersionLen:], sealed); err != nil {
+			return nil, false, fmt.Errorf("invalid password key, err:%v", err)
+		}
+		plain, err := keystore.OpenWithPassphrase(sealed, []byte(password), data[:passwordKeyVersionLen])
+		return plain, false, err
+	default:
+		return nil, false, fmt.Errorf("unsupported password key version %v", version)
+	}
+}
 
+func legacyAesDecrypt(origData []byte, password string) ([]byte, error) {
+	logger.AppLogger().Debugf("legacyAesDecrypt")
+
+	if len(origData) < passwordKeyVersionLen+passwordKeyIVLen {
+		return nil, fmt.Errorf("invalid password key")
+	}
 	key := aesDerivedKey(password)
 	iv := origData[passwordKeyVersionLen : passwordKeyVersionLen+passwordKeyIVLen]
 	encData := origData[passwordKeyVersionLen+passwordKeyIVLen:]
@@ -159,32 +236,94 @@ func aesDecrypt(origData []byte, password string) ([]byte, error) {
 	return decbuf, nil
 }
 
+// getOptionalKey 读取 key, 不存在时返回 nil.
+func getOptionalKey(levelDBTrans *leveldb.Trans, key string) ([]byte, error) {
+	exist, err := leveldb.Has(levelDBTrans, []byte(key))
+	if err != nil || !exist {
+		return nil, err
+	}
+	return leveldb.Get(levelDBTrans, []byte(key))
+}
+
+// getEncryptedPrivatePasswordKey 返回给客户端的密码私钥密文, 即保存的密码私钥. 旧格式的数据升级前原样返回.
 func getEncryptedPrivatePasswordKey(levelDBTrans *leveldb.Trans, aoId string) ([]byte, bool, error) {
 	logger.AppLogger().Debugf("getEncryptedPrivatePasswordKey, aoId:%v",
 		aoId)
 
-	var err error
-	exist, err := leveldb.Has(levelDBTrans, []byte(leveldb.KNameOfPasswordRSAPri(aoId)))
-	if err != nil { // error
-		logger.AppLogger().Debugf("getPasswordKey, leveldb.Has:%v, err:%v",
+	storedKey, err := getOptionalKey(levelDBTrans, leveldb.KNameOfPasswordRSAPri(aoId))
+	if err != nil {
+		logger.AppLogger().Debugf("getEncryptedPrivatePasswordKey, %v, err:%v",
 			leveldb.KNameOfPasswordRSAPri(aoId), err)
-		return nil, exist, err
+		return nil, false, err
 	}
-	fmt.Printf("\ngetPasswordKey, leveldb.Has:%v, err:%v\n",
-		leveldb.KNameOfPasswordRSAPri(aoId), err)
+	return storedKey, storedKey != nil, nil
+}
 
-	var encryptedPriKeyBytes []byte
-	if exist {
-		encryptedPriKeyBytes, err = leveldb.Get(levelDBTrans, []byte(leveldb.KNameOfPasswordRSAPri(aoId)))
-		if err != nil { // error
-			logger.AppLogger().Debugf("getPasswordKey, leveldb.Get:%v, err:%v",
-				leveldb.KNameOfPasswordRSAPri(aoId), err)
-			return nil, exist, err
+// putPasswordKey 用密码加密保存密码私钥并删除旧格式的客户端副本, 返回保存的密文.
+func putPasswordKey(levelDBTrans *leveldb.Trans, aoId string, priKeyBytes []byte, password string) ([]byte, error) {
+	encryptedPriKeyBytes, err := wrapPasswordKey(priKeyBytes, password)
+	if err != nil {
+		return nil, err
+	}
+	if err := leveldb.Put(levelDBTrans, []byte(leveldb.KNameOfPasswordRSAPri(aoId)), encryptedPriKeyBytes); err != nil {
+		return nil, err
+	}
+	if err := deleteLegacyClientKey(levelDBTrans, aoId); err != nil {
+		return nil, err
+	}
+	return encryptedPriKeyBytes, nil
+}
+
+// deleteLegacyClientKey 删除之前版本保存的旧格式客户端副本.
+func deleteLegacyClientKey(levelDBTrans *leveldb.Trans, aoId string) error {
+	key := []byte(leveldb.KNameOfPasswordRSAPriForClient(aoId))
+	exist, err := leveldb.Has(levelDBTrans, key)
+	if err != nil || !exist {
+		return err
+	}
+	if err := leveldb.Delete(levelDBTrans, key); err != nil {
+		return err
+	}
+	logger.AppLogger().Infof("deleteLegacyClientKey, legacy client key of %v deleted", aoId)
+	return nil
+}
+
+// unlockPasswordKey 用密码解密保存的密码私钥, 并校验解密结果是有效的私钥. 旧格式的数据在校验通过后升级为最新格式.
+func unlockPasswordKey(levelDBTrans *leveldb.Trans, aoId, password string) ([]byte, []byte, error) {
+	logger.AppLogger().Debugf("unlockPasswordKey, aoId:%v", aoId)
+
+	encryptedPriKeyBytes, err := getOptionalKey(levelDBTrans, leveldb.KNameOfPasswordRSAPri(aoId))
+	if err != nil {
+		return nil, nil, err
+	}
+	if encryptedPriKeyBytes == nil {
+		return nil, nil, fmt.Errorf("key of %v not exist", leveldb.KNameOfPasswordRSAPri(aoId))
+	}
+	priKeyBytes, legacy, err := unwrapPasswordKey(encryptedPriKeyBytes, password)
+	if err != nil {
+		return nil, nil, err
+	}
+	// 旧格式没有完整性校验, 错误的密码也可能解密成功
+	pubKeyBytes, err := rsa.GetRsaPubKeyByPriKeyBytes(priKeyBytes)
+	if err != nil {
+		keystore.Zeroize(priKeyBytes)
+		logger.AppLogger().Debugf("unlockPasswordKey, failed GetRsaPubKeyByPriKeyBytes, err:%v", err)
+		return nil, nil, fmt.Errorf("invalid password key of %v, err:%v", aoId, err)
+	}
+	if legacy {
+		if _, err := putPasswordKey(levelDBTrans, aoId, priKeyBytes, password); err != nil {
+			keystore.Zeroize(priKeyBytes)
+			return nil, nil, err
 		}
+		logger.AppLogger().Infof("unlockPasswordKey, password key of %v upgraded to version %v", aoId, passwordKeyVersion1)
+	} else if err := deleteLegacyClientKey(levelDBTrans, aoId); err != nil {
+		keystore.Zeroize(priKeyBytes)
+		return nil, nil, err
 	}
-	return encryptedPriKeyBytes, exist, nil
+	return priKeyBytes, pubKeyBytes, nil
 }
 
+// getPasswordKey 返回密码私钥密文、密码私钥和公钥. 不存在时生成新的密码私钥.
 func getPasswordKey(levelDBTrans *leveldb.Trans, aoId, password string) ([]byte, []byte, []byte, error) {
 	logger.AppLogger().Debugf("getPasswordKey, aoId:%v",
 		aoId)
@@ -203,29 +342,17 @@ func getPasswordKey(levelDBTrans *leveldb.Trans, aoId, password string) ([]byte,
 	var pubKeyBytes []byte
 	var encryptedPriKeyBytes []byte
 	if exist {
-		encryptedPriKeyBytes, err = leveldb.Get(levelDBTrans, []byte(leveldb.KNameOfPasswordRSAPri(aoId)))
-		if err != nil { // error
-			logger.AppLogger().Debugf("getPasswordKey, leveldb.Get:%v, err:%v",
-				leveldb.KNameOfPasswordRSAPri(aoId), err)
-			return nil, nil, nil, err
-		}
-		logger.AppLogger().Debugf("getPasswordKey, len(encryptedPriKeyBytes):%v", encryptedPriKeyBytes)
-
-		priKeyBytes, err := aesDecrypt(encryptedPriKeyBytes, password)
+		priKeyBytes, pubKeyBytes, err = unlockPasswordKey(levelDBTrans, aoId, password)
 		if err != nil {
 			return nil, nil, nil, err
 		}
-		logger.AppLogger().Debugf("getPasswordKey, aesDecrypt")
+		logger.AppLogger().Debugf("getPasswordKey, unlockPasswordKey, pubKeyBytes:%v",
+			pubKeyBytes)
 
-		pubKeyBytes, err = rsa.GetRsaPubKeyByPriKeyBytes(priKeyBytes)
+		encryptedPriKeyBytes, _, err = getEncryptedPrivatePasswordKey(levelDBTrans, aoId)
 		if err != nil {
-			logger.AppLogger().Debugf("getPasswordKey, failed GetRsaPubKeyByPriKeyBytes, pubKeyBytes:%v, err:%v",
-				pubKeyBytes, err)
 			return nil, nil, nil, err
 		}
-		logger.AppLogger().Debugf("getPasswordKey, failed GetRsaPubKeyByPriKeyBytes, pubKeyBytes:%v",
-			pubKeyBytes)
-
 	} else { // not exist
 		if preGeneratedPasswordKeyPri != nil && preGeneratedPasswordKeyPub != nil {
 			priKeyBytes = preGeneratedPasswordKeyPri
@@ -242,17 +369,11 @@ func getPasswordKey(levelDBTrans *leveldb.Trans, aoId, password string) ([]byte,
 				leveldb.KNameOfPasswordRSAPri(aoId), string(pubKeyBytes))
 		}
 
-		encryptedPriKeyBytes, err = aesEncrypt(priKeyBytes, password)
+		encryptedPriKeyBytes, err = putPasswordKey(levelDBTrans, aoId, priKeyBytes, password)
 		if err != nil {
 			return nil, nil, nil, err
 		}
-		logger.AppLogger().Debugf("getPasswordKey, aesEncrypt")
-
-		err := leveldb.Put(levelDBTrans, []byte(leveldb.KNameOfPasswordRSAPri(aoId)), encryptedPriKeyBytes)
-		if err != nil {
-			return nil, nil, nil, err
-		}
-		logger.AppLogger().Debugf("getPasswordKey, Put")
+		logger.AppLogger().Debugf("getPasswordKey, putPasswordKey")
 	}
 
 	return encryptedPriKeyBytes, priKeyBytes, pubKeyBytes, nil
@@ -263,53 +384,23 @@ func deletePasswordKey(levelDBTrans *leveldb.Trans, aoId string) error {
 		aoId)
 
 	err := leveldb.Delete(levelDBTrans, []byte(leveldb.KNameOfPasswordRSAPri(aoId)))
-	return err
+	if err != nil {
+		return err
+	}
+	return leveldb.Delete(levelDBTrans, []byte(leveldb.KNameOfPasswordRSAPriForClient(aoId)))
 }
 
 func updatePasswordKey(levelDBTrans *leveldb.Trans, aoId string, oldPassword string, newPassword string) error {
 	logger.AppLogger().Debugf("updatePasswordKey, aoId:%v",
 		aoId)
 
-	var err error
-	exist, err := leveldb.Has(levelDBTrans, []byte(leveldb.KNameOfPasswordRSAPri(aoId)))
-	if err != nil { // error
-		return err
-	}
-	if !exist {
-		return fmt.Errorf("key of %v not exist", leveldb.KNameOfPasswordRSAPri(aoId))
-	}
-
-	priKeyBytes, err := leveldb.Get(levelDBTrans, []byte(leveldb.KNameOfPasswordRSAPri(aoId)))
-	if err != nil { // error
-		logger.AppLogger().Debugf("updatePasswordKey, leveldb.Get:%v, err:%v",
-			leveldb.KNameOfPasswordRSAPri(aoId), err)
-		return err
-	}
-
-	decryptedPriKeyBytes, err := aesDecrypt(priKeyBytes, oldPassword)
-	if err != nil {
-		return err
-	}
-
-	pubKeyBytes, err := rsa.GetRsaPubKeyByPriKeyBytes(decryptedPriKeyBytes)
-	if err != nil {
-		logger.AppLogger().Debugf("updatePasswordKey, failed GetRsaPubKeyByPriKeyBytes, pubKeyBytes:%v, err:%v",
-			pubKeyBytes, err)
-		return err
-	}
-	logger.AppLogger().Debugf("updatePasswordKey, failed GetRsaPubKeyByPriKeyBytes, pubKeyBytes:%v",
-		pubKeyBytes)
-
-	encryptedPriKeyBytes, err := aesEncrypt(decryptedPriKeyBytes, newPassword)
-	if err != nil {
-		return err
-	}
-
-	err = leveldb.Put(levelDBTrans, []byte(leveldb.KNameOfPasswordRSAPri(aoId)), encryptedPriKeyBytes)
+	decryptedPriKeyBytes, _, err := unlockPasswordKey(levelDBTrans, aoId, oldPassword)
 	if err != nil {
 		return err
 	}
+	defer keystore.Zeroize(decryptedPriKeyBytes)
 
+	_, err = putPasswordKey(levelDBTrans, aoId, decryptedPriKeyBytes, newPassword)
 	return err
 }
 
@@ -325,6 +416,13 @@ func saveDidDoc(levelDBTrans *leveldb.Trans, did string, doc []byte) error {
 	logger.AppLogger().Debugf("saveDidDoc, did:%v",
 		did)
 
+	// 先追加版本记录, 覆盖当前文档之前保留上一版本.
+	if _, err := saveDidDocVersion(levelDBTrans, did, doc, false, time.Now()); err != nil {
+		logger.AppLogger().Debugf("saveDidDoc, saveDidDocVersion:%v, err:%v",
+			leveldb.KNameOfDidDocMeta(did), err)
+		return err
+	}
+
 	err := leveldb.Put(levelDBTrans, []byte(leveldb.KNameOfDidDoc(did)), doc)
 	if err != nil {
 		logger.AppLogger().Debugf("saveDidDoc, leveldb.Put:%v, err:%v",
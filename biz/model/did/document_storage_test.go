@@ -0,0 +1,151 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package did
+
+import (
+	"agent/biz/model/did/leveldb"
+	"agent/deps/did/aospace/rsa"
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/dungeonsnd/gocom/encrypt/aes"
+	"github.com/dungeonsnd/gocom/encrypt/random"
+)
+
+func passwordKeyVersion(t *testing.T, aoId string) uint32 {
+	b, err := leveldb.Get(nil, []byte(leveldb.KNameOfPasswordRSAPri(aoId)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return binary.BigEndian.Uint32(b[:passwordKeyVersionLen])
+}
+
+// legacyAesEncrypt 按旧格式加密, 用于构造升级前的数据.
+func legacyAesEncrypt(t *testing.T, origData []byte, password string) []byte {
+	iv := random.Random(passwordKeyIVLen)
+	encbuf, err := aes.AesEncryptByPkcs5Padding(origData, aesDerivedKey(password), iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encData := make([]byte, passwordKeyVersionLen)
+	encData = append(encData, iv...)
+	return append(encData, encbuf...)
+}
+
+func hasLegacyClientKey(t *testing.T, aoId string) bool {
+	exist, err := leveldb.Has(nil, []byte(leveldb.KNameOfPasswordRSAPriForClient(aoId)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return exist
+}
+
+// 只保存最新格式的密码私钥, 客户端收到的 encryptedPriKeyBytes 即保存的密文, 之前版本留下的旧格式副本写入时删除.
+func TestPasswordKeyForClient(t *testing.T) {
+	openTestDB(t)
+	createTestDocument(t, "aoid-1", "123456")
+
+	if v := passwordKeyVersion(t, "aoid-1"); v != passwordKeyVersion1 {
+		t.Fatalf("stored password key version %v", v)
+	}
+	if hasLegacyClientKey(t, "aoid-1") {
+		t.Fatal("legacy client key written")
+	}
+	clientKey, found, err := GetEncryptedPriKeyBytes(nil, "aoid-1")
+	if err != nil || !found {
+		t.Fatalf("GetEncryptedPriKeyBytes, found:%v, err:%v", found, err)
+	}
+	priKeyBytes, legacy, err := unwrapPasswordKey(clientKey, "123456")
+	if err != nil || legacy {
+		t.Fatalf("unwrapPasswordKey, legacy:%v, err:%v", legacy, err)
+	}
+	if _, err := rsa.GetRsaPubKeyByPriKeyBytes(priKeyBytes); err != nil {
+		t.Fatal(err)
+	}
+
+	// 修改密码时删除之前版本留下的旧格式副本
+	if err := leveldb.Put(nil, []byte(leveldb.KNameOfPasswordRSAPriForClient("aoid-1")),
+		legacyAesEncrypt(t, priKeyBytes, "123456")); err != nil {
+		t.Fatal(err)
+	}
+	if err := updatePasswordKey(nil, "aoid-1", "123456", "654321"); err != nil {
+		t.Fatal(err)
+	}
+	if hasLegacyClientKey(t, "aoid-1") {
+		t.Fatal("legacy client key not deleted after write")
+	}
+	clientKey, _, err = GetEncryptedPriKeyBytes(nil, "aoid-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	updated, _, err := unwrapPasswordKey(clientKey, "654321")
+	if err != nil || !bytes.Equal(updated, priKeyBytes) {
+		t.Fatalf("client key not updated, err:%v", err)
+	}
+}
+
+func TestVerifyPasswordKeyUpgradesLegacy(t *testing.T) {
+	openTestDB(t)
+	priKeyBytes, _, err := rsa.GenRsaKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacyKey := legacyAesEncrypt(t, priKeyBytes, "123456")
+	if err := leveldb.Put(nil, []byte(leveldb.KNameOfPasswordRSAPri("aoid-1")), legacyKey); err != nil {
+		t.Fatal(err)
+	}
+	if err := leveldb.Put(nil, []byte(leveldb.KNameOfPasswordRSAPriForClient("aoid-1")), legacyKey); err != nil {
+		t.Fatal(err)
+	}
+
+	// 升级前返回保存的旧格式数据
+	clientKey, found, err := GetEncryptedPriKeyBytes(nil, "aoid-1")
+	if err != nil || !found || !bytes.Equal(clientKey, legacyKey) {
+		t.Fatalf("GetEncryptedPriKeyBytes before upgrade, found:%v, err:%v", found, err)
+	}
+
+	// 密码错误时不升级
+	if err := VerifyPasswordKey(nil, "aoid-1", "wrong-password"); err == nil {
+		t.Fatal("wrong password verified")
+	}
+	if v := passwordKeyVersion(t, "aoid-1"); v != passwordKeyVersionLegacy {
+		t.Fatalf("upgraded with wrong password, version %v", v)
+	}
+	if !hasLegacyClientKey(t, "aoid-1") {
+		t.Fatal("legacy client key deleted with wrong password")
+	}
+
+	if err := VerifyPasswordKey(nil, "aoid-1", "123456"); err != nil {
+		t.Fatal(err)
+	}
+	if v := passwordKeyVersion(t, "aoid-1"); v != passwordKeyVersion1 {
+		t.Fatalf("not upgraded, version %v", v)
+	}
+	if hasLegacyClientKey(t, "aoid-1") {
+		t.Fatal("legacy client key not deleted after upgrade")
+	}
+	clientKey, _, err = GetEncryptedPriKeyBytes(nil, "aoid-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	decrypted, legacy, err := unwrapPasswordKey(clientKey, "123456")
+	if err != nil || legacy || !bytes.Equal(decrypted, priKeyBytes) {
+		t.Fatalf("client key after upgrade, legacy:%v, err:%v", legacy, err)
+	}
+	if err := VerifyPasswordKey(nil, "aoid-1", "123456"); err != nil {
+		t.Fatal(err)
+	}
+}
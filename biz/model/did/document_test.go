@@ -17,24 +17,61 @@ package did
 import (
 	"agent/biz/model/did/leveldb"
 	"agent/biz/model/dto/did/document"
+	"agent/config"
+	aospacedid "agent/deps/did/aospace/did"
+	"agent/deps/did/aospace/rsa"
+	cryptorsa "crypto/rsa"
 	"testing"
 )
 
-func TestCreateDocument(t *testing.T) {
+// openTestDB 在临时目录中打开 leveldb, 测试结束后关闭.
+func openTestDB(t *testing.T) {
+	rootPath := config.Config.Box.DID.RootPath
+	config.Config.Box.DID.RootPath = t.TempDir()
 	if err := leveldb.OpenDB(); err != nil {
-		panic(err)
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		leveldb.CloseDB()
+		config.Config.Box.DID.RootPath = rootPath
+	})
+}
+
+// createTestDocument 用新生成的客户端密钥(key-1)创建 aoId 的文档并保存索引, 返回 did 和客户端私钥.
+func createTestDocument(t *testing.T, aoId, password string) (string, *cryptorsa.PrivateKey) {
+	priKeyBytes, pubKeyBytes, err := rsa.GenRsaKey(2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	binderKey, err := rsa.GetPrivateKey(priKeyBytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ID := aospacedid.CalVerificationIdString(string(pubKeyBytes)) + "?credentialType=" + CredentialTypeBinder
+	verificationMethods := []*document.VerificationMethod{{ID: ID, Type: "RsaVerificationKey2018", PublicKeyPem: string(pubKeyBytes)}}
+	_, _, didStr, err := CreateDocument(nil, aoId, password, verificationMethods)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveAoIdToDid(nil, aoId, didStr); err != nil {
+		t.Fatal(err)
 	}
+	return stripDidURL(didStr), binderKey
+}
+
+func TestCreateDocument(t *testing.T) {
+	openTestDB(t)
 
 	t.Logf("\n$$$$ CreateDocument\n")
 	aoId := "aoId-1"
 	oldPassword := "123456"
 	newPassword := "111111"
-	ID := ":AAAHtMWCPnvz2q5ONvw="
 	keyType := "RsaVerificationKey2018"
 	publicKeyPemClient := "-----BEGIN PUBLIC KEY-----\nMIIBIjANBgkqhkiG9w0BAQEFAAOCAQ8AMIIBCgKCAQEAnN5jap7CGcqYURbLDVUa\nLc9kMxOyCMEykfwbQKXvTkPMkR9tKZmq8EqfG2d2OyUpF1TIfqHK7Q6d33yD02oO\nBTXZw1Ijkfxvu0KwG2zLV02FTuwZzgYa/AaP5iRZDx5GwTk/YFw+NTqT8Gf29a/L\n/ItcCfsEFLr3zMDXUcU9A7rBEy5ncva6RLNpXawegFGlCZa5+Gah8voKl8ZGpIgt\nlSc1IdnbPbBCYYlUATWLCLeYl+Q9/LslbpkFtdR+4M8vU7G1H+AQZ5fr2E9qX36I\nzcnchDmKq5bkbWQ9GJeZKqZTkhtCPBy4cphM8fHtZuoh1fA3VfF01N4KHT2bUdtp\nJwIDAQAB\n-----END PUBLIC KEY-----"
+	ID := aospacedid.CalVerificationIdString(publicKeyPemClient) + "?credentialType=" + CredentialTypeBinder
 	verificationMethod := &document.VerificationMethod{ID: ID, Type: keyType, PublicKeyPem: publicKeyPemClient}
 	verificationMethods := []*document.VerificationMethod{verificationMethod}
-	_, didDocBytes, did, err := CreateDocument(aoId, oldPassword, verificationMethods)
+	_, didDocBytes, did, err := CreateDocument(nil, aoId, oldPassword, verificationMethods)
 	if err != nil {
 		panic(err)
 	}
@@ -43,13 +80,13 @@ func TestCreateDocument(t *testing.T) {
 	t.Logf("\ndid:%+v\n", did)
 
 	t.Logf("\n$$$$ UpdateDocumentOfPasswordVerficationByDid\n")
-	err = UpdatePasswordKey(did, aoId, oldPassword, newPassword)
+	err = UpdatePasswordKey(nil, did, aoId, oldPassword, newPassword)
 	if err != nil {
 		panic(err)
 	}
 
 	t.Logf("\n$$$$ GetDocumentFromFile\n")
-	didDocBytes, err = GetDocumentFromFile(did)
+	didDocBytes, err = GetDocumentFromFile(nil, aoId, did)
 	if err != nil {
 		panic(err)
 	}
@@ -0,0 +1,282 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package did
+
+import (
+	"agent/biz/model/did/leveldb"
+	aospacedid "agent/deps/did/aospace/did"
+	"agent/utils/logger"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gibson042/canonicaljson-go"
+)
+
+var ErrDocumentDeactivated = errors.New("did document deactivated")
+
+// DocumentVersion DID 文档的一个历史版本. PreviousHash 为上一版本文档的 SHA256, 各版本形成哈希链.
+type DocumentVersion struct {
+	VersionId    string `json:"versionId"`
+	VersionTime  string `json:"versionTime,omitempty"` // 升级前保存的文档没有时间
+	PreviousHash string `json:"previousHash,omitempty"`
+	Hash         string `json:"hash"`
+	Deactivated  bool   `json:"deactivated,omitempty"`
+	Document     []byte `json:"document"`
+}
+
+func docHash(doc []byte) string {
+	sum := sha256.Sum256(doc)
+	return hex.EncodeToString(sum[:])
+}
+
+// saveDidDocVersion 保存文档之前追加版本记录并更新元数据. 已注销的文档不能再更新.
+func saveDidDocVersion(levelDBTrans *leveldb.Trans, did string, doc []byte, deactivated bool, now time.Time) (*DocumentMetadata, error) {
+	meta, found, err := getDidDocMeta(levelDBTrans, did)
+	if err != nil {
+		return nil, err
+	}
+	if found && meta.Deactivated {
+		return nil, ErrDocumentDeactivated
+	}
+
+	timeNow := now.UTC().Format(time.RFC3339)
+	if !found {
+		meta = &DocumentMetadata{Created: timeNow}
+
+		// 升级前保存的文档没有版本记录, 作为第一个版本保留, 创建时间未知.
+		legacy, exist, err := getLegacyDidDoc(levelDBTrans, did)
+		if err != nil {
+			return nil, err
+		}
+		if exist {
+			v := &DocumentVersion{VersionId: "1", Hash: docHash(legacy), Document: legacy}
+			if err := putDidDocVersion(levelDBTrans, did, 1, v); err != nil {
+				return nil, err
+			}
+			meta = &DocumentMetadata{VersionId: v.VersionId, Hash: v.Hash}
+		}
+	}
+
+	versionId, _ := strconv.ParseUint(meta.VersionId, 10, 64)
+	versionId++
+	v := &DocumentVersion{
+		VersionId:    strconv.FormatUint(versionId, 10),
+		VersionTime:  timeNow,
+		PreviousHash: meta.Hash,
+		Hash:         docHash(doc),
+		Deactivated:  deactivated,
+		Document:     doc,
+	}
+	if err := putDidDocVersion(levelDBTrans, did, versionId, v); err != nil {
+		return nil, err
+	}
+
+	if versionId > 1 {
+		meta.Updated = timeNow
+	}
+	meta.VersionId = v.VersionId
+	meta.Hash = v.Hash
+	meta.Deactivated = deactivated
+	if err := putDidDocMeta(levelDBTrans, did, meta); err != nil {
+		return nil, err
+	}
+	return meta, nil
+}
+
+func getLegacyDidDoc(levelDBTrans *leveldb.Trans, did string) ([]byte, bool, error) {
+	exist, err := leveldb.Has(levelDBTrans, []byte(leveldb.KNameOfDidDoc(did)))
+	if err != nil || !exist {
+		return nil, false, err
+	}
+	doc, err := leveldb.Get(levelDBTrans, []byte(leveldb.KNameOfDidDoc(did)))
+	return doc, err == nil, err
+}
+
+func putDidDocVersion(levelDBTrans *leveldb.Trans, did string, versionId uint64, v *DocumentVersion) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return leveldb.Put(levelDBTrans, []byte(leveldb.KNameOfDidDocVersion(did, versionId)), b)
+}
+
+func getDidDocVersion(levelDBTrans *leveldb.Trans, did string, versionId uint64) (*DocumentVersion, bool, error) {
+	key := []byte(leveldb.KNameOfDidDocVersion(did, versionId))
+	exist, err := leveldb.Has(levelDBTrans, key)
+	if err != nil || !exist {
+		return nil, false, err
+	}
+	b, err := leveldb.Get(levelDBTrans, key)
+	if err != nil {
+		return nil, false, err
+	}
+	v := &DocumentVersion{}
+	if err := json.Unmarshal(b, v); err != nil {
+		return nil, false, fmt.Errorf("failed to parse version %v of %v, err:%v", versionId, did, err)
+	}
+	return v, true, nil
+}
+
+// ListDocumentVersions 按版本顺序返回文档的所有历史版本.
+func ListDocumentVersions(levelDBTrans *leveldb.Trans, did string) ([]*DocumentVersion, error) {
+	versions := make([]*DocumentVersion, 0)
+	var parseErr error
+	err := leveldb.Iterate(levelDBTrans, []byte(leveldb.KNamePrefixOfDidDocVersion(did)), func(key, value []byte) bool {
+		v := &DocumentVersion{}
+		if parseErr = json.Unmarshal(value, v); parseErr != nil {
+			parseErr = fmt.Errorf("failed to parse %v, err:%v", string(key), parseErr)
+			return false
+		}
+		versions = append(versions, v)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return versions, parseErr
+}
+
+// VerifyDocumentVersions 校验历史版本的哈希链和当前文档.
+func VerifyDocumentVersions(levelDBTrans *leveldb.Trans, did string) error {
+	versions, err := ListDocumentVersions(levelDBTrans, did)
+	if err != nil {
+		return err
+	}
+	if len(versions) < 1 {
+		return nil
+	}
+	doc, err := getDidDoc(levelDBTrans, did)
+	if err != nil {
+		return err
+	}
+	return verifyVersionChain(did, versions, doc)
+}
+
+func verifyVersionChain(did string, versions []*DocumentVersion, currentDoc []byte) error {
+	previousHash := ""
+	for i, v := range versions {
+		if v.VersionId != strconv.Itoa(i+1) {
+			return fmt.Errorf("version %v of %v missing", i+1, did)
+		}
+		if v.Hash != docHash(v.Document) {
+			return fmt.Errorf("hash mismatch at version %v of %v", v.VersionId, did)
+		}
+		if v.PreviousHash != previousHash {
+			return fmt.Errorf("previous hash mismatch at version %v of %v", v.VersionId, did)
+		}
+		previousHash = v.Hash
+	}
+	if docHash(currentDoc) != previousHash {
+		return fmt.Errorf("current document of %v does not match latest version", did)
+	}
+	return nil
+}
+
+// DeactivateDocument 注销 DID(删除用户或重置设备时调用). 当前文档替换为只有 id 的墓碑文档并作为新版本保存,
+// 历史版本保留用于解析. 同时删除该用户的空间密钥、密码密钥和 aoId 索引. 重复调用直接返回墓碑文档.
+func DeactivateDocument(levelDBTrans *leveldb.Trans, didStr, aoId string) ([]byte, string, error) {
+	logger.AppLogger().Debugf("DeactivateDocument, didStr:%v, aoId:%v", didStr, aoId)
+
+	if len(aoId) < 1 && len(didStr) < 1 {
+		return nil, "", fmt.Errorf("did(%v) and aoId(%v) can't both be empty", didStr, aoId)
+	}
+	if len(aoId) < 1 {
+		aoIdFound, found, err := GetAoIdByDid(levelDBTrans, didStr)
+		if err != nil {
+			return nil, "", err
+		}
+		if !found {
+			return nil, "", fmt.Errorf("aoId not found by did(%v)", didStr)
+		}
+		aoId = aoIdFound
+	}
+	if len(didStr) < 1 {
+		didStrFound, found, err := GetDidByAoId(levelDBTrans, aoId)
+		if err != nil {
+			return nil, "", err
+		}
+		if !found {
+			return nil, "", fmt.Errorf("did not found by aoId(%v)", aoId)
+		}
+		didStr = didStrFound
+	}
+	if i := strings.IndexAny(didStr, "?#"); i > 0 {
+		didStr = didStr[:i]
+	}
+
+	doc, err := getDidDoc(levelDBTrans, didStr)
+	if err != nil {
+		return nil, "", err
+	}
+	meta, found, err := getDidDocMeta(levelDBTrans, didStr)
+	if err != nil {
+		return nil, "", err
+	}
+	if found && meta.Deactivated {
+		return doc, didStr, nil
+	}
+
+	didDoc := &aospacedid.Document{}
+	if err := json.Unmarshal(doc, didDoc); err != nil {
+		return nil, "", err
+	}
+	tombstone, err := canonicaljson.Marshal(&aospacedid.Document{Context: didDoc.Context, Subject: didDoc.Subject})
+	if err != nil {
+		return nil, "", fmt.Errorf("MarshalIndent err:%v", err)
+	}
+	if _, err := saveDidDocVersion(levelDBTrans, didStr, tombstone, true, time.Now()); err != nil {
+		return nil, "", err
+	}
+	if err := leveldb.Put(levelDBTrans, []byte(leveldb.KNameOfDidDoc(didStr)), tombstone); err != nil {
+		return nil, "", err
+	}
+
+	for _, key := range []string{
+		leveldb.KNameOfSpaceRSAPri(aoId),
+		leveldb.KNameOfSpaceRSAPriPrevious(aoId),
+		leveldb.KNameOfPasswordRSAPri(aoId),
+		leveldb.KNameOfPasswordRSAPriForClient(aoId),
+		leveldb.KNameOfAoIdToDid(aoId),
+	} {
+		if err := leveldb.Delete(levelDBTrans, []byte(key)); err != nil {
+			return nil, "", fmt.Errorf("failed to delete %v, err:%v", key, err)
+		}
+	}
+	logger.AppLogger().Infof("DeactivateDocument, %v of %v deactivated", didStr, aoId)
+	return tombstone, didStr, nil
+}
+
+// DeactivateAllDocuments 注销所有 DID, 重置设备时调用.
+func DeactivateAllDocuments(levelDBTrans *leveldb.Trans) ([]string, error) {
+	aoIds, err := ListAoIds(levelDBTrans)
+	if err != nil {
+		return nil, err
+	}
+	dids := make([]string, 0, len(aoIds))
+	for _, aoId := range aoIds {
+		_, didStr, err := DeactivateDocument(levelDBTrans, "", aoId)
+		if err != nil {
+			return dids, fmt.Errorf("failed to deactivate did of %v, err:%v", aoId, err)
+		}
+		dids = append(dids, didStr)
+	}
+	return dids, nil
+}
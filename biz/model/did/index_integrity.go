@@ -0,0 +1,91 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package did
+
+import (
+	"agent/biz/model/did/leveldb"
+	"agent/utils/logger"
+	"strings"
+	"time"
+)
+
+type indexEntry struct {
+	key   string
+	value string
+}
+
+// CheckIndexIntegrity 检查 aoid->did 和 did->aoid 索引是否互相对应, 返回孤立的索引项.
+// 注销的文档只删除 aoid->did, 其 did->aoid 不视为孤立.
+func CheckIndexIntegrity(levelDBTrans *leveldb.Trans) (*leveldb.IntegrityReport, error) {
+	report := &leveldb.IntegrityReport{CheckedAt: time.Now().UTC().Format(time.RFC3339),
+		OrphanedAoIdToDid: make([]string, 0), OrphanedDidToAoId: make([]string, 0)}
+
+	aoIdToDid, err := listIndexEntries(levelDBTrans, leveldb.KNamePrefixOfAoIdToDid())
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range aoIdToDid {
+		aoId, didStr := e.key, e.value
+		backAoId, found, err := GetAoIdByDid(levelDBTrans, didStr)
+		if err != nil {
+			return nil, err
+		}
+		docFound, err := leveldb.Has(levelDBTrans, []byte(leveldb.KNameOfDidDoc(didStr)))
+		if err != nil {
+			return nil, err
+		}
+		if !found || backAoId != aoId || !docFound {
+			report.OrphanedAoIdToDid = append(report.OrphanedAoIdToDid, aoId+"->"+didStr)
+		}
+	}
+
+	didToAoId, err := listIndexEntries(levelDBTrans, leveldb.KNamePrefixOfDidToAoId())
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range didToAoId {
+		didStr, aoId := e.key, e.value
+		backDid, found, err := GetDidByAoId(levelDBTrans, aoId)
+		if err != nil {
+			return nil, err
+		}
+		if found && backDid == didStr {
+			continue
+		}
+		meta, metaFound, err := getDidDocMeta(levelDBTrans, didStr)
+		if err != nil {
+			return nil, err
+		}
+		if metaFound && meta.Deactivated {
+			continue
+		}
+		report.OrphanedDidToAoId = append(report.OrphanedDidToAoId, didStr+"->"+aoId)
+	}
+
+	if len(report.OrphanedAoIdToDid) > 0 || len(report.OrphanedDidToAoId) > 0 {
+		logger.AppLogger().Warnf("CheckIndexIntegrity, orphaned aoid->did:%v, orphaned did->aoid:%v",
+			report.OrphanedAoIdToDid, report.OrphanedDidToAoId)
+	}
+	return report, nil
+}
+
+func listIndexEntries(levelDBTrans *leveldb.Trans, prefix string) ([]indexEntry, error) {
+	entries := make([]indexEntry, 0)
+	err := leveldb.Iterate(levelDBTrans, []byte(prefix), func(key, value []byte) bool {
+		entries = append(entries, indexEntry{key: strings.TrimPrefix(string(key), prefix), value: string(value)})
+		return true
+	})
+	return entries, err
+}
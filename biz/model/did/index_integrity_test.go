@@ -0,0 +1,56 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package did
+
+import (
+	"agent/biz/model/did/leveldb"
+	"testing"
+)
+
+func TestCheckIndexIntegrity(t *testing.T) {
+	openTestDB(t)
+	createTestDocument(t, "aoid-1", "123456")
+	deactivatedDid, _ := createTestDocument(t, "aoid-2", "123456")
+	if _, _, err := DeactivateDocument(nil, "", "aoid-2"); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := CheckIndexIntegrity(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.OrphanedAoIdToDid) != 0 || len(report.OrphanedDidToAoId) != 0 {
+		t.Fatalf("unexpected orphaned index %+v", report)
+	}
+
+	// aoid->did 指向不存在的文档, did->aoid 指向没有反向索引的 aoId
+	if err := leveldb.Put(nil, []byte(leveldb.KNameOfAoIdToDid("aoid-3")), []byte("did:aospace:missing")); err != nil {
+		t.Fatal(err)
+	}
+	if err := leveldb.Put(nil, []byte(leveldb.KNameOfDidToAoId("did:aospace:orphan")), []byte("aoid-4")); err != nil {
+		t.Fatal(err)
+	}
+	report, err = CheckIndexIntegrity(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.OrphanedAoIdToDid) != 1 || report.OrphanedAoIdToDid[0] != "aoid-3->did:aospace:missing" {
+		t.Fatalf("unexpected orphaned aoid->did %v", report.OrphanedAoIdToDid)
+	}
+	// 注销文档的 did->aoid 不视为孤立
+	if len(report.OrphanedDidToAoId) != 1 || report.OrphanedDidToAoId[0] != "did:aospace:orphan->aoid-4" {
+		t.Fatalf("unexpected orphaned did->aoid %v, deactivated:%v", report.OrphanedDidToAoId, deactivatedDid)
+	}
+}
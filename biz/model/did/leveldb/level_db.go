@@ -20,6 +20,7 @@ import (
 	"fmt"
 
 	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/errors"
 )
 
 var ldb *leveldb.DB
@@ -29,10 +30,17 @@ func OpenDB() error {
 		config.Config.Box.DID.DBFileName)
 	var err error
 	ldb, err = leveldb.OpenFile(f, nil)
+	if err != nil && errors.IsCorrupted(err) && config.Config.Box.DID.AutoRecover {
+		logger.AppLogger().Errorf("OpenDB, file:%+v corrupted, err:%+v, try to recover", f, err)
+		ldb, err = leveldb.RecoverFile(f, nil)
+		setRecoverResult(err)
+	}
 	if err != nil {
 		logger.AppLogger().Warnf("OpenDB, file:%+v, err:%+v", f, err)
+		return err
 	}
-	return err
+	setOpened()
+	return nil
 }
 
 func CloseDB() {
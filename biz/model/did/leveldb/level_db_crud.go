@@ -16,6 +16,9 @@ package leveldb
 
 import (
 	"agent/utils/logger"
+
+	"github.com/syndtr/goleveldb/leveldb/iterator"
+	"github.com/syndtr/goleveldb/leveldb/util"
 )
 
 func Put(levelDBTrans *Trans, key, value []byte) error {
@@ -64,3 +67,21 @@ func Delete(levelDBTrans *Trans, key []byte) error {
 		string(key), err)
 	return err
 }
+
+// Iterate 按 key 前缀遍历, fn 返回 false 时停止遍历.
+func Iterate(levelDBTrans *Trans, prefix []byte, fn func(key, value []byte) bool) error {
+	logger.LevelDBLogger().Debugf("leveldb.Iterate, prefix:%v", string(prefix))
+	var iter iterator.Iterator
+	if levelDBTrans != nil {
+		iter = levelDBTrans.Transaction.NewIterator(util.BytesPrefix(prefix), nil)
+	} else {
+		iter = ldb.NewIterator(util.BytesPrefix(prefix), nil)
+	}
+	defer iter.Release()
+	for iter.Next() {
+		if !fn(iter.Key(), iter.Value()) {
+			break
+		}
+	}
+	return iter.Error()
+}
@@ -0,0 +1,239 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leveldb
+
+import (
+	"agent/utils/logger"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+	"github.com/syndtr/goleveldb/leveldb/opt"
+	"github.com/syndtr/goleveldb/leveldb/util"
+)
+
+const (
+	backupNamePrefix = "did-"
+	backupNameSuffix = ".leveldb"
+	backupBatchSize  = 1000
+)
+
+// MaintenanceStatus 数据库维护状态, 通过 /agent/info 返回.
+type MaintenanceStatus struct {
+	OpenedAt     string `json:"openedAt,omitempty"`
+	Recovered    bool   `json:"recovered"`              // 打开时是否因 manifest 损坏执行过 leveldb.Recover
+	RecoverError string `json:"recoverError,omitempty"` // leveldb.Recover 失败原因
+
+	LastCompactionAt string `json:"lastCompactionAt,omitempty"`
+	CompactionError  string `json:"compactionError,omitempty"`
+
+	LastBackupAt   string `json:"lastBackupAt,omitempty"`
+	LastBackupPath string `json:"lastBackupPath,omitempty"`
+	LastBackupKeys int    `json:"lastBackupKeys,omitempty"`
+	BackupError    string `json:"backupError,omitempty"`
+
+	Integrity *IntegrityReport `json:"integrity,omitempty"`
+}
+
+// IntegrityReport 索引完整性检查结果. 只报告, 不自动修复.
+type IntegrityReport struct {
+	CheckedAt         string   `json:"checkedAt"`
+	OrphanedAoIdToDid []string `json:"orphanedAoIdToDid"` // aoid->did 没有对应的 did->aoid 或文档, 格式 "aoId->did"
+	OrphanedDidToAoId []string `json:"orphanedDidToAoId"` // did->aoid 没有对应的 aoid->did 且文档未注销, 格式 "did->aoId"
+	Error             string   `json:"error,omitempty"`
+}
+
+var (
+	maintenanceMu     sync.Mutex
+	maintenanceStatus MaintenanceStatus
+)
+
+// GetMaintenanceStatus 返回维护状态的副本.
+func GetMaintenanceStatus() *MaintenanceStatus {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+	status := maintenanceStatus
+	if maintenanceStatus.Integrity != nil {
+		integrity := *maintenanceStatus.Integrity
+		status.Integrity = &integrity
+	}
+	return &status
+}
+
+// SetIntegrityReport 记录最近一次完整性检查结果.
+func SetIntegrityReport(report *IntegrityReport) {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+	maintenanceStatus.Integrity = report
+}
+
+func setOpened() {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+	maintenanceStatus.OpenedAt = time.Now().UTC().Format(time.RFC3339)
+}
+
+func setRecoverResult(err error) {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+	maintenanceStatus.Recovered = err == nil
+	maintenanceStatus.RecoverError = errString(err)
+}
+
+// Compact 压缩整个 key 范围. 压缩期间会等待正在进行的事务结束.
+func Compact() error {
+	if ldb == nil {
+		return fmt.Errorf("leveldb not opened")
+	}
+	start := time.Now()
+	err := ldb.CompactRange(util.Range{})
+	if err != nil {
+		logger.AppLogger().Warnf("leveldb Compact, err:%v", err)
+	} else {
+		logger.AppLogger().Infof("leveldb Compact, cost:%v", time.Since(start))
+	}
+
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+	maintenanceStatus.LastCompactionAt = start.UTC().Format(time.RFC3339)
+	maintenanceStatus.CompactionError = errString(err)
+	return err
+}
+
+// Backup 基于快照在线备份到 dir 下新的子目录, 只保留最新的 keep 个备份. 返回备份路径.
+// 备份本身是一个完整的 leveldb 数据库, 替换 DBFileName 即可恢复.
+func Backup(dir string, keep int) (string, error) {
+	start := time.Now()
+	path, count, err := backup(dir, start)
+	if err == nil {
+		err = rotateBackups(dir, keep)
+	}
+	if err != nil {
+		logger.AppLogger().Warnf("leveldb Backup, dir:%v, err:%v", dir, err)
+	} else {
+		logger.AppLogger().Infof("leveldb Backup, path:%v, keys:%v, cost:%v", path, count, time.Since(start))
+	}
+
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+	maintenanceStatus.BackupError = errString(err)
+	if len(path) > 0 {
+		maintenanceStatus.LastBackupAt = start.UTC().Format(time.RFC3339)
+		maintenanceStatus.LastBackupPath = path
+		maintenanceStatus.LastBackupKeys = count
+	}
+	return path, err
+}
+
+func backup(dir string, now time.Time) (string, int, error) {
+	if ldb == nil {
+		return "", 0, fmt.Errorf("leveldb not opened")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", 0, fmt.Errorf("failed to create %v, err:%v", dir, err)
+	}
+	snapshot, err := ldb.GetSnapshot()
+	if err != nil {
+		return "", 0, fmt.Errorf("GetSnapshot err:%v", err)
+	}
+	defer snapshot.Release()
+
+	// 先写入临时目录, 完成后再改名, 避免留下不完整的备份.
+	path := filepath.Join(dir, backupNamePrefix+now.UTC().Format("20060102T150405.000Z")+backupNameSuffix)
+	tmpPath := path + ".tmp"
+	if err := os.RemoveAll(tmpPath); err != nil {
+		return "", 0, err
+	}
+	bdb, err := leveldb.OpenFile(tmpPath, &opt.Options{ErrorIfExist: true})
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to open %v, err:%v", tmpPath, err)
+	}
+
+	count, err := copySnapshot(snapshot, bdb)
+	if err1 := bdb.Close(); err == nil && err1 != nil {
+		err = fmt.Errorf("failed to close %v, err:%v", tmpPath, err1)
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.RemoveAll(tmpPath)
+		return "", 0, err
+	}
+	return path, count, nil
+}
+
+func copySnapshot(snapshot *leveldb.Snapshot, bdb *leveldb.DB) (int, error) {
+	iter := snapshot.NewIterator(nil, nil)
+	defer iter.Release()
+
+	count := 0
+	batch := new(leveldb.Batch)
+	for iter.Next() {
+		batch.Put(iter.Key(), iter.Value())
+		count++
+		if batch.Len() >= backupBatchSize {
+			if err := bdb.Write(batch, nil); err != nil {
+				return 0, fmt.Errorf("failed to write backup, err:%v", err)
+			}
+			batch.Reset()
+		}
+	}
+	if err := iter.Error(); err != nil {
+		return 0, fmt.Errorf("failed to iterate snapshot, err:%v", err)
+	}
+	if err := bdb.Write(batch, &opt.WriteOptions{Sync: true}); err != nil {
+		return 0, fmt.Errorf("failed to write backup, err:%v", err)
+	}
+	return count, nil
+}
+
+// rotateBackups 删除 dir 下较旧的备份, 只保留最新的 keep 个. keep 小于 1 时不删除.
+func rotateBackups(dir string, keep int) error {
+	if keep < 1 {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0)
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), backupNamePrefix) &&
+			strings.HasSuffix(entry.Name(), backupNameSuffix) {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names) // 名称中的时间戳保证按时间排序
+	for i := 0; i < len(names)-keep; i++ {
+		if err := os.RemoveAll(filepath.Join(dir, names[i])); err != nil {
+			return fmt.Errorf("failed to remove old backup %v, err:%v", names[i], err)
+		}
+		logger.AppLogger().Infof("leveldb Backup, removed old backup %v", names[i])
+	}
+	return nil
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
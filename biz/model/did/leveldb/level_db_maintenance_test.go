@@ -0,0 +1,126 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package leveldb
+
+import (
+	"agent/config"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/syndtr/goleveldb/leveldb"
+)
+
+func openTestDB(t *testing.T) {
+	rootPath := config.Config.Box.DID.RootPath
+	config.Config.Box.DID.RootPath = t.TempDir()
+	if err := OpenDB(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		CloseDB()
+		config.Config.Box.DID.RootPath = rootPath
+	})
+}
+
+func listBackups(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0)
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestBackup(t *testing.T) {
+	openTestDB(t)
+	dir := t.TempDir()
+	if err := Put(nil, []byte("k1"), []byte("v1")); err != nil {
+		t.Fatal(err)
+	}
+
+	path, err := Backup(dir, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status := GetMaintenanceStatus(); status.LastBackupPath != path || status.LastBackupKeys != 1 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+
+	// 备份之后的写入不影响备份内容
+	if err := Put(nil, []byte("k2"), []byte("v2")); err != nil {
+		t.Fatal(err)
+	}
+	bdb, err := leveldb.OpenFile(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bdb.Close()
+	if v, err := bdb.Get([]byte("k1"), nil); err != nil || string(v) != "v1" {
+		t.Fatalf("k1 in backup, v:%s, err:%v", v, err)
+	}
+	if _, err := bdb.Get([]byte("k2"), nil); err != leveldb.ErrNotFound {
+		t.Fatalf("k2 in backup, err:%v", err)
+	}
+}
+
+func TestRotateBackups(t *testing.T) {
+	openTestDB(t)
+	dir := t.TempDir()
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	paths := make([]string, 0)
+	for i := 0; i < 4; i++ {
+		path, _, err := backup(dir, start.Add(time.Duration(i)*time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths = append(paths, filepath.Base(path))
+	}
+	// 不是备份的文件和目录不会被删除
+	if err := os.WriteFile(filepath.Join(dir, "other"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(filepath.Join(dir, "did-other"), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := rotateBackups(dir, 0); err != nil {
+		t.Fatal(err)
+	}
+	if names := listBackups(t, dir); len(names) != 6 {
+		t.Fatalf("keep 0 removed backups: %v", names)
+	}
+
+	if err := rotateBackups(dir, 2); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"did-other", paths[2], paths[3], "other"}
+	sort.Strings(want)
+	names := listBackups(t, dir)
+	if len(names) != len(want) {
+		t.Fatalf("got %v, want %v", names, want)
+	}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Fatalf("got %v, want %v", names, want)
+		}
+	}
+}
@@ -14,6 +14,8 @@
 
 package leveldb
 
+import "fmt"
+
 const (
 	// 大类
 	prefixPriKey = "key"
@@ -24,16 +26,47 @@ const (
 func KNameOfSpaceRSAPri(aoId string) string {
 	return prefixPriKey + "--space_rsa_pri--" + aoId
 }
+func KNameOfSpaceRSAPriPrevious(aoId string) string {
+	return prefixPriKey + "--space_rsa_pri_previous--" + aoId
+}
 func KNameOfPasswordRSAPri(aoId string) string {
 	return prefixPriKey + "--password_rsa_pri--" + aoId
 }
+
+// KNameOfPasswordRSAPriForClient 之前版本保存的旧格式客户端副本, 只用于删除.
+func KNameOfPasswordRSAPriForClient(aoId string) string {
+	return prefixPriKey + "--password_rsa_pri_client--" + aoId
+}
 func KNameOfDidDoc(did string) string {
 	return prefixDidDoc + "--did_doc--" + did
 }
+func KNameOfDidDocMeta(did string) string {
+	return prefixDidDoc + "--did_doc_meta--" + did
+}
+
+// KNameOfDidDocVersion versionId 补零到固定长度, 按 key 遍历时即为版本顺序.
+func KNameOfDidDocVersion(did string, versionId uint64) string {
+	return KNamePrefixOfDidDocVersion(did) + fmt.Sprintf("%020d", versionId)
+}
+func KNamePrefixOfDidDocVersion(did string) string {
+	return prefixDidDoc + "--did_doc_version--" + did + "--"
+}
+func KNameOfDidDocProposal(id string) string {
+	return KNamePrefixOfDidDocProposal() + id
+}
+func KNamePrefixOfDidDocProposal() string {
+	return prefixDidDoc + "--did_doc_proposal--"
+}
 
 func KNameOfAoIdToDid(aoId string) string {
 	return prefixIndex + "--aoid_to_did--" + aoId
 }
+func KNamePrefixOfAoIdToDid() string {
+	return prefixIndex + "--aoid_to_did--"
+}
 func KNameOfDidToAoId(did string) string {
 	return prefixIndex + "--did_to_aoid--" + did
+}
+func KNamePrefixOfDidToAoId() string {
+	return prefixIndex + "--did_to_aoid--"
 }
\ No newline at end of file
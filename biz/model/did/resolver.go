@@ -0,0 +1,108 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package did
+
+import (
+	"agent/biz/model/did/leveldb"
+	"errors"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrDocumentNotFound = errors.New("did document not found")
+	ErrVersionNotFound  = errors.New("did document version not found")
+)
+
+// ResolveOptions 解析参数, 为空时解析当前版本.
+type ResolveOptions struct {
+	VersionId   string
+	VersionTime time.Time
+}
+
+// ResolveDocument 按 DID(不含 query、fragment)解析文档, 返回文档和元数据.
+// 指定 VersionId 或 VersionTime 时从历史版本中查找. 旧版本创建且未更新过的文档没有版本记录, 只能解析当前版本.
+func ResolveDocument(levelDBTrans *leveldb.Trans, didStr string, opts *ResolveOptions) ([]byte, *DocumentMetadata, error) {
+	exist, err := leveldb.Has(levelDBTrans, []byte(leveldb.KNameOfDidDoc(didStr)))
+	if err != nil {
+		return nil, nil, err
+	}
+	if !exist {
+		return nil, nil, ErrDocumentNotFound
+	}
+	meta, found, err := getDidDocMeta(levelDBTrans, didStr)
+	if err != nil {
+		return nil, nil, err
+	}
+	byVersion := opts != nil && (len(opts.VersionId) > 0 || !opts.VersionTime.IsZero())
+	if !byVersion || !found {
+		if byVersion {
+			return nil, nil, ErrVersionNotFound
+		}
+		if !found {
+			meta = &DocumentMetadata{}
+		}
+		doc, err := getDidDoc(levelDBTrans, didStr)
+		if err != nil {
+			return nil, nil, err
+		}
+		return doc, meta, nil
+	}
+
+	var v *DocumentVersion
+	if len(opts.VersionId) > 0 {
+		versionId, err := strconv.ParseUint(opts.VersionId, 10, 64)
+		if err != nil {
+			return nil, nil, ErrVersionNotFound
+		}
+		if v, exist, err = getDidDocVersion(levelDBTrans, didStr, versionId); err != nil {
+			return nil, nil, err
+		}
+		if !exist {
+			return nil, nil, ErrVersionNotFound
+		}
+	} else {
+		versions, err := ListDocumentVersions(levelDBTrans, didStr)
+		if err != nil {
+			return nil, nil, err
+		}
+		// 取 versionTime 之前最后一个版本. 升级前保存的版本没有时间, 视为一直有效.
+		for _, ver := range versions {
+			if t, err := time.Parse(time.RFC3339, ver.VersionTime); err == nil && t.After(opts.VersionTime) {
+				break
+			}
+			v = ver
+		}
+		if v == nil {
+			return nil, nil, ErrVersionNotFound
+		}
+	}
+
+	versionMeta := &DocumentMetadata{Created: meta.Created, VersionId: v.VersionId,
+		Deactivated: meta.Deactivated, Hash: v.Hash}
+	if v.VersionId != "1" {
+		versionMeta.Updated = v.VersionTime
+	}
+	versionId, _ := strconv.ParseUint(v.VersionId, 10, 64)
+	next, exist, err := getDidDocVersion(levelDBTrans, didStr, versionId+1)
+	if err != nil {
+		return nil, nil, err
+	}
+	if exist {
+		versionMeta.NextVersionId = next.VersionId
+		versionMeta.NextUpdate = next.VersionTime
+	}
+	return v.Document, versionMeta, nil
+}
@@ -0,0 +1,411 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package did
+
+import (
+	"agent/biz/model/did/leveldb"
+	"agent/biz/model/dto/did/document"
+	aospacedid "agent/deps/did/aospace/did"
+	"agent/deps/did/aospace/rsa"
+	"agent/utils/keystore"
+	"agent/utils/logger"
+	"crypto"
+	"crypto/rand"
+	cryptorsa "crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gibson042/canonicaljson-go"
+)
+
+const (
+	UpdateKindMethod       = "method"       // 重置密码验证方法(key-2)
+	UpdateKindPassword     = "password"     // 修改空间密码, 文档不变
+	UpdateKindDeviceMethod = "devicemethod" // 轮换设备验证方法(key-0)
+
+	updateProposalTTL = 10 * time.Minute
+)
+
+var (
+	ErrProposalNotFound   = errors.New("update proposal not found or expired")
+	ErrUnauthorizedUpdate = errors.New("update not authorized by capabilityInvocation")
+)
+
+// UpdateProposal 待授权的文档更新. 提议时在不提交的事务中计算出新文档和新的密码私钥,
+// 按 capabilityInvocation 中的多重签名条件校验通过后才写入.
+type UpdateProposal struct {
+	ID          string    `json:"id"`
+	Kind        string    `json:"kind"`
+	DID         string    `json:"did"` // 文档 id
+	AoId        string    `json:"aoId"`
+	BaseHash    string    `json:"baseHash"`    // 提议时当前文档的 SHA256, 文档在提交前被修改时提议失效
+	Document    []byte    `json:"document"`    // 提议的文档(规范化 JSON)
+	PasswordKey []byte    `json:"passwordKey"` // 提交时写入的密码私钥(由新密码加密)
+	ExpiresAt   time.Time `json:"expiresAt"`
+
+	SpaceKey         []byte `json:"spaceKey,omitempty"`         // devicemethod: 提交时写入的新空间私钥(加密保存的格式)
+	PreviousSpaceKey []byte `json:"previousSpaceKey,omitempty"` // devicemethod: 提交时写入的旧空间私钥
+}
+
+// SigningInput 返回待签名数据, 即 {"challenge":<提议 id>,"document":<提议的文档>} 的规范化 JSON.
+// 提议 id 只能使用一次, 避免签名被重放到之后内容相同的提议(例如修改密码).
+func (p *UpdateProposal) SigningInput() ([]byte, error) {
+	var doc interface{}
+	if err := json.Unmarshal(p.Document, &doc); err != nil {
+		return nil, err
+	}
+	return canonicaljson.Marshal(map[string]interface{}{"challenge": p.ID, "document": doc})
+}
+
+// ProposeMethodReset 生成重置密码验证方法的提议. 计算过程会写入 levelDBTrans, 调用方需要回滚该事务,
+// 再用 SaveUpdateProposal 保存提议.
+func ProposeMethodReset(levelDBTrans *leveldb.Trans, didStr, aoId, newPassword string) (*UpdateProposal, error) {
+	didStr, aoId, baseDoc, err := loadUpdateBase(levelDBTrans, didStr, aoId)
+	if err != nil {
+		return nil, err
+	}
+	doc, subject, err := ResetPasswordVerficationMethod(levelDBTrans, didStr, aoId, newPassword)
+	if err != nil {
+		return nil, err
+	}
+	return newUpdateProposal(levelDBTrans, UpdateKindMethod, subject, aoId, baseDoc, doc)
+}
+
+// ProposePasswordUpdate 生成修改空间密码的提议, 提议的文档即当前文档. 调用方需要回滚 levelDBTrans.
+func ProposePasswordUpdate(levelDBTrans *leveldb.Trans, didStr, aoId, oldPassword, newPassword string) (*UpdateProposal, error) {
+	didStr, aoId, baseDoc, err := loadUpdateBase(levelDBTrans, didStr, aoId)
+	if err != nil {
+		return nil, err
+	}
+	if err := UpdatePasswordKey(levelDBTrans, didStr, aoId, oldPassword, newPassword); err != nil {
+		return nil, err
+	}
+	didDoc := &aospacedid.Document{}
+	if err := json.Unmarshal(baseDoc, didDoc); err != nil {
+		return nil, err
+	}
+	return newUpdateProposal(levelDBTrans, UpdateKindPassword, didDoc.Subject, aoId, baseDoc, baseDoc)
+}
+
+// ProposeDeviceMethodRotation 生成轮换设备验证方法(key-0)的提议, 旧公钥保留到 graceUntil. 调用方需要回滚 levelDBTrans.
+func ProposeDeviceMethodRotation(levelDBTrans *leveldb.Trans, aoId string, graceUntil time.Time) (*UpdateProposal, error) {
+	_, aoId, baseDoc, err := loadUpdateBase(levelDBTrans, "", aoId)
+	if err != nil {
+		return nil, err
+	}
+	doc, _, err := rotateDeviceMethod(levelDBTrans, aoId, graceUntil)
+	if err != nil {
+		return nil, err
+	}
+	didDoc := &aospacedid.Document{}
+	if err := json.Unmarshal(doc, didDoc); err != nil {
+		return nil, err
+	}
+	p, err := newUpdateProposal(levelDBTrans, UpdateKindDeviceMethod, didDoc.Subject, aoId, baseDoc, doc)
+	if err != nil {
+		return nil, err
+	}
+	if p.SpaceKey, err = leveldb.Get(levelDBTrans, []byte(leveldb.KNameOfSpaceRSAPri(aoId))); err != nil {
+		return nil, err
+	}
+	if p.PreviousSpaceKey, err = leveldb.Get(levelDBTrans, []byte(leveldb.KNameOfSpaceRSAPriPrevious(aoId))); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// SaveUpdateProposal 保存提议, 同时清理已过期的提议.
+func SaveUpdateProposal(levelDBTrans *leveldb.Trans, p *UpdateProposal) error {
+	now := time.Now()
+	expired := make([][]byte, 0)
+	err := leveldb.Iterate(levelDBTrans, []byte(leveldb.KNamePrefixOfDidDocProposal()), func(key, value []byte) bool {
+		old := &UpdateProposal{}
+		if json.Unmarshal(value, old) != nil || now.After(old.ExpiresAt) {
+			expired = append(expired, append([]byte{}, key...))
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	for _, key := range expired {
+		if err := leveldb.Delete(levelDBTrans, key); err != nil {
+			return err
+		}
+	}
+
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	return leveldb.Put(levelDBTrans, []byte(leveldb.KNameOfDidDocProposal(p.ID)), b)
+}
+
+// CommitUpdateProposal 校验签名满足当前文档 capabilityInvocation 的多重签名条件后写入提议的更新.
+// 设备验证方法(key-0)的私钥保存在盒子上, 由盒子联署; 客户端需要提供其余验证方法的签名.
+func CommitUpdateProposal(levelDBTrans *leveldb.Trans, proposalId, kind string,
+	signatures []*document.UpdateSignature) (*UpdateProposal, error) {
+	logger.AppLogger().Debugf("CommitUpdateProposal, proposalId:%v, kind:%v", proposalId, kind)
+
+	p, err := getUpdateProposal(levelDBTrans, proposalId)
+	if err != nil {
+		return nil, err
+	}
+	if p.Kind != kind {
+		return nil, fmt.Errorf("proposal %v is not for %v update", proposalId, kind)
+	}
+	baseDoc, err := getDidDoc(levelDBTrans, p.DID)
+	if err != nil {
+		return nil, err
+	}
+	if docHash(baseDoc) != p.BaseHash {
+		return nil, fmt.Errorf("document changed after proposal %v was created", proposalId)
+	}
+
+	data, err := p.SigningInput()
+	if err != nil {
+		return nil, err
+	}
+	deviceSignature, err := cosignUpdate(levelDBTrans, p.AoId, data)
+	if err != nil {
+		return nil, err
+	}
+	if err := authorizeUpdate(baseDoc, p.DID, data, append(signatures, deviceSignature)); err != nil {
+		return nil, err
+	}
+
+	switch p.Kind {
+	case UpdateKindDeviceMethod:
+		if err := leveldb.Put(levelDBTrans, []byte(leveldb.KNameOfSpaceRSAPri(p.AoId)), p.SpaceKey); err != nil {
+			return nil, err
+		}
+		if err := leveldb.Put(levelDBTrans, []byte(leveldb.KNameOfSpaceRSAPriPrevious(p.AoId)), p.PreviousSpaceKey); err != nil {
+			return nil, err
+		}
+	default:
+		if err := leveldb.Put(levelDBTrans, []byte(leveldb.KNameOfPasswordRSAPri(p.AoId)), p.PasswordKey); err != nil {
+			return nil, err
+		}
+		if err := deleteLegacyClientKey(levelDBTrans, p.AoId); err != nil {
+			return nil, err
+		}
+	}
+	if p.Kind == UpdateKindMethod || p.Kind == UpdateKindDeviceMethod {
+		if err := saveDidDoc(levelDBTrans, p.DID, p.Document); err != nil {
+			return nil, fmt.Errorf("saveDidDoc err:%v", err)
+		}
+	}
+	if err := leveldb.Delete(levelDBTrans, []byte(leveldb.KNameOfDidDocProposal(proposalId))); err != nil {
+		return nil, err
+	}
+	logger.AppLogger().Infof("CommitUpdateProposal, %v update of %v committed, proposalId:%v", p.Kind, p.DID, proposalId)
+	return p, nil
+}
+
+func loadUpdateBase(levelDBTrans *leveldb.Trans, didStr, aoId string) (string, string, []byte, error) {
+	if len(aoId) < 1 && len(didStr) < 1 {
+		return "", "", nil, fmt.Errorf("did(%v) and aoId(%v) can't both be empty", didStr, aoId)
+	}
+	if len(aoId) < 1 {
+		aoIdFound, found, err := GetAoIdByDid(levelDBTrans, didStr)
+		if err != nil {
+			return "", "", nil, err
+		}
+		if !found {
+			return "", "", nil, fmt.Errorf("aoId not found by did(%v)", didStr)
+		}
+		aoId = aoIdFound
+	}
+	if len(didStr) < 1 {
+		didStrFound, found, err := GetDidByAoId(levelDBTrans, aoId)
+		if err != nil {
+			return "", "", nil, err
+		}
+		if !found {
+			return "", "", nil, fmt.Errorf("did not found by aoId(%v)", aoId)
+		}
+		didStr = didStrFound
+	}
+	if meta, found, err := getDidDocMeta(levelDBTrans, stripDidURL(didStr)); err != nil {
+		return "", "", nil, err
+	} else if found && meta.Deactivated {
+		return "", "", nil, ErrDocumentDeactivated
+	}
+	baseDoc, err := getDidDoc(levelDBTrans, didStr)
+	if err != nil {
+		return "", "", nil, err
+	}
+	return didStr, aoId, baseDoc, nil
+}
+
+func newUpdateProposal(levelDBTrans *leveldb.Trans, kind, subject, aoId string, baseDoc, doc []byte) (*UpdateProposal, error) {
+	passwordKey, err := leveldb.Get(levelDBTrans, []byte(leveldb.KNameOfPasswordRSAPri(aoId)))
+	if err != nil {
+		return nil, err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	return &UpdateProposal{
+		ID:          hex.EncodeToString(id),
+		Kind:        kind,
+		DID:         subject,
+		AoId:        aoId,
+		BaseHash:    docHash(baseDoc),
+		Document:    doc,
+		PasswordKey: passwordKey,
+		ExpiresAt:   time.Now().Add(updateProposalTTL),
+	}, nil
+}
+
+func getUpdateProposal(levelDBTrans *leveldb.Trans, proposalId string) (*UpdateProposal, error) {
+	key := []byte(leveldb.KNameOfDidDocProposal(proposalId))
+	exist, err := leveldb.Has(levelDBTrans, key)
+	if err != nil {
+		return nil, err
+	}
+	if !exist {
+		return nil, ErrProposalNotFound
+	}
+	b, err := leveldb.Get(levelDBTrans, key)
+	if err != nil {
+		return nil, err
+	}
+	p := &UpdateProposal{}
+	if err := json.Unmarshal(b, p); err != nil {
+		return nil, fmt.Errorf("failed to parse proposal %v, err:%v", proposalId, err)
+	}
+	if time.Now().After(p.ExpiresAt) {
+		return nil, ErrProposalNotFound
+	}
+	return p, nil
+}
+
+// cosignUpdate 盒子用设备验证方法(key-0)对应的空间私钥签名.
+func cosignUpdate(levelDBTrans *leveldb.Trans, aoId string, data []byte) (*document.UpdateSignature, error) {
+	priKeyBytes, err := getPrivateKey(levelDBTrans, leveldb.KNameOfSpaceRSAPri(aoId))
+	if err != nil {
+		return nil, fmt.Errorf("getPrivateKey:%v err:%v", leveldb.KNameOfSpaceRSAPri(aoId), err)
+	}
+	priKey, err := rsa.GetPrivateKey(priKeyBytes)
+	keystore.Zeroize(priKeyBytes)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	sig, err := cryptorsa.SignPKCS1v15(rand.Reader, priKey, crypto.SHA256, sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return &document.UpdateSignature{VerificationMethod: "#" + fragmentOfDevice,
+		Signature: base64.StdEncoding.EncodeToString(sig)}, nil
+}
+
+// authorizeUpdate 用当前文档中的验证方法校验签名, 任一 capabilityInvocation 的条件满足即授权通过.
+func authorizeUpdate(baseDoc []byte, subject string, data []byte, signatures []*document.UpdateSignature) error {
+	didDoc := &aospacedid.Document{}
+	if err := json.Unmarshal(baseDoc, didDoc); err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(data)
+	signed := make(map[string]bool)
+	for _, s := range signatures {
+		if s == nil {
+			continue
+		}
+		i := strings.Index(s.VerificationMethod, "#")
+		if i < 0 || (i > 0 && s.VerificationMethod[:i] != stripDidURL(subject)) {
+			return fmt.Errorf("verification method %v not in %v", s.VerificationMethod, subject)
+		}
+		fragment := s.VerificationMethod[i:]
+		vm, found := findDocumentMethod(didDoc, fragment)
+		if !found || len(vm.PublicKeyPem) < 1 {
+			return fmt.Errorf("verification method %v not found", s.VerificationMethod)
+		}
+		pub, err := rsa.GetPublicKey([]byte(vm.PublicKeyPem))
+		if err != nil {
+			return err
+		}
+		sig, err := base64.StdEncoding.DecodeString(s.Signature)
+		if err != nil {
+			return fmt.Errorf("invalid signature of %v, err:%v", s.VerificationMethod, err)
+		}
+		if err := cryptorsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig); err != nil {
+			return fmt.Errorf("invalid signature of %v, err:%v", s.VerificationMethod, err)
+		}
+		signed[strings.TrimPrefix(fragment, "#")] = true
+	}
+
+	for _, capability := range didDoc.CapabilityInvocation {
+		vm, found := findDocumentMethod(didDoc, capability)
+		if !found {
+			continue
+		}
+		if conditionSatisfied(map[string]interface{}{"conditionOr": vm.ConditionOr, "conditionAnd": vm.ConditionAnd}, signed) {
+			return nil
+		}
+	}
+	logger.AppLogger().Warnf("authorizeUpdate, %v not authorized, signed by:%v", subject, signed)
+	return ErrUnauthorizedUpdate
+}
+
+func findDocumentMethod(didDoc *aospacedid.Document, fragment string) (*aospacedid.VerificationKey, bool) {
+	for _, vm := range didDoc.VerificationMethod {
+		if vm.Fragment() == fragment {
+			return vm, true
+		}
+	}
+	return nil, false
+}
+
+// conditionSatisfied 计算多重签名条件. 叶子节点为验证方法的 fragment(例如 key-0), 中间节点为 conditionAnd/conditionOr.
+func conditionSatisfied(node interface{}, signed map[string]bool) bool {
+	switch v := node.(type) {
+	case string:
+		return signed[strings.TrimPrefix(v, "#")]
+	case map[string]interface{}:
+		if and, ok := v["conditionAnd"].([]interface{}); ok && len(and) > 0 {
+			for _, c := range and {
+				if !conditionSatisfied(c, signed) {
+					return false
+				}
+			}
+			return true
+		}
+		if or, ok := v["conditionOr"].([]interface{}); ok {
+			for _, c := range or {
+				if conditionSatisfied(c, signed) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+func stripDidURL(didStr string) string {
+	if i := strings.IndexAny(didStr, "?#"); i > 0 {
+		return didStr[:i]
+	}
+	return didStr
+}
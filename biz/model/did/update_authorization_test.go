@@ -0,0 +1,230 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package did
+
+import (
+	"agent/biz/model/did/leveldb"
+	"agent/biz/model/dto/did/document"
+	"crypto/rand"
+	cryptorsa "crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// proposeMethodReset 按服务层的方式生成并保存提议: 在回滚的事务中计算, 再单独保存.
+func proposeMethodReset(t *testing.T, aoId, newPassword string, expiresAt time.Time) *UpdateProposal {
+	scratchTrans, err := leveldb.BeginTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := ProposeMethodReset(scratchTrans, "", aoId, newPassword)
+	scratchTrans.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !expiresAt.IsZero() {
+		p.ExpiresAt = expiresAt
+	}
+	if err := SaveUpdateProposal(nil, p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func signProposal(t *testing.T, p *UpdateProposal, verificationMethod string, key *cryptorsa.PrivateKey) *document.UpdateSignature {
+	data, err := p.SigningInput()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := signWith(key)(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &document.UpdateSignature{VerificationMethod: verificationMethod, Signature: base64.StdEncoding.EncodeToString(sig)}
+}
+
+func TestCommitUpdateProposal(t *testing.T) {
+	openTestDB(t)
+	didStr, binderKey := createTestDocument(t, "aoid-1", "123456")
+
+	// 只有盒子联署的 key-0, 拒绝
+	p := proposeMethodReset(t, "aoid-1", "111111", time.Time{})
+	if _, err := CommitUpdateProposal(nil, p.ID, UpdateKindMethod, nil); !errors.Is(err, ErrUnauthorizedUpdate) {
+		t.Fatalf("key-0 only, err:%v", err)
+	}
+
+	// 不是 key-1 私钥的签名, 拒绝
+	otherKey, err := cryptorsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forged := signProposal(t, p, didStr+"#key-1", otherKey)
+	if _, err := CommitUpdateProposal(nil, p.ID, UpdateKindMethod, []*document.UpdateSignature{forged}); err == nil {
+		t.Fatal("forged key-1 signature accepted")
+	}
+
+	// 类型不一致, 拒绝
+	signature := signProposal(t, p, didStr+"#key-1", binderKey)
+	if _, err := CommitUpdateProposal(nil, p.ID, UpdateKindPassword, []*document.UpdateSignature{signature}); err == nil {
+		t.Fatal("proposal committed as another kind")
+	}
+
+	// key-0 + key-1, 通过
+	if _, err := CommitUpdateProposal(nil, p.ID, UpdateKindMethod, []*document.UpdateSignature{signature}); err != nil {
+		t.Fatalf("key-0 and key-1, err:%v", err)
+	}
+	doc, err := getDidDoc(nil, didStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(doc) != string(p.Document) {
+		t.Fatal("proposed document not saved")
+	}
+
+	// 提议只能使用一次
+	if _, err := CommitUpdateProposal(nil, p.ID, UpdateKindMethod, []*document.UpdateSignature{signature}); !errors.Is(err, ErrProposalNotFound) {
+		t.Fatalf("reused proposal, err:%v", err)
+	}
+}
+
+func TestCommitUpdateProposalExpired(t *testing.T) {
+	openTestDB(t)
+	didStr, binderKey := createTestDocument(t, "aoid-1", "123456")
+
+	p := proposeMethodReset(t, "aoid-1", "111111", time.Now().Add(-time.Second))
+	signature := signProposal(t, p, didStr+"#key-1", binderKey)
+	if _, err := CommitUpdateProposal(nil, p.ID, UpdateKindMethod, []*document.UpdateSignature{signature}); !errors.Is(err, ErrProposalNotFound) {
+		t.Fatalf("expired proposal, err:%v", err)
+	}
+}
+
+func TestCommitUpdateProposalBaseChanged(t *testing.T) {
+	openTestDB(t)
+	didStr, binderKey := createTestDocument(t, "aoid-1", "123456")
+
+	first := proposeMethodReset(t, "aoid-1", "111111", time.Time{})
+	second := proposeMethodReset(t, "aoid-1", "222222", time.Time{})
+	if _, err := CommitUpdateProposal(nil, first.ID, UpdateKindMethod,
+		[]*document.UpdateSignature{signProposal(t, first, "#key-1", binderKey)}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 文档已被第一个提议修改, 第二个提议失效
+	_, err := CommitUpdateProposal(nil, second.ID, UpdateKindMethod,
+		[]*document.UpdateSignature{signProposal(t, second, didStr+"#key-1", binderKey)})
+	if err == nil || !strings.Contains(err.Error(), "document changed") {
+		t.Fatalf("base document changed, err:%v", err)
+	}
+}
+
+func TestConditionSatisfied(t *testing.T) {
+	condition := map[string]interface{}{"conditionOr": []interface{}{
+		map[string]interface{}{"conditionAnd": []interface{}{"#key-0", "#key-1"}},
+		map[string]interface{}{"conditionAnd": []interface{}{"#key-2", "#key-3"}},
+	}}
+	cases := []struct {
+		signed []string
+		want   bool
+	}{
+		{nil, false},
+		{[]string{"key-0"}, false},
+		{[]string{"key-1"}, false},
+		{[]string{"key-0", "key-1"}, true},
+		{[]string{"key-0", "key-2"}, false},
+		{[]string{"key-2", "key-3"}, true},
+	}
+	for _, c := range cases {
+		signed := make(map[string]bool)
+		for _, k := range c.signed {
+			signed[k] = true
+		}
+		if got := conditionSatisfied(condition, signed); got != c.want {
+			t.Errorf("conditionSatisfied(%v) = %v, want %v", c.signed, got, c.want)
+		}
+	}
+}
+
+func TestCommitDeviceMethodRotation(t *testing.T) {
+	openTestDB(t)
+	didStr, binderKey := createTestDocument(t, "aoid-1", "123456")
+	oldSpaceKey, err := getPrivateKey(nil, leveldb.KNameOfSpaceRSAPri("aoid-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	baseDoc, err := getDidDoc(nil, didStr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scratchTrans, err := leveldb.BeginTransaction()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := ProposeDeviceMethodRotation(scratchTrans, "aoid-1", time.Now().Add(-time.Second))
+	scratchTrans.Rollback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SaveUpdateProposal(nil, p); err != nil {
+		t.Fatal(err)
+	}
+	// 提议不修改当前文档和空间密钥
+	if doc, err := getDidDoc(nil, didStr); err != nil || string(doc) != string(baseDoc) {
+		t.Fatalf("document changed by proposal, err:%v", err)
+	}
+
+	// 只有盒子联署的 key-0, 拒绝
+	if _, err := CommitUpdateProposal(nil, p.ID, UpdateKindDeviceMethod, nil); !errors.Is(err, ErrUnauthorizedUpdate) {
+		t.Fatalf("key-0 only, err:%v", err)
+	}
+	signature := signProposal(t, p, didStr+"#key-1", binderKey)
+	if _, err := CommitUpdateProposal(nil, p.ID, UpdateKindDeviceMethod, []*document.UpdateSignature{signature}); err != nil {
+		t.Fatalf("key-0 and key-1, err:%v", err)
+	}
+
+	doc, err := getDidDoc(nil, didStr)
+	if err != nil || string(doc) != string(p.Document) {
+		t.Fatalf("proposed document not saved, err:%v", err)
+	}
+	didDoc, err := parseBackupDocument(doc, stripDidURL(didStr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newSpaceKey, err := getPrivateKey(nil, leveldb.KNameOfSpaceRSAPri("aoid-1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vm, found := findDocumentMethod(didDoc, "#"+fragmentOfDevice); !found || matchKeyPair(newSpaceKey, vm.PublicKeyPem) != nil {
+		t.Fatal("key-0 does not match the new space key")
+	}
+	previousSpaceKey, err := getPrivateKey(nil, leveldb.KNameOfSpaceRSAPriPrevious("aoid-1"))
+	if err != nil || string(previousSpaceKey) != string(oldSpaceKey) {
+		t.Fatalf("previous space key not saved, err:%v", err)
+	}
+
+	// 宽限期已过: 只删除旧空间私钥, 文档不变
+	if pruned, err := PruneExpiredDeviceMethods(nil, "aoid-1"); err != nil || !pruned {
+		t.Fatalf("pruned:%v, err:%v", pruned, err)
+	}
+	if exist, _ := leveldb.Has(nil, []byte(leveldb.KNameOfSpaceRSAPriPrevious("aoid-1"))); exist {
+		t.Error("previous space key not deleted")
+	}
+	if after, err := getDidDoc(nil, didStr); err != nil || string(after) != string(doc) {
+		t.Errorf("document changed by prune, err:%v", err)
+	}
+}
@@ -18,6 +18,7 @@ import (
 	"agent/biz/model/did/leveldb"
 	"agent/biz/model/dto/did/document"
 	aospacedid "agent/deps/did/aospace/did"
+	"agent/utils/keystore"
 	"agent/utils/logger"
 	"fmt"
 	"strings"
@@ -45,7 +46,8 @@ func createDeviceMethod(levelDBTrans *leveldb.Trans, fragment, aoId, timeNow str
 	logger.AppLogger().Debugf("createDeviceMethod, aoId:%v, fragment:%v",
 		aoId, fragment)
 
-	_, spacePubKeyBytes, err := getSpaceKey(levelDBTrans, aoId)
+	spacePriKeyBytes, spacePubKeyBytes, err := getSpaceKey(levelDBTrans, aoId)
+	keystore.Zeroize(spacePriKeyBytes)
 	if err != nil {
 		logger.AppLogger().Warnf("failed getSpaceKey, aoId:%v, err:%v",
 			aoId, err)
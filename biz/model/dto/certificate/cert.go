@@ -14,8 +14,12 @@
 
 package certificate
 
+import "time"
+
 type LanCert struct {
-	Cert string `json:"cert"`
+	Cert            string `json:"cert"`                      // 服务端证书 DER 的 base64
+	RootCA          string `json:"rootCa,omitempty"`          // 局域网根证书 DER 的 base64
+	RootFingerprint string `json:"rootFingerprint,omitempty"` // 局域网根证书 DER 的 SHA256, 小写十六进制
 }
 
 type UserDomainReq struct {
@@ -39,3 +43,26 @@ type DnsRecordReq struct {
 
 type DNSTxtRecordRsp struct {
 }
+
+// InventoryEntry 证书清单中的一张证书
+type InventoryEntry struct {
+	Source       string    `json:"source"` // lan, lan-root, acme, internal-ca, docker-tls, platform-ca, compose:<服务名>, extra
+	Path         string    `json:"path"`   // 证书文件路径
+	Subject      string    `json:"subject,omitempty"`
+	Issuer       string    `json:"issuer,omitempty"`
+	SerialNumber string    `json:"serialNumber,omitempty"` // 十六进制
+	NotBefore    time.Time `json:"notBefore"`
+	NotAfter     time.Time `json:"notAfter"`
+	DaysLeft     int       `json:"daysLeft"`          // 距离过期的天数, 已过期为负数
+	KeyType      string    `json:"keyType,omitempty"` // 如 RSA-2048, ECDSA-P256, Ed25519
+	DNSNames     []string  `json:"dnsNames,omitempty"`
+	IPAddresses  []string  `json:"ipAddresses,omitempty"`
+	IsCA         bool      `json:"isCa"`
+	HasKey       bool      `json:"hasKey"`          // 同目录下有匹配的私钥
+	Error        string    `json:"error,omitempty"` // 解析失败原因
+}
+
+type InventoryRsp struct {
+	CheckedAt time.Time        `json:"checkedAt"`
+	Entries   []InventoryEntry `json:"entries"`
+}
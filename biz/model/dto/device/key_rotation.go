@@ -0,0 +1,44 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//	http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package device
+
+import "agent/biz/model/dto/did/document"
+
+// KeyRotationReq 不带 proposals 时轮换设备密钥, 并为每个 DID 生成轮换设备验证方法的提议;
+// 带 proposals 时提交客户端签名后的提议, 签名需满足文档 capabilityInvocation 的多重签名条件.
+type KeyRotationReq struct {
+	GraceHours uint32                  `json:"graceHours" form:"graceHours"` // 旧密钥的宽限期(小时), 为 0 时使用配置值
+	Proposals  []*DeviceMethodProposal `json:"proposals" form:"proposals"`   // 提交的提议
+}
+
+// DeviceMethodProposal 轮换 DID 文档设备验证方法(key-0)的提议.
+type DeviceMethodProposal struct {
+	DID          string                      `json:"did,omitempty"`
+	ProposalId   string                      `json:"proposalId"`
+	DIDDoc       string                      `json:"didDoc,omitempty"`       // base64 编码的提议文档
+	SigningInput string                      `json:"signingInput,omitempty"` // base64 编码的待签名数据
+	ExpiresAt    string                      `json:"expiresAt,omitempty"`
+	Signatures   []*document.UpdateSignature `json:"signatures,omitempty"` // 提交时由客户端填写
+}
+
+type KeyRotationRsp struct {
+	OldFingerprint     string                  `json:"oldFingerprint,omitempty"`
+	NewFingerprint     string                  `json:"newFingerprint,omitempty"`
+	GraceUntil         string                  `json:"graceUntil,omitempty"` // 旧密钥失效时间, RFC3339
+	Proposals          []*DeviceMethodProposal `json:"proposals,omitempty"`  // 待客户端签名的设备验证方法轮换提议
+	RotatedDIDs        []string                `json:"rotatedDids"`          // 已提交设备验证方法轮换的 DID
+	ReissuedTokens     int                     `json:"reissuedTokens"`       // 重新签发的 agent token 数量
+	PlatformRegistered bool                    `json:"platformRegistered"`   // 是否已向平台登记新公钥, 失败时在后台重试
+}
@@ -0,0 +1,36 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import "encoding/json"
+
+type ExportBackupReq struct {
+	Passphrase string `json:"passphrase" form:"passphrase" binding:"required"` // 恢复口令, 至少 8 个字符
+}
+
+type ExportBackupRsp struct {
+	Archive json.RawMessage `json:"archive"`
+	Count   int             `json:"count"` // 备份的 DID 数量
+}
+
+type RestoreBackupReq struct {
+	Archive    json.RawMessage `json:"archive" binding:"required"`
+	Passphrase string          `json:"passphrase" binding:"required"`
+	Overwrite  bool            `json:"overwrite"` // 本机已有相同 DID 时是否覆盖, 覆盖时备份的文档作为新版本追加, 已注销的 DID 不能覆盖
+}
+
+type RestoreBackupRsp struct {
+	DIDs []string `json:"dids"`
+}
@@ -0,0 +1,57 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package credential
+
+import "encoding/json"
+
+const (
+	TypeMember = "member" // 空间成员凭证, 由管理员 DID 签发
+	TypeDevice = "device" // 设备绑定凭证, 由 aoId 自己的 DID 签发
+)
+
+type IssueCredentialReq struct {
+	Type           string `json:"type" form:"type"` // member 或 device
+	AOID           string `json:"aoId" form:"aoId"`
+	ExpiresInHours int    `json:"expiresInHours" form:"expiresInHours"` // 为 0 时不过期
+}
+
+type IssueCredentialRsp struct {
+	Credential json.RawMessage `json:"credential"`
+}
+
+type VerifyCredentialReq struct {
+	Credential json.RawMessage `json:"credential"`
+}
+
+type VerifyCredentialRsp struct {
+	Verified bool                   `json:"verified"`
+	Reason   string                 `json:"reason,omitempty"` // 校验失败的原因
+	Issuer   string                 `json:"issuer"`
+	Types    []string               `json:"types"`
+	Subject  map[string]interface{} `json:"credentialSubject"`
+}
+
+type VerifyPresentationReq struct {
+	Presentation json.RawMessage `json:"presentation"`
+	Challenge    string          `json:"challenge"` // 校验方下发的随机数, 不能为空
+	Domain       string          `json:"domain"`    // 为空时不检查
+}
+
+type VerifyPresentationRsp struct {
+	Verified    bool                  `json:"verified"`
+	Reason      string                `json:"reason,omitempty"`
+	Holder      string                `json:"holder"`
+	Credentials []VerifyCredentialRsp `json:"credentials"`
+}
@@ -0,0 +1,25 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deactivate
+
+type DeactivateDocumentReq struct {
+	DID  string `json:"did" form:"did"` // did、aoId 需要至少传一个参数, all 为 true 时忽略.
+	AOID string `json:"aoId" form:"aoId"`
+	All  bool   `json:"all" form:"all"` // 重置设备时注销所有 DID
+}
+
+type DeactivateDocumentRsp struct {
+	DIDs []string `json:"dids"`
+}
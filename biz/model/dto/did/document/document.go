@@ -24,6 +24,13 @@ type VerificationMethod struct {
 	PublicKeyPem string `json:"publicKeyPem" form:"publicKeyPem" binding:"required"`
 }
 
+// UpdateSignature 文档更新提议的签名. 签名数据为提议返回的 signingInput(base64 解码后),
+// 算法为 RSA PKCS#1 v1.5 + SHA256.
+type UpdateSignature struct {
+	VerificationMethod string `json:"verificationMethod" form:"verificationMethod"` // 签名的验证方法, 例如 did:aospace:xxx#key-1 或 #key-1
+	Signature          string `json:"signature" form:"signature"`                   // base64 编码的签名
+}
+
 type GetDocumentReq struct {
 	DID  string `json:"did" form:"did"`
 	AOID string `json:"aoId" form:"aoId"`
@@ -21,9 +21,16 @@ type UpdateDocumentMethodReq struct {
 	DID          string                         `json:"did" form:"did"`                 // did 和 aoId 需要至少传一个参数.
 	AOID         string                         `json:"aoId" form:"aoId"`
 	VerifyMethod []*document.VerificationMethod `json:"verificationMethod" form:"verificationMethod"` // 增加的验证方法
+
+	// 不传 proposalId 时只生成更新提议, 客户端按 capabilityInvocation 签名后再带上 proposalId、signatures 提交.
+	ProposalId string                      `json:"proposalId" form:"proposalId"`
+	Signatures []*document.UpdateSignature `json:"signatures" form:"signatures"`
 }
 
 type UpdateDocumentMethodRsp struct {
-	DIDDoc string `json:"didDoc,omitempty"`
-	DID    string `json:"did,omitempty"`
+	DIDDoc       string `json:"didDoc,omitempty"` // 生成提议时为提议的文档
+	DID          string `json:"did,omitempty"`
+	ProposalId   string `json:"proposalId,omitempty"`
+	SigningInput string `json:"signingInput,omitempty"` // base64 编码的待签名数据
+	ExpiresAt    string `json:"expiresAt,omitempty"`
 }
@@ -14,9 +14,22 @@
 
 package password
 
+import "agent/biz/model/dto/did/document"
+
 type UpdateDocumentPasswordReq struct {
-	OldPassword string `json:"oldPassword" form:"oldPassword" binding:"required"`
-	NewPassword string `json:"newPassword" form:"newPassword" binding:"required"`
+	OldPassword string `json:"oldPassword" form:"oldPassword"` // 生成提议时必传
+	NewPassword string `json:"newPassword" form:"newPassword"` // 生成提议时必传
 	DID         string `json:"did" form:"did"`
 	AOID        string `json:"aoId" form:"aoId"`
+
+	// 不传 proposalId 时只生成更新提议, 客户端按 capabilityInvocation 签名后再带上 proposalId、signatures 提交.
+	ProposalId string                      `json:"proposalId" form:"proposalId"`
+	Signatures []*document.UpdateSignature `json:"signatures" form:"signatures"`
+}
+
+type UpdateDocumentPasswordRsp struct {
+	DIDDoc       string `json:"didDoc,omitempty"`
+	ProposalId   string `json:"proposalId,omitempty"`
+	SigningInput string `json:"signingInput,omitempty"` // base64 编码的待签名数据
+	ExpiresAt    string `json:"expiresAt,omitempty"`
 }
@@ -0,0 +1,59 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import "encoding/json"
+
+const (
+	ContextResolution = "https://w3id.org/did-resolution/v1"
+
+	ContentTypeResolutionResult = `application/ld+json;profile="https://w3id.org/did-resolution"`
+	ContentTypeDidDocument      = "application/did+ld+json"
+
+	// didResolutionMetadata.error
+	ErrorInvalidDid         = "invalidDid"
+	ErrorInvalidOptions     = "invalidOptions"
+	ErrorNotFound           = "notFound"
+	ErrorMethodNotSupported = "methodNotSupported"
+	ErrorInternalError      = "internalError"
+)
+
+type ResolveReq struct {
+	VersionId   string `json:"versionId" form:"versionId"`
+	VersionTime string `json:"versionTime" form:"versionTime"` // RFC3339
+}
+
+// ResolutionResult W3C DID Resolution Result.
+type ResolutionResult struct {
+	Context               string              `json:"@context"`
+	DidDocument           json.RawMessage     `json:"didDocument"`
+	DidResolutionMetadata *ResolutionMetadata `json:"didResolutionMetadata"`
+	DidDocumentMetadata   *DocumentMetadata   `json:"didDocumentMetadata"`
+}
+
+type ResolutionMetadata struct {
+	ContentType  string `json:"contentType,omitempty"`
+	Error        string `json:"error,omitempty"`
+	ErrorMessage string `json:"errorMessage,omitempty"`
+}
+
+type DocumentMetadata struct {
+	Created       string `json:"created,omitempty"`
+	Updated       string `json:"updated,omitempty"`
+	VersionId     string `json:"versionId,omitempty"`
+	NextUpdate    string `json:"nextUpdate,omitempty"`
+	NextVersionId string `json:"nextVersionId,omitempty"`
+	Deactivated   bool   `json:"deactivated,omitempty"`
+}
@@ -48,6 +48,7 @@ const (
 	AgentCodeDockerPulling        = "AG-469" // 容器下载中
 	AgentCodeDockerStarting       = "AG-470" // 容器启动中
 	AgentCodeDockerStarted        = "AG-471" // 容器已经启动
+	AgentCodeUnauthorizedUpdate   = "AG-472" // DID 文档更新未通过 capabilityInvocation 授权
 
 	AgentCodeServerErrorStr              = "AG-500"
 	AgentCodeCallServiceFailedStr        = "AG-560"
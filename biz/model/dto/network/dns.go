@@ -0,0 +1,35 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+// DnsLinkConfig 单个网卡的 dns 设置, 为空的字段不修改
+type DnsLinkConfig struct {
+	Interface  string   `json:"interface"`
+	Dns        []string `json:"dns"`
+	Domains    []string `json:"domains"`    // ~ 开头表示只把该域名的查询发给这个网卡的 dns, 如 ~corp.example.com
+	DnsOverTls string   `json:"dnsOverTls"` // no, opportunistic, yes
+	Dnssec     string   `json:"dnssec"`     // no, allow-downgrade, yes
+}
+
+// DnsConfig systemd-resolved 的 dns 设置. dns 服务器格式为 ip[#sni], ipv4:port[#sni] 或 [ipv6]:port[#sni],
+// 如 1.1.1.1#cloudflare-dns.com, sni 用于 DNS-over-TLS 校验服务器证书.
+type DnsConfig struct {
+	Dns         []string         `json:"dns"`
+	FallbackDns []string         `json:"fallbackDns"` // 为空时使用系统默认值
+	Domains     []string         `json:"domains"`     // 搜索域
+	DnsOverTls  string           `json:"dnsOverTls"`  // no, opportunistic, yes, 为空表示系统默认
+	Dnssec      string           `json:"dnssec"`      // no, allow-downgrade, yes, 为空表示系统默认
+	Links       []*DnsLinkConfig `json:"links"`
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import "time"
+
+// FailoverStatus 有线/无线链路故障切换状态
+type FailoverStatus struct {
+	Enabled         bool                  `json:"enabled"`
+	ActiveInterface string                `json:"activeInterface"` // 当前承载默认路由的网卡, 空串表示没有可用链路
+	Links           []*FailoverLink       `json:"links"`           // 按优先级排序, 有线优先
+	Transitions     []*FailoverTransition `json:"transitions"`     // 最近的切换记录, 从旧到新
+}
+
+type FailoverLink struct {
+	Interface           string    `json:"interface"`
+	Wired               bool      `json:"wired"`
+	ConnectionId        string    `json:"connectionId"` // wifi 时一般为 SSID
+	Connected           bool      `json:"connected"`
+	Healthy             bool      `json:"healthy"`             // 已连接且能访问互联网
+	ConsecutiveFailures int       `json:"consecutiveFailures"` // 连续探测失败次数
+	HealthySince        time.Time `json:"healthySince"`
+	LastProbe           time.Time `json:"lastProbe"`
+}
+
+type FailoverTransition struct {
+	Time   time.Time `json:"time"`
+	From   string    `json:"from"`   // 原网卡, 空串表示之前没有可用链路
+	To     string    `json:"to"`     // 新网卡, 空串表示没有可用链路
+	Reason string    `json:"reason"` // initial, link_down, internet_lost, failback, recovered
+}
@@ -34,4 +34,11 @@ type NetworkAdapter struct {
 	Ipv6               string `json:"ipv6"`               // ipv6  (获取网络信息: 返回;  无线连上修改配置: 必传;  无线未连上修改配置:  可选;  有线时修改配置:  必传;)
 	SubNetPreLen       string `json:"subNetPreLen"`       // 子网前缀长度 (获取网络信息: 返回;  无线连上修改配置: 必传;  无线未连上修改配置:  可选;  有线时修改配置:  必传;)
 	Ipv6DefaultGateway string `json:"ipv6DefaultGateway"` // ipv6 默认网关 (获取网络信息: 返回;  无线连上修改配置: 必传;  无线未连上修改配置:  可选;  有线时修改配置:  必传;)
+
+	Ipv6Mode               string   `json:"ipv6Mode"`               // ipv6 配置方式 auto(SLAAC, 路由通告要求时同时使用 DHCPv6), dhcp(只用 DHCPv6), manual, link-local, disabled。为空时按 ipv6UseDhcp/ipv6 判断 (获取网络信息: 返回; 其他: 选传)
+	Ipv6Addresses          []string `json:"ipv6Addresses"`          // manual 时的 ipv6 地址列表, 如 2001:db8::10/64。为空时使用 ipv6/subNetPreLen (获取网络信息: 不返回; 其他: 选传)
+	Ipv6Privacy            string   `json:"ipv6Privacy"`            // ipv6 隐私扩展(临时地址) disabled, prefer-public, prefer-temp。为空时使用系统默认 (获取网络信息: 返回; 其他: 选传)
+	Ipv6GlobalAddresses    []string `json:"ipv6GlobalAddresses"`    // 全局单播地址 (获取网络信息: 返回; 其他: 不传;)
+	Ipv6UlaAddresses       []string `json:"ipv6UlaAddresses"`       // 唯一本地地址 fc00::/7 (获取网络信息: 返回; 其他: 不传;)
+	Ipv6LinkLocalAddresses []string `json:"ipv6LinkLocalAddresses"` // 链路本地地址 fe80::/10 (获取网络信息: 返回; 其他: 不传;)
 }
@@ -21,3 +21,7 @@ type NetworkConfigReq struct {
 	Ipv6DNS2        string            `json:"ipv6DNS2"`        // ipv6 dNS2 地址
 	NetworkAdapters []*NetworkAdapter `json:"networkAdapters"` // 网络适配器列表
 }
+
+type NetworkConfigConfirmReq struct {
+	TransactionId string `json:"transactionId"` // 配置网络时返回的 transactionId
+}
@@ -23,4 +23,13 @@ type NetworkStatusRsp struct {
 	Ipv6DNS1        string            `json:"ipv6DNS1"`        // ipv6 dNS1 地址 (获取网络信息: 返回; 其他: 选传)
 	Ipv6DNS2        string            `json:"ipv6DNS2"`        // ipv6 dNS2 地址 (获取网络信息: 返回; 其他: 选传)
 	NetworkAdapters []*NetworkAdapter `json:"networkAdapters"` // 网络适配器列表 (获取网络信息: 返回; 其他: 必传)
+	Failover        *FailoverStatus   `json:"failover"`        // 链路故障切换状态 (获取网络信息: 返回;  其他: 不传;)
+	Tunnel          *TunnelStatus     `json:"tunnel"`          // gt client 运行状态, 可能有 StatusCacheSeconds 的延迟 (获取网络信息: 返回;  其他: 不传;)
+}
+
+// NetworkConfigApplyRsp 网络配置开始在后台应用. 客户端需在应用完成后 confirmTimeoutSec 秒内通过新的网络路径调用确认接口,
+// 否则自动回滚. 配置还在应用时确认接口返回 AG-402, 客户端稍后重试.
+type NetworkConfigApplyRsp struct {
+	TransactionId     string `json:"transactionId"`
+	ConfirmTimeoutSec int    `json:"confirmTimeoutSec"`
 }
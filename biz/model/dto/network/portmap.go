@@ -0,0 +1,41 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import "time"
+
+const (
+	PortMapState_Disabled = "disabled"
+	PortMapState_Mapping  = "mapping" // 正在发现路由器或映射
+	PortMapState_Mapped   = "mapped"
+	PortMapState_Failed   = "failed" // 没有可用的协议或路由器拒绝, 等待重试
+)
+
+// PortMappingStatusRsp 路由器端口映射状态. DirectAvailable 为 false 时客户端应继续使用隧道访问.
+type PortMappingStatusRsp struct {
+	Enabled         bool      `json:"enabled"`
+	State           string    `json:"state"`           // PortMapState_*
+	Protocol        string    `json:"protocol"`        // upnp, natpmp, pcp
+	Gateway         string    `json:"gateway"`         // 路由器地址
+	InternalIp      string    `json:"internalIp"`      // 盒子的局域网地址
+	InternalPort    int       `json:"internalPort"`    // 即网关的 TlsLanPort
+	ExternalIp      string    `json:"externalIp"`      // 路由器的外部地址
+	ExternalPort    int       `json:"externalPort"`    // 路由器实际分配的外部端口
+	LeaseSec        int       `json:"leaseSec"`        // 路由器实际给的租期, 0 表示永久
+	DirectAvailable bool      `json:"directAvailable"` // 外部地址是公网地址(非私有地址、非运营商级 NAT 地址)时才能直连
+	DirectAddress   string    `json:"directAddress"`   // 直连地址 externalIp:externalPort, 只在 directAvailable 时有值
+	LastError       string    `json:"lastError"`
+	UpdatedAt       time.Time `json:"updatedAt"`
+}
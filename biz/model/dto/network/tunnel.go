@@ -0,0 +1,60 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+// TunnelServiceReq 新增或修改通过 gt client 暴露的本地服务, hostPrefix 已存在时修改其本地地址
+type TunnelServiceReq struct {
+	Local      string `json:"local"`      // 本地地址, 如 https://aospace-nginx:443, 支持 http, https, tcp
+	HostPrefix string `json:"hostPrefix"` // 子域名, 字母、数字和 -
+}
+
+// TunnelServiceRemoveReq 删除暴露的本地服务, 盒子本身的服务不能删除
+type TunnelServiceRemoveReq struct {
+	HostPrefix string `json:"hostPrefix"`
+}
+
+// TunnelOptions gt client 的连接参数. 修改时零值或空串表示不修改
+type TunnelOptions struct {
+	RemoteConnections int    `json:"remoteConnections"` // 与服务器的连接数, 1~10
+	ReconnectDelay    string `json:"reconnectDelay"`    // 断开后重连的间隔, 如 15s
+	LocalTimeout      string `json:"localTimeout"`      // 本地服务超时时间
+	RemoteTimeout     string `json:"remoteTimeout"`     // 服务器超时时间
+	LogLevel          string `json:"logLevel"`          // trace, debug, info, warn, error
+	WebrtcMinPort     int    `json:"webrtcMinPort"`
+	WebrtcMaxPort     int    `json:"webrtcMaxPort"`
+}
+
+type TunnelService struct {
+	Local      string `json:"local"`
+	HostPrefix string `json:"hostPrefix"`
+	Default    bool   `json:"default"` // 盒子本身的服务
+}
+
+type TunnelConfigRsp struct {
+	Services []*TunnelService `json:"services"`
+	Options  TunnelOptions    `json:"options"`
+	Status   *TunnelStatus    `json:"status"`
+}
+
+// TunnelStatus gt client 运行状态
+type TunnelStatus struct {
+	State        string `json:"state"`        // 容器状态 running, restarting, exited ..., 容器不存在时为 not_found
+	Connected    *bool  `json:"connected"`    // 是否已连上服务器, 未配置状态接口或查询失败时为 null
+	StartedAt    string `json:"startedAt"`    // 容器启动时间
+	RestartCount int    `json:"restartCount"` // 容器重启次数
+	RxBytes      uint64 `json:"rxBytes"`      // 容器启动以来接收字节数
+	TxBytes      uint64 `json:"txBytes"`      // 容器启动以来发送字节数
+	Services     int    `json:"services"`     // 暴露的服务数
+}
@@ -0,0 +1,69 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+// WifiEapReq 企业版 wifi(WPA2-Enterprise) 的 802.1X 认证参数
+type WifiEapReq struct {
+	Method            string `json:"method"`            // peap, ttls
+	Phase2Auth        string `json:"phase2Auth"`        // 内层认证 mschapv2(默认), pap, gtc
+	Identity          string `json:"identity"`          // 用户名
+	Password          string `json:"password"`          // 新增时必传, 修改已有配置时为空表示保留原密码
+	AnonymousIdentity string `json:"anonymousIdentity"` // 外层匿名身份, 可选
+	CaCertPath        string `json:"caCertPath"`        // 盒子上服务器 CA 证书(PEM)的绝对路径
+	DomainSuffixMatch string `json:"domainSuffixMatch"` // 校验服务器证书的域名后缀
+	NoServerCertCheck bool   `json:"noServerCertCheck"` // 不校验服务器证书. 为 false 时 caCertPath 和 domainSuffixMatch 至少传一个
+}
+
+// WifiProfileSaveReq 新增或修改 wifi 配置, 同一 SSID 只保存一个配置
+type WifiProfileSaveReq struct {
+	Ssid        string      `json:"ssid"`
+	Hidden      bool        `json:"hidden"`      // 隐藏网络
+	Security    string      `json:"security"`    // none, wpa-psk(WPA/WPA2 个人版), sae(WPA3 个人版), wpa-eap(企业版)
+	Password    string      `json:"password"`    // wpa-psk/sae 的密码. 新增时必传, 修改已有配置时为空表示保留原密码
+	Priority    int32       `json:"priority"`    // 自动连接优先级, 越大越优先
+	AutoConnect *bool       `json:"autoConnect"` // 是否自动连接, 不传时为 true
+	Connect     bool        `json:"connect"`     // 保存后是否立即连接
+	Eap         *WifiEapReq `json:"eap"`         // security 为 wpa-eap 时必传
+}
+
+type WifiProfileSaveRsp struct {
+	Uuid      string `json:"uuid"`
+	Connected bool   `json:"connected"` // connect 为 true 时是否连接成功
+}
+
+// WifiProfilePriorityReq 修改已保存 wifi 的自动连接优先级
+type WifiProfilePriorityReq struct {
+	Uuid        string `json:"uuid"`
+	Priority    int32  `json:"priority"`
+	AutoConnect bool   `json:"autoConnect"`
+}
+
+// WifiProfileForgetReq 删除已保存的 wifi 配置, 正在使用时会断开
+type WifiProfileForgetReq struct {
+	Uuid string `json:"uuid"`
+}
+
+// WifiProfileRsp 已保存的 wifi 配置, 不返回密码
+type WifiProfileRsp struct {
+	Uuid        string `json:"uuid"`
+	Ssid        string `json:"ssid"`
+	Hidden      bool   `json:"hidden"`
+	Security    string `json:"security"`  // none, wpa-psk, sae, wpa-eap
+	EapMethod   string `json:"eapMethod"` // 企业版时为 peap, ttls
+	Identity    string `json:"identity"`  // 企业版时的用户名
+	Priority    int32  `json:"priority"`
+	AutoConnect bool   `json:"autoConnect"`
+	Active      bool   `json:"active"` // 当前是否已连接
+}
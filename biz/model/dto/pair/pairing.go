@@ -30,6 +30,8 @@ type PubKeyExchangeReq struct {
 type PubKeyExchangeRsp struct {
 	BoxPubKey  string `json:"boxPubKey"`  // 盒子端公钥.
 	SignedBtid string `json:"signedBtid"` // 用盒子端端私钥签名btid. 客户端用盒子端公钥进行验证.
+
+	LanRootCAFingerprint string `json:"lanRootCaFingerprint,omitempty"` // 局域网根证书 DER 的 SHA256, 客户端固定后用于校验局域网 HTTPS 证书.
 }
 
 type KeyExchangeReq struct {
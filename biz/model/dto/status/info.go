@@ -21,7 +21,10 @@
  */
 package status
 
-import "agent/biz/model/device"
+import (
+	"agent/biz/model/device"
+	"agent/biz/model/did/leveldb"
+)
 
 type Info struct {
 	Status  string `json:"status"`  // 状态
@@ -37,4 +40,6 @@ type Info struct {
 
 	QrCode             string `json:"boxQrCode"`          // 绑定二维码
 	TryoutCodeVerified bool   `json:"tryoutCodeVerified"` // 试用码是否验证通过(仅在 PC 试用场景下使用).
+
+	DIDStore *leveldb.MaintenanceStatus `json:"didStore"` // DID 数据库的恢复、压缩、备份和索引检查状态
 }
@@ -124,6 +124,7 @@ func (conf *Config) RemoveService(appName string, port string, appToken string)
 			updatedServices = append(updatedServices, service)
 		}
 	}
+	currentConf.Services = updatedServices
 	err = currentConf.Save()
 	if err != nil {
 		return err
@@ -164,6 +165,33 @@ func (conf *Config) Save() error {
 	return nil
 }
 
+// SetService 新增服务, hostPrefix 已存在时修改其本地地址
+func (conf *Config) SetService(service Service) {
+	for i := range conf.Services {
+		if conf.Services[i].HostPrefix == service.HostPrefix {
+			conf.Services[i].Local = service.Local
+			return
+		}
+	}
+	conf.Services = append(conf.Services, service)
+}
+
+// DeleteService 删除 hostPrefix 对应的服务, 不存在时返回 false
+func (conf *Config) DeleteService(hostPrefix string) bool {
+	for i := range conf.Services {
+		if conf.Services[i].HostPrefix == hostPrefix {
+			conf.Services = append(conf.Services[:i], conf.Services[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// IsDefaultService 是否是盒子本身的服务(子域名为 client id), 不允许删除
+func (conf *Config) IsDefaultService(hostPrefix string) bool {
+	return hostPrefix == conf.Options.ID
+}
+
 // Load load current gt client yaml config
 func Load() (*Config, error) {
 	var conf Config
@@ -0,0 +1,132 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gt
+
+import (
+	"agent/config"
+	"fmt"
+	"net"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const gatewayContainerName = "aospace-gateway"
+
+var (
+	hostPrefixRegexp = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?$`)
+
+	logLevels = map[string]bool{"trace": true, "debug": true, "info": true, "warn": true, "error": true,
+		"fatal": true, "panic": true, "disable": true}
+)
+
+// Validate 检查配置, 写入并重载 gt client 前调用, 避免错误配置导致 gt client 无法启动.
+func (conf *Config) Validate() error {
+	if len(conf.Version) < 1 {
+		return fmt.Errorf("empty version")
+	}
+	if len(conf.Services) < 1 {
+		return fmt.Errorf("no service")
+	}
+	prefixes := map[string]bool{}
+	for _, s := range conf.Services {
+		if err := s.Validate(); err != nil {
+			return err
+		}
+		if prefixes[s.HostPrefix] {
+			return fmt.Errorf("duplicate hostPrefix %v", s.HostPrefix)
+		}
+		prefixes[s.HostPrefix] = true
+	}
+	if !prefixes[conf.Options.ID] {
+		return fmt.Errorf("missing default service %v", conf.Options.ID)
+	}
+	return conf.Options.Validate()
+}
+
+// Validate 检查本地地址和子域名
+func (s *Service) Validate() error {
+	if !hostPrefixRegexp.MatchString(s.HostPrefix) {
+		return fmt.Errorf("invalid hostPrefix %v", s.HostPrefix)
+	}
+	u, err := url.Parse(s.Local)
+	if err != nil {
+		return fmt.Errorf("invalid local %v, err:%v", s.Local, err)
+	}
+	switch u.Scheme {
+	case "http", "https", "tcp":
+	default:
+		return fmt.Errorf("invalid local %v, scheme should be http, https or tcp", s.Local)
+	}
+	if len(u.Hostname()) < 1 {
+		return fmt.Errorf("invalid local %v, empty host", s.Local)
+	}
+	port := u.Port()
+	if len(port) < 1 {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+	if !isAllowedUpstream(u.Hostname(), port) {
+		return fmt.Errorf("invalid local %v, only loopback, nginx and gateway upstreams can be exposed", s.Local)
+	}
+	return nil
+}
+
+// isAllowedUpstream 只允许转发到回环地址和 nginx、网关容器的服务端口,
+// 避免通过隧道把局域网或 docker 网桥上的其他服务暴露到公网.
+func isAllowedUpstream(host, port string) bool {
+	if strings.EqualFold(host, "localhost") {
+		return true
+	}
+	if ip := net.ParseIP(host); ip != nil {
+		return ip.IsLoopback()
+	}
+	upstreams := map[string]bool{
+		net.JoinHostPort(config.Config.Docker.NginxContainerName, "80"):  true,
+		net.JoinHostPort(config.Config.Docker.NginxContainerName, "443"): true,
+	}
+	if u, err := url.Parse(config.Config.GateWay.APIRoot.Url); err == nil && len(u.Port()) > 0 {
+		upstreams[net.JoinHostPort(gatewayContainerName, u.Port())] = true
+		upstreams[net.JoinHostPort(u.Hostname(), u.Port())] = true
+	}
+	return upstreams[net.JoinHostPort(strings.ToLower(host), port)]
+}
+
+// Validate 检查连接参数和超时设置
+func (opt *Option) Validate() error {
+	if len(opt.ID) < 1 || len(opt.Secret) < 1 {
+		return fmt.Errorf("empty id or secret")
+	}
+	if u, err := url.Parse(opt.RemoteAPI); err != nil || len(u.Scheme) < 1 || len(u.Host) < 1 {
+		return fmt.Errorf("invalid remoteAPI %v", opt.RemoteAPI)
+	}
+	if opt.RemoteConnections < 1 || opt.RemoteConnections > 10 {
+		return fmt.Errorf("remoteConnections should be in [1, 10], got %v", opt.RemoteConnections)
+	}
+	if !logLevels[opt.LogLevel] {
+		return fmt.Errorf("invalid logLevel %v", opt.LogLevel)
+	}
+	for name, v := range map[string]string{"reconnectDelay": opt.ReconnectDelay, "localTimeout": opt.LocalTimeout,
+		"remoteTimeout": opt.RemoteTimeout} {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("invalid %v %v", name, v)
+		}
+	}
+	if opt.WebrtcMinPort < 1024 || opt.WebrtcMaxPort > 65535 || opt.WebrtcMinPort > opt.WebrtcMaxPort {
+		return fmt.Errorf("invalid webrtc port range %v-%v", opt.WebrtcMinPort, opt.WebrtcMaxPort)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package gt
+
+import "testing"
+
+func testConfig() *Config {
+	return &Config{Version: "1.0",
+		Services: []Service{{Local: "http://aospace-nginx:80", HostPrefix: "abcd1234"}},
+		Options: Option{ID: "abcd1234", Secret: "secret", RemoteAPI: "https://ao.space/v2/platform/servers/network/detail",
+			RemoteConnections: 5, LogLevel: "info", ReconnectDelay: "15s", LocalTimeout: "15s", RemoteTimeout: "70s",
+			WebrtcMinPort: 61001, WebrtcMaxPort: 62000}}
+}
+
+func TestConfigValidate(t *testing.T) {
+	conf := testConfig()
+	conf.SetService(Service{Local: "https://aospace-nginx:443", HostPrefix: "app-token"})
+	if err := conf.Validate(); err != nil {
+		t.Fatalf("Validate failed, err:%v", err)
+	}
+	conf.SetService(Service{Local: "tcp://127.0.0.1:8080", HostPrefix: "app-token"})
+	if len(conf.Services) != 2 || conf.Services[1].Local != "tcp://127.0.0.1:8080" {
+		t.Errorf("SetService should update the existing service, %+v", conf.Services)
+	}
+
+	for name, bad := range map[string]func(c *Config){
+		"no default service": func(c *Config) { c.DeleteService("abcd1234") },
+		"duplicate prefix":   func(c *Config) { c.Services = append(c.Services, c.Services[0]) },
+		"invalid prefix":     func(c *Config) { c.SetService(Service{Local: "http://a:80", HostPrefix: "app_1"}) },
+		"bad local scheme":   func(c *Config) { c.SetService(Service{Local: "ftp://a:21", HostPrefix: "app"}) },
+		"no local host":      func(c *Config) { c.SetService(Service{Local: "http://:80", HostPrefix: "app"}) },
+		"lan host":           func(c *Config) { c.SetService(Service{Local: "http://192.168.1.1:80", HostPrefix: "app"}) },
+		"other container":    func(c *Config) { c.SetService(Service{Local: "tcp://aospace-redis:6379", HostPrefix: "app"}) },
+		"nginx other port":   func(c *Config) { c.SetService(Service{Local: "tcp://aospace-nginx:22", HostPrefix: "app"}) },
+		"connections":        func(c *Config) { c.Options.RemoteConnections = 0 },
+		"log level":          func(c *Config) { c.Options.LogLevel = "verbose" },
+		"duration":           func(c *Config) { c.Options.RemoteTimeout = "70" },
+		"webrtc ports":       func(c *Config) { c.Options.WebrtcMinPort = 62001 },
+		"remote api":         func(c *Config) { c.Options.RemoteAPI = "" },
+	} {
+		c := testConfig()
+		bad(c)
+		if err := c.Validate(); err == nil {
+			t.Errorf("%v: Validate should fail", name)
+		}
+	}
+
+	for _, local := range []string{"http://localhost:8080", "tcp://[::1]:22", "https://aospace-nginx",
+		"http://aospace-gateway:8080"} {
+		if err := (&Service{Local: local, HostPrefix: "app"}).Validate(); err != nil {
+			t.Errorf("%v should be allowed, err:%v", local, err)
+		}
+	}
+
+	if !conf.DeleteService("app-token") || conf.DeleteService("app-token") || len(conf.Services) != 1 {
+		t.Errorf("DeleteService, services:%+v", conf.Services)
+	}
+}
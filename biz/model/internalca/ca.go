@@ -0,0 +1,293 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package internalca 内部接口双向 TLS 使用的本地 CA.
+// CA 为 docker 网桥上的内部接口签发服务端证书, 并为每个容器签发客户端证书(CN 为容器名),
+// 客户端证书通过 docker-compose 挂载到对应容器中.
+package internalca
+
+import (
+	"agent/config"
+	"agent/utils/logger"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dungeonsnd/gocom/file/fileutil"
+)
+
+const (
+	caCertFile     = "ca.pem"
+	caKeyFile      = "ca.key"
+	serverCertFile = "server.pem"
+	serverKeyFile  = "server.key"
+
+	ClientCertFile = "client.pem"
+	ClientKeyFile  = "client.key"
+	ClientCAFile   = "ca.pem"
+
+	caCommonName     = "AOSPACE AGENT INTERNAL CA"
+	serverCommonName = "aospace-agent"
+
+	renewBefore = 30 * 24 * time.Hour // 证书剩余有效期小于该值时重新签发
+)
+
+var (
+	caLock sync.Mutex
+	caCert *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+)
+
+// Enabled 内部接口是否启用了双向 TLS.
+func Enabled() bool {
+	return config.Config.Web.InternalMTLS.Enable
+}
+
+// ClientNames 返回需要签发客户端证书的容器名列表.
+func ClientNames() []string {
+	var names []string
+	for _, n := range strings.Split(config.Config.Web.InternalMTLS.Clients, ",") {
+		n = strings.TrimSpace(n)
+		if len(n) > 0 {
+			names = append(names, n)
+		}
+	}
+	return names
+}
+
+// ClientCertDirOf 返回指定容器的客户端证书在宿主机上的存储目录.
+func ClientCertDirOf(name string) string {
+	return filepath.Join(config.Config.Web.InternalMTLS.ClientCertDir, name)
+}
+
+// loadOrCreateCA 加载本地 CA, 不存在或即将过期时重新生成.
+func loadOrCreateCA() (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	caLock.Lock()
+	defer caLock.Unlock()
+
+	if caCert != nil && time.Until(caCert.NotAfter) > renewBefore {
+		return caCert, caKey, nil
+	}
+
+	dir := config.Config.Web.InternalMTLS.CADir
+	certFile := filepath.Join(dir, caCertFile)
+	keyFile := filepath.Join(dir, caKeyFile)
+
+	cert, key, err := readCertAndKey(certFile, keyFile)
+	if err == nil && cert.IsCA && time.Until(cert.NotAfter) > renewBefore {
+		caCert, caKey = cert, key
+		return caCert, caKey, nil
+	}
+	if err != nil {
+		logger.AppLogger().Infof("loadOrCreateCA, no usable internal CA in %v (%v), creating", dir, err)
+	} else {
+		logger.AppLogger().Infof("loadOrCreateCA, internal CA in %v is expiring at %v, recreating", dir, cert.NotAfter)
+	}
+
+	key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate CA key, err:%v", err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          newSerialNumber(),
+		Subject:               pkix.Name{CommonName: caCommonName, Organization: []string{"AO.space"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().AddDate(10, 0, 0),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create CA certificate, err:%v", err)
+	}
+	cert, err = x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := writeCertAndKey(certFile, keyFile, der, key); err != nil {
+		return nil, nil, err
+	}
+	caCert, caKey = cert, key
+	return caCert, caKey, nil
+}
+
+// issue 使用本地 CA 签发叶子证书.
+func issue(commonName string, extKeyUsage x509.ExtKeyUsage, dnsNames []string, ips []net.IP) ([]byte, *ecdsa.PrivateKey, error) {
+	ca, caPri, err := loadOrCreateCA()
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key for %v, err:%v", commonName, err)
+	}
+	days := config.Config.Web.InternalMTLS.CertValidDays
+	if days <= 0 {
+		days = 365
+	}
+	notAfter := time.Now().AddDate(0, 0, days)
+	if notAfter.After(ca.NotAfter) {
+		notAfter = ca.NotAfter
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: newSerialNumber(),
+		Subject:      pkix.Name{CommonName: commonName, Organization: []string{"AO.space"}},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:  []x509.ExtKeyUsage{extKeyUsage},
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caPri)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to issue certificate for %v, err:%v", commonName, err)
+	}
+	return der, key, nil
+}
+
+// EnsureClientCerts 为配置的每个容器签发客户端证书. 已存在且由当前 CA 签发、未临近过期的证书不会重新签发.
+func EnsureClientCerts() error {
+	ca, _, err := loadOrCreateCA()
+	if err != nil {
+		return err
+	}
+	caPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Raw})
+
+	for _, name := range ClientNames() {
+		dir := ClientCertDirOf(name)
+		certFile := filepath.Join(dir, ClientCertFile)
+		keyFile := filepath.Join(dir, ClientKeyFile)
+
+		if cert, _, err := readCertAndKey(certFile, keyFile); err == nil &&
+			cert.CheckSignatureFrom(ca) == nil && time.Until(cert.NotAfter) > renewBefore {
+			continue
+		}
+
+		der, key, err := issue(name, x509.ExtKeyUsageClientAuth, nil, nil)
+		if err != nil {
+			return err
+		}
+		if err := writeCertAndKey(certFile, keyFile, der, key); err != nil {
+			return err
+		}
+		if err := fileutil.WriteToFile(filepath.Join(dir, ClientCAFile), caPem, true); err != nil {
+			return fmt.Errorf("failed to write %v, err:%v", filepath.Join(dir, ClientCAFile), err)
+		}
+		logger.AppLogger().Infof("EnsureClientCerts, issued client certificate for %v", name)
+	}
+	return nil
+}
+
+// ServerTLSConfig 返回内部接口使用的 TLS 配置: 服务端证书由本地 CA 签发, 要求并校验客户端证书.
+// listenAddr 中的主机地址会加入服务端证书的 SAN.
+func ServerTLSConfig(listenAddr string) (*tls.Config, error) {
+	if err := EnsureClientCerts(); err != nil {
+		return nil, err
+	}
+	ca, _, err := loadOrCreateCA()
+	if err != nil {
+		return nil, err
+	}
+
+	dnsNames := []string{serverCommonName, "localhost", "aospace-all-in-one"}
+	ips := []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("172.17.0.1")}
+	if host, _, err := net.SplitHostPort(listenAddr); err == nil && len(host) > 0 {
+		if ip := net.ParseIP(host); ip != nil {
+			ips = append(ips, ip)
+		} else {
+			dnsNames = append(dnsNames, host)
+		}
+	}
+	der, key, err := issue(serverCommonName, x509.ExtKeyUsageServerAuth, dnsNames, ips)
+	if err != nil {
+		return nil, err
+	}
+	dir := config.Config.Web.InternalMTLS.CADir
+	if err := writeCertAndKey(filepath.Join(dir, serverCertFile), filepath.Join(dir, serverKeyFile), der, key); err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}, nil
+}
+
+// PeerIdentity 返回已校验的客户端证书身份(证书 CN, 即容器名). 非 TLS 请求返回空字符串.
+func PeerIdentity(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) < 1 || len(state.VerifiedChains[0]) < 1 {
+		return ""
+	}
+	return state.VerifiedChains[0][0].Subject.CommonName
+}
+
+func newSerialNumber() *big.Int {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return big.NewInt(time.Now().UnixNano())
+	}
+	return serial
+}
+
+func readCertAndKey(certFile, keyFile string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, nil, err
+	}
+	key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("unexpected key type %T in %v", pair.PrivateKey, keyFile)
+	}
+	return cert, key, nil
+}
+
+func writeCertAndKey(certFile, keyFile string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(certFile), 0755); err != nil {
+		return fmt.Errorf("failed to create dir %v, err:%v", filepath.Dir(certFile), err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600); err != nil {
+		return fmt.Errorf("failed to write %v, err:%v", keyFile, err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return fmt.Errorf("failed to write %v, err:%v", certFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,255 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package lanca 盒子的局域网根证书. 根私钥按 Keystore 配置加密保存, 用于签发局域网 HTTPS 使用的服务端证书.
+// 客户端通过配对二维码或公钥交换获得根证书指纹并固定(pin).
+package lanca
+
+import (
+	"agent/config"
+	"agent/utils/keystore"
+	"agent/utils/logger"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// Authority 局域网根证书和私钥.
+type Authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+var (
+	authority     *Authority
+	authorityLock sync.Mutex
+)
+
+// Load 返回根证书, 不存在时生成并保存.
+func Load() (*Authority, error) {
+	authorityLock.Lock()
+	defer authorityLock.Unlock()
+	if authority != nil {
+		return authority, nil
+	}
+
+	certFile := config.Config.Box.Cert.LanCA.RootCertFile
+	keyFile := config.Config.Box.Cert.LanCA.RootKeyFile
+	if err := migrateRootKey(keyFile); err != nil {
+		return nil, err
+	}
+	a, err := load(certFile, keyFile)
+	if os.IsNotExist(err) {
+		a, err = create(certFile, keyFile)
+	}
+	if err != nil {
+		return nil, err
+	}
+	authority = a
+	return authority, nil
+}
+
+// migrateRootKey 把之前版本保存在 CertDir 下的根私钥移动到 keyFile. CertDir 挂载到 nginx 容器, 根私钥不能留在其中.
+func migrateRootKey(keyFile string) error {
+	legacyFile := filepath.Join(config.Config.Box.Cert.CertDir, "lanca", "root.key")
+	if filepath.Clean(legacyFile) == filepath.Clean(keyFile) {
+		return nil
+	}
+	data, err := os.ReadFile(legacyFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer keystore.Zeroize(data)
+	if _, err := os.Stat(keyFile); os.IsNotExist(err) {
+		// 原样保存, 明文数据在 load 时按 Keystore 配置重新加密.
+		if err := keystore.WriteFile(keyFile, data, false); err != nil {
+			return err
+		}
+	} else if err != nil {
+		return err
+	}
+	if err := os.Remove(legacyFile); err != nil {
+		return err
+	}
+	logger.CertificateLogger().Infof("LAN root CA key moved from %v to %v", legacyFile, keyFile)
+	return nil
+}
+
+func load(certFile, keyFile string) (*Authority, error) {
+	certPem, err := os.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	keyDer, err := keystore.ReadFile(keyFile, keystore.Enabled())
+	if err != nil {
+		return nil, err
+	}
+	defer keystore.Zeroize(keyDer)
+
+	block, _ := pem.Decode(certPem)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, fmt.Errorf("invalid root certificate %v", certFile)
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("ParseCertificate err:%v", err)
+	}
+	key, err := x509.ParseECPrivateKey(keyDer)
+	if err != nil {
+		return nil, fmt.Errorf("ParseECPrivateKey err:%v", err)
+	}
+	if !key.PublicKey.Equal(cert.PublicKey) {
+		return nil, fmt.Errorf("root key does not match root certificate")
+	}
+	return &Authority{cert: cert, key: key}, nil
+}
+
+func create(certFile, keyFile string) (*Authority, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	serial, err := newSerial()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"AO.space"}, CommonName: "AO.space LAN Root CA"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(config.Config.Box.Cert.LanCA.RootValidYears, 0, 0),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		MaxPathLenZero:        true, // 只签发服务端证书, 不签发中间证书
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("CreateCertificate err:%v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	defer keystore.Zeroize(keyDer)
+	if err := keystore.WriteFile(keyFile, keyDer, keystore.Enabled()); err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(certFile), 0700); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		return nil, err
+	}
+	a := &Authority{cert: cert, key: key}
+	logger.CertificateLogger().Infof("LAN root CA created, fingerprint:%v", a.Fingerprint())
+	return a, nil
+}
+
+// Certificate 根证书.
+func (a *Authority) Certificate() *x509.Certificate {
+	return a.cert
+}
+
+// Fingerprint 根证书 DER 的 SHA256, 小写十六进制.
+func (a *Authority) Fingerprint() string {
+	return Fingerprint(a.cert.Raw)
+}
+
+// Issue 为 pub 签发服务端证书, 返回 DER.
+func (a *Authority) Issue(pub crypto.PublicKey, dnsNames []string, ips []net.IP, validity time.Duration) ([]byte, error) {
+	serial, err := newSerial()
+	if err != nil {
+		return nil, err
+	}
+	commonName := ""
+	if len(dnsNames) > 0 {
+		commonName = dnsNames[0]
+	} else if len(ips) > 0 {
+		commonName = ips[0].String()
+	}
+	now := time.Now()
+	notAfter := now.Add(validity)
+	if notAfter.After(a.cert.NotAfter) {
+		notAfter = a.cert.NotAfter
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"AO.space"}, CommonName: commonName},
+		DNSNames:              dnsNames,
+		IPAddresses:           ips,
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              notAfter,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	return x509.CreateCertificate(rand.Reader, tmpl, a.cert, pub, a.key)
+}
+
+// IssuedBy 判断 cert 是否由本根证书签发.
+func (a *Authority) IssuedBy(cert *x509.Certificate) bool {
+	return cert.CheckSignatureFrom(a.cert) == nil
+}
+
+// RootFingerprint 返回根证书指纹. 根证书尚未生成时返回空字符串, 不会生成新的根证书.
+func RootFingerprint() string {
+	authorityLock.Lock()
+	a := authority
+	authorityLock.Unlock()
+	if a != nil {
+		return a.Fingerprint()
+	}
+	b, err := os.ReadFile(config.Config.Box.Cert.LanCA.RootCertFile)
+	if err != nil {
+		return ""
+	}
+	block, _ := pem.Decode(b)
+	if block == nil {
+		return ""
+	}
+	return Fingerprint(block.Bytes)
+}
+
+// Fingerprint 证书 DER 的 SHA256, 小写十六进制.
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+func newSerial() (*big.Int, error) {
+	return rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+}
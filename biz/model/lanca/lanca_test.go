@@ -0,0 +1,117 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package lanca
+
+import (
+	"agent/config"
+	"agent/utils/keystore"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func setupTestAuthority(t *testing.T) {
+	dir := t.TempDir()
+	certDir, keystoreEnable := config.Config.Box.Cert.CertDir, config.Config.Box.Keystore.Enable
+	config.Config.Box.Cert.CertDir = filepath.Join(dir, "certs")
+	config.Config.Box.Cert.LanCA.RootCertFile = filepath.Join(dir, "certs", "lanca", "root.pem")
+	config.Config.Box.Cert.LanCA.RootKeyFile = filepath.Join(dir, "lanca", "root.key")
+	config.Config.Box.Keystore.Enable = true
+	authority = nil
+	t.Cleanup(func() {
+		authority = nil
+		config.Config.Box.Cert.CertDir, config.Config.Box.Keystore.Enable = certDir, keystoreEnable
+	})
+}
+
+func TestIssueAndReload(t *testing.T) {
+	if _, err := keystore.MachineSecret(); err != nil {
+		t.Skipf("no machine secret, err:%v", err)
+	}
+	setupTestAuthority(t)
+
+	if len(RootFingerprint()) > 0 {
+		t.Fatal("RootFingerprint should not create root CA")
+	}
+	ca, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyOnDisk, _ := os.ReadFile(config.Config.Box.Cert.LanCA.RootKeyFile)
+	if !keystore.IsProtected(keyOnDisk) {
+		t.Fatal("root key not sealed")
+	}
+
+	leafKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	der, err := ca.Issue(&leafKey.PublicKey, []string{"aospace.local"},
+		[]net.IP{net.ParseIP("192.168.1.20"), net.ParseIP("fd00::20")}, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, _ := x509.ParseCertificate(der)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Certificate())
+	for _, name := range []string{"192.168.1.20", "fd00::20", "aospace.local"} {
+		if _, err := leaf.Verify(x509.VerifyOptions{DNSName: name, Roots: roots}); err != nil {
+			t.Errorf("Verify %v err:%v", name, err)
+		}
+	}
+
+	// 重新加载得到相同的根证书.
+	fp := ca.Fingerprint()
+	authority = nil
+	if got := RootFingerprint(); got != fp {
+		t.Fatalf("RootFingerprint:%v, want:%v", got, fp)
+	}
+	ca2, err := Load()
+	if err != nil || ca2.Fingerprint() != fp || !ca2.IssuedBy(leaf) {
+		t.Fatalf("reload root CA, err:%v", err)
+	}
+}
+
+func TestMigrateRootKeyOutOfCertDir(t *testing.T) {
+	if _, err := keystore.MachineSecret(); err != nil {
+		t.Skipf("no machine secret, err:%v", err)
+	}
+	setupTestAuthority(t)
+	ca, err := Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := ca.Fingerprint()
+
+	// 模拟之前版本保存在 CertDir 下的根私钥
+	keyFile := config.Config.Box.Cert.LanCA.RootKeyFile
+	legacyFile := filepath.Join(config.Config.Box.Cert.CertDir, "lanca", "root.key")
+	if err := os.Rename(keyFile, legacyFile); err != nil {
+		t.Fatal(err)
+	}
+	authority = nil
+	ca, err = Load()
+	if err != nil || ca.Fingerprint() != fp {
+		t.Fatalf("load migrated root CA, err:%v", err)
+	}
+	if _, err := os.Stat(legacyFile); !os.IsNotExist(err) {
+		t.Fatalf("root key left in CertDir, err:%v", err)
+	}
+	if _, err := os.Stat(keyFile); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,44 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"agent/utils/logger"
+	"time"
+)
+
+const AgentTokenRefreshEvent = "agent_token_refresh"
+
+// OnAgentTokenRefreshed 设备密钥轮换后把重新签发的 agent token 推送给客户端.
+func OnAgentTokenRefreshed(clientUUID, agentToken string, graceUntil time.Time) error {
+	logger.NotificationLogger().Debugf("OnAgentTokenRefreshed, clientUUID:%v", clientUUID)
+
+	type TokenInfo struct {
+		AgentToken string `json:"agentToken"`
+		GraceUntil string `json:"graceUntil"` // 旧 token 的失效时间
+	}
+	info := &TokenInfo{AgentToken: agentToken, GraceUntil: graceUntil.UTC().Format(time.RFC3339)}
+	var err1 error
+	for i := 0; i < 3; i++ {
+		_, err1 = storeIntoRedis(clientUUID, AgentTokenRefreshEvent, info)
+		if err1 == nil {
+			break
+		}
+		logger.NotificationLogger().Debugf("storeIntoRedis, waiting storeIntoRedis, err1:%v", err1)
+		time.Sleep(time.Duration(1) * time.Second)
+	}
+	logger.NotificationLogger().Debugf("storeIntoRedis, loop break, err1:%v", err1)
+	return err1
+}
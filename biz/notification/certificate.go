@@ -0,0 +1,54 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"agent/utils/logger"
+	"time"
+)
+
+const CertificateExpiringEvent = "certificate_expiring"
+
+// OnCertificateExpiring 证书距离过期的天数达到提醒阈值时推送给管理员客户端.
+func OnCertificateExpiring(source, path, subject string, notAfter time.Time, daysLeft, threshold int) error {
+	logger.NotificationLogger().Debugf("OnCertificateExpiring, source:%v, path:%v, daysLeft:%v", source, path, daysLeft)
+
+	clientUUID, err := clientUuid()
+	if err != nil {
+		return err
+	}
+
+	type CertInfo struct {
+		Source    string `json:"source"`
+		Path      string `json:"path"`
+		Subject   string `json:"subject"`
+		NotAfter  string `json:"notAfter"`
+		DaysLeft  int    `json:"daysLeft"`
+		Threshold int    `json:"threshold"`
+	}
+	info := &CertInfo{Source: source, Path: path, Subject: subject,
+		NotAfter: notAfter.UTC().Format(time.RFC3339), DaysLeft: daysLeft, Threshold: threshold}
+	var err1 error
+	for i := 0; i < 3; i++ {
+		_, err1 = storeIntoRedis(clientUUID, CertificateExpiringEvent, info)
+		if err1 == nil {
+			break
+		}
+		logger.NotificationLogger().Debugf("storeIntoRedis, waiting storeIntoRedis, err1:%v", err1)
+		time.Sleep(time.Duration(1) * time.Second)
+	}
+	logger.NotificationLogger().Debugf("storeIntoRedis, loop break, err1:%v", err1)
+	return err1
+}
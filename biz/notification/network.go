@@ -0,0 +1,78 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package notification
+
+import (
+	"agent/biz/model/dto/pair"
+	"agent/utils/logger"
+	"time"
+)
+
+const LanAddressChangedEvent = "lan_address_changed"
+
+// OnLanAddressChanged 盒子局域网地址变化后通知网关和管理员客户端, 避免继续使用旧的局域网地址.
+func OnLanAddressChanged(networks []*pair.Network) error {
+	logger.NotificationLogger().Debugf("OnLanAddressChanged, networks:%+v", networks)
+
+	clientUUID, err := clientUuid()
+	if err != nil {
+		return err
+	}
+
+	type LanAddressInfo struct {
+		Networks []*pair.Network `json:"networks"`
+	}
+	info := &LanAddressInfo{Networks: networks}
+	var err1 error
+	for i := 0; i < 3; i++ {
+		_, err1 = storeIntoRedis(clientUUID, LanAddressChangedEvent, info)
+		if err1 == nil {
+			break
+		}
+		logger.NotificationLogger().Debugf("storeIntoRedis, waiting storeIntoRedis, err1:%v", err1)
+		time.Sleep(time.Duration(1) * time.Second)
+	}
+	logger.NotificationLogger().Debugf("storeIntoRedis, loop break, err1:%v", err1)
+	return err1
+}
+
+const DirectAddressChangedEvent = "direct_address_changed"
+
+// OnDirectAddressChanged 路由器端口映射得到的直连地址变化后通知网关. available 为 false 时网关不再对外公布直连地址, 客户端走隧道.
+func OnDirectAddressChanged(address string, available bool) error {
+	logger.NotificationLogger().Debugf("OnDirectAddressChanged, address:%v, available:%v", address, available)
+
+	clientUUID, err := clientUuid()
+	if err != nil {
+		return err
+	}
+
+	type DirectAddressInfo struct {
+		Address   string `json:"address"`
+		Available bool   `json:"available"`
+	}
+	info := &DirectAddressInfo{Address: address, Available: available}
+	var err1 error
+	for i := 0; i < 3; i++ {
+		_, err1 = storeIntoRedis(clientUUID, DirectAddressChangedEvent, info)
+		if err1 == nil {
+			break
+		}
+		logger.NotificationLogger().Debugf("storeIntoRedis, waiting storeIntoRedis, err1:%v", err1)
+		time.Sleep(time.Duration(1) * time.Second)
+	}
+	logger.NotificationLogger().Debugf("storeIntoRedis, loop break, err1:%v", err1)
+	return err1
+}
@@ -15,9 +15,11 @@
 package base
 
 import (
+	"agent/biz/model/clientinfo"
 	"agent/biz/model/device"
 	"agent/biz/model/device_ability"
 	"agent/biz/service/encwrapper"
+	"agent/config"
 	"agent/utils/jwt"
 	"agent/utils/logger"
 	"fmt"
@@ -26,13 +28,59 @@ import (
 
 const (
 	TokenTypeBind = "BIND_API_TOKEN"
+
+	agentTokenLifetime = 24 * time.Hour * 365 * 3
 )
 
+// VerifyAgentToken 校验 agent token. 设备密钥轮换后, 宽限期内旧密钥签发的 token 仍然有效.
+// 未开启 BoxKey.EnforceAgentToken 时与之前一样不校验, 兼容不携带或携带无效 token 的旧客户端; 开启后 token 不能为空.
 func VerifyAgentToken(agentToken string) error {
-	if device_ability.GetAbilityModel().SecurityChipSupport {
+	if !config.Config.Box.BoxKey.EnforceAgentToken {
+		return nil
+	}
+	if len(agentToken) < 1 {
+		return fmt.Errorf("empty agent token")
+	}
 
+	var issuer string
+	var audience []string
+	var err error
+	if device_ability.GetAbilityModel().SecurityChipSupport {
+		issuer, _, audience, _, err = jwt.ParseJwt(agentToken, nil)
+		if err != nil {
+			return fmt.Errorf("failed ParseJwt, err:%v", err)
+		}
 	} else {
+		pub, err1 := encwrapper.GetPublicKey(string(device.GetDevicePubKey()))
+		if err1 != nil {
+			return err1
+		}
+		issuer, _, audience, _, err = jwt.ParseJwt(agentToken, pub)
+		if err != nil {
+			previousPubKey, ok := device.GetPreviousDevicePubKey()
+			if !ok {
+				return fmt.Errorf("failed ParseJwt, err:%v", err)
+			}
+			previousPub, err1 := encwrapper.GetPublicKey(string(previousPubKey))
+			if err1 != nil {
+				return err1
+			}
+			issuer, _, audience, _, err1 = jwt.ParseJwt(agentToken, previousPub)
+			if err1 != nil {
+				return fmt.Errorf("failed ParseJwt, err:%v", err)
+			}
+			logger.AppLogger().Debugf("VerifyAgentToken, token signed by previous device key")
+		}
+	}
 
+	if issuer != device.GetDeviceInfo().BoxUuid {
+		return fmt.Errorf("unexpected issuer:%v", issuer)
+	}
+	// 升级前签发的 token 没有记录, 校验通过后补充, 以便设备密钥轮换时重新签发
+	for _, clientUuid := range audience {
+		if err := seedAgentTokenRecord(clientUuid, time.Now().Add(agentTokenLifetime)); err != nil {
+			logger.AppLogger().Warnf("VerifyAgentToken, failed seedAgentTokenRecord, err:%v", err)
+		}
 	}
 	return nil
 }
@@ -40,7 +88,48 @@ func VerifyAgentToken(agentToken string) error {
 func CreateAgentToken(clientUuid string) (string, error) {
 	logger.AppLogger().Debugf("CreateAgentToken")
 
-	expiredAt := time.Now().Add(24 * time.Hour * 365 * 3)
+	expiredAt := time.Now().Add(agentTokenLifetime)
+	jwtToken, err := createAgentToken(clientUuid, expiredAt)
+	if err != nil {
+		return "", err
+	}
+	if err := recordAgentToken(clientUuid, expiredAt); err != nil {
+		logger.AppLogger().Warnf("CreateAgentToken, failed recordAgentToken, err:%v", err)
+	}
+	return jwtToken, nil
+}
+
+// ReissueAgentTokens 使用当前设备密钥重新签发所有未过期的 agent token, 过期时间不变.
+// 返回 clientUuid 到新 token 的映射.
+func ReissueAgentTokens() (map[string]string, error) {
+	records, err := loadAgentTokenRecords()
+	if err != nil {
+		return nil, err
+	}
+	tokens := make(map[string]string)
+	now := time.Now()
+	// 升级前签发给管理员客户端的 token 没有记录, 补充后一起重新签发
+	if info := clientinfo.GetAdminPairedInfo(); info != nil && info.AlreadyBound() && len(info.ClientUuid) > 0 {
+		if _, ok := records[info.ClientUuid]; !ok {
+			records[info.ClientUuid] = &agentTokenRecord{IssuedAt: now, ExpiresAt: now.Add(agentTokenLifetime)}
+		}
+	}
+	for clientUuid, record := range records {
+		if now.After(record.ExpiresAt) {
+			delete(records, clientUuid)
+			continue
+		}
+		jwtToken, err := createAgentToken(clientUuid, record.ExpiresAt)
+		if err != nil {
+			return tokens, fmt.Errorf("failed to reissue agent token of %v, err:%v", clientUuid, err)
+		}
+		record.IssuedAt = now
+		tokens[clientUuid] = jwtToken
+	}
+	return tokens, saveAgentTokenRecords(records)
+}
+
+func createAgentToken(clientUuid string, expiredAt time.Time) (string, error) {
 
 	if device_ability.GetAbilityModel().SecurityChipSupport {
 		logger.AppLogger().Debugf("createAgentToken, using SecurityChipSupport, clientUuid: %v", clientUuid)
@@ -0,0 +1,101 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package base
+
+import (
+	"agent/config"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dungeonsnd/gocom/file/fileutil"
+)
+
+// agentTokenRecord 已签发的 agent token, 不保存 token 本身, 只用于设备密钥轮换后重新签发.
+type agentTokenRecord struct {
+	IssuedAt  time.Time `json:"issuedAt"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
+
+var agentTokenRecordLock sync.Mutex
+
+func recordAgentToken(clientUuid string, expiresAt time.Time) error {
+	agentTokenRecordLock.Lock()
+	defer agentTokenRecordLock.Unlock()
+
+	records, err := readAgentTokenRecords()
+	if err != nil {
+		return err
+	}
+	records[clientUuid] = &agentTokenRecord{IssuedAt: time.Now(), ExpiresAt: expiresAt}
+	return writeAgentTokenRecords(records)
+}
+
+// seedAgentTokenRecord 没有记录时补充一条, 已有记录不修改.
+func seedAgentTokenRecord(clientUuid string, expiresAt time.Time) error {
+	agentTokenRecordLock.Lock()
+	defer agentTokenRecordLock.Unlock()
+
+	records, err := readAgentTokenRecords()
+	if err != nil {
+		return err
+	}
+	if _, ok := records[clientUuid]; ok {
+		return nil
+	}
+	records[clientUuid] = &agentTokenRecord{IssuedAt: time.Now(), ExpiresAt: expiresAt}
+	return writeAgentTokenRecords(records)
+}
+
+func loadAgentTokenRecords() (map[string]*agentTokenRecord, error) {
+	agentTokenRecordLock.Lock()
+	defer agentTokenRecordLock.Unlock()
+	return readAgentTokenRecords()
+}
+
+func saveAgentTokenRecords(records map[string]*agentTokenRecord) error {
+	agentTokenRecordLock.Lock()
+	defer agentTokenRecordLock.Unlock()
+	return writeAgentTokenRecords(records)
+}
+
+func readAgentTokenRecords() (map[string]*agentTokenRecord, error) {
+	records := make(map[string]*agentTokenRecord)
+	f := config.Config.Box.AgentTokenRecordFile
+	if fileutil.IsFileNotExist(f) {
+		return records, nil
+	}
+	b, err := fileutil.ReadFromFile(f)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &records); err != nil {
+		return nil, fmt.Errorf("failed to parse %v, err:%v", f, err)
+	}
+	return records, nil
+}
+
+func writeAgentTokenRecords(records map[string]*agentTokenRecord) error {
+	b, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+	f := config.Config.Box.AgentTokenRecordFile
+	if err := fileutil.WriteToFile(f, b, true); err != nil {
+		return fmt.Errorf("failed to write %v, err:%v", f, err)
+	}
+	return nil
+}
@@ -16,6 +16,8 @@ package password
 
 import (
 	"agent/biz/model/clientinfo"
+	"agent/biz/model/did"
+	"agent/biz/model/did/leveldb"
 	"agent/biz/model/dto"
 	"agent/biz/model/dto/bind/password"
 	"agent/biz/service/base"
@@ -65,6 +67,10 @@ func (svc *VerifyService) Process() dto.BaseRspStr {
 			return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, Message: err.Error()}
 		}
 		rsp.AgentToken = jwtToken
+
+		if err := verifyPasswordKey(req.Password); err != nil {
+			logger.AppLogger().Warnf("verifyPasswordKey, err:%v", err)
+		}
 	}
 
 	svc.Rsp = rsp
@@ -83,3 +89,16 @@ func doCheck(password string, clientUUID string) (*call.MicroServerRsp, error) {
 	}
 	return &results, nil
 }
+
+// verifyPasswordKey 空间密码校验通过后解密管理员的密码私钥, 旧格式的数据在此时升级.
+func verifyPasswordKey(password string) error {
+	levelDBTrans, err := leveldb.BeginTransaction()
+	if err != nil {
+		return fmt.Errorf("BeginTransaction err:%v", err)
+	}
+	defer levelDBTrans.Rollback()
+	if err := did.VerifyPasswordKey(levelDBTrans, did.AdminAoId, password); err != nil {
+		return err
+	}
+	return levelDBTrans.Commit()
+}
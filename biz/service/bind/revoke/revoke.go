@@ -19,6 +19,7 @@ import (
 	"agent/biz/model/dto/bind/revoke"
 	"agent/biz/service/base"
 	"agent/biz/service/call"
+	"agent/biz/service/did/document/deactivate"
 	"agent/config"
 	"fmt"
 
@@ -57,6 +58,11 @@ func (svc *RevokeService) Process() dto.BaseRspStr {
 		Results:   microServerRsp.Results}
 
 	if microServerRsp.Code == dto.GatewayCodeOkStr || microServerRsp.Code == dto.AccountCodeOkStr {
+		// 解绑成功, 注销所有 DID. 账号已解绑, 注销失败只记录日志
+		if _, err := deactivate.DeactivateAll(); err != nil {
+			logger.AppLogger().Errorf("failed DeactivateAll, err:%v", err)
+		}
+
 		jwtToken, err := base.CreateAgentToken(req.ClientUuid)
 		if err != nil {
 			logger.AppLogger().Debugf("%v", err)
@@ -239,7 +239,7 @@ func (svc *SpaceCreateService) createDid(levelDBTrans *leveldb.Trans, req *creat
 	// }
 	// logger.AppLogger().Debugf("aoId:%+v", aoId)
 
-	aoId := "aoid-1"
+	aoId := did.AdminAoId
 
 	encryptedPriKeyBytes, didDocBytes, didStr, err := did.CreateDocument(levelDBTrans, aoId, req.Password, req.VerifyMethod)
 	if err != nil {
@@ -0,0 +1,463 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certificate
+
+import (
+	"agent/biz/model/clientinfo"
+	"agent/config"
+	"agent/utils/docker/dockerfacade"
+	"agent/utils/logger"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	cr "crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/robfig/cron/v3"
+	"golang.org/x/crypto/acme"
+)
+
+const (
+	acmeDirName        = "acme"
+	acmeAccountKeyFile = "account.key"
+	acmeLiveLink       = "live" // 指向当前证书版本目录的符号链接, nginx 引用 live/fullchain.pem 和 live/privkey.pem
+	acmeFullchainFile  = "fullchain.pem"
+	acmePrivkeyFile    = "privkey.pem"
+	acmeKeepVersions   = 2 // 保留当前和上一版本证书, 用于回滚
+	acmeUserAgent      = "aospace-agent"
+)
+
+// ACMEManager 通过 ACME 协议(RFC 8555)申请和续期证书, 使用 DNS-01 验证.
+// 每次签发的证书写入 Dir 下新的版本目录, 再原子替换 live 符号链接并重载 nginx.
+type ACMEManager struct {
+	DirectoryURL       string
+	Email              string
+	Dir                string // 账户密钥和证书目录
+	Provider           DNSProvider
+	RenewBefore        time.Duration // 距离过期不足该时间时续期
+	PropagationTimeout time.Duration // 等待 TXT 记录生效的最长时间, 为 0 时不等待
+	Reload             func() error  // 替换证书后调用, 失败时回滚到上一版本. 为 nil 时不重载
+	HTTPClient         *http.Client  // 为 nil 时使用 http.DefaultClient
+
+	lookupTXT func(domain string) ([]string, error)
+	mu        sync.Mutex
+}
+
+// NewACMEManager 按配置创建, 使用平台 DNS 接口和 nginx 容器.
+func NewACMEManager() *ACMEManager {
+	cfg := config.Config.Box.Cert.ACME
+	return &ACMEManager{
+		DirectoryURL:       cfg.DirectoryURL,
+		Email:              config.Config.Box.Cert.ACMERegisterEmail,
+		Dir:                filepath.Join(config.Config.Box.Cert.CertDir, acmeDirName),
+		Provider:           &PlatformDNSProvider{},
+		RenewBefore:        time.Duration(cfg.RenewBeforeDays) * 24 * time.Hour,
+		PropagationTimeout: time.Duration(cfg.DNSPropagationSeconds) * time.Second,
+		Reload:             ReloadNginx,
+	}
+}
+
+// CertFile 当前证书链文件.
+func (m *ACMEManager) CertFile() string {
+	return filepath.Join(m.Dir, acmeLiveLink, acmeFullchainFile)
+}
+
+// KeyFile 当前证书私钥文件.
+func (m *ACMEManager) KeyFile() string {
+	return filepath.Join(m.Dir, acmeLiveLink, acmePrivkeyFile)
+}
+
+// RenewIfNeeded 当前证书不存在、不包含全部 domains 或即将过期时重新申请. 返回是否签发了新证书.
+func (m *ACMEManager) RenewIfNeeded(ctx context.Context, domains []string) (bool, error) {
+	if crt, err := ReadCert(m.CertFile(), m.KeyFile()); err == nil && !m.needRenew(crt, domains) {
+		logger.CertificateLogger().Debugf("RenewIfNeeded, certificate of %v valid until %v", domains, crt.NotAfter)
+		return false, nil
+	}
+	if _, err := m.Obtain(ctx, domains); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func (m *ACMEManager) needRenew(crt *x509.Certificate, domains []string) bool {
+	if time.Until(crt.NotAfter) < m.RenewBefore {
+		return true
+	}
+	names := make(map[string]bool)
+	for _, name := range crt.DNSNames {
+		names[name] = true
+	}
+	for _, domain := range domains {
+		if !names[domain] {
+			return true
+		}
+	}
+	return false
+}
+
+// Obtain 注册账户(已注册时复用)、创建订单、完成 DNS-01 验证并签发证书, 然后替换当前证书.
+func (m *ACMEManager) Obtain(ctx context.Context, domains []string) (*x509.Certificate, error) {
+	if len(domains) < 1 {
+		return nil, errors.New("no domain")
+	}
+	if m.Provider == nil {
+		return nil, errors.New("no dns provider")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	client, err := m.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+	order, err := client.AuthorizeOrder(ctx, acme.DomainIDs(domains...))
+	if err != nil {
+		return nil, fmt.Errorf("AuthorizeOrder err:%v", err)
+	}
+	for _, url := range order.AuthzURLs {
+		if err := m.authorize(ctx, client, url); err != nil {
+			return nil, err
+		}
+	}
+	order, err = client.WaitOrder(ctx, order.URI)
+	if err != nil {
+		return nil, fmt.Errorf("WaitOrder err:%v", err)
+	}
+
+	key, err := GeneratePriKey()
+	if err != nil {
+		return nil, fmt.Errorf("GeneratePriKey err:%v", err)
+	}
+	csr, err := x509.CreateCertificateRequest(cr.Reader, &x509.CertificateRequest{
+		Subject:  pkix.Name{CommonName: domains[0]},
+		DNSNames: domains,
+	}, key)
+	if err != nil {
+		return nil, fmt.Errorf("CreateCertificateRequest err:%v", err)
+	}
+	der, certURL, err := client.CreateOrderCert(ctx, order.FinalizeURL, csr, true)
+	if err != nil {
+		return nil, fmt.Errorf("CreateOrderCert err:%v", err)
+	}
+	leaf, err := verifyIssuedCert(der, key, domains)
+	if err != nil {
+		return nil, err
+	}
+	logger.CertificateLogger().Infof("Obtain, certificate of %v issued, url:%v, notAfter:%v", domains, certURL, leaf.NotAfter)
+
+	chainPem := make([]byte, 0)
+	for _, b := range der {
+		chainPem = append(chainPem, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: b})...)
+	}
+	keyPem := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := m.install(chainPem, keyPem); err != nil {
+		return nil, err
+	}
+	return leaf, nil
+}
+
+// client 返回已注册账户的 ACME 客户端. 账户密钥不存在时生成.
+func (m *ACMEManager) client(ctx context.Context) (*acme.Client, error) {
+	key, err := m.accountKey()
+	if err != nil {
+		return nil, err
+	}
+	client := &acme.Client{Key: key, DirectoryURL: m.DirectoryURL, HTTPClient: m.HTTPClient, UserAgent: acmeUserAgent}
+	account := &acme.Account{}
+	if len(m.Email) > 0 {
+		account.Contact = []string{"mailto:" + m.Email}
+	}
+	if _, err := client.Register(ctx, account, acme.AcceptTOS); err != nil && err != acme.ErrAccountAlreadyExists {
+		return nil, fmt.Errorf("Register err:%v", err)
+	}
+	return client, nil
+}
+
+func (m *ACMEManager) accountKey() (crypto.Signer, error) {
+	f := filepath.Join(m.Dir, acmeAccountKeyFile)
+	if b, err := os.ReadFile(f); err == nil {
+		block, _ := pem.Decode(b)
+		if block == nil || block.Type != "EC PRIVATE KEY" {
+			return nil, fmt.Errorf("invalid account key %v", f)
+		}
+		return x509.ParseECPrivateKey(block.Bytes)
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), cr.Reader)
+	if err != nil {
+		return nil, err
+	}
+	b, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(m.Dir, 0700); err != nil {
+		return nil, err
+	}
+	if err := writeFileSync(f, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: b}), 0600); err != nil {
+		return nil, fmt.Errorf("failed to write account key, err:%v", err)
+	}
+	logger.CertificateLogger().Infof("ACME account key generated, %v", f)
+	return key, nil
+}
+
+// authorize 完成一个授权的 DNS-01 验证. 已经有效的授权直接跳过.
+func (m *ACMEManager) authorize(ctx context.Context, client *acme.Client, url string) error {
+	authz, err := client.GetAuthorization(ctx, url)
+	if err != nil {
+		return fmt.Errorf("GetAuthorization err:%v", err)
+	}
+	if authz.Status == acme.StatusValid {
+		return nil
+	}
+	var chal *acme.Challenge
+	for _, c := range authz.Challenges {
+		if c.Type == "dns-01" {
+			chal = c
+			break
+		}
+	}
+	if chal == nil {
+		return fmt.Errorf("no dns-01 challenge for %v", authz.Identifier.Value)
+	}
+	value, err := client.DNS01ChallengeRecord(chal.Token)
+	if err != nil {
+		return err
+	}
+
+	domain := authz.Identifier.Value
+	fqdn := acmeChallengeFQDN(domain)
+	if err := m.Provider.Present(ctx, fqdn, value); err != nil {
+		return fmt.Errorf("failed to present TXT %v, err:%v", fqdn, err)
+	}
+	defer func() {
+		if err := m.Provider.CleanUp(ctx, fqdn, value); err != nil {
+			logger.CertificateLogger().Warnf("failed to clean up TXT %v, err:%v", fqdn, err)
+		}
+	}()
+	m.waitPropagation(ctx, domain, value)
+
+	if _, err := client.Accept(ctx, chal); err != nil {
+		return fmt.Errorf("Accept err:%v", err)
+	}
+	if _, err := client.WaitAuthorization(ctx, authz.URI); err != nil {
+		return fmt.Errorf("WaitAuthorization of %v err:%v", domain, err)
+	}
+	logger.CertificateLogger().Infof("authorize, %v authorized", domain)
+	return nil
+}
+
+// waitPropagation 等待 TXT 记录可以查询到. 超时后仍然继续, 由 CA 给出最终结果.
+func (m *ACMEManager) waitPropagation(ctx context.Context, domain, value string) {
+	if m.PropagationTimeout <= 0 {
+		return
+	}
+	lookup := m.lookupTXT
+	if lookup == nil {
+		lookup = CheckDNSTXT
+	}
+	deadline := time.Now().Add(m.PropagationTimeout)
+	for {
+		values, _ := lookup(domain)
+		for _, v := range values {
+			if v == value {
+				return
+			}
+		}
+		if time.Now().After(deadline) {
+			logger.CertificateLogger().Warnf("waitPropagation, TXT of %v not found in %v", domain, m.PropagationTimeout)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func verifyIssuedCert(der [][]byte, key crypto.Signer, domains []string) (*x509.Certificate, error) {
+	if len(der) < 1 {
+		return nil, errors.New("empty certificate chain")
+	}
+	leaf, err := x509.ParseCertificate(der[0])
+	if err != nil {
+		return nil, fmt.Errorf("ParseCertificate err:%v", err)
+	}
+	pub, ok := leaf.PublicKey.(interface{ Equal(crypto.PublicKey) bool })
+	if !ok || !pub.Equal(key.Public()) {
+		return nil, errors.New("issued certificate does not match private key")
+	}
+	names := make(map[string]bool)
+	for _, name := range leaf.DNSNames {
+		names[name] = true
+	}
+	for _, domain := range domains {
+		if !names[domain] {
+			return nil, fmt.Errorf("issued certificate does not contain %v", domain)
+		}
+	}
+	return leaf, nil
+}
+
+// install 写入新的版本目录后原子替换 live 链接并重载, 重载失败时恢复上一版本.
+func (m *ACMEManager) install(chainPem, keyPem []byte) error {
+	version := time.Now().UTC().Format("20060102T150405.000000Z")
+	if err := os.MkdirAll(m.Dir, 0700); err != nil {
+		return err
+	}
+	if err := os.Mkdir(filepath.Join(m.Dir, version), 0700); err != nil {
+		return err
+	}
+	if err := writeFileSync(filepath.Join(m.Dir, version, acmePrivkeyFile), keyPem, 0600); err != nil {
+		return err
+	}
+	if err := writeFileSync(filepath.Join(m.Dir, version, acmeFullchainFile), chainPem, 0644); err != nil {
+		return err
+	}
+
+	previous, _ := os.Readlink(filepath.Join(m.Dir, acmeLiveLink))
+	if err := m.switchLive(version); err != nil {
+		return err
+	}
+	if m.Reload != nil {
+		if err := m.Reload(); err != nil {
+			logger.CertificateLogger().Errorf("install, reload err:%v, roll back to %v", err, previous)
+			if len(previous) > 0 {
+				if err1 := m.switchLive(previous); err1 == nil {
+					m.Reload()
+				}
+			}
+			os.RemoveAll(filepath.Join(m.Dir, version))
+			return fmt.Errorf("reload err:%v", err)
+		}
+	}
+	logger.CertificateLogger().Infof("install, certificate version %v installed", version)
+	m.pruneVersions(version)
+	return nil
+}
+
+// switchLive 用 rename 原子替换 live 链接. 链接目标为相对路径, 挂载到容器中同样有效.
+func (m *ACMEManager) switchLive(version string) error {
+	tmp := filepath.Join(m.Dir, acmeLiveLink+".tmp")
+	os.Remove(tmp)
+	if err := os.Symlink(version, tmp); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(m.Dir, acmeLiveLink))
+}
+
+func (m *ACMEManager) pruneVersions(current string) {
+	entries, err := os.ReadDir(m.Dir)
+	if err != nil {
+		return
+	}
+	versions := make([]string, 0)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			versions = append(versions, entry.Name())
+		}
+	}
+	sort.Strings(versions)
+	for i := 0; i < len(versions)-acmeKeepVersions; i++ {
+		if versions[i] != current {
+			os.RemoveAll(filepath.Join(m.Dir, versions[i]))
+		}
+	}
+}
+
+func writeFileSync(name string, data []byte, perm os.FileMode) error {
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReloadNginx 在 nginx 容器中先执行 nginx -t 检查配置和证书, 通过后执行 nginx -s reload.
+// nginx -s reload 只是发送信号, 新配置加载失败时仍然返回 0, 因此证书错误需要由 nginx -t 发现.
+func ReloadNginx() error {
+	dockerApi := dockerfacade.NewDockerFacade()
+	cid, err := dockerApi.FindContainer(config.Config.Docker.NginxContainerName)
+	if err != nil {
+		logger.CertificateLogger().Errorf("find nginx container err:%v", err)
+		return err
+	}
+	if len(cid) < 1 {
+		return fmt.Errorf("container %v not found", config.Config.Docker.NginxContainerName)
+	}
+	if err := dockerApi.Exec(cid, []string{"nginx", "-t"}); err != nil {
+		logger.CertificateLogger().Errorf("nginx config test err:%v", err)
+		return err
+	}
+	if err := dockerApi.Exec(cid, []string{"nginx", "-s", "reload"}); err != nil {
+		logger.CertificateLogger().Errorf("reload nginx err:%v", err)
+		return err
+	}
+	return nil
+}
+
+// CronForACME 启用 ACME 时启动检查, 并按 RenewCron 定时续期管理员域名的证书.
+func CronForACME() {
+	if !config.Config.Box.Cert.ACME.Enable {
+		return
+	}
+	m := NewACMEManager()
+	go renewBoxCert(m)
+
+	c := cron.New()
+	_, err := c.AddFunc(config.Config.Box.Cert.ACME.RenewCron, func() { renewBoxCert(m) })
+	if err != nil {
+		logger.AppLogger().Errorf("Failed to config cron: %s", err)
+	}
+	c.Start()
+}
+
+func renewBoxCert(m *ACMEManager) {
+	domain := clientinfo.GetAdminDomain()
+	if len(domain) < 1 {
+		logger.CertificateLogger().Debugf("renewBoxCert, box not bound, skip")
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Minute)
+	defer cancel()
+	renewed, err := m.RenewIfNeeded(ctx, []string{domain})
+	if err != nil {
+		logger.CertificateLogger().Errorf("renewBoxCert, RenewIfNeeded %v err:%v", domain, err)
+		return
+	}
+	logger.CertificateLogger().Infof("renewBoxCert, domain:%v, renewed:%v", domain, renewed)
+}
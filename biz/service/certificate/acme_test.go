@@ -0,0 +1,379 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certificate
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	cr "crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryDNSProvider 记录 TXT 记录, 供 acmeStandIn 校验.
+type memoryDNSProvider struct {
+	mu      sync.Mutex
+	records map[string][]string
+	corrupt bool // 为 true 时写入错误的值
+}
+
+func (p *memoryDNSProvider) Present(ctx context.Context, fqdn, value string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.corrupt {
+		value = "x" + value
+	}
+	p.records[fqdn] = append(p.records[fqdn], value)
+	return nil
+}
+
+func (p *memoryDNSProvider) CleanUp(ctx context.Context, fqdn, value string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.records, fqdn)
+	return nil
+}
+
+func (p *memoryDNSProvider) lookup(fqdn string) []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.records[fqdn]
+}
+
+type standInAuthz struct {
+	id, domain, token, status string
+}
+
+type standInOrder struct {
+	id      string
+	domains []string
+	authzs  []*standInAuthz
+	cert    []byte
+}
+
+// acmeStandIn 本地 ACME 服务(类似 Pebble), 只实现 RFC 8555 中客户端用到的部分, 不校验 JWS 签名.
+type acmeStandIn struct {
+	t        *testing.T
+	srv      *httptest.Server
+	dns      *memoryDNSProvider
+	validity time.Duration
+
+	mu         sync.Mutex
+	seq        int
+	thumbprint string
+	accounts   int
+	orders     map[string]*standInOrder
+	authzs     map[string]*standInAuthz
+	caKey      *ecdsa.PrivateKey
+	caCert     *x509.Certificate
+}
+
+func newACMEStandIn(t *testing.T, dns *memoryDNSProvider) *acmeStandIn {
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), cr.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(1), Subject: pkix.Name{CommonName: "stand-in CA"},
+		NotBefore: time.Now().Add(-time.Hour), NotAfter: time.Now().Add(24 * time.Hour),
+		IsCA: true, BasicConstraintsValid: true, KeyUsage: x509.KeyUsageCertSign}
+	der, err := x509.CreateCertificate(cr.Reader, tmpl, tmpl, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caCert, _ := x509.ParseCertificate(der)
+
+	s := &acmeStandIn{t: t, dns: dns, validity: 90 * 24 * time.Hour, caKey: caKey, caCert: caCert,
+		orders: make(map[string]*standInOrder), authzs: make(map[string]*standInAuthz)}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.srv.Close)
+	return s
+}
+
+func (s *acmeStandIn) url(path string) string {
+	return s.srv.URL + path
+}
+
+func (s *acmeStandIn) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	w.Header().Set("Replay-Nonce", fmt.Sprintf("nonce-%d", s.seq))
+
+	if r.URL.Path == "/dir" {
+		writeJSON(w, http.StatusOK, map[string]string{"newNonce": s.url("/nonce"),
+			"newAccount": s.url("/account"), "newOrder": s.url("/order")})
+		return
+	}
+	if r.URL.Path == "/nonce" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	var jws struct {
+		Protected string `json:"protected"`
+		Payload   string `json:"payload"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&jws); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	payload, _ := base64.RawURLEncoding.DecodeString(jws.Payload)
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	switch parts[0] {
+	case "account":
+		s.newAccount(w, jws.Protected)
+	case "order":
+		if len(parts) == 1 {
+			s.newOrder(w, payload)
+		} else {
+			s.writeOrder(w, http.StatusOK, s.orders[parts[1]])
+		}
+	case "authz":
+		s.writeAuthz(w, s.authzs[parts[1]])
+	case "chal":
+		s.validate(w, s.authzs[parts[1]])
+	case "finalize":
+		s.finalize(w, s.orders[parts[1]], payload)
+	case "cert":
+		o := s.orders[parts[1]]
+		w.Header().Set("Content-Type", "application/pem-certificate-chain")
+		w.Write(o.cert)
+		w.Write(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: s.caCert.Raw}))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (s *acmeStandIn) newAccount(w http.ResponseWriter, protected string) {
+	b, _ := base64.RawURLEncoding.DecodeString(protected)
+	var header struct {
+		JWK struct {
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"jwk"`
+	}
+	json.Unmarshal(b, &header)
+	sum := sha256.Sum256([]byte(fmt.Sprintf(`{"crv":"%s","kty":"EC","x":"%s","y":"%s"}`,
+		header.JWK.Crv, header.JWK.X, header.JWK.Y)))
+	thumbprint := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	w.Header().Set("Location", s.url("/account/1"))
+	if thumbprint == s.thumbprint {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "valid"})
+		return
+	}
+	s.thumbprint = thumbprint
+	s.accounts++
+	writeJSON(w, http.StatusCreated, map[string]string{"status": "valid"})
+}
+
+func (s *acmeStandIn) newOrder(w http.ResponseWriter, payload []byte) {
+	var req struct {
+		Identifiers []struct {
+			Value string `json:"value"`
+		} `json:"identifiers"`
+	}
+	json.Unmarshal(payload, &req)
+	o := &standInOrder{id: fmt.Sprint(s.seq)}
+	for i, id := range req.Identifiers {
+		a := &standInAuthz{id: fmt.Sprintf("%v-%v", o.id, i), domain: id.Value,
+			token: fmt.Sprintf("token-%v-%v", o.id, i), status: "pending"}
+		s.authzs[a.id] = a
+		o.domains = append(o.domains, id.Value)
+		o.authzs = append(o.authzs, a)
+	}
+	s.orders[o.id] = o
+	s.writeOrder(w, http.StatusCreated, o)
+}
+
+func (s *acmeStandIn) writeOrder(w http.ResponseWriter, code int, o *standInOrder) {
+	status := "ready"
+	authzURLs := make([]string, 0)
+	identifiers := make([]map[string]string, 0)
+	for _, a := range o.authzs {
+		authzURLs = append(authzURLs, s.url("/authz/"+a.id))
+		identifiers = append(identifiers, map[string]string{"type": "dns", "value": a.domain})
+		if a.status == "invalid" {
+			status = "invalid"
+		} else if a.status != "valid" && status != "invalid" {
+			status = "pending"
+		}
+	}
+	body := map[string]interface{}{"identifiers": identifiers, "authorizations": authzURLs,
+		"finalize": s.url("/finalize/" + o.id)}
+	if o.cert != nil {
+		status = "valid"
+		body["certificate"] = s.url("/cert/" + o.id)
+	}
+	body["status"] = status
+	w.Header().Set("Location", s.url("/order/"+o.id))
+	writeJSON(w, code, body)
+}
+
+func (s *acmeStandIn) writeAuthz(w http.ResponseWriter, a *standInAuthz) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{"status": a.status,
+		"identifier": map[string]string{"type": "dns", "value": a.domain},
+		"challenges": []map[string]string{s.challenge(a)}})
+}
+
+func (s *acmeStandIn) challenge(a *standInAuthz) map[string]string {
+	return map[string]string{"type": "dns-01", "url": s.url("/chal/" + a.id), "token": a.token, "status": a.status}
+}
+
+// validate 检查 TXT 记录是否为 base64url(sha256(token.thumbprint)).
+func (s *acmeStandIn) validate(w http.ResponseWriter, a *standInAuthz) {
+	sum := sha256.Sum256([]byte(a.token + "." + s.thumbprint))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	a.status = "invalid"
+	for _, v := range s.dns.lookup("_acme-challenge." + a.domain) {
+		if v == expected {
+			a.status = "valid"
+		}
+	}
+	writeJSON(w, http.StatusOK, s.challenge(a))
+}
+
+func (s *acmeStandIn) finalize(w http.ResponseWriter, o *standInOrder, payload []byte) {
+	var req struct {
+		CSR string `json:"csr"`
+	}
+	json.Unmarshal(payload, &req)
+	der, _ := base64.RawURLEncoding.DecodeString(req.CSR)
+	csr, err := x509.ParseCertificateRequest(der)
+	if err != nil || strings.Join(csr.DNSNames, ",") != strings.Join(o.domains, ",") {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"type": "urn:ietf:params:acme:error:badCSR"})
+		return
+	}
+	tmpl := &x509.Certificate{SerialNumber: big.NewInt(int64(s.seq)), Subject: csr.Subject, DNSNames: csr.DNSNames,
+		NotBefore: time.Now().Add(-time.Minute), NotAfter: time.Now().Add(s.validity),
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}, KeyUsage: x509.KeyUsageDigitalSignature}
+	certDer, err := x509.CreateCertificate(cr.Reader, tmpl, s.caCert, csr.PublicKey, s.caKey)
+	if err != nil {
+		s.t.Errorf("CreateCertificate err:%v", err)
+		return
+	}
+	o.cert = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDer})
+	s.writeOrder(w, http.StatusOK, o)
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func newTestACMEManager(t *testing.T, s *acmeStandIn) *ACMEManager {
+	return &ACMEManager{DirectoryURL: s.url("/dir"), Email: "test@example.com", Dir: t.TempDir(),
+		Provider: s.dns, RenewBefore: 30 * 24 * time.Hour}
+}
+
+func TestACMEObtainAndRenew(t *testing.T) {
+	dns := &memoryDNSProvider{records: make(map[string][]string)}
+	s := newACMEStandIn(t, dns)
+	m := newTestACMEManager(t, s)
+	reloads := 0
+	m.Reload = func() error {
+		reloads++
+		return nil
+	}
+	domains := []string{"box.example.com", "lan.box.example.com"}
+
+	renewed, err := m.RenewIfNeeded(context.Background(), domains)
+	if err != nil || !renewed {
+		t.Fatalf("first RenewIfNeeded, renewed:%v, err:%v", renewed, err)
+	}
+	crt, err := ReadCert(m.CertFile(), m.KeyFile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := crt.VerifyHostname("lan.box.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if len(dns.records) != 0 {
+		t.Fatalf("TXT records not cleaned up: %v", dns.records)
+	}
+	first, _ := os.Readlink(filepath.Join(m.Dir, acmeLiveLink))
+
+	// 证书仍然有效, 不续期.
+	renewed, err = m.RenewIfNeeded(context.Background(), domains)
+	if err != nil || renewed {
+		t.Fatalf("second RenewIfNeeded, renewed:%v, err:%v", renewed, err)
+	}
+
+	// 进入续期窗口后重新签发, 复用账户.
+	m.RenewBefore = s.validity + time.Hour
+	renewed, err = m.RenewIfNeeded(context.Background(), domains)
+	if err != nil || !renewed {
+		t.Fatalf("third RenewIfNeeded, renewed:%v, err:%v", renewed, err)
+	}
+	second, _ := os.Readlink(filepath.Join(m.Dir, acmeLiveLink))
+	if second == first || s.accounts != 1 || reloads != 2 {
+		t.Fatalf("live:%v->%v, accounts:%v, reloads:%v", first, second, s.accounts, reloads)
+	}
+}
+
+func TestACMEReloadFailureRollsBack(t *testing.T) {
+	dns := &memoryDNSProvider{records: make(map[string][]string)}
+	s := newACMEStandIn(t, dns)
+	m := newTestACMEManager(t, s)
+	domains := []string{"box.example.com"}
+	if _, err := m.Obtain(context.Background(), domains); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.Readlink(filepath.Join(m.Dir, acmeLiveLink))
+
+	m.Reload = func() error {
+		return errors.New("nginx config test failed")
+	}
+	if _, err := m.Obtain(context.Background(), domains); err == nil {
+		t.Fatal("expect reload error")
+	}
+	after, _ := os.Readlink(filepath.Join(m.Dir, acmeLiveLink))
+	if before != after {
+		t.Fatalf("live not rolled back, %v -> %v", before, after)
+	}
+	if _, err := ReadCert(m.CertFile(), m.KeyFile()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestACMEInvalidDNSChallenge(t *testing.T) {
+	dns := &memoryDNSProvider{records: make(map[string][]string), corrupt: true}
+	s := newACMEStandIn(t, dns)
+	m := newTestACMEManager(t, s)
+	if _, err := m.Obtain(context.Background(), []string{"box.example.com"}); err == nil {
+		t.Fatal("expect authorization error")
+	}
+	if _, err := os.Lstat(filepath.Join(m.Dir, acmeLiveLink)); !os.IsNotExist(err) {
+		t.Fatalf("no certificate should be installed, err:%v", err)
+	}
+}
@@ -17,6 +17,7 @@ package certificate
 import (
 	"agent/biz/model/dto"
 	"agent/biz/model/dto/certificate"
+	"agent/biz/model/lanca"
 	"agent/biz/service/base"
 	"agent/config"
 	"agent/utils/logger"
@@ -44,10 +45,6 @@ const (
 	certCSRFile = "cert.csr"
 )
 
-func init() {
-	go InitCert()
-}
-
 type LanCertService struct {
 	base.BaseService
 }
@@ -70,6 +67,10 @@ func (svc *LanCertService) Process() dto.BaseRspStr {
 	}
 	var lancert certificate.LanCert
 	lancert.Cert = encoding.Base64Encode(rsp.Raw)
+	if ca, err := lanca.Load(); err == nil && ca.IssuedBy(rsp) {
+		lancert.RootCA = encoding.Base64Encode(ca.Certificate().Raw)
+		lancert.RootFingerprint = ca.Fingerprint()
+	}
 	svc.Rsp = lancert
 	return svc.BaseService.Process()
 }
@@ -157,30 +158,24 @@ func CreateCSR(domains []string) error {
 	return nil
 }
 
+// InitCert 启动时检查局域网证书, 不存在或已经过时则使用局域网根证书签发.
 func InitCert() {
-
-	if _, err := os.Stat(config.Config.Box.Cert.CertDir + certDerFile); err != nil {
-		subj := &pkix.Name{
-			Country:            []string{"CN"},
-			Organization:       []string{"ISCAS"},
-			OrganizationalUnit: []string{"ISRC"},
-			Locality:           []string{"Nanjing"},
-			Province:           []string{"Jiangsu"},
-			StreetAddress:      []string{"ChuangYanRoad"},
-			PostalCode:         nil,
-			CommonName:         "AOSPACE LAN CERT",
-		}
-		// 生成自签名证书
-		selfSignCert, err := Req(subj, 10)
-		if err != nil {
-			logger.CertificateLogger().Errorf("generate self-sign certificate failed")
-		}
-		err = WriteCert(selfSignCert)
-		if err != nil {
-			logger.CertificateLogger().Errorf("generate self-sign certificate failed")
-		}
+	if _, err := EnsureLanCert(); err != nil {
+		logger.CertificateLogger().Errorf("InitCert, EnsureLanCert err:%v", err)
 	}
+}
 
+// readLanCertKey 读取局域网证书的 RSA 私钥.
+func readLanCertKey(keyFile string) (*rsa.PrivateKey, error) {
+	b, err := os.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "RSA PRIVATE KEY" {
+		return nil, errors.New("failed to decode PEM block containing private key")
+	}
+	return x509.ParsePKCS1PrivateKey(block.Bytes)
 }
 
 func GeneratePriKey() (*rsa.PrivateKey, error) {
@@ -0,0 +1,95 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certificate
+
+import (
+	"agent/biz/model/device"
+	dtocert "agent/biz/model/dto/certificate"
+	"agent/biz/service/pair"
+	"agent/config"
+	"agent/utils"
+	"agent/utils/logger"
+	utilshttp "agent/utils/network/http"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/dungeonsnd/gocom/encrypt/random"
+)
+
+const acmeChallengePrefix = "_acme-challenge."
+
+// DNSProvider 添加/删除 DNS-01 验证使用的 TXT 记录.
+// fqdn 形如 _acme-challenge.example.com, 不带末尾的点.
+type DNSProvider interface {
+	Present(ctx context.Context, fqdn, value string) error
+	CleanUp(ctx context.Context, fqdn, value string) error
+}
+
+// CheckDNSTXT 查询 domain 的 _acme-challenge TXT 记录.
+func CheckDNSTXT(domain string) ([]string, error) {
+	fqdn := acmeChallengeFQDN(domain)
+	values, err := net.LookupTXT(fqdn)
+	if err != nil {
+		logger.CertificateLogger().Debugf("CheckDNSTXT, LookupTXT %v err:%v", fqdn, err)
+		return nil, err
+	}
+	logger.CertificateLogger().Debugf("CheckDNSTXT, %v:%v", fqdn, values)
+	return values, nil
+}
+
+func acmeChallengeFQDN(domain string) string {
+	return acmeChallengePrefix + strings.TrimPrefix(strings.TrimSuffix(domain, "."), "*.")
+}
+
+// PlatformDNSProvider 通过平台接口管理盒子域名下的 TXT 记录, 使用 box-reg-key 鉴权.
+type PlatformDNSProvider struct{}
+
+func (p *PlatformDNSProvider) Present(ctx context.Context, fqdn, value string) error {
+	return p.send(http.MethodPost, fqdn, value)
+}
+
+func (p *PlatformDNSProvider) CleanUp(ctx context.Context, fqdn, value string) error {
+	return p.send(http.MethodDelete, fqdn, value)
+}
+
+func (p *PlatformDNSProvider) send(method, fqdn, value string) error {
+	regKey, err := pair.GetDeviceRegKey("")
+	if err != nil {
+		return fmt.Errorf("GetDeviceRegKey err:%v", err)
+	}
+	url, err := utils.JoinUrl(device.GetApiBaseUrl(), strings.ReplaceAll(config.Config.Platform.DNSRecord.Path,
+		"{box_uuid}", device.GetDeviceInfo().BoxUuid))
+	if err != nil {
+		return err
+	}
+	parms := &dtocert.DnsRecordReq{SubDomain: fqdn, Type: "TXT", Value: value}
+	headers := map[string]string{"Box-Reg-Key": regKey.BoxRegKey, "Request-Id": random.GenUUID()}
+
+	var rsp interface{}
+	httpReq, httpRsp, body, err := utilshttp.SendJsonWithHeaders(method, url, parms, headers, &rsp)
+	if err != nil {
+		logger.CertificateLogger().Warnf("PlatformDNSProvider, failed %v, err:%v, @@httpReq:%+v, @@httpRsp:%+v, @@body:%v",
+			method, err, httpReq, httpRsp, string(body))
+		return err
+	}
+	if httpRsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("url:%v, StatusCode:%v, body:%v", url, httpRsp.StatusCode, string(body))
+	}
+	logger.CertificateLogger().Infof("PlatformDNSProvider, %v TXT %v done", method, fqdn)
+	return nil
+}
@@ -0,0 +1,416 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certificate
+
+import (
+	"agent/biz/model/dto"
+	"agent/biz/model/dto/certificate"
+	"agent/biz/notification"
+	"agent/biz/service/base"
+	"agent/config"
+	"agent/res"
+	"agent/utils/logger"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dungeonsnd/gocom/file/fileutil"
+	"github.com/robfig/cron/v3"
+	"gopkg.in/yaml.v3"
+)
+
+const maxInventoryFileSize = 1 << 20 // 大于该大小的文件不当作证书解析
+
+var certFileExts = []string{".pem", ".crt", ".cer", ".cert"}
+
+type CertInventoryService struct {
+	base.BaseService
+}
+
+func (svc *CertInventoryService) Process() dto.BaseRspStr {
+	svc.Rsp = CollectInventory()
+	return svc.BaseService.Process()
+}
+
+// inventorySource 证书来源, path 为文件或目录(目录时扫描其中的证书文件).
+type inventorySource struct {
+	source string
+	path   string
+	depth  int // 目录向下扫描的层数
+}
+
+// CollectInventory 从配置的路径和 compose 挂载的目录中发现证书并逐一解析.
+func CollectInventory() certificate.InventoryRsp {
+	now := time.Now()
+	rsp := certificate.InventoryRsp{CheckedAt: now, Entries: make([]certificate.InventoryEntry, 0)}
+	seen := map[string]bool{}
+	for _, src := range inventorySources() {
+		for _, f := range certFilesOf(src) {
+			abs, err := filepath.Abs(f)
+			if err == nil {
+				f = abs
+			}
+			if seen[f] {
+				continue
+			}
+			seen[f] = true
+			rsp.Entries = append(rsp.Entries, inspectCertFile(src.source, f, now)...)
+		}
+	}
+	return rsp
+}
+
+func inventorySources() []inventorySource {
+	conf := config.Config.Box.Cert
+	sources := []inventorySource{
+		{source: "lan", path: conf.CertDir + certPemFile},
+		{source: "lan-root", path: conf.LanCA.RootCertFile},
+		{source: "acme", path: NewACMEManager().CertFile()},
+		{source: "internal-ca", path: config.Config.Web.InternalMTLS.CADir},
+		{source: "internal-ca", path: config.Config.Web.InternalMTLS.ClientCertDir, depth: 1},
+		{source: "docker-tls", path: conf.Inventory.DockerTLSDir},
+		{source: "platform-ca", path: conf.Inventory.PlatformCABundle},
+	}
+	sources = append(sources, composeVolumeSources(config.Config.Docker.ComposeFile)...)
+	for _, p := range strings.Split(conf.Inventory.ExtraPaths, ",") {
+		if p = strings.TrimSpace(p); len(p) > 0 {
+			sources = append(sources, inventorySource{source: "extra", path: p})
+		}
+	}
+	return sources
+}
+
+// composeVolumeSources 返回 compose 文件中挂载的证书文件以及看起来是证书目录的宿主机路径.
+func composeVolumeSources(composeFile string) []inventorySource {
+	content, err := os.ReadFile(composeFile)
+	if err != nil {
+		logger.CertificateLogger().Debugf("composeVolumeSources, read %v err:%v", composeFile, err)
+		return nil
+	}
+	var compose struct {
+		Services map[string]struct {
+			Volumes []string `yaml:"volumes"`
+		} `yaml:"services"`
+	}
+	if err := yaml.Unmarshal(content, &compose); err != nil {
+		logger.CertificateLogger().Warnf("composeVolumeSources, parse %v err:%v", composeFile, err)
+		return nil
+	}
+
+	names := make([]string, 0, len(compose.Services))
+	for name := range compose.Services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sources := make([]inventorySource, 0)
+	for _, name := range names {
+		for _, v := range compose.Services[name].Volumes {
+			hostPath := strings.SplitN(v, ":", 2)[0]
+			if !strings.HasPrefix(hostPath, "/") { // 具名卷
+				continue
+			}
+			if !isCertFileName(hostPath) && !looksLikeCertDir(hostPath) {
+				continue
+			}
+			sources = append(sources, inventorySource{source: "compose:" + name, path: res.GetVolumeAgentPath(hostPath)})
+		}
+	}
+	return sources
+}
+
+func looksLikeCertDir(p string) bool {
+	for _, seg := range strings.Split(filepath.ToSlash(p), "/") {
+		seg = strings.ToLower(seg)
+		if strings.Contains(seg, "cert") || seg == "ca" || strings.HasSuffix(seg, "-ca") ||
+			seg == "tls" || seg == "ssl" {
+			return true
+		}
+	}
+	return false
+}
+
+func isCertFileName(p string) bool {
+	ext := strings.ToLower(filepath.Ext(p))
+	for _, e := range certFileExts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+// certFilesOf 返回来源中的证书文件, 不存在的路径返回空.
+func certFilesOf(src inventorySource) []string {
+	if len(src.path) < 1 {
+		return nil
+	}
+	fi, err := os.Stat(src.path)
+	if err != nil {
+		return nil
+	}
+	if !fi.IsDir() {
+		return []string{src.path}
+	}
+	return scanCertDir(src.path, src.depth)
+}
+
+func scanCertDir(dir string, depth int) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		logger.CertificateLogger().Debugf("scanCertDir, read %v err:%v", dir, err)
+		return nil
+	}
+	files := make([]string, 0)
+	for _, e := range entries {
+		p := filepath.Join(dir, e.Name())
+		if e.IsDir() {
+			if depth > 0 {
+				files = append(files, scanCertDir(p, depth-1)...)
+			}
+			continue
+		}
+		if isCertFileName(e.Name()) && !isKeyFileName(e.Name()) {
+			files = append(files, p)
+		}
+	}
+	return files
+}
+
+func isKeyFileName(name string) bool {
+	name = strings.ToLower(name)
+	return strings.Contains(name, "key") && !strings.Contains(name, "pubkey")
+}
+
+// inspectCertFile 解析文件中的全部证书. 第一张证书有匹配的私钥时用 ReadCert 加载并校验.
+// 文件中没有证书时(如私钥文件)返回空.
+func inspectCertFile(source, file string, now time.Time) []certificate.InventoryEntry {
+	fi, err := os.Stat(file)
+	if err != nil || fi.Size() > maxInventoryFileSize {
+		return nil
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return []certificate.InventoryEntry{{Source: source, Path: file, Error: err.Error()}}
+	}
+
+	certs := make([]*x509.Certificate, 0)
+	var parseErr error
+	for rest := data; ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		c, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			parseErr = err
+			continue
+		}
+		certs = append(certs, c)
+	}
+	if len(certs) == 0 && parseErr == nil {
+		if c, err := x509.ParseCertificate(data); err == nil { // DER
+			certs = append(certs, c)
+		}
+	}
+	if len(certs) == 0 {
+		if parseErr != nil {
+			return []certificate.InventoryEntry{{Source: source, Path: file, Error: parseErr.Error()}}
+		}
+		return nil
+	}
+
+	hasKey := false
+	if keyFile := keyFileOf(file); len(keyFile) > 0 {
+		if leaf, err := ReadCert(file, keyFile); err == nil {
+			certs[0] = leaf
+			hasKey = true
+		} else {
+			logger.CertificateLogger().Debugf("inspectCertFile, ReadCert %v %v err:%v", file, keyFile, err)
+		}
+	}
+
+	entries := make([]certificate.InventoryEntry, 0, len(certs))
+	for i, c := range certs {
+		e := inventoryEntryOf(source, file, c, now)
+		e.HasKey = i == 0 && hasKey
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// keyFileOf 按常见命名查找证书对应的私钥文件: cert.pem/cert.key, fullchain.pem/privkey.pem, xxx.pem/xxx-key.pem.
+func keyFileOf(certFile string) string {
+	dir := filepath.Dir(certFile)
+	base := strings.TrimSuffix(filepath.Base(certFile), filepath.Ext(certFile))
+	candidates := []string{base + ".key", base + "-key.pem", base + "_key.pem"}
+	switch base {
+	case "fullchain", "cert", "chain":
+		candidates = append(candidates, "privkey.pem")
+	}
+	if base == "cert" {
+		candidates = append(candidates, "key.pem")
+	}
+	for _, c := range candidates {
+		p := filepath.Join(dir, c)
+		if fi, err := os.Stat(p); err == nil && !fi.IsDir() {
+			return p
+		}
+	}
+	return ""
+}
+
+func inventoryEntryOf(source, file string, c *x509.Certificate, now time.Time) certificate.InventoryEntry {
+	e := certificate.InventoryEntry{
+		Source:       source,
+		Path:         file,
+		Subject:      c.Subject.String(),
+		Issuer:       c.Issuer.String(),
+		SerialNumber: fmt.Sprintf("%x", c.SerialNumber),
+		NotBefore:    c.NotBefore,
+		NotAfter:     c.NotAfter,
+		DaysLeft:     int(math.Floor(c.NotAfter.Sub(now).Hours() / 24)),
+		KeyType:      keyTypeOf(c),
+		DNSNames:     c.DNSNames,
+		IsCA:         c.IsCA,
+	}
+	for _, ip := range c.IPAddresses {
+		e.IPAddresses = append(e.IPAddresses, ip.String())
+	}
+	return e
+}
+
+func keyTypeOf(c *x509.Certificate) string {
+	switch pub := c.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return fmt.Sprintf("RSA-%d", pub.N.BitLen())
+	case *ecdsa.PublicKey:
+		return "ECDSA-" + strings.ReplaceAll(pub.Curve.Params().Name, "-", "")
+	case ed25519.PublicKey:
+		return "Ed25519"
+	}
+	return c.PublicKeyAlgorithm.String()
+}
+
+// parseThresholds 解析逗号分隔的提醒阈值(天), 按从大到小排序.
+func parseThresholds(s string) []int {
+	thresholds := make([]int, 0)
+	for _, v := range strings.Split(s, ",") {
+		v = strings.TrimSpace(v)
+		if len(v) < 1 {
+			continue
+		}
+		d, err := strconv.Atoi(v)
+		if err != nil || d < 0 {
+			logger.CertificateLogger().Warnf("parseThresholds, invalid threshold %q", v)
+			continue
+		}
+		thresholds = append(thresholds, d)
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(thresholds)))
+	return thresholds
+}
+
+// thresholdToNotify 返回 daysLeft 已达到的最小阈值. 该阈值比上次推送过的阈值更小时才需要推送.
+func thresholdToNotify(daysLeft int, thresholds []int, notified int, hasNotified bool) (int, bool) {
+	reached := -1
+	for _, t := range thresholds {
+		if daysLeft <= t {
+			reached = t
+		}
+	}
+	if reached < 0 {
+		return 0, false
+	}
+	if hasNotified && notified <= reached {
+		return 0, false
+	}
+	return reached, true
+}
+
+var inventoryNotifyMtx sync.Mutex
+
+// CheckCertExpiry 收集证书清单, 对达到提醒阈值的证书推送通知.
+// 每张证书(路径+序列号)的每个阈值只推送一次, 证书更换后序列号变化会重新计算.
+func CheckCertExpiry() {
+	inventoryNotifyMtx.Lock()
+	defer inventoryNotifyMtx.Unlock()
+
+	thresholds := parseThresholds(config.Config.Box.Cert.Inventory.ExpiryThresholds)
+	if len(thresholds) == 0 {
+		return
+	}
+	recordFile := config.Config.Box.Cert.Inventory.NotifiedRecordFile
+	notified := map[string]int{}
+	if !fileutil.IsFileNotExist(recordFile) {
+		if err := fileutil.ReadFileJsonToObject(recordFile, &notified); err != nil {
+			logger.CertificateLogger().Warnf("CheckCertExpiry, read %v err:%v", recordFile, err)
+		}
+	}
+
+	current := map[string]int{}
+	for _, e := range CollectInventory().Entries {
+		if len(e.Error) > 0 {
+			continue
+		}
+		key := e.Path + "#" + e.SerialNumber
+		last, ok := notified[key]
+		if ok {
+			current[key] = last
+		}
+		t, need := thresholdToNotify(e.DaysLeft, thresholds, last, ok)
+		if !need {
+			continue
+		}
+		logger.CertificateLogger().Infof("CheckCertExpiry, %v %v expires at %v, daysLeft:%v",
+			e.Source, e.Path, e.NotAfter, e.DaysLeft)
+		if err := notification.OnCertificateExpiring(e.Source, e.Path, e.Subject, e.NotAfter, e.DaysLeft, t); err != nil {
+			logger.CertificateLogger().Warnf("CheckCertExpiry, OnCertificateExpiring err:%v", err)
+			continue
+		}
+		current[key] = t
+	}
+
+	if err := fileutil.WriteToFileAsJson(recordFile, current, "  ", true); err != nil {
+		logger.CertificateLogger().Warnf("CheckCertExpiry, write %v err:%v", recordFile, err)
+	}
+}
+
+// CronForCertInventory 启动时检查一次证书过期情况, 之后按 CheckCron 定时检查.
+func CronForCertInventory() {
+	go CheckCertExpiry()
+
+	c := cron.New()
+	_, err := c.AddFunc(config.Config.Box.Cert.Inventory.CheckCron, CheckCertExpiry)
+	if err != nil {
+		logger.AppLogger().Errorf("Failed to config cron: %s", err)
+	}
+	c.Start()
+}
@@ -0,0 +1,129 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certificate
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeTestCert(t *testing.T, dir, name, keyName string, serial int64, notAfter time.Time) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     notAfter,
+		DNSNames:     []string{"box.local"},
+		IPAddresses:  []net.IP{net.ParseIP("192.168.1.2")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, name), certPem, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if len(keyName) > 0 {
+		keyDer, _ := x509.MarshalECPrivateKey(key)
+		keyPem := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})
+		if err := os.WriteFile(filepath.Join(dir, keyName), keyPem, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return certPem
+}
+
+func TestInspectCertDir(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Now()
+	writeTestCert(t, dir, "cert.pem", "cert.key", 1, now.Add(10*24*time.Hour+time.Hour))
+	a := writeTestCert(t, dir, "a.pem", "", 2, now.Add(100*24*time.Hour+time.Hour))
+	b := writeTestCert(t, dir, "b.pem", "", 3, now.Add(-24*time.Hour-time.Hour))
+	if err := os.WriteFile(filepath.Join(dir, "bundle.crt"), append(a, b...), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Remove(filepath.Join(dir, "a.pem"))
+	os.Remove(filepath.Join(dir, "b.pem"))
+
+	files := certFilesOf(inventorySource{source: "extra", path: dir})
+	if len(files) != 2 {
+		t.Fatalf("expected 2 cert files, got %v", files)
+	}
+	got := map[string][]int{}
+	for _, f := range files {
+		for _, e := range inspectCertFile("extra", f, now) {
+			if len(e.Error) > 0 {
+				t.Fatalf("%v: %v", f, e.Error)
+			}
+			if e.KeyType != "ECDSA-P256" {
+				t.Errorf("%v: keyType %v", f, e.KeyType)
+			}
+			if len(e.DNSNames) != 1 || len(e.IPAddresses) != 1 || e.IPAddresses[0] != "192.168.1.2" {
+				t.Errorf("%v: SANs %v %v", f, e.DNSNames, e.IPAddresses)
+			}
+			if filepath.Base(f) == "cert.pem" && !e.HasKey {
+				t.Errorf("cert.pem: key not matched")
+			}
+			got[filepath.Base(f)] = append(got[filepath.Base(f)], e.DaysLeft)
+		}
+	}
+	if d := got["cert.pem"]; len(d) != 1 || d[0] != 10 {
+		t.Errorf("cert.pem daysLeft %v", d)
+	}
+	if d := got["bundle.crt"]; len(d) != 2 || d[0] != 100 || d[1] != -2 {
+		t.Errorf("bundle.crt daysLeft %v", d)
+	}
+}
+
+func TestThresholdToNotify(t *testing.T) {
+	thresholds := parseThresholds("1, 30,7")
+	cases := []struct {
+		daysLeft    int
+		notified    int
+		hasNotified bool
+		threshold   int
+		need        bool
+	}{
+		{daysLeft: 45, need: false},
+		{daysLeft: 30, threshold: 30, need: true},
+		{daysLeft: 20, notified: 30, hasNotified: true, need: false},
+		{daysLeft: 6, notified: 30, hasNotified: true, threshold: 7, need: true},
+		{daysLeft: 3, notified: 7, hasNotified: true, need: false},
+		{daysLeft: -5, notified: 7, hasNotified: true, threshold: 1, need: true},
+		{daysLeft: -6, notified: 1, hasNotified: true, need: false},
+	}
+	for _, c := range cases {
+		threshold, need := thresholdToNotify(c.daysLeft, thresholds, c.notified, c.hasNotified)
+		if need != c.need || (need && threshold != c.threshold) {
+			t.Errorf("daysLeft:%v notified:%v got (%v, %v), expected (%v, %v)",
+				c.daysLeft, c.notified, threshold, need, c.threshold, c.need)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package certificate
+
+import (
+	"agent/biz/model/clientinfo"
+	"agent/biz/model/lanca"
+	"agent/biz/service/pair"
+	"agent/config"
+	"agent/utils/logger"
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// EnsureLanCert 检查局域网证书, 以下情况使用局域网根证书重新签发, 返回是否重新签发:
+// 证书不存在或不是根证书签发的(如旧版本的自签名证书)、SAN 与当前 IP/主机名/域名不一致、即将过期.
+// 服务端私钥存在时沿用.
+func EnsureLanCert() (bool, error) {
+	ca, err := lanca.Load()
+	if err != nil {
+		return false, fmt.Errorf("failed to load LAN root CA, err:%v", err)
+	}
+	dnsNames, ips := lanCertNames()
+
+	certDir := config.Config.Box.Cert.CertDir
+	current, err := ReadCert(certDir+certPemFile, certDir+certKeyFile)
+	if err == nil && ca.IssuedBy(current) {
+		renewBefore := time.Duration(config.Config.Box.Cert.LanCA.LeafRenewDays) * 24 * time.Hour
+		if time.Until(current.NotAfter) > renewBefore {
+			if len(ips) < 1 {
+				// 暂时获取不到 IP 时保留原证书, 避免去掉仍在使用的 IP.
+				return false, nil
+			}
+			if sameNames(current, dnsNames, ips) {
+				return false, nil
+			}
+		}
+	}
+
+	key, err := readLanCertKey(certDir + certKeyFile)
+	if err != nil {
+		if key, err = GeneratePriKey(); err != nil {
+			return false, fmt.Errorf("GeneratePriKey err:%v", err)
+		}
+	}
+	validity := time.Duration(config.Config.Box.Cert.LanCA.LeafValidDays) * 24 * time.Hour
+	der, err := ca.Issue(&key.PublicKey, dnsNames, ips, validity)
+	if err != nil {
+		return false, fmt.Errorf("failed to issue LAN certificate, err:%v", err)
+	}
+
+	c := &Cert{Cert: der, CertKey: key, CertPem: new(bytes.Buffer), CertKeyPemBuff: new(bytes.Buffer)}
+	pem.Encode(c.CertPem, &pem.Block{Type: "CERTIFICATE", Bytes: der})
+	pem.Encode(c.CertPem, &pem.Block{Type: "CERTIFICATE", Bytes: ca.Certificate().Raw})
+	pem.Encode(c.CertKeyPemBuff, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	if err := WriteCert(c); err != nil {
+		return false, fmt.Errorf("WriteCert err:%v", err)
+	}
+	logger.CertificateLogger().Infof("EnsureLanCert, LAN certificate issued, dnsNames:%v, ips:%v", dnsNames, ips)
+	return true, nil
+}
+
+// CronForLanCert 定时检查局域网证书, 重新签发后重载 nginx.
+func CronForLanCert() {
+	c := cron.New()
+	_, err := c.AddFunc(config.Config.Box.Cert.LanCA.ReissueCheckCron, func() {
+		reissued, err := EnsureLanCert()
+		if err != nil {
+			logger.CertificateLogger().Errorf("CronForLanCert, EnsureLanCert err:%v", err)
+			return
+		}
+		if reissued {
+			ReloadNginx()
+		}
+	})
+	if err != nil {
+		logger.AppLogger().Errorf("Failed to config cron: %s", err)
+	}
+	c.Start()
+}
+
+// lanCertNames 返回局域网证书的 SAN: mDNS 主机名、盒子域名和当前所有局域网 IP.
+func lanCertNames() ([]string, []net.IP) {
+	dnsNames := make([]string, 0)
+	if hostname := mdnsHostname(); len(hostname) > 0 {
+		dnsNames = append(dnsNames, hostname)
+	}
+	if domain := clientinfo.GetAdminDomain(); len(domain) > 0 {
+		dnsNames = append(dnsNames, domain)
+	}
+
+	ips := make([]net.IP, 0)
+	seen := make(map[string]bool)
+	addrs := pair.GetLocalIp()
+	// 容器中运行时从 HostIpFile 获取宿主机 IP
+	if b, err := os.ReadFile(config.Config.Box.HostIpFile); err == nil {
+		host := strings.TrimSpace(string(b))
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		addrs = append(addrs, host)
+	}
+	for _, addr := range addrs {
+		ip := net.ParseIP(addr)
+		if ip == nil || ip.IsLoopback() || seen[ip.String()] {
+			continue
+		}
+		seen[ip.String()] = true
+		ips = append(ips, ip)
+	}
+	return dnsNames, ips
+}
+
+// mdnsHostname avahi 广播的主机名, 即 <hostname>.local.
+func mdnsHostname() string {
+	hostname, err := os.Hostname()
+	if err != nil || len(hostname) < 1 || hostname == "localhost" {
+		return ""
+	}
+	if i := strings.Index(hostname, "."); i > 0 {
+		hostname = hostname[:i]
+	}
+	return strings.ToLower(hostname) + ".local"
+}
+
+func sameNames(cert *x509.Certificate, dnsNames []string, ips []net.IP) bool {
+	ipStrings := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		ipStrings = append(ipStrings, ip.String())
+	}
+	certIps := make([]string, 0, len(cert.IPAddresses))
+	for _, ip := range cert.IPAddresses {
+		certIps = append(certIps, ip.String())
+	}
+	return sameStrings(cert.DNSNames, dnsNames) && sameStrings(certIps, ipStrings)
+}
+
+func sameStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a = append([]string{}, a...)
+	b = append([]string{}, b...)
+	sort.Strings(a)
+	sort.Strings(b)
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,273 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package device
+
+import (
+	"agent/biz/docker"
+	"agent/biz/model/device"
+	"agent/biz/model/device_ability"
+	"agent/biz/model/did"
+	"agent/biz/model/did/leveldb"
+	"agent/biz/model/dto"
+	dtodevice "agent/biz/model/dto/device"
+	"agent/biz/notification"
+	"agent/biz/service/base"
+	didservice "agent/biz/service/did/document"
+	"agent/biz/service/pair"
+	"agent/config"
+	"agent/utils"
+	"agent/utils/logger"
+	utilshttp "agent/utils/network/http"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dungeonsnd/gocom/encrypt/random"
+	"github.com/robfig/cron/v3"
+)
+
+// KeyRotationService 轮换设备密钥:
+// 1. 生成新的 box_key, 旧公钥在宽限期内保留;
+// 2. 为所有 DID 文档生成轮换设备验证方法的提议, 客户端签名后再次调用本接口提交;
+// 3. 用新密钥重新签发 agent token 并推送给客户端;
+// 4. 向平台登记新公钥, 刷新容器环境变量中的公钥指纹.
+type KeyRotationService struct {
+	base.BaseService
+}
+
+func (svc *KeyRotationService) Process() dto.BaseRspStr {
+	req := svc.Req.(*dtodevice.KeyRotationReq)
+	logger.AppLogger().Debugf("KeyRotationService Process, svc.RequestId:%v, req:%+v", svc.RequestId, req)
+
+	if req != nil && len(req.Proposals) > 0 {
+		return svc.commitProposals(req.Proposals)
+	}
+
+	// 加密芯片中的密钥不可导出, 不支持轮换. 在修改任何状态之前拒绝.
+	if device_ability.GetAbilityModel().SecurityChipSupport {
+		return dto.BaseRspStr{Code: dto.AgentCodeUnsupportedFunction, RequestId: svc.RequestId,
+			Message: "device key is kept in security chip, rotation unsupported"}
+	}
+
+	graceHours := config.Config.Box.BoxKey.RotationGraceHours
+	if req != nil && req.GraceHours > 0 {
+		graceHours = req.GraceHours
+	}
+	grace := time.Duration(graceHours) * time.Hour
+
+	// 平台只认识旧公钥, 需要在轮换之前用旧密钥获取 box-reg-key.
+	var regKey *pair.BoxRegKeyInfo
+	if device.IsBoxRegistered() {
+		var err error
+		regKey, err = pair.GetDeviceRegKey("")
+		if err != nil {
+			err1 := fmt.Errorf("failed GetDeviceRegKey before rotation, err:%v", err)
+			logger.AppLogger().Warnf("KeyRotationService, %v", err1)
+			return dto.BaseRspStr{Code: dto.AgentCodeCallServiceFailedStr, RequestId: svc.RequestId, Message: err1.Error()}
+		}
+	}
+
+	levelDBTrans, err := leveldb.BeginTransaction()
+	if err != nil {
+		return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, RequestId: svc.RequestId, Message: err.Error()}
+	}
+	aoIds, err := did.ListAoIds(levelDBTrans)
+	levelDBTrans.Rollback()
+	if err != nil {
+		err1 := fmt.Errorf("ListAoIds err:%v", err)
+		return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, RequestId: svc.RequestId, Message: err1.Error()}
+	}
+
+	result, err := device.RotateDeviceKey(grace)
+	if err != nil {
+		err1 := fmt.Errorf("RotateDeviceKey err:%v", err)
+		logger.AppLogger().Errorf("KeyRotationService, %v", err1)
+		return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, RequestId: svc.RequestId, Message: err1.Error()}
+	}
+
+	// DID 文档中的设备验证方法使用各空间自己的密钥, 与设备密钥无关. 文档修改需要客户端多重签名授权,
+	// 这里只生成提议, 生成失败不影响已完成的设备密钥轮换.
+	proposals := make([]*dtodevice.DeviceMethodProposal, 0, len(aoIds))
+	for _, aoId := range aoIds {
+		proposal, err := didservice.CreateUpdateProposal(func(levelDBTrans *leveldb.Trans) (*did.UpdateProposal, error) {
+			return did.ProposeDeviceMethodRotation(levelDBTrans, aoId, result.GraceUntil)
+		})
+		if err != nil {
+			logger.AppLogger().Warnf("KeyRotationService, ProposeDeviceMethodRotation of %v err:%v", aoId, err)
+			continue
+		}
+		signingInput, err := proposal.SigningInput()
+		if err != nil {
+			logger.AppLogger().Warnf("KeyRotationService, SigningInput of %v err:%v", proposal.ID, err)
+			continue
+		}
+		proposals = append(proposals, &dtodevice.DeviceMethodProposal{DID: proposal.DID, ProposalId: proposal.ID,
+			DIDDoc:       base64.StdEncoding.EncodeToString(proposal.Document),
+			SigningInput: base64.StdEncoding.EncodeToString(signingInput),
+			ExpiresAt:    proposal.ExpiresAt.UTC().Format(time.RFC3339)})
+	}
+
+	tokens, err := base.ReissueAgentTokens()
+	if err != nil {
+		logger.AppLogger().Warnf("KeyRotationService, ReissueAgentTokens err:%v", err)
+	}
+	go func() {
+		for clientUuid, token := range tokens {
+			if err := notification.OnAgentTokenRefreshed(clientUuid, token, result.GraceUntil); err != nil {
+				logger.AppLogger().Warnf("KeyRotationService, OnAgentTokenRefreshed of %v err:%v", clientUuid, err)
+			}
+		}
+	}()
+
+	platformRegistered := false
+	if regKey != nil {
+		if err := registerPubKey(regKey, result); err != nil {
+			logger.AppLogger().Warnf("KeyRotationService, registerPubKey err:%v, retrying in background", err)
+			go retryRegisterPubKey(regKey, result)
+		} else {
+			platformRegistered = true
+		}
+	}
+
+	go func() {
+		if err := docker.DockerUpImmediately(nil); err != nil {
+			logger.AppLogger().Warnf("KeyRotationService, DockerUpImmediately err:%v", err)
+		}
+	}()
+
+	newFingerprint, _ := device.GetDevicePubKeyFingerprint()
+	oldFingerprint := ""
+	if info := device.GetPreviousDeviceKeyInfo(); info != nil {
+		oldFingerprint = info.Fingerprint
+	}
+	svc.Rsp = &dtodevice.KeyRotationRsp{OldFingerprint: oldFingerprint,
+		NewFingerprint:     newFingerprint,
+		GraceUntil:         result.GraceUntil.UTC().Format(time.RFC3339),
+		Proposals:          proposals,
+		RotatedDIDs:        []string{},
+		ReissuedTokens:     len(tokens),
+		PlatformRegistered: platformRegistered}
+	return svc.BaseService.Process()
+}
+
+// commitProposals 校验客户端签名后提交设备验证方法的轮换提议. 每个提议单独提交, 任一失败时返回错误,
+// 之前已提交的提议保持有效.
+func (svc *KeyRotationService) commitProposals(proposals []*dtodevice.DeviceMethodProposal) dto.BaseRspStr {
+	rotatedDIDs := make([]string, 0, len(proposals))
+	for _, p := range proposals {
+		if p == nil {
+			continue
+		}
+		proposal, err := didservice.CommitUpdateProposal(p.ProposalId, did.UpdateKindDeviceMethod, p.Signatures)
+		if err != nil {
+			err1 := fmt.Errorf("CommitUpdateProposal of %v err:%v, committed:%v", p.ProposalId, err, rotatedDIDs)
+			logger.AppLogger().Warnf("KeyRotationService, %v", err1)
+			code := dto.AgentCodeServerErrorStr
+			if errors.Is(err, did.ErrUnauthorizedUpdate) {
+				code = dto.AgentCodeUnauthorizedUpdate
+			} else if errors.Is(err, did.ErrProposalNotFound) {
+				code = dto.AgentCodeParamErr
+			}
+			return dto.BaseRspStr{Code: code, RequestId: svc.RequestId, Message: err1.Error()}
+		}
+		rotatedDIDs = append(rotatedDIDs, proposal.DID)
+	}
+	svc.Rsp = &dtodevice.KeyRotationRsp{RotatedDIDs: rotatedDIDs}
+	return svc.BaseService.Process()
+}
+
+// registerPubKey 向平台登记新公钥. attestation 为旧私钥对新公钥的签名.
+func registerPubKey(regKey *pair.BoxRegKeyInfo, result *device.KeyRotationResult) error {
+	type pubKeyReq struct {
+		BoxUUID     string `json:"boxUUID"`
+		BoxPubKey   string `json:"boxPubKey"`
+		OldPubKey   string `json:"oldPubKey"`
+		Attestation string `json:"attestation"`
+	}
+	parms := &pubKeyReq{BoxUUID: device.GetDeviceInfo().BoxUuid,
+		BoxPubKey:   string(result.NewPubKey),
+		OldPubKey:   string(result.OldPubKey),
+		Attestation: result.Attestation}
+	url, err := utils.JoinUrl(device.GetApiBaseUrl(), strings.ReplaceAll(config.Config.Platform.BoxPubKey.Path,
+		"{box_uuid}", device.GetDeviceInfo().BoxUuid))
+	if err != nil {
+		return err
+	}
+	headers := map[string]string{"Box-Reg-Key": regKey.BoxRegKey, "Request-Id": random.GenUUID()}
+
+	var rsp interface{}
+	httpReq, httpRsp, body, err := utilshttp.PostJsonWithHeaders(url, parms, headers, &rsp)
+	if err != nil {
+		logger.AppLogger().Warnf("registerPubKey, failed PostJson, err:%v, @@httpReq:%+v, @@httpRsp:%+v, @@body:%v",
+			err, httpReq, httpRsp, string(body))
+		return err
+	}
+	if httpRsp.StatusCode != http.StatusOK {
+		return fmt.Errorf("url:%v, StatusCode:%v, body:%v", url, httpRsp.StatusCode, string(body))
+	}
+	logger.AppLogger().Infof("registerPubKey, new device public key registered, rsp:%+v", rsp)
+	return nil
+}
+
+func retryRegisterPubKey(regKey *pair.BoxRegKeyInfo, result *device.KeyRotationResult) {
+	for i := 0; i < 10; i++ {
+		time.Sleep(time.Second * 30)
+		if err := registerPubKey(regKey, result); err != nil {
+			logger.AppLogger().Warnf("retryRegisterPubKey(%v/10), err:%v", i+1, err)
+			continue
+		}
+		return
+	}
+	logger.AppLogger().Errorf("retryRegisterPubKey, failed to register new device public key, retry too much times.")
+}
+
+// CronForKeyRotation 定时清理宽限期已过的旧设备密钥和 DID 文档中的旧设备验证方法.
+func CronForKeyRotation() {
+	c := cron.New()
+	_, err := c.AddFunc("@hourly", pruneExpiredDeviceKeys)
+	if err != nil {
+		logger.AppLogger().Errorf("Failed to config cron: %s", err)
+	}
+	c.Start()
+}
+
+func pruneExpiredDeviceKeys() {
+	device.GetPreviousDevicePubKey() // 过期时会删除旧密钥记录
+
+	levelDBTrans, err := leveldb.BeginTransaction()
+	if err != nil {
+		logger.AppLogger().Warnf("pruneExpiredDeviceKeys, BeginTransaction err:%v", err)
+		return
+	}
+	defer levelDBTrans.Rollback()
+
+	aoIds, err := did.ListAoIds(levelDBTrans)
+	if err != nil {
+		logger.AppLogger().Warnf("pruneExpiredDeviceKeys, ListAoIds err:%v", err)
+		return
+	}
+	for _, aoId := range aoIds {
+		if _, err := did.PruneExpiredDeviceMethods(levelDBTrans, aoId); err != nil {
+			logger.AppLogger().Warnf("pruneExpiredDeviceKeys, PruneExpiredDeviceMethods of %v err:%v", aoId, err)
+			return
+		}
+	}
+	if err := levelDBTrans.Commit(); err != nil {
+		logger.AppLogger().Warnf("pruneExpiredDeviceKeys, Commit err:%v", err)
+	}
+}
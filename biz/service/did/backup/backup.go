@@ -0,0 +1,98 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	"agent/biz/model/did"
+	"agent/biz/model/did/leveldb"
+	"agent/biz/model/dto"
+	"agent/biz/model/dto/did/backup"
+	"agent/biz/service/base"
+	"agent/utils/logger"
+	"fmt"
+)
+
+// Export 导出加密的 DID 备份, 返回备份内容和 DID 数量.
+func Export(passphrase string) ([]byte, int, error) {
+	levelDBTrans, err := leveldb.BeginTransaction() // 在事务中读取, 保证导出内容一致
+	if err != nil {
+		return nil, 0, fmt.Errorf("BeginTransaction err:%v", err)
+	}
+	defer levelDBTrans.Rollback()
+	return did.ExportBackup(levelDBTrans, passphrase)
+}
+
+// Restore 校验并导入备份, 返回导入的 DID.
+func Restore(archive []byte, passphrase string, overwrite bool) ([]string, error) {
+	levelDBTrans, err := leveldb.BeginTransaction()
+	if err != nil {
+		return nil, fmt.Errorf("BeginTransaction err:%v", err)
+	}
+	defer levelDBTrans.Rollback()
+	dids, err := did.RestoreBackup(levelDBTrans, archive, passphrase, overwrite)
+	if err != nil {
+		return nil, err
+	}
+	if err := levelDBTrans.Commit(); err != nil {
+		return nil, fmt.Errorf("Commit err:%v", err)
+	}
+	return dids, nil
+}
+
+type ExportBackup struct {
+	base.BaseService
+}
+
+func NewExportBackup() *ExportBackup {
+	svc := new(ExportBackup)
+	return svc
+}
+
+func (svc *ExportBackup) Process() dto.BaseRspStr {
+	req := svc.Req.(*backup.ExportBackupReq)
+	logger.AppLogger().Debugf("ExportBackup Process, svc.RequestId:%v", svc.RequestId)
+
+	archive, count, err := Export(req.Passphrase)
+	if err != nil {
+		err1 := fmt.Errorf("ExportBackup err:%v", err)
+		logger.AppLogger().Warnf(err1.Error())
+		return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, RequestId: svc.RequestId, Message: err1.Error()}
+	}
+	svc.Rsp = &backup.ExportBackupRsp{Archive: archive, Count: count}
+	return svc.BaseService.Process()
+}
+
+type RestoreBackup struct {
+	base.BaseService
+}
+
+func NewRestoreBackup() *RestoreBackup {
+	svc := new(RestoreBackup)
+	return svc
+}
+
+func (svc *RestoreBackup) Process() dto.BaseRspStr {
+	req := svc.Req.(*backup.RestoreBackupReq)
+	logger.AppLogger().Debugf("RestoreBackup Process, svc.RequestId:%v, overwrite:%v", svc.RequestId, req.Overwrite)
+
+	dids, err := Restore(req.Archive, req.Passphrase, req.Overwrite)
+	if err != nil {
+		err1 := fmt.Errorf("RestoreBackup err:%v", err)
+		logger.AppLogger().Warnf(err1.Error())
+		return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, RequestId: svc.RequestId, Message: err1.Error()}
+	}
+	svc.Rsp = &backup.RestoreBackupRsp{DIDs: dids}
+	return svc.BaseService.Process()
+}
@@ -0,0 +1,106 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package credential
+
+import (
+	"agent/biz/model/device"
+	"agent/biz/model/did"
+	"agent/biz/model/did/leveldb"
+	"agent/biz/model/dto"
+	"agent/biz/model/dto/did/credential"
+	"agent/biz/service/base"
+	"agent/utils/logger"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+const (
+	typeMemberCredential        = "AOSpaceMemberCredential"
+	typeDeviceBindingCredential = "AOSpaceDeviceBindingCredential"
+)
+
+type IssueCredential struct {
+	base.BaseService
+}
+
+func NewIssueCredential() *IssueCredential {
+	svc := new(IssueCredential)
+	return svc
+}
+
+func (svc *IssueCredential) Process() dto.BaseRspStr {
+	req := svc.Req.(*credential.IssueCredentialReq)
+	logger.AppLogger().Debugf("IssueCredential Process, svc.RequestId:%v, req:%+v", svc.RequestId, req)
+	if req == nil || len(req.AOID) < 1 || req.ExpiresInHours < 0 {
+		err1 := fmt.Errorf("request error")
+		logger.AppLogger().Debugf(err1.Error())
+		return dto.BaseRspStr{Code: dto.AgentCodeBadReqStr, RequestId: svc.RequestId, Message: err1.Error()}
+	}
+
+	levelDBTrans, err := leveldb.BeginTransaction() // 开启事务
+	if err != nil {
+		err1 := fmt.Errorf("BeginTransaction err:%v", err)
+		logger.AppLogger().Warnf(err1.Error())
+		return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, RequestId: svc.RequestId, Message: err1.Error()}
+	}
+	defer levelDBTrans.Rollback()
+
+	subjectDid, found, err := did.GetDidByAoId(levelDBTrans, req.AOID)
+	if err != nil || !found {
+		err1 := fmt.Errorf("did not found by aoId(%v), err:%v", req.AOID, err)
+		logger.AppLogger().Warnf(err1.Error())
+		return dto.BaseRspStr{Code: dto.AgentCodeParamErr, RequestId: svc.RequestId, Message: err1.Error()}
+	}
+
+	boxUuid := device.GetDeviceInfo().BoxUuid
+	var issuerAoId string
+	var types []string
+	subject := map[string]interface{}{"id": subjectDid, "aoId": req.AOID}
+	switch req.Type {
+	case credential.TypeMember:
+		issuerAoId = did.AdminAoId // 成员凭证由管理员 DID 签发
+		types = []string{typeMemberCredential}
+		subject["memberOf"] = "urn:uuid:" + boxUuid
+	case credential.TypeDevice:
+		issuerAoId = req.AOID
+		types = []string{typeDeviceBindingCredential}
+		subject["boxUuid"] = boxUuid
+	default:
+		err1 := fmt.Errorf("unsupported credential type %v", req.Type)
+		logger.AppLogger().Debugf(err1.Error())
+		return dto.BaseRspStr{Code: dto.AgentCodeParamErr, RequestId: svc.RequestId, Message: err1.Error()}
+	}
+
+	var expiration time.Time
+	if req.ExpiresInHours > 0 {
+		expiration = time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour)
+	}
+	vc, err := did.IssueCredential(levelDBTrans, issuerAoId, types, subject, expiration)
+	if err != nil {
+		err1 := fmt.Errorf("IssueCredential err:%v", err)
+		logger.AppLogger().Warnf(err1.Error())
+		return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, RequestId: svc.RequestId, Message: err1.Error()}
+	}
+	vcBytes, err := json.Marshal(vc)
+	if err != nil {
+		err1 := fmt.Errorf("Marshal err:%v", err)
+		logger.AppLogger().Warnf(err1.Error())
+		return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, RequestId: svc.RequestId, Message: err1.Error()}
+	}
+
+	svc.Rsp = &credential.IssueCredentialRsp{Credential: vcBytes}
+	return svc.BaseService.Process()
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package credential
+
+import (
+	"agent/biz/model/did"
+	"agent/biz/model/dto"
+	"agent/biz/model/dto/did/credential"
+	"agent/biz/service/base"
+	"agent/utils/logger"
+	"fmt"
+)
+
+type VerifyCredential struct {
+	base.BaseService
+}
+
+func NewVerifyCredential() *VerifyCredential {
+	svc := new(VerifyCredential)
+	return svc
+}
+
+// Process 校验结果放在 verified、reason 中, 只有请求格式错误时返回错误码.
+func (svc *VerifyCredential) Process() dto.BaseRspStr {
+	req := svc.Req.(*credential.VerifyCredentialReq)
+	logger.AppLogger().Debugf("VerifyCredential Process, svc.RequestId:%v", svc.RequestId)
+	if req == nil || len(req.Credential) < 1 {
+		err1 := fmt.Errorf("request error")
+		logger.AppLogger().Debugf(err1.Error())
+		return dto.BaseRspStr{Code: dto.AgentCodeBadReqStr, RequestId: svc.RequestId, Message: err1.Error()}
+	}
+
+	rsp := &credential.VerifyCredentialRsp{}
+	vc, err := did.VerifyCredential(nil, req.Credential)
+	if err != nil {
+		logger.AppLogger().Infof("VerifyCredential, not verified, err:%v", err)
+		rsp.Reason = err.Error()
+	} else {
+		*rsp = credential.VerifyCredentialRsp{Verified: true, Issuer: vc.Issuer, Types: vc.Type,
+			Subject: vc.CredentialSubject}
+	}
+	svc.Rsp = rsp
+	return svc.BaseService.Process()
+}
+
+type VerifyPresentation struct {
+	base.BaseService
+}
+
+func NewVerifyPresentation() *VerifyPresentation {
+	svc := new(VerifyPresentation)
+	return svc
+}
+
+func (svc *VerifyPresentation) Process() dto.BaseRspStr {
+	req := svc.Req.(*credential.VerifyPresentationReq)
+	logger.AppLogger().Debugf("VerifyPresentation Process, svc.RequestId:%v", svc.RequestId)
+	if req == nil || len(req.Presentation) < 1 || len(req.Challenge) < 1 {
+		err1 := fmt.Errorf("request error")
+		logger.AppLogger().Debugf(err1.Error())
+		return dto.BaseRspStr{Code: dto.AgentCodeBadReqStr, RequestId: svc.RequestId, Message: err1.Error()}
+	}
+
+	rsp := &credential.VerifyPresentationRsp{}
+	vp, err := did.VerifyPresentation(nil, req.Presentation, req.Challenge, req.Domain)
+	if err != nil {
+		logger.AppLogger().Infof("VerifyPresentation, not verified, err:%v", err)
+		rsp.Reason = err.Error()
+		svc.Rsp = rsp
+		return svc.BaseService.Process()
+	}
+
+	rsp.Verified = true
+	rsp.Holder = vp.Holder
+	for _, vc := range vp.VerifiableCredential {
+		rsp.Credentials = append(rsp.Credentials, credential.VerifyCredentialRsp{Verified: true,
+			Issuer: vc.Issuer, Types: vc.Type, Subject: vc.CredentialSubject})
+	}
+	svc.Rsp = rsp
+	return svc.BaseService.Process()
+}
@@ -0,0 +1,93 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deactivate
+
+import (
+	"agent/biz/model/did"
+	"agent/biz/model/did/leveldb"
+	"agent/biz/model/dto"
+	"agent/biz/model/dto/did/document/deactivate"
+	"agent/biz/service/base"
+	"agent/utils/logger"
+	"fmt"
+)
+
+type DeactivateDocument struct {
+	base.BaseService
+}
+
+func NewDeactivateDocument() *DeactivateDocument {
+	svc := new(DeactivateDocument)
+	return svc
+}
+
+func (svc *DeactivateDocument) Process() dto.BaseRspStr {
+	req := svc.Req.(*deactivate.DeactivateDocumentReq)
+	logger.AppLogger().Debugf("DeactivateDocument Process, svc.RequestId:%v, req:%+v", svc.RequestId, req)
+	if req == nil {
+		err1 := fmt.Errorf("request error")
+		logger.AppLogger().Debugf(err1.Error())
+		return dto.BaseRspStr{Code: dto.AgentCodeBadReqStr, RequestId: svc.RequestId, Message: err1.Error()}
+	}
+
+	levelDBTrans, err := leveldb.BeginTransaction() // 开启事务
+	if err != nil {
+		err1 := fmt.Errorf("BeginTransaction err:%v", err)
+		logger.AppLogger().Warnf(err1.Error())
+		return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, RequestId: svc.RequestId, Message: err1.Error()}
+	}
+	defer levelDBTrans.Rollback() // 退出时回滚事务. 如果成功, 函数返回之前主动 commit.
+
+	var dids []string
+	if req.All {
+		dids, err = did.DeactivateAllDocuments(levelDBTrans)
+	} else {
+		var didStr string
+		_, didStr, err = did.DeactivateDocument(levelDBTrans, req.DID, req.AOID)
+		dids = []string{didStr}
+	}
+	if err != nil {
+		err1 := fmt.Errorf("DeactivateDocument err:%v", err)
+		logger.AppLogger().Warnf(err1.Error())
+		return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, RequestId: svc.RequestId, Message: err1.Error()}
+	}
+	if err := levelDBTrans.Commit(); err != nil {
+		err1 := fmt.Errorf("Commit err:%v", err)
+		logger.AppLogger().Warnf(err1.Error())
+		return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, RequestId: svc.RequestId, Message: err1.Error()}
+	}
+
+	svc.Rsp = &deactivate.DeactivateDocumentRsp{DIDs: dids}
+	return svc.BaseService.Process()
+}
+
+// DeactivateAll 在独立事务中注销所有 DID, 管理员解绑(重置设备)成功后调用.
+func DeactivateAll() ([]string, error) {
+	levelDBTrans, err := leveldb.BeginTransaction()
+	if err != nil {
+		return nil, fmt.Errorf("BeginTransaction err:%v", err)
+	}
+	defer levelDBTrans.Rollback()
+
+	dids, err := did.DeactivateAllDocuments(levelDBTrans)
+	if err != nil {
+		return nil, fmt.Errorf("DeactivateAllDocuments err:%v", err)
+	}
+	if err := levelDBTrans.Commit(); err != nil {
+		return nil, fmt.Errorf("Commit err:%v", err)
+	}
+	logger.AppLogger().Infof("DeactivateAll, dids:%v", dids)
+	return dids, nil
+}
@@ -20,8 +20,12 @@ import (
 	"agent/biz/model/dto"
 	"agent/biz/model/dto/did/document/password"
 	"agent/biz/service/base"
+	"agent/biz/service/did/document"
 	"agent/utils/logger"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"time"
 )
 
 type UpdateDocumentPassword struct {
@@ -33,27 +37,54 @@ func NewUpdateDocumentPassword() *UpdateDocumentPassword {
 	return svc
 }
 
+// Process 不带 proposalId 时生成提议并返回待签名数据; 带 proposalId 时校验签名后写入.
 func (svc *UpdateDocumentPassword) Process() dto.BaseRspStr {
 	req := svc.Req.(*password.UpdateDocumentPasswordReq)
-	logger.AppLogger().Debugf("UpdateDocumentPassword Process, svc.RequestId:%v, req:%+v", svc.RequestId, req)
 	if req == nil {
 		err1 := fmt.Errorf("request is nil")
 		logger.AppLogger().Debugf(err1.Error())
 		return dto.BaseRspStr{Code: dto.AgentCodeBadReqStr, RequestId: svc.RequestId, Message: err1.Error()}
 	}
+	logger.AppLogger().Debugf("UpdateDocumentPassword Process, svc.RequestId:%v, did:%v, aoId:%v, proposalId:%v",
+		svc.RequestId, req.DID, req.AOID, req.ProposalId)
 
-	levelDBTrans, err := leveldb.BeginTransaction() // 开启事务
-	defer levelDBTrans.Rollback()                   // 退出时回滚事务. 如果成功, 函数返回之前主动 commit.
-
-	err = did.UpdatePasswordKey(levelDBTrans, req.DID, req.AOID, req.OldPassword, req.NewPassword)
-	if err != nil {
-		err1 := fmt.Errorf("UpdatePasswordKey err:%v", err)
-		logger.AppLogger().Debugf(err1.Error())
-		return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, RequestId: svc.RequestId, Message: err1.Error()}
+	if len(req.ProposalId) < 1 {
+		if len(req.OldPassword) < 1 || len(req.NewPassword) < 1 {
+			err1 := fmt.Errorf("oldPassword and newPassword are required")
+			logger.AppLogger().Debugf(err1.Error())
+			return dto.BaseRspStr{Code: dto.AgentCodeParamErr, RequestId: svc.RequestId, Message: err1.Error()}
+		}
+		proposal, err := document.CreateUpdateProposal(func(levelDBTrans *leveldb.Trans) (*did.UpdateProposal, error) {
+			return did.ProposePasswordUpdate(levelDBTrans, req.DID, req.AOID, req.OldPassword, req.NewPassword)
+		})
+		if err != nil {
+			err1 := fmt.Errorf("ProposePasswordUpdate err:%v", err)
+			logger.AppLogger().Debugf(err1.Error())
+			return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, RequestId: svc.RequestId, Message: err1.Error()}
+		}
+		signingInput, err := proposal.SigningInput()
+		if err != nil {
+			err1 := fmt.Errorf("SigningInput err:%v", err)
+			logger.AppLogger().Debugf(err1.Error())
+			return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, RequestId: svc.RequestId, Message: err1.Error()}
+		}
+		svc.Rsp = &password.UpdateDocumentPasswordRsp{DIDDoc: base64.StdEncoding.EncodeToString(proposal.Document),
+			ProposalId:   proposal.ID,
+			SigningInput: base64.StdEncoding.EncodeToString(signingInput),
+			ExpiresAt:    proposal.ExpiresAt.UTC().Format(time.RFC3339)}
+		return svc.BaseService.Process()
 	}
 
-	if levelDBTrans != nil {
-		levelDBTrans.Commit() // commit 提交事务
+	if _, err := document.CommitUpdateProposal(req.ProposalId, did.UpdateKindPassword, req.Signatures); err != nil {
+		err1 := fmt.Errorf("CommitUpdateProposal err:%v", err)
+		logger.AppLogger().Warnf(err1.Error())
+		code := dto.AgentCodeServerErrorStr
+		if errors.Is(err, did.ErrUnauthorizedUpdate) {
+			code = dto.AgentCodeUnauthorizedUpdate
+		} else if errors.Is(err, did.ErrProposalNotFound) {
+			code = dto.AgentCodeParamErr
+		}
+		return dto.BaseRspStr{Code: code, RequestId: svc.RequestId, Message: err1.Error()}
 	}
 	return svc.BaseService.Process()
 }
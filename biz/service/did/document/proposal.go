@@ -0,0 +1,65 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package document
+
+import (
+	"agent/biz/model/did"
+	"agent/biz/model/did/leveldb"
+	"agent/biz/model/dto/did/document"
+	"fmt"
+)
+
+// CreateUpdateProposal 在回滚的事务中计算提议的更新, 再在新的事务中保存提议.
+func CreateUpdateProposal(propose func(levelDBTrans *leveldb.Trans) (*did.UpdateProposal, error)) (*did.UpdateProposal, error) {
+	scratchTrans, err := leveldb.BeginTransaction()
+	if err != nil {
+		return nil, fmt.Errorf("BeginTransaction err:%v", err)
+	}
+	proposal, err := propose(scratchTrans)
+	scratchTrans.Rollback() // 只用于计算, 不提交
+	if err != nil {
+		return nil, err
+	}
+
+	levelDBTrans, err := leveldb.BeginTransaction()
+	if err != nil {
+		return nil, fmt.Errorf("BeginTransaction err:%v", err)
+	}
+	defer levelDBTrans.Rollback()
+	if err := did.SaveUpdateProposal(levelDBTrans, proposal); err != nil {
+		return nil, fmt.Errorf("SaveUpdateProposal err:%v", err)
+	}
+	if err := levelDBTrans.Commit(); err != nil {
+		return nil, fmt.Errorf("Commit err:%v", err)
+	}
+	return proposal, nil
+}
+
+// CommitUpdateProposal 校验签名并写入提议的更新.
+func CommitUpdateProposal(proposalId, kind string, signatures []*document.UpdateSignature) (*did.UpdateProposal, error) {
+	levelDBTrans, err := leveldb.BeginTransaction()
+	if err != nil {
+		return nil, fmt.Errorf("BeginTransaction err:%v", err)
+	}
+	defer levelDBTrans.Rollback()
+	proposal, err := did.CommitUpdateProposal(levelDBTrans, proposalId, kind, signatures)
+	if err != nil {
+		return nil, err
+	}
+	if err := levelDBTrans.Commit(); err != nil {
+		return nil, fmt.Errorf("Commit err:%v", err)
+	}
+	return proposal, nil
+}
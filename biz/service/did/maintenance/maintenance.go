@@ -0,0 +1,61 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package maintenance
+
+import (
+	"agent/biz/model/did"
+	"agent/biz/model/did/leveldb"
+	"agent/config"
+	"agent/utils/logger"
+
+	"github.com/robfig/cron/v3"
+)
+
+// Start 在 leveldb.OpenDB 之后调用: 执行索引完整性检查, 并启动定时压缩和在线备份.
+// 结果记录在 leveldb.GetMaintenanceStatus 中.
+func Start() {
+	CheckIntegrity()
+
+	c := cron.New()
+	if spec := config.Config.Box.DID.CompactionCron; len(spec) > 0 {
+		if _, err := c.AddFunc(spec, compact); err != nil {
+			logger.AppLogger().Errorf("Failed to config cron: %s", err)
+		}
+	}
+	if spec := config.Config.Box.DID.BackupCron; len(spec) > 0 {
+		if _, err := c.AddFunc(spec, backup); err != nil {
+			logger.AppLogger().Errorf("Failed to config cron: %s", err)
+		}
+	}
+	c.Start()
+}
+
+// CheckIntegrity 检查 aoid->did 和 did->aoid 索引, 只报告孤立项, 不修改数据.
+func CheckIntegrity() {
+	report, err := did.CheckIndexIntegrity(nil)
+	if err != nil {
+		logger.AppLogger().Warnf("CheckIntegrity, CheckIndexIntegrity err:%v", err)
+		report = &leveldb.IntegrityReport{Error: err.Error()}
+	}
+	leveldb.SetIntegrityReport(report)
+}
+
+func compact() {
+	leveldb.Compact()
+}
+
+func backup() {
+	leveldb.Backup(config.Config.Box.DID.BackupDir, config.Config.Box.DID.BackupKeep)
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"agent/biz/model/did"
+	"agent/biz/model/dto/did/resolve"
+	aospacedid "agent/deps/did/aospace/did"
+	"agent/utils/logger"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	didScheme        = "did:"
+	aospaceDidPrefix = "did:aospace:"
+)
+
+// Resolve 按 W3C DID Resolution 解析本地保存的 DID 文档, 返回 HTTP 状态码和解析结果.
+func Resolve(didStr string, req *resolve.ResolveReq) (int, *resolve.ResolutionResult) {
+	logger.AppLogger().Debugf("Resolve, did:%v, req:%+v", didStr, req)
+
+	// 先按 method 分流, 其他 method 的 DID 不交给 aospace 的解析器.
+	if !strings.HasPrefix(didStr, didScheme) {
+		return errorResult(http.StatusBadRequest, resolve.ErrorInvalidDid,
+			fmt.Errorf("invalid did: %v", didStr))
+	}
+	if !strings.HasPrefix(didStr, aospaceDidPrefix) {
+		return errorResult(http.StatusNotImplemented, resolve.ErrorMethodNotSupported,
+			fmt.Errorf("only %v is supported", aospaceDidPrefix))
+	}
+	// 只解析 DID, DID URL(path、query、fragment)需要先解引用.
+	if strings.ContainsAny(didStr, "/?#") {
+		return errorResult(http.StatusBadRequest, resolve.ErrorInvalidDid,
+			fmt.Errorf("DID URL is not supported: %v", didStr))
+	}
+	if _, err := aospacedid.Parse(didStr); err != nil {
+		return errorResult(http.StatusBadRequest, resolve.ErrorInvalidDid, err)
+	}
+
+	opts := &did.ResolveOptions{VersionId: req.VersionId}
+	if len(req.VersionTime) > 0 {
+		t, err := time.Parse(time.RFC3339, req.VersionTime)
+		if err != nil {
+			return errorResult(http.StatusBadRequest, resolve.ErrorInvalidOptions,
+				fmt.Errorf("invalid versionTime, err:%v", err))
+		}
+		opts.VersionTime = t
+	}
+
+	doc, meta, err := did.ResolveDocument(nil, didStr, opts)
+	if errors.Is(err, did.ErrDocumentNotFound) || errors.Is(err, did.ErrVersionNotFound) {
+		return errorResult(http.StatusNotFound, resolve.ErrorNotFound, err)
+	}
+	if err != nil {
+		logger.AppLogger().Warnf("Resolve, did:%v, err:%v", didStr, err)
+		return errorResult(http.StatusInternalServerError, resolve.ErrorInternalError, err)
+	}
+
+	status := http.StatusOK
+	if meta.Deactivated {
+		status = http.StatusGone
+	}
+	return status, &resolve.ResolutionResult{
+		Context:               resolve.ContextResolution,
+		DidDocument:           doc,
+		DidResolutionMetadata: &resolve.ResolutionMetadata{ContentType: resolve.ContentTypeDidDocument},
+		DidDocumentMetadata: &resolve.DocumentMetadata{Created: meta.Created, Updated: meta.Updated,
+			VersionId: meta.VersionId, NextUpdate: meta.NextUpdate, NextVersionId: meta.NextVersionId,
+			Deactivated: meta.Deactivated},
+	}
+}
+
+// InvalidOptions 返回解析参数错误的结果.
+func InvalidOptions(err error) (int, *resolve.ResolutionResult) {
+	return errorResult(http.StatusBadRequest, resolve.ErrorInvalidOptions, err)
+}
+
+func errorResult(status int, code string, err error) (int, *resolve.ResolutionResult) {
+	return status, &resolve.ResolutionResult{
+		Context:               resolve.ContextResolution,
+		DidResolutionMetadata: &resolve.ResolutionMetadata{Error: code, ErrorMessage: err.Error()},
+		DidDocumentMetadata:   &resolve.DocumentMetadata{},
+	}
+}
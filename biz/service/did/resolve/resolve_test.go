@@ -0,0 +1,43 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"agent/biz/model/dto/did/resolve"
+	"net/http"
+	"testing"
+)
+
+func TestResolveInvalidInput(t *testing.T) {
+	cases := []struct {
+		did         string
+		versionTime string
+		status      int
+		code        string
+	}{
+		{"abc", "", http.StatusBadRequest, resolve.ErrorInvalidDid},
+		{"did:aospace:abc#key-0", "", http.StatusBadRequest, resolve.ErrorInvalidDid},
+		{"did:example:abc", "", http.StatusNotImplemented, resolve.ErrorMethodNotSupported},
+		{"did:example:abc/path?x=1", "", http.StatusNotImplemented, resolve.ErrorMethodNotSupported},
+		{"did:aospace:abc", "yesterday", http.StatusBadRequest, resolve.ErrorInvalidOptions},
+	}
+	for _, c := range cases {
+		status, result := Resolve(c.did, &resolve.ResolveReq{VersionTime: c.versionTime})
+		if status != c.status || result.DidResolutionMetadata.Error != c.code {
+			t.Errorf("Resolve(%v), status:%v, error:%v, want %v %v", c.did, status,
+				result.DidResolutionMetadata.Error, c.status, c.code)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mdns
+
+import (
+	"agent/biz/model/clientinfo"
+	"agent/biz/model/device"
+	"agent/biz/model/device_ability"
+	"agent/config"
+	"fmt"
+	"net"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"agent/utils/logger"
+
+	"github.com/dungeonsnd/gocom/sys/run"
+	"github.com/grandcat/zeroconf"
+)
+
+const (
+	mdnsPort      = 5353
+	serviceHttp   = "_http._tcp"
+	serviceHttps  = "_https._tcp"
+	serviceDomain = "local."
+)
+
+var (
+	mtx     sync.Mutex
+	servers []*zeroconf.Server
+	text    []string
+	ifaces  []string // 注册时的组播网卡, 变化时需要重新注册
+	avahi   bool     // 5353 端口已被占用, 由 avahi 广播
+)
+
+// Start 在进程内广播盒子的 HTTP/HTTPS 服务. 5353 端口已被其他进程(一般是 avahi-daemon)占用时不启动,
+// 网络变化时改为重启 avahi.
+func Start() {
+	if !config.Config.Box.Mdns.Enable || device_ability.GetAbilityModel().RunInDocker {
+		return
+	}
+	if portInUse() {
+		logger.AppLogger().Infof("mdns, port %v in use, advertising by %v", mdnsPort, config.Config.Box.Avahi.AvahiServiceName)
+		mtx.Lock()
+		avahi = true
+		mtx.Unlock()
+		return
+	}
+
+	mtx.Lock()
+	if err := register(); err != nil {
+		logger.AppLogger().Warnf("mdns, register err:%v", err)
+	}
+	mtx.Unlock()
+
+	interval := config.Config.Box.Mdns.RefreshIntervalSec
+	if interval <= 0 {
+		interval = 10
+	}
+	go func() {
+		for range time.Tick(time.Duration(interval) * time.Second) {
+			Refresh()
+		}
+	}()
+}
+
+// Refresh 配对状态等变化时更新 TXT 记录, 组播网卡变化或之前注册失败时重新注册.
+func Refresh() {
+	mtx.Lock()
+	defer mtx.Unlock()
+	if avahi || !config.Config.Box.Mdns.Enable || device_ability.GetAbilityModel().RunInDocker {
+		return
+	}
+	if len(servers) < 1 || !reflect.DeepEqual(ifaces, multicastIfaces()) {
+		if err := register(); err != nil {
+			logger.AppLogger().Warnf("mdns, register err:%v", err)
+		}
+		return
+	}
+	if t := txtRecords(); !reflect.DeepEqual(t, text) {
+		logger.AppLogger().Infof("mdns, update txt:%v", t)
+		for _, s := range servers {
+			s.SetText(t)
+		}
+		text = t
+	}
+}
+
+// OnNetworkChange 局域网地址变化时调用. 地址记录在应答时按网卡实时获取, 只需要处理网卡增减;
+// 由 avahi 广播时重启 avahi.
+func OnNetworkChange() {
+	mtx.Lock()
+	useAvahi := avahi
+	mtx.Unlock()
+	if !useAvahi {
+		Refresh()
+		return
+	}
+	params := []string{"restart", config.Config.Box.Avahi.AvahiServiceName}
+	if stdOutput, errOutput, err := run.RunExe("systemctl", params); err != nil {
+		logger.AppLogger().Warnf("mdns, failed systemctl %v, err:%v, stdOutput:%v, errOutput:%v",
+			params, err, string(stdOutput), string(errOutput))
+	}
+}
+
+// register 注销原有服务后按当前的网卡和 TXT 记录重新注册. 调用者持有 mtx.
+func register() error {
+	shutdown()
+	ifaces = multicastIfaces()
+	text = txtRecords()
+	name, err := instanceName()
+	if err != nil {
+		return err
+	}
+	for _, svc := range []struct {
+		service string
+		port    string
+	}{
+		{serviceHttp, config.Config.Box.Avahi.WebPort},
+		{serviceHttps, config.Config.Box.Avahi.SSLPort},
+	} {
+		port, err := strconv.Atoi(svc.port)
+		if err != nil {
+			return fmt.Errorf("invalid port %v of %v, err:%v", svc.port, svc.service, err)
+		}
+		s, err := zeroconf.Register(name, svc.service, serviceDomain, port, text, nil)
+		if err != nil {
+			shutdown()
+			return fmt.Errorf("failed to register %v, err:%v", svc.service, err)
+		}
+		servers = append(servers, s)
+	}
+	logger.AppLogger().Infof("mdns, registered %v on %v, txt:%v", name, ifaces, text)
+	return nil
+}
+
+func shutdown() {
+	for _, s := range servers {
+		s.Shutdown()
+	}
+	servers = nil
+}
+
+func instanceName() (string, error) {
+	btidHash := shortBtidHash()
+	if len(btidHash) < 1 {
+		return "", fmt.Errorf("btidhash not ready")
+	}
+	return config.Config.Box.Mdns.InstancePrefix + btidHash, nil
+}
+
+func shortBtidHash() string {
+	btidHash := device.GetDeviceInfo().BtidHash
+	if n := int(config.Config.Box.Avahi.BtIdHashLen); n > 0 && len(btidHash) > n {
+		btidHash = btidHash[:n]
+	}
+	return btidHash
+}
+
+func txtRecords() []string {
+	return buildText(shortBtidHash(), device_ability.GetAbilityModel().DeviceModelNumber, config.VersionNumber,
+		clientinfo.GetAdminPairedStatus() == clientinfo.DeviceAlreadyBound)
+}
+
+func buildText(btidHash string, model int, version string, paired bool) []string {
+	return []string{
+		"btidhash=" + btidHash,
+		"devicemodel=" + strconv.Itoa(model),
+		"version=" + version,
+		"paired=" + strconv.FormatBool(paired),
+	}
+}
+
+// multicastIfaces 与 zeroconf 选择网卡的规则一致: 已启用且支持组播.
+func multicastIfaces() []string {
+	list, err := net.Interfaces()
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0)
+	for _, iface := range list {
+		if iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagMulticast != 0 {
+			names = append(names, iface.Name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// portInUse 不设置 SO_REUSEADDR 绑定 5353 端口, avahi 等已绑定该端口时会失败.
+func portInUse() bool {
+	c, err := net.ListenUDP("udp4", &net.UDPAddr{Port: mdnsPort})
+	if err != nil {
+		return true
+	}
+	c.Close()
+	return false
+}
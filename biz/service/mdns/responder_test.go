@@ -0,0 +1,28 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package mdns
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestBuildText(t *testing.T) {
+	text := buildText("a1b2c3", 200, "1.0.0", true)
+	want := []string{"btidhash=a1b2c3", "devicemodel=200", "version=1.0.0", "paired=true"}
+	if !reflect.DeepEqual(text, want) {
+		t.Errorf("text %v, want %v", text, want)
+	}
+}
@@ -0,0 +1,206 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"agent/config"
+	util_network "agent/utils/network"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"agent/utils/logger"
+	"github.com/dungeonsnd/gocom/encrypt/random"
+	"github.com/dungeonsnd/gocom/file/fileutil"
+)
+
+const (
+	applyPendingFile = "pending.json"
+
+	maxApplyConfirmSeconds = 600 // 等待确认的最长时间, 避免配置错误时长时间无法回滚
+)
+
+// networkApply 一次网络配置变更. 从 beginNetworkApply 开始占用变更槽位, 直到客户端确认或回滚.
+// 快照和 pending 记录保存在 ApplySnapshotDir, agent 重启后由 RecoverNetworkApply 继续计时或回滚.
+type networkApply struct {
+	TransactionId string    `json:"transactionId"`
+	Deadline      time.Time `json:"deadline"`
+
+	timer *time.Timer // 配置已应用, 开始等待确认后设置
+}
+
+var (
+	applyMtx     sync.Mutex
+	pendingApply *networkApply
+
+	errApplyPending  = fmt.Errorf("previous network config is in progress or waiting for confirmation")
+	errApplyNotArmed = fmt.Errorf("network config is still being applied")
+)
+
+// applyConfirmSeconds 等待客户端确认的秒数, 不超过 maxApplyConfirmSeconds.
+func applyConfirmSeconds() int {
+	if config.Config.Box.Network.ApplyConfirmSeconds > maxApplyConfirmSeconds {
+		return maxApplyConfirmSeconds
+	}
+	return config.Config.Box.Network.ApplyConfirmSeconds
+}
+
+// beginNetworkApply 占用变更槽位并保存当前网络配置快照. 已有进行中或等待确认的变更时返回 errApplyPending.
+// 成功后由 runNetworkApply 应用配置, 所有变更都需要客户端确认, 超时未确认则回滚.
+func beginNetworkApply() (*networkApply, error) {
+	applyMtx.Lock()
+	defer applyMtx.Unlock()
+	if pendingApply != nil {
+		return nil, errApplyPending
+	}
+	if err := util_network.TakeSnapshot(config.Config.Box.Network.ApplySnapshotDir); err != nil {
+		return nil, fmt.Errorf("failed to take network snapshot, err:%v", err)
+	}
+	pendingApply = &networkApply{TransactionId: random.GenUUID()}
+	return pendingApply, nil
+}
+
+// runNetworkApply 在后台应用配置, 失败时立即回滚, 成功后开始等待确认.
+// 应用配置可能断开客户端当前的连接, 因此请求在应用前就返回 transactionId.
+func runNetworkApply(a *networkApply, apply func() error) {
+	if err := apply(); err != nil {
+		logger.AppLogger().Warnf("failed to apply network config %v, rollback, err:%v", a.TransactionId, err)
+		abortNetworkApply(a)
+		return
+	}
+	if err := armNetworkApply(a); err != nil {
+		logger.AppLogger().Warnf("failed armNetworkApply, rollback, err:%v", err)
+		abortNetworkApply(a)
+	}
+}
+
+// reserveNetworkApply 只占用变更槽位, 不保存快照, 用于自行回滚的修改(如 dns 设置), 避免与网络配置变更或其回滚交错.
+// 用完调用 releaseNetworkApply.
+func reserveNetworkApply() (*networkApply, error) {
+	applyMtx.Lock()
+	defer applyMtx.Unlock()
+	if pendingApply != nil {
+		return nil, errApplyPending
+	}
+	pendingApply = &networkApply{TransactionId: random.GenUUID()}
+	return pendingApply, nil
+}
+
+// releaseNetworkApply 释放 reserveNetworkApply 占用的槽位.
+func releaseNetworkApply(a *networkApply) {
+	applyMtx.Lock()
+	defer applyMtx.Unlock()
+	if pendingApply == a {
+		pendingApply = nil
+	}
+}
+
+// armNetworkApply 配置已应用, 开始等待确认, 超时未确认则回滚.
+func armNetworkApply(a *networkApply) error {
+	applyMtx.Lock()
+	defer applyMtx.Unlock()
+	if pendingApply != a {
+		return fmt.Errorf("network config %v not in progress", a.TransactionId)
+	}
+	a.Deadline = time.Now().Add(time.Duration(applyConfirmSeconds()) * time.Second)
+	if err := fileutil.WriteToFileAsJson(applyPendingFilePath(), a, "  ", true); err != nil {
+		return fmt.Errorf("failed to write %v, err:%v", applyPendingFilePath(), err)
+	}
+	startApplyTimer(a)
+	return nil
+}
+
+func startApplyTimer(a *networkApply) {
+	pendingApply = a
+	a.timer = time.AfterFunc(time.Until(a.Deadline), func() {
+		applyMtx.Lock()
+		defer applyMtx.Unlock()
+		if pendingApply != a {
+			return
+		}
+		logger.AppLogger().Warnf("network config %v not confirmed before %v, rollback", a.TransactionId, a.Deadline)
+		rollbackNetworkApply()
+	})
+}
+
+// ConfirmNetworkApply 客户端通过新的网络路径确认配置可用, 取消回滚. 配置还在应用时返回 errApplyNotArmed, 客户端稍后重试.
+func ConfirmNetworkApply(transactionId string) error {
+	applyMtx.Lock()
+	defer applyMtx.Unlock()
+	if pendingApply == nil || pendingApply.TransactionId != transactionId {
+		return fmt.Errorf("no pending network config %v", transactionId)
+	}
+	if pendingApply.timer == nil {
+		return errApplyNotArmed
+	}
+	pendingApply.timer.Stop()
+	pendingApply = nil
+	logger.AppLogger().Infof("network config %v confirmed", transactionId)
+	return os.Remove(applyPendingFilePath())
+}
+
+// abortNetworkApply 应用配置失败时立即回滚.
+func abortNetworkApply(a *networkApply) {
+	applyMtx.Lock()
+	defer applyMtx.Unlock()
+	if pendingApply != a {
+		return
+	}
+	rollbackNetworkApply()
+}
+
+// rollbackNetworkApply 恢复快照并清除等待状态, 调用方需持有 applyMtx.
+func rollbackNetworkApply() {
+	if pendingApply != nil && pendingApply.timer != nil {
+		pendingApply.timer.Stop()
+	}
+	if err := util_network.RestoreSnapshot(config.Config.Box.Network.ApplySnapshotDir); err != nil {
+		logger.AppLogger().Errorf("failed to restore network snapshot, err:%v", err)
+	}
+	pendingApply = nil
+	if fileutil.IsFileExist(applyPendingFilePath()) {
+		if err := os.Remove(applyPendingFilePath()); err != nil {
+			logger.AppLogger().Warnf("failed to delete %v, err:%v", applyPendingFilePath(), err)
+		}
+	}
+}
+
+// RecoverNetworkApply 启动时检查重启前是否有未确认的网络配置. 已超时则回滚, 否则继续等待确认.
+func RecoverNetworkApply() {
+	f := applyPendingFilePath()
+	if !fileutil.IsFileExist(f) {
+		return
+	}
+	a := &networkApply{}
+	if err := fileutil.ReadFileJsonToObject(f, a); err != nil {
+		logger.AppLogger().Warnf("failed to read %v, err:%v", f, err)
+	}
+
+	applyMtx.Lock()
+	defer applyMtx.Unlock()
+	if time.Now().After(a.Deadline) {
+		logger.AppLogger().Warnf("network config %v not confirmed before restart, rollback", a.TransactionId)
+		rollbackNetworkApply()
+		return
+	}
+	logger.AppLogger().Infof("network config %v waiting for confirmation until %v", a.TransactionId, a.Deadline)
+	startApplyTimer(a)
+}
+
+func applyPendingFilePath() string {
+	return filepath.Join(config.Config.Box.Network.ApplySnapshotDir, applyPendingFile)
+}
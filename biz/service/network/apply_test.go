@@ -0,0 +1,218 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"agent/config"
+	util_network "agent/utils/network"
+)
+
+// setupApplyTest 使用临时目录和 FakeBackend, wired 为快照时激活的连接.
+func setupApplyTest(t *testing.T) (*util_network.FakeBackend, string) {
+	connDir := t.TempDir()
+	oldConnDir, oldSnapDir := config.Config.Box.Network.ConnectionDir, config.Config.Box.Network.ApplySnapshotDir
+	oldDns, oldSeconds := config.Config.Box.DnsConfigFile, config.Config.Box.Network.ApplyConfirmSeconds
+	config.Config.Box.Network.ConnectionDir = connDir
+	config.Config.Box.Network.ApplySnapshotDir = filepath.Join(t.TempDir(), "apply")
+	config.Config.Box.DnsConfigFile = filepath.Join(t.TempDir(), "resolved.conf")
+	config.Config.Box.Network.ApplyConfirmSeconds = 120
+
+	fake := util_network.NewFakeBackend()
+	fake.DevicesList = []*util_network.Device{{Interface: "eth0", Type: util_network.DevStatus_Type_Wire,
+		State: util_network.DevState_Connected, ConnectionUuid: "wired"}}
+	fake.Connections["wired"] = &util_network.Connection{Id: "eth0", Uuid: "wired", Type: "802-3-ethernet", InterfaceName: "eth0"}
+	old := util_network.SetBackend(fake)
+
+	t.Cleanup(func() {
+		applyMtx.Lock()
+		if pendingApply != nil && pendingApply.timer != nil {
+			pendingApply.timer.Stop()
+		}
+		pendingApply = nil
+		applyMtx.Unlock()
+		util_network.SetBackend(old)
+		config.Config.Box.Network.ConnectionDir, config.Config.Box.Network.ApplySnapshotDir = oldConnDir, oldSnapDir
+		config.Config.Box.DnsConfigFile, config.Config.Box.Network.ApplyConfirmSeconds = oldDns, oldSeconds
+	})
+	return fake, connDir
+}
+
+func TestRunNetworkApply(t *testing.T) {
+	setupApplyTest(t)
+	a, err := beginNetworkApply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 应用配置期间槽位已被占用, 确认需要等应用完成
+	if _, err := beginNetworkApply(); err != errApplyPending {
+		t.Fatalf("expected errApplyPending, err:%v", err)
+	}
+	if err := ConfirmNetworkApply(a.TransactionId); err != errApplyNotArmed {
+		t.Fatalf("expected errApplyNotArmed, err:%v", err)
+	}
+	runNetworkApply(a, func() error { return nil })
+	if _, err := os.Stat(applyPendingFilePath()); err != nil {
+		t.Fatalf("pending file not written, err:%v", err)
+	}
+	if err := ConfirmNetworkApply(a.TransactionId); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := beginNetworkApply(); err != nil {
+		t.Errorf("slot not released, err:%v", err)
+	}
+}
+
+func TestRunNetworkApplyFailed(t *testing.T) {
+	fake, _ := setupApplyTest(t)
+	a, err := beginNetworkApply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	runNetworkApply(a, func() error { return fmt.Errorf("failed to connect wifi") })
+	if fake.Reloaded != 1 {
+		t.Errorf("not rolled back, reloaded %v", fake.Reloaded)
+	}
+	if err := ConfirmNetworkApply(a.TransactionId); err == nil {
+		t.Errorf("confirm after rollback should fail")
+	}
+	if _, err := beginNetworkApply(); err != nil {
+		t.Errorf("slot not released, err:%v", err)
+	}
+}
+
+func TestApplyConfirmSecondsBounded(t *testing.T) {
+	setupApplyTest(t)
+	config.Config.Box.Network.ApplyConfirmSeconds = 3600
+	if got := applyConfirmSeconds(); got != maxApplyConfirmSeconds {
+		t.Errorf("applyConfirmSeconds %v, want %v", got, maxApplyConfirmSeconds)
+	}
+}
+
+func TestNetworkApplyConfirm(t *testing.T) {
+	setupApplyTest(t)
+	a, err := beginNetworkApply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ConfirmNetworkApply(a.TransactionId); err == nil {
+		t.Errorf("confirm should fail before the config is applied")
+	}
+	if err := armNetworkApply(a); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := beginNetworkApply(); err != errApplyPending {
+		t.Errorf("expected errApplyPending, err:%v", err)
+	}
+	if err := ConfirmNetworkApply("other"); err == nil {
+		t.Errorf("confirm with wrong transaction id should fail")
+	}
+	if err := ConfirmNetworkApply(a.TransactionId); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(applyPendingFilePath()); !os.IsNotExist(err) {
+		t.Errorf("pending file not removed, err:%v", err)
+	}
+	if err := ConfirmNetworkApply(a.TransactionId); err == nil {
+		t.Errorf("confirm twice should fail")
+	}
+}
+
+func TestNetworkApplyTimeoutRollback(t *testing.T) {
+	fake, connDir := setupApplyTest(t)
+	config.Config.Box.Network.ApplyConfirmSeconds = 0
+	a, err := beginNetworkApply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	added := filepath.Join(connDir, "home.nmconnection")
+	if err := os.WriteFile(added, []byte("ssid=home"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := armNetworkApply(a); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		applyMtx.Lock()
+		done := pendingApply == nil
+		applyMtx.Unlock()
+		if done {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("not rolled back")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := os.Stat(added); !os.IsNotExist(err) {
+		t.Errorf("added connection not removed, err:%v", err)
+	}
+	if fake.Reloaded != 1 || len(fake.Activated) != 1 || fake.Activated[0] != "wired" {
+		t.Errorf("reloaded %v, activated %v", fake.Reloaded, fake.Activated)
+	}
+	if err := ConfirmNetworkApply(a.TransactionId); err == nil {
+		t.Errorf("confirm after rollback should fail")
+	}
+}
+
+func TestNetworkApplyAbort(t *testing.T) {
+	fake, _ := setupApplyTest(t)
+	a, err := beginNetworkApply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	abortNetworkApply(a)
+	if fake.Reloaded != 1 {
+		t.Errorf("reloaded %v", fake.Reloaded)
+	}
+	if _, err := beginNetworkApply(); err != nil {
+		t.Errorf("slot not released after abort, err:%v", err)
+	}
+}
+
+func TestReserveNetworkApply(t *testing.T) {
+	setupApplyTest(t)
+	a, err := reserveNetworkApply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := beginNetworkApply(); err != errApplyPending {
+		t.Errorf("expected errApplyPending, err:%v", err)
+	}
+	if err := ConfirmNetworkApply(a.TransactionId); err == nil {
+		t.Errorf("reservation should not be confirmed")
+	}
+	releaseNetworkApply(a)
+
+	b, err := beginNetworkApply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reserveNetworkApply(); err != errApplyPending {
+		t.Errorf("expected errApplyPending, err:%v", err)
+	}
+	// 释放过期的占用不影响当前变更
+	releaseNetworkApply(a)
+	if err := armNetworkApply(b); err != nil {
+		t.Fatal(err)
+	}
+}
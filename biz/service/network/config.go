@@ -22,8 +22,9 @@ import (
 	"agent/biz/service/base"
 	"agent/config"
 	util_network "agent/utils/network"
-	rpi_network "agent/utils/rpi/network"
+	"errors"
 	"fmt"
+	"strings"
 
 	"agent/utils/logger"
 )
@@ -66,69 +67,79 @@ func (svc *GetNetworkConfigService) Process() dto.BaseRspStr {
 	rsp.InternetAccess = model.Get().PingCloudHost
 	rsp.LanAccessPort = config.Config.GateWay.LanPort
 	rsp.NetworkAdapters = []*network.NetworkAdapter{}
+	rsp.Failover = failoverStatus()
+	rsp.Tunnel = cachedTunnelStatus()
 
 	if device_ability.GetAbilityModel().RunInDocker {
 		svc.Rsp = rsp
 		return svc.BaseService.Process()
 	}
 
-	networkDevInfos, err := util_network.GetNetworkDevStatus()
+	devices, err := util_network.Backend().Devices()
 	if err != nil {
 		return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr,
 			Message: err.Error()}
 	}
 
-	for i, devStatus := range networkDevInfos {
-		logger.AppLogger().Debugf("GetNetworkConfigService, devStatus(%v/%v): %+v", i, len(networkDevInfos), devStatus)
-		if !devStatus.IsEthernetAndWifi() {
+	for i, dev := range devices {
+		logger.AppLogger().Debugf("GetNetworkConfigService, dev(%v/%v): %+v", i, len(devices), dev)
+		if !dev.IsEthernetAndWifi() {
 			continue
 		}
-		if !devStatus.IsConnected() {
+		if !dev.IsConnected() {
 			continue
 		}
 
-		conInfo, err := util_network.GetNetworkConInfo(devStatus.CONUUID)
+		conInfo, err := util_network.Backend().Connection(dev.ConnectionUuid)
 		if err != nil {
-			logger.AppLogger().Warnf("failed GetNetworkConInfo, devStatus.CONUUID:%v, err:%v", devStatus.CONUUID, err)
+			logger.AppLogger().Warnf("failed Connection, dev.ConnectionUuid:%v, err:%v", dev.ConnectionUuid, err)
 			return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr,
 				Message: err.Error()}
 		}
 		logger.AppLogger().Debugf("GetNetworkConfigService, conInfo: %+v", conInfo)
 
-		devInfo, err := util_network.GetNetworkDevInfo(devStatus.DEVICE)
-		if err != nil {
-			logger.AppLogger().Warnf("failed GetNetworkDevInfo, devStatus.DEVICE:%v, err:%v", devStatus.DEVICE, err)
-			return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr,
-				Message: err.Error()}
+		dns1, dns2 := "", ""
+		if n := len(dev.Ip4Dns); n >= 2 {
+			dns1, dns2 = dev.Ip4Dns[n-2], dev.Ip4Dns[n-1]
+		} else if n == 1 {
+			dns1 = dev.Ip4Dns[0]
 		}
 
 		networkAdapter := network.NetworkAdapter{}
-		networkAdapter.AdapterName = devStatus.DEVICE
-		networkAdapter.Wired = devStatus.IsWire()
-		if devStatus.IsWireless() {
-			networkAdapter.WIFIAddress = conInfo.SeenBssids
-			networkAdapter.WIFIName = conInfo.GENERALNAME
+		networkAdapter.AdapterName = dev.Interface
+		networkAdapter.Wired = dev.IsWire()
+		if dev.IsWireless() {
+			networkAdapter.WIFIAddress = strings.Join(conInfo.SeenBssids, ",")
+			networkAdapter.WIFIName = dev.ConnectionId
 		}
-		networkAdapter.Connected = devStatus.IsConnected()
-		networkAdapter.MACAddress = devInfo.GENERALHWADDR
+		networkAdapter.Connected = dev.IsConnected()
+		networkAdapter.MACAddress = dev.HwAddress
 
 		networkAdapter.Ipv4UseDhcp = conInfo.UseDhcp()
-		networkAdapter.Ipv4 = conInfo.Ipv4Address()
-		networkAdapter.SubNetMask = conInfo.Ipv4NetMask()
-		networkAdapter.DefaultGateway = conInfo.IP4GATEWAY
-		networkAdapter.Ipv4DNS1 = conInfo.IP4DNS1
-		networkAdapter.Ipv4DNS2 = conInfo.IP4DNS2
+		networkAdapter.Ipv4 = dev.Ipv4Address()
+		networkAdapter.SubNetMask = dev.Ipv4NetMask()
+		networkAdapter.DefaultGateway = dev.Ip4Gateway
+		networkAdapter.Ipv4DNS1 = dns1
+		networkAdapter.Ipv4DNS2 = dns2
 		networkAdapter.Ipv6UseDhcp = conInfo.UseDhcpIpv6()
-		networkAdapter.Ipv6 = conInfo.IP6ADDRESS
-		networkAdapter.Ipv6DefaultGateway = conInfo.IP6GATEWAY
+		networkAdapter.Ipv6Mode = conInfo.Ipv6Method
+		networkAdapter.Ipv6Privacy = conInfo.Ipv6Privacy
+		fillIpv6Addresses(&networkAdapter, dev.Ip6Addresses)
+		networkAdapter.Ipv6DefaultGateway = dev.Ip6Gateway
 
 		rsp.NetworkAdapters = append(rsp.NetworkAdapters, &networkAdapter)
 
-		if len(conInfo.IP4DNS1) > 0 {
-			rsp.DNS1 = conInfo.IP4DNS1
+		if len(dns1) > 0 {
+			rsp.DNS1 = dns1
 		}
-		if len(conInfo.IP4DNS2) > 0 {
-			rsp.DNS2 = conInfo.IP4DNS2
+		if len(dns2) > 0 {
+			rsp.DNS2 = dns2
+		}
+		if n := len(dev.Ip6Dns); n > 0 && len(rsp.Ipv6DNS1) < 1 {
+			rsp.Ipv6DNS1 = dev.Ip6Dns[0]
+			if n > 1 {
+				rsp.Ipv6DNS2 = dev.Ip6Dns[1]
+			}
 		}
 	}
 
@@ -142,11 +153,78 @@ func (svc *GetNetworkConfigService) Process() dto.BaseRspStr {
 	if len(dns2) > 0 {
 		rsp.DNS2 = dns2[len(dns2)-1]
 	}
+	// 手动设置过 ipv6 dns 时以 resolved.conf 为准
+	if dns6, err := util_network.GetSystemdDnsIpv6(); err != nil {
+		logger.AppLogger().Warnf("failed GetSystemdDnsIpv6, err:%v", err)
+	} else if len(dns6) > 0 {
+		rsp.Ipv6DNS1, rsp.Ipv6DNS2 = dns6[0], ""
+		if len(dns6) > 1 {
+			rsp.Ipv6DNS2 = dns6[len(dns6)-1]
+		}
+	}
 
 	svc.Rsp = rsp
 	return svc.BaseService.Process()
 }
 
+// fillIpv6Addresses 把网卡的 ipv6 地址按全局、唯一本地、链路本地分开. 兼容旧字段 ipv6/subNetPreLen,
+// 依次优先取全局、唯一本地、链路本地地址.
+func fillIpv6Addresses(adapter *network.NetworkAdapter, addrs []string) {
+	adapter.Ipv6GlobalAddresses, adapter.Ipv6UlaAddresses, adapter.Ipv6LinkLocalAddresses = []string{}, []string{}, []string{}
+	for _, addr := range addrs {
+		switch util_network.Ipv6Scope(addr) {
+		case util_network.Ipv6Scope_Global:
+			adapter.Ipv6GlobalAddresses = append(adapter.Ipv6GlobalAddresses, addr)
+		case util_network.Ipv6Scope_Ula:
+			adapter.Ipv6UlaAddresses = append(adapter.Ipv6UlaAddresses, addr)
+		case util_network.Ipv6Scope_LinkLocal:
+			adapter.Ipv6LinkLocalAddresses = append(adapter.Ipv6LinkLocalAddresses, addr)
+		}
+	}
+	for _, list := range [][]string{adapter.Ipv6GlobalAddresses, adapter.Ipv6UlaAddresses, adapter.Ipv6LinkLocalAddresses} {
+		if len(list) > 0 {
+			arr := strings.Split(list[0], "/")
+			adapter.Ipv6 = arr[0]
+			if len(arr) > 1 {
+				adapter.SubNetPreLen = arr[1]
+			}
+			break
+		}
+	}
+}
+
+// ipv6ConfigOf 根据请求生成网卡的 ipv6 设置. 未指定 ipv6Mode 时兼容旧字段: ipv6UseDhcp 为 true 时使用 SLAAC,
+// 传了 ipv6 地址时使用静态地址, 否则返回的 Method 为空, 即不修改原有 ipv6 设置.
+func ipv6ConfigOf(adapter *network.NetworkAdapter, req *network.NetworkConfigReq) (util_network.Ipv6Config, error) {
+	cfg := util_network.Ipv6Config{Method: adapter.Ipv6Mode, Privacy: adapter.Ipv6Privacy,
+		Addresses: adapter.Ipv6Addresses}
+	if len(cfg.Addresses) < 1 && len(adapter.Ipv6) > 0 {
+		addr := adapter.Ipv6
+		if !strings.Contains(addr, "/") {
+			prelen := adapter.SubNetPreLen
+			if len(prelen) < 1 {
+				prelen = "64"
+			}
+			addr = fmt.Sprintf("%v/%v", addr, prelen)
+		}
+		cfg.Addresses = []string{addr}
+	}
+	if len(cfg.Method) < 1 {
+		if adapter.Ipv6UseDhcp {
+			cfg.Method = util_network.Ipv6Method_Auto
+		} else if len(cfg.Addresses) > 0 {
+			cfg.Method = util_network.Ipv6Method_Manual
+		} else {
+			return util_network.Ipv6Config{}, nil
+		}
+	}
+	if cfg.Method == util_network.Ipv6Method_Manual {
+		cfg.Gateway = adapter.Ipv6DefaultGateway
+	}
+	cfg.Dns = []string{req.Ipv6DNS1, req.Ipv6DNS2}
+	return cfg, cfg.Validate()
+}
+
 type PostNetworkConfigService struct {
 	base.BaseService
 }
@@ -161,6 +239,29 @@ func (svc *PostNetworkConfigService) Process() dto.BaseRspStr {
 			Message: err.Error()}
 	}
 
+	// 先保存快照, 应用失败或客户端超时未确认时回滚
+	apply, err := beginNetworkApply()
+	if err == errApplyPending {
+		return dto.BaseRspStr{Code: dto.AgentCodeResBusyErr, Message: err.Error()}
+	} else if err != nil {
+		logger.AppLogger().Warnf("failed beginNetworkApply, err:%v", err)
+		return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, Message: err.Error()}
+	}
+	go runNetworkApply(apply, func() error {
+		if rsp := applyNetworkConfig(req); rsp.Code != dto.AgentCodeOkStr {
+			return fmt.Errorf("%v", rsp.Message)
+		}
+		return nil
+	})
+
+	svc.Rsp = network.NetworkConfigApplyRsp{TransactionId: apply.TransactionId, ConfirmTimeoutSec: applyConfirmSeconds()}
+	return svc.BaseService.Process()
+}
+
+// applyNetworkConfig 连接 wifi 并修改各网卡的 ip、网关和 dns.
+func applyNetworkConfig(req *network.NetworkConfigReq) dto.BaseRspStr {
+	backend := util_network.Backend()
+
 	// 尝试连接传入的 wifi
 	for _, adapter := range req.NetworkAdapters {
 		logger.AppLogger().Debugf("PostNetworkConfigService, adapter:%+v", adapter)
@@ -171,12 +272,12 @@ func (svc *PostNetworkConfigService) Process() dto.BaseRspStr {
 
 		// 查看是否已经连接上了
 		alreadyConnectedRequestedWifi := false
-		devStatuss, err := rpi_network.GetIpAddress()
+		devices, err := backend.Devices()
 		if err != nil {
-			logger.AppLogger().Warnf("failed GetIpAddress, err:%v", err)
+			logger.AppLogger().Warnf("failed Devices, err:%v", err)
 		} else {
-			for _, devStatus := range devStatuss {
-				if devStatus.GeneralConnection == adapter.WIFIName {
+			for _, dev := range devices {
+				if dev.IsEthernetAndWifi() && dev.IsConnected() && dev.ConnectionId == adapter.WIFIName {
 					alreadyConnectedRequestedWifi = true
 					break
 				}
@@ -190,106 +291,91 @@ func (svc *PostNetworkConfigService) Process() dto.BaseRspStr {
 		// 尝试去连接
 		logger.AppLogger().Debugf("try to connect wifi, adapter.WIFIAddress:[%v], adapter.WIFIName:[%v]",
 			adapter.WIFIAddress, adapter.WIFIName)
-		succ := false
+		err = fmt.Errorf("neither wifi address nor name provided")
 		if len(adapter.WIFIAddress) > 0 {
-			succ, err = rpi_network.ConnectWifi(adapter.WIFIAddress, adapter.WIFIPassword)
-			logger.AppLogger().Debugf("connect wifi using WIFIAddress result: %v, err:%v", succ, err)
+			err = backend.ConnectWifi(adapter.WIFIAddress, adapter.WIFIPassword)
+			logger.AppLogger().Debugf("connect wifi using WIFIAddress, err:%v", err)
 		}
-		if !succ && len(adapter.WIFIName) > 0 {
-			succ, err = rpi_network.ConnectWifi(adapter.WIFIName, adapter.WIFIPassword)
-			logger.AppLogger().Debugf("connect wifi using WIFIName result: %v, err:%v", succ, err)
+		if err != nil && len(adapter.WIFIName) > 0 {
+			err = backend.ConnectWifi(adapter.WIFIName, adapter.WIFIPassword)
+			logger.AppLogger().Debugf("connect wifi using WIFIName, err:%v", err)
 		}
-		if succ {
+		if err == nil {
 			logger.AppLogger().Debugf("connect wifi succ, adapter.WIFIName:%+v, adapter.WIFIAddress:%+v", adapter.WIFIName, adapter.WIFIAddress)
 			break
-		} else {
-			err1 := fmt.Errorf("PostNetworkConfigService, connect wifi err:%v", err)
-			logger.AppLogger().Warnf(err1.Error())
-			if err != nil {
-				return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr,
-					Message: err1.Error()}
-			} else {
-				return dto.BaseRspStr{Code: dto.AgentCodeConnectWifiFailedStr,
-					Message: err1.Error()}
-			}
 		}
+		err1 := fmt.Errorf("PostNetworkConfigService, connect wifi err:%v", err)
+		logger.AppLogger().Warnf(err1.Error())
+		if errors.Is(err, util_network.ErrWifiActivationFailed) {
+			return dto.BaseRspStr{Code: dto.AgentCodeConnectWifiFailedStr,
+				Message: err1.Error()}
+		}
+		return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr,
+			Message: err1.Error()}
 	}
 
-	networkDevInfos, err := util_network.GetNetworkDevStatus()
+	devices, err := backend.Devices()
 	if err != nil {
-		logger.AppLogger().Warnf("failed GetNetworkDevStatus, err:%v", err)
+		logger.AppLogger().Warnf("failed Devices, err:%v", err)
 		return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr,
 			Message: err.Error()}
 	}
 
 	for _, adapter := range req.NetworkAdapters {
-		networkDevInfo := util_network.GetNetworkDevStatusByDevice(adapter.AdapterName, networkDevInfos)
-		logger.AppLogger().Debugf("start configing, adapter: %+v, networkDevInfo=%+v", adapter, networkDevInfo)
-		if networkDevInfo == nil {
+		var dev *util_network.Device
+		for _, d := range devices {
+			if strings.EqualFold(d.Interface, adapter.AdapterName) {
+				dev = d
+				break
+			}
+		}
+		logger.AppLogger().Debugf("start configing, adapter: %+v, dev=%+v", adapter, dev)
+		if dev == nil {
 			continue
 		}
 
-		if adapter.Wired { // 有线
-			if adapter.Ipv4UseDhcp { // 自动
-				if err := util_network.SetWireIpAuto(adapter.AdapterName); err != nil {
-					logger.AppLogger().Warnf("failed SetWireIpAuto, adapter.AdapterName:%v, err:%v", adapter.AdapterName, err)
-					return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, Message: err.Error()}
-				}
-
-				if err = util_network.SetNetworkDeviceDown(adapter.AdapterName); err != nil {
-					logger.AppLogger().Warnf("failed SetNetworkDeviceDown, adapter.AdapterName:%v, err:%v", adapter.AdapterName, err)
-					return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, Message: err.Error()}
-				}
-			} else { // 手动
-				if err := util_network.SetWireIpManual(adapter.AdapterName, adapter.Ipv4, adapter.SubNetMask, adapter.DefaultGateway); err != nil {
-					logger.AppLogger().Warnf("failed SetWireIpManual, adapter.AdapterName:%v, err:%v", adapter.AdapterName, err)
-					return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, Message: err.Error()}
-				}
-
-				if err := util_network.SetWireDnsManual(adapter.AdapterName, req.DNS1, req.DNS2); err != nil {
-					logger.AppLogger().Warnf("failed SetWireDnsManual, adapter.AdapterName:%v, err:%v", adapter.AdapterName, err)
-					return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, Message: err.Error()}
-				}
-			}
-
-			if err = util_network.SetNetworkDeviceUp(adapter.AdapterName); err != nil {
-				logger.AppLogger().Warnf("failed SetNetworkDeviceUp, adapter.AdapterName:%v, err:%v", adapter.AdapterName, err)
+		cfg := util_network.Ipv4Config{Method: util_network.Ipv4Method_Auto}
+		if !adapter.Ipv4UseDhcp { // 手动
+			prelen, err := util_network.SubNetMaskToLen(adapter.SubNetMask)
+			if err != nil {
+				logger.AppLogger().Warnf("failed SubNetMaskToLen, adapter.SubNetMask:%v, err:%v", adapter.SubNetMask, err)
 				return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, Message: err.Error()}
 			}
+			cfg = util_network.Ipv4Config{Method: util_network.Ipv4Method_Manual,
+				Address: fmt.Sprintf("%v/%v", adapter.Ipv4, prelen),
+				Gateway: adapter.DefaultGateway,
+				Dns:     []string{req.DNS1, req.DNS2}}
+		}
 
-		} else { // 无线
-			if adapter.Ipv4UseDhcp { // 自动
-				if err := util_network.SetWirelessIpAuto(networkDevInfo.CONUUID); err != nil {
-					logger.AppLogger().Warnf("failed SetWirelessIpAuto, adapter.AdapterName:%v, err:%v", adapter.AdapterName, err)
-					return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, Message: err.Error()}
-				}
-
-				if err = util_network.SetNetworkDeviceDown(networkDevInfo.CONUUID); err != nil {
-					logger.AppLogger().Warnf("failed SetNetworkDeviceDown, adapter.AdapterName:%v, err:%v", adapter.AdapterName, err)
-					return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, Message: err.Error()}
-				}
-			} else { // 手动
-				if err := util_network.SetWirelessIpManual(networkDevInfo.CONUUID, adapter.Ipv4, adapter.SubNetMask, adapter.DefaultGateway); err != nil {
-					logger.AppLogger().Warnf("failed SetWirelessIpManual, adapter.AdapterName:%v, err:%v", adapter.AdapterName, err)
-					return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, Message: err.Error()}
-				}
+		cfg6, err := ipv6ConfigOf(adapter, req)
+		if err != nil {
+			logger.AppLogger().Warnf("invalid ipv6 config, adapter.AdapterName:%v, err:%v", adapter.AdapterName, err)
+			return dto.BaseRspStr{Code: dto.AgentCodeBadReqStr, Message: err.Error()}
+		}
 
-				if err := util_network.SetWirelessDnsManual(networkDevInfo.CONUUID, req.DNS1, req.DNS2); err != nil {
-					logger.AppLogger().Warnf("failed SetWirelessDnsManual, adapter.AdapterName:%v, err:%v", adapter.AdapterName, err)
-					return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, Message: err.Error()}
-				}
+		if adapter.Wired { // 有线
+			if err := backend.SetWiredIp(adapter.AdapterName, cfg, cfg6); err != nil {
+				logger.AppLogger().Warnf("failed SetWiredIp, adapter.AdapterName:%v, err:%v", adapter.AdapterName, err)
+				return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, Message: err.Error()}
 			}
-
-			if err = util_network.SetNetworkDeviceUp(networkDevInfo.CONUUID); err != nil {
-				logger.AppLogger().Warnf("failed SetNetworkDeviceUp, adapter.AdapterName:%v, err:%v", adapter.AdapterName, err)
+		} else { // 无线. 不能删除网卡配置, 要不然 wifi 账号/密码也被删除了.
+			if err := backend.SetConnectionIp(dev.ConnectionUuid, cfg, cfg6); err != nil {
+				logger.AppLogger().Warnf("failed SetConnectionIp, adapter.AdapterName:%v, err:%v", adapter.AdapterName, err)
 				return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, Message: err.Error()}
 			}
 		}
 	}
 
 	// 修改 dns
+	dns := []string{}
 	if len(req.DNS1) > 0 && len(req.DNS2) > 0 {
-		if err = util_network.SetSystemdDnsManual(req.DNS1, req.DNS2); err != nil {
+		dns = append(dns, req.DNS1, req.DNS2)
+	}
+	if len(req.Ipv6DNS1) > 0 || len(req.Ipv6DNS2) > 0 {
+		dns = append(dns, req.Ipv6DNS1, req.Ipv6DNS2)
+	}
+	if len(dns) > 0 {
+		if err = util_network.SetSystemdDnsManual(dns...); err != nil {
 			logger.AppLogger().Warnf("failed SetSystemdDnsManual, err:%v", err)
 			return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, Message: err.Error()}
 		}
@@ -300,5 +386,20 @@ func (svc *PostNetworkConfigService) Process() dto.BaseRspStr {
 		}
 	}
 
+	return dto.BaseRspStr{Code: dto.AgentCodeOkStr}
+}
+
+type ConfirmNetworkConfigService struct {
+	base.BaseService
+}
+
+func (svc *ConfirmNetworkConfigService) Process() dto.BaseRspStr {
+	req := svc.Req.(*network.NetworkConfigConfirmReq)
+	logger.AppLogger().Debugf("ConfirmNetworkConfigService, req:%+v", req)
+	if err := ConfirmNetworkApply(req.TransactionId); err == errApplyNotArmed {
+		return dto.BaseRspStr{Code: dto.AgentCodeResBusyErr, Message: err.Error()}
+	} else if err != nil {
+		return dto.BaseRspStr{Code: dto.AgentCodeBadReqStr, Message: err.Error()}
+	}
 	return svc.BaseService.Process()
 }
@@ -0,0 +1,59 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"testing"
+
+	"agent/biz/model/dto/network"
+	util_network "agent/utils/network"
+)
+
+func TestIpv6ConfigOf(t *testing.T) {
+	req := &network.NetworkConfigReq{Ipv6DNS1: "2001:4860:4860::8888"}
+
+	// 兼容旧字段
+	cfg, err := ipv6ConfigOf(&network.NetworkAdapter{Ipv6: "2001:db8::10", SubNetPreLen: "48",
+		Ipv6DefaultGateway: "fe80::1"}, req)
+	if err != nil || cfg.Method != util_network.Ipv6Method_Manual || len(cfg.Addresses) != 1 ||
+		cfg.Addresses[0] != "2001:db8::10/48" || cfg.Gateway != "fe80::1" {
+		t.Errorf("legacy manual %+v, err:%v", cfg, err)
+	}
+	if cfg, err := ipv6ConfigOf(&network.NetworkAdapter{}, req); err != nil || len(cfg.Method) > 0 {
+		t.Errorf("unchanged %+v, err:%v", cfg, err)
+	}
+
+	cfg, err = ipv6ConfigOf(&network.NetworkAdapter{Ipv6Mode: util_network.Ipv6Method_Dhcp,
+		Ipv6Privacy: util_network.Ipv6Privacy_PreferTemp, Ipv6DefaultGateway: "fe80::1"}, req)
+	if err != nil || cfg.Method != util_network.Ipv6Method_Dhcp || len(cfg.Gateway) > 0 || cfg.Dns[0] != req.Ipv6DNS1 {
+		t.Errorf("dhcp %+v, err:%v", cfg, err)
+	}
+
+	if _, err := ipv6ConfigOf(&network.NetworkAdapter{Ipv6Mode: util_network.Ipv6Method_Manual,
+		Ipv6Addresses: []string{"2001:db8::10/64", "192.168.1.2/24"}}, req); err == nil {
+		t.Errorf("expected error for ipv4 address in ipv6Addresses")
+	}
+}
+
+func TestFillIpv6Addresses(t *testing.T) {
+	var adapter network.NetworkAdapter
+	fillIpv6Addresses(&adapter, []string{"fe80::1/64", "fd00::2/64", "2001:db8::3/64", "2001:db8::4/128"})
+	if len(adapter.Ipv6GlobalAddresses) != 2 || len(adapter.Ipv6UlaAddresses) != 1 || len(adapter.Ipv6LinkLocalAddresses) != 1 {
+		t.Errorf("%+v", adapter)
+	}
+	if adapter.Ipv6 != "2001:db8::3" || adapter.SubNetPreLen != "64" {
+		t.Errorf("legacy ipv6 %v/%v", adapter.Ipv6, adapter.SubNetPreLen)
+	}
+}
@@ -0,0 +1,123 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"agent/biz/model/device_ability"
+	"agent/biz/model/dto"
+	"agent/biz/model/dto/network"
+	"agent/biz/service/base"
+	"agent/config"
+	"net/url"
+	"time"
+
+	util_network "agent/utils/network"
+
+	"agent/utils/logger"
+)
+
+type GetDnsConfigService struct {
+	base.BaseService
+}
+
+func (svc *GetDnsConfigService) Process() dto.BaseRspStr {
+	logger.AppLogger().Debugf("GetDnsConfigService")
+	if !device_ability.GetAbilityModel().InnerDiskSupport {
+		return dto.BaseRspStr{Code: dto.AgentCodeUnsupportedFunction, Message: "unsupported function"}
+	}
+
+	cfg, err := util_network.ReadResolvedConfig()
+	if err != nil {
+		logger.AppLogger().Warnf("GetDnsConfigService, ReadResolvedConfig err:%v", err)
+		return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, Message: err.Error()}
+	}
+	rsp := network.DnsConfig{Dns: cfg.Dns, FallbackDns: cfg.FallbackDns, Domains: cfg.Domains,
+		DnsOverTls: cfg.DnsOverTls, Dnssec: cfg.Dnssec, Links: []*network.DnsLinkConfig{}}
+	for _, l := range cfg.Links {
+		rsp.Links = append(rsp.Links, &network.DnsLinkConfig{Interface: l.Interface, Dns: l.Dns, Domains: l.Domains,
+			DnsOverTls: l.DnsOverTls, Dnssec: l.Dnssec})
+	}
+	svc.Rsp = rsp
+	return svc.BaseService.Process()
+}
+
+type SetDnsConfigService struct {
+	base.BaseService
+}
+
+func (svc *SetDnsConfigService) Process() dto.BaseRspStr {
+	logger.AppLogger().Debugf("SetDnsConfigService")
+	if !device_ability.GetAbilityModel().InnerDiskSupport {
+		return dto.BaseRspStr{Code: dto.AgentCodeUnsupportedFunction, Message: "unsupported function"}
+	}
+
+	req := svc.Req.(*network.DnsConfig)
+	logger.AppLogger().Debugf("SetDnsConfigService, req:%+v", req)
+	cfg := &util_network.ResolvedConfig{Dns: req.Dns, FallbackDns: req.FallbackDns, Domains: req.Domains,
+		DnsOverTls: req.DnsOverTls, Dnssec: req.Dnssec}
+	for _, l := range req.Links {
+		if l == nil {
+			continue
+		}
+		cfg.Links = append(cfg.Links, &util_network.ResolvedLinkConfig{Interface: l.Interface, Dns: l.Dns,
+			Domains: l.Domains, DnsOverTls: l.DnsOverTls, Dnssec: l.Dnssec})
+	}
+	if err := cfg.Validate(); err != nil {
+		return dto.BaseRspStr{Code: dto.AgentCodeBadReqStr, Message: err.Error()}
+	}
+
+	// 网络配置变更的回滚会覆盖 resolved.conf, 应用 dns 设置期间占用变更槽位
+	reserved, err := reserveNetworkApply()
+	if err != nil {
+		return dto.BaseRspStr{Code: dto.AgentCodeResBusyErr, Message: err.Error()}
+	}
+	defer releaseNetworkApply(reserved)
+
+	timeout := time.Duration(config.Config.Box.Network.Resolved.ValidateTimeoutSec) * time.Second
+	if err := util_network.ApplyResolvedConfig(cfg, dnsValidateHosts(), timeout); err != nil {
+		logger.AppLogger().Warnf("SetDnsConfigService, ApplyResolvedConfig err:%v", err)
+		return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, Message: err.Error()}
+	}
+	return svc.BaseService.Process()
+}
+
+// dnsValidateHosts 应用 dns 设置后用于验证的平台域名
+func dnsValidateHosts() []string {
+	hosts := []string{}
+	seen := map[string]bool{}
+	for _, s := range []string{config.Config.Platform.APIBase.Url, config.Config.PSPlatform.APIBase.Url,
+		config.Config.NetworkCheck.CloudHost.Url} {
+		host := s
+		if u, err := url.Parse(s); err == nil && len(u.Hostname()) > 0 {
+			host = u.Hostname()
+		}
+		if len(host) < 1 || seen[host] {
+			continue
+		}
+		seen[host] = true
+		hosts = append(hosts, host)
+	}
+	return hosts
+}
+
+// reapplyResolvedLinks 网卡重新连接后 NetworkManager 会重新下发网卡的 dns, 覆盖保存的网卡设置, 需要再次下发.
+func reapplyResolvedLinks(events []*util_network.NetEvent) {
+	if !lanAddressChanged(events) {
+		return
+	}
+	if err := util_network.ReapplyResolvedLinks(); err != nil {
+		logger.AppLogger().Warnf("reapplyResolvedLinks err:%v", err)
+	}
+}
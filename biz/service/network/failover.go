@@ -0,0 +1,101 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"agent/biz/alivechecker"
+	"agent/biz/model/device_ability"
+	"agent/biz/model/dto/network"
+	"agent/config"
+	"time"
+
+	util_network "agent/utils/network"
+
+	"agent/utils/logger"
+)
+
+var (
+	failover        *util_network.FailoverEngine
+	failoverTrigger = make(chan struct{}, 1)
+)
+
+// StartFailover 定时探测各链路, 有线断开或不能上网时切换到已保存的 wifi, 有线恢复稳定后切回.
+// 网卡状态或默认路由变化时立即检查一次.
+func StartFailover() {
+	cfg := config.Config.Box.Network.Failover
+	if !cfg.Enable || device_ability.GetAbilityModel().RunInDocker {
+		logger.AppLogger().Infof("StartFailover, failover disabled")
+		return
+	}
+	interval := time.Duration(cfg.CheckIntervalSec) * time.Second
+	if interval <= 0 {
+		interval = 15 * time.Second
+	}
+	failover = util_network.NewFailoverEngine(probeInternet, cfg.FailThreshold,
+		time.Duration(cfg.FailbackStableSec)*time.Second, cfg.MaxTransitions)
+
+	util_network.SubscribeAsyncNetworkChange(func(events []*util_network.NetEvent) {
+		select {
+		case failoverTrigger <- struct{}{}:
+		default:
+		}
+	})
+	go func() {
+		for {
+			if err := failover.Evaluate(); err != nil {
+				logger.AppLogger().Warnf("failover, Evaluate err:%v", err)
+			}
+			select {
+			case <-time.After(interval):
+			case <-failoverTrigger:
+			}
+		}
+	}()
+}
+
+// probeInternet 与 alivechecker 使用相同的探测目标, 任一可达即认为链路能访问互联网
+func probeInternet(iface string) bool {
+	for _, host := range []string{config.Config.NetworkCheck.CloudHost.Url, config.Config.NetworkCheck.ThirdPartyHost.Url} {
+		if len(host) < 1 {
+			continue
+		}
+		ok, err := alivechecker.PingVia(iface, host)
+		if ok {
+			return true
+		}
+		logger.AppLogger().Debugf("probeInternet, iface:%v, host:%v, err:%v", iface, host, err)
+	}
+	return false
+}
+
+// failoverStatus 返回 /network/config 中的故障切换状态
+func failoverStatus() *network.FailoverStatus {
+	status := &network.FailoverStatus{Links: []*network.FailoverLink{}, Transitions: []*network.FailoverTransition{}}
+	if failover == nil {
+		return status
+	}
+	status.Enabled = true
+	active, links, transitions := failover.Status()
+	status.ActiveInterface = active
+	for _, l := range links {
+		status.Links = append(status.Links, &network.FailoverLink{Interface: l.Interface, Wired: l.Type == util_network.DevStatus_Type_Wire,
+			ConnectionId: l.ConnectionId, Connected: l.Connected, Healthy: l.Healthy, ConsecutiveFailures: l.ConsecutiveFailures,
+			HealthySince: l.HealthySince, LastProbe: l.LastProbe})
+	}
+	for _, t := range transitions {
+		status.Transitions = append(status.Transitions, &network.FailoverTransition{Time: t.Time, From: t.From, To: t.To, Reason: t.Reason})
+	}
+	return status
+}
@@ -15,9 +15,25 @@
 package network
 
 import (
+	"agent/biz/model/dto/network"
+	"agent/biz/model/gt"
 	"agent/config"
 	"agent/utils/docker/dockerfacade"
 	"agent/utils/logger"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+var (
+	gtConfigMtx sync.Mutex
+
+	tunnelStatusMtx      sync.Mutex
+	tunnelStatusCache    *network.TunnelStatus
+	tunnelStatusCachedAt time.Time
 )
 
 // ReloadGTClient 重载 gt client 配置
@@ -28,6 +44,9 @@ func ReloadGTClient() error {
 		logger.AppLogger().Errorf("find gt client container err:%v", err)
 		return err
 	}
+	if len(cid) < 1 {
+		return fmt.Errorf("gt client container %v not found", config.Config.Docker.NetworkClientContainerName)
+	}
 	logger.AppLogger().Debugf("gt client container id ：%s", cid)
 	reloadCmd := []string{"client", "-s", "reload"}
 	err = dockerApi.Exec(cid, reloadCmd)
@@ -45,6 +64,9 @@ func RestartGTClient() error {
 		logger.AppLogger().Errorf("find gt client container err:%v", err)
 		return err
 	}
+	if len(cid) < 1 {
+		return fmt.Errorf("gt client container %v not found", config.Config.Docker.NetworkClientContainerName)
+	}
 	logger.AppLogger().Debugf("gt client container id ：%s", cid)
 	//reloadCmd := []string{"client", "-s", "restart"}
 	err = dockerApi.RestartContainer(cid)
@@ -52,5 +74,104 @@ func RestartGTClient() error {
 		logger.AppLogger().Errorf("restart gt client err:%v", err)
 		return err
 	}
+	invalidateTunnelStatus()
+	return nil
+}
+
+// applyGTConfig 检查配置后写入并重载 gt client, 重载失败时恢复原配置.
+func applyGTConfig(conf *gt.Config) error {
+	if err := conf.Validate(); err != nil {
+		return err
+	}
+	old, err := os.ReadFile(config.Config.GTClient.ConfigPath)
+	if err != nil {
+		return fmt.Errorf("failed to read %v, err:%v", config.Config.GTClient.ConfigPath, err)
+	}
+	if err := conf.Save(); err != nil {
+		return fmt.Errorf("failed to save gt client config, err:%v", err)
+	}
+	if err := ReloadGTClient(); err != nil {
+		logger.AppLogger().Warnf("applyGTConfig, reload failed, restore config. err:%v", err)
+		if e := os.WriteFile(config.Config.GTClient.ConfigPath, old, os.ModePerm); e != nil {
+			logger.AppLogger().Errorf("applyGTConfig, failed to restore config, err:%v", e)
+		} else if e := ReloadGTClient(); e != nil {
+			logger.AppLogger().Errorf("applyGTConfig, failed to reload restored config, err:%v", e)
+		}
+		return fmt.Errorf("failed to reload gt client, err:%v", err)
+	}
+	invalidateTunnelStatus()
 	return nil
 }
+
+// cachedTunnelStatus 返回 StatusCacheSeconds 内缓存的 gt client 状态, 过期后重新查询.
+func cachedTunnelStatus() *network.TunnelStatus {
+	tunnelStatusMtx.Lock()
+	defer tunnelStatusMtx.Unlock()
+	ttl := time.Duration(config.Config.GTClient.StatusCacheSeconds) * time.Second
+	if tunnelStatusCache == nil || time.Since(tunnelStatusCachedAt) >= ttl {
+		tunnelStatusCache, tunnelStatusCachedAt = tunnelStatus(), time.Now()
+	}
+	status := *tunnelStatusCache
+	return &status
+}
+
+// invalidateTunnelStatus gt client 配置变更后清除缓存的状态.
+func invalidateTunnelStatus() {
+	tunnelStatusMtx.Lock()
+	defer tunnelStatusMtx.Unlock()
+	tunnelStatusCache = nil
+}
+
+// tunnelStatus 查询 gt client 容器状态和流量, 配置了 StatusUrl 时再查询是否已连上服务器.
+func tunnelStatus() *network.TunnelStatus {
+	status := &network.TunnelStatus{}
+	if conf, err := gt.Load(); err == nil {
+		status.Services = len(conf.Services)
+	}
+
+	dockerApi := dockerfacade.NewDockerFacade()
+	cid, err := dockerApi.FindContainer(config.Config.Docker.NetworkClientContainerName)
+	if err != nil {
+		logger.AppLogger().Warnf("tunnelStatus, find gt client container err:%v", err)
+		return status
+	}
+	if len(cid) < 1 {
+		status.State = "not_found"
+		return status
+	}
+	cs, err := dockerApi.ContainerStatus(cid)
+	if err != nil {
+		logger.AppLogger().Warnf("tunnelStatus, ContainerStatus err:%v", err)
+		return status
+	}
+	status.State, status.StartedAt, status.RestartCount = cs.State, cs.StartedAt, cs.RestartCount
+	status.RxBytes, status.TxBytes = cs.RxBytes, cs.TxBytes
+
+	if len(config.Config.GTClient.StatusUrl) > 0 && cs.State == "running" {
+		if connected, err := gtClientConnected(config.Config.GTClient.StatusUrl); err != nil {
+			logger.AppLogger().Debugf("tunnelStatus, gtClientConnected err:%v", err)
+		} else {
+			status.Connected = &connected
+		}
+	}
+	return status
+}
+
+func gtClientConnected(url string) (bool, error) {
+	client := &http.Client{Timeout: time.Second * 3}
+	rsp, err := client.Get(url)
+	if err != nil {
+		return false, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("status code %v", rsp.StatusCode)
+	}
+	var result struct {
+		Connected bool `json:"connected"`
+	}
+	if err := json.NewDecoder(rsp.Body).Decode(&result); err != nil {
+		return false, err
+	}
+	return result.Connected, nil
+}
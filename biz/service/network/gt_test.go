@@ -0,0 +1,53 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"testing"
+	"time"
+
+	"agent/biz/model/dto/network"
+	"agent/config"
+)
+
+func TestCachedTunnelStatus(t *testing.T) {
+	oldSeconds := config.Config.GTClient.StatusCacheSeconds
+	config.Config.GTClient.StatusCacheSeconds = 30
+	defer func() {
+		config.Config.GTClient.StatusCacheSeconds = oldSeconds
+		invalidateTunnelStatus()
+	}()
+
+	tunnelStatusMtx.Lock()
+	tunnelStatusCache, tunnelStatusCachedAt = &network.TunnelStatus{State: "running", Services: 2}, time.Now()
+	tunnelStatusMtx.Unlock()
+
+	status := cachedTunnelStatus()
+	if status.State != "running" || status.Services != 2 {
+		t.Fatalf("cached status %+v", status)
+	}
+	// 返回的是副本, 修改不影响缓存
+	status.State = "exited"
+	if cachedTunnelStatus().State != "running" {
+		t.Errorf("cache modified by caller")
+	}
+
+	invalidateTunnelStatus()
+	tunnelStatusMtx.Lock()
+	defer tunnelStatusMtx.Unlock()
+	if tunnelStatusCache != nil {
+		t.Errorf("cache not invalidated")
+	}
+}
@@ -22,7 +22,7 @@ import (
 	"fmt"
 	"time"
 
-	utilsnetwork "agent/utils/rpi/network"
+	utilsnetwork "agent/utils/network"
 
 	"agent/utils/logger"
 )
@@ -43,18 +43,11 @@ func (svc *NetworkIgnoreService) Process() dto.BaseRspStr {
 	req := svc.Req.(*network.NetworkIgnoreReq)
 	logger.AppLogger().Debugf("PostNetworkConfigService, req:%+v", req)
 
-	succ, err := utilsnetwork.ForgetWifi(req.WIFIName)
-	if err != nil {
-		logger.AppLogger().Warnf("ForgetWifi err:%+v", err)
+	if err := utilsnetwork.Backend().DeleteConnection(req.WIFIName); err != nil {
+		logger.AppLogger().Warnf("DeleteConnection err:%+v", err)
 		return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr,
 			Message: err.Error()}
 	}
-	if !succ {
-		err1 := fmt.Errorf("ForgetWifi succ==false")
-		logger.AppLogger().Warnf("%v", err1)
-		return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr,
-			Message: err1.Error()}
-	}
 	time.Sleep(3 * time.Second) // 命令返回了，但是ip还在。时间关系，暂时这么处理。
 	return svc.BaseService.Process()
 }
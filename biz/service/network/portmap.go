@@ -0,0 +1,288 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"agent/biz/model/dto"
+	"agent/biz/model/dto/network"
+	"agent/biz/notification"
+	"agent/biz/service/base"
+	"agent/config"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	util_network "agent/utils/network"
+	"agent/utils/portmap"
+
+	"agent/utils/logger"
+)
+
+const portMapDescription = "ao-space gateway"
+
+var portMap = struct {
+	mtx     sync.Mutex
+	status  network.PortMappingStatusRsp
+	mapper  portmap.Mapper   // 当前使用的协议, 为 nil 时重新发现
+	mapping *portmap.Mapping // 当前映射, 网络变化后删除
+	gateway net.IP
+	stale   bool // 网络已变化, 由 refreshPortMapping 删除旧映射后重新发现
+	trigger chan struct{}
+}{trigger: make(chan struct{}, 1)}
+
+// StartPortMapping 在家庭路由器上依次尝试 UPnP IGD、NAT-PMP、PCP 映射网关的 TlsLanPort, 租期过半时续租,
+// 失败后定时重试. 默认路由或局域网地址变化时删除旧映射并重新映射. 直连地址变化时通知网关.
+func StartPortMapping() {
+	cfg := config.Config.Box.Network.PortMap
+	portMap.mtx.Lock()
+	portMap.status = network.PortMappingStatusRsp{Enabled: cfg.Enable, State: network.PortMapState_Disabled,
+		InternalPort: int(config.Config.GateWay.TlsLanPort), UpdatedAt: time.Now()}
+	portMap.mtx.Unlock()
+	if !cfg.Enable {
+		logger.AppLogger().Infof("StartPortMapping, port mapping disabled")
+		return
+	}
+	util_network.SubscribeAsyncNetworkChange(remapOnNetworkChange)
+	go func() {
+		for {
+			wait := refreshPortMapping()
+			select {
+			case <-time.After(wait):
+			case <-portMap.trigger:
+			}
+		}
+	}()
+}
+
+// PortMappingStatus 当前端口映射状态
+func PortMappingStatus() network.PortMappingStatusRsp {
+	portMap.mtx.Lock()
+	defer portMap.mtx.Unlock()
+	return portMap.status
+}
+
+// remapOnNetworkChange 换了路由器或本机地址后原映射失效, 重新发现并映射. 删除和重新映射都在映射协程中进行,
+// 避免与正在进行的续租交错, 把刚删除的映射又加回去.
+func remapOnNetworkChange(events []*util_network.NetEvent) {
+	remap := lanAddressChanged(events)
+	for _, ev := range events {
+		if ev.Type == util_network.NetEvent_DefaultRouteChanged && ev.Family == util_network.Family_Ipv4 {
+			remap = true
+		}
+	}
+	if !remap {
+		return
+	}
+	portMap.mtx.Lock()
+	portMap.stale = true
+	portMap.mtx.Unlock()
+	select {
+	case portMap.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// refreshPortMapping 映射或续租一次, 返回距下一次的等待时间.
+func refreshPortMapping() time.Duration {
+	cfg := config.Config.Box.Network.PortMap
+	retry := time.Duration(cfg.RetryIntervalSec) * time.Second
+	if retry <= 0 {
+		retry = 5 * time.Minute
+	}
+	lease := time.Duration(cfg.LeaseSeconds) * time.Second
+
+	portMap.mtx.Lock()
+	mapper, gateway := portMap.mapper, portMap.gateway
+	var staleMapper portmap.Mapper
+	var staleMapping *portmap.Mapping
+	if portMap.stale {
+		staleMapper, staleMapping = portMap.mapper, portMap.mapping
+		portMap.mapper, portMap.mapping, portMap.stale = nil, nil, false
+		mapper = nil
+	}
+	if mapper == nil {
+		portMap.status.State = network.PortMapState_Mapping
+	}
+	portMap.mtx.Unlock()
+	if staleMapper != nil && staleMapping != nil {
+		// 旧路由器可能已不可达, 只尽力删除
+		if err := staleMapper.DeleteMapping(staleMapping); err != nil {
+			logger.AppLogger().Debugf("refreshPortMapping, DeleteMapping err:%v", err)
+		}
+	}
+
+	var mapping *portmap.Mapping
+	var internalIP net.IP
+	var err error
+	if mapper != nil {
+		if internalIP, err = portmap.LocalIPFor(gateway); err == nil {
+			mapping, err = mapper.AddMapping(portmap.Transport_TCP, internalIP, int(config.Config.GateWay.TlsLanPort), cfg.ExternalPort, lease)
+		}
+	} else {
+		mapper, mapping, gateway, internalIP, err = discoverPortMapping(lease)
+	}
+	if err != nil {
+		logger.AppLogger().Warnf("refreshPortMapping, err:%v", err)
+		portMap.mtx.Lock()
+		portMap.mapper, portMap.mapping = nil, nil
+		portMap.status.State = network.PortMapState_Failed
+		portMap.status.LastError = err.Error()
+		portMap.status.UpdatedAt = time.Now()
+		portMap.mtx.Unlock()
+		updateDirectAddress("", false)
+		return retry
+	}
+
+	externalIP, err := mapper.ExternalIP()
+	if err == portmap.ErrExternalIPUnknown {
+		externalIP, err = mapping.ExternalIP, nil
+	}
+	if err != nil {
+		logger.AppLogger().Warnf("refreshPortMapping, ExternalIP err:%v", err)
+	}
+	directAvailable := portmap.IsPublicIP(externalIP)
+	directAddress := ""
+	if directAvailable {
+		directAddress = net.JoinHostPort(externalIP.String(), strconv.Itoa(mapping.ExternalPort))
+	}
+
+	portMap.mtx.Lock()
+	portMap.mapper, portMap.mapping, portMap.gateway = mapper, mapping, gateway
+	if portMap.stale {
+		// 映射期间网络又变化了, 不发布该映射, 立即删除并重新映射
+		portMap.mtx.Unlock()
+		return 0
+	}
+	portMap.status.State = network.PortMapState_Mapped
+	portMap.status.Protocol = mapper.Protocol()
+	portMap.status.Gateway = gateway.String()
+	portMap.status.InternalIp = internalIP.String()
+	portMap.status.ExternalIp = ""
+	if externalIP != nil {
+		portMap.status.ExternalIp = externalIP.String()
+	}
+	portMap.status.ExternalPort = mapping.ExternalPort
+	portMap.status.LeaseSec = int(mapping.Lease / time.Second)
+	portMap.status.DirectAvailable = directAvailable
+	portMap.status.DirectAddress = directAddress
+	portMap.status.LastError = ""
+	if err != nil {
+		portMap.status.LastError = err.Error()
+	}
+	portMap.status.UpdatedAt = time.Now()
+	portMap.mtx.Unlock()
+	updateDirectAddress(directAddress, directAvailable)
+
+	// 路由器给的租期可能比请求的短; 永久映射也按请求租期(或重试间隔)定期检查外部地址是否变化
+	renew := lease / 2
+	if mapping.Lease > 0 && mapping.Lease/2 < renew {
+		renew = mapping.Lease / 2
+	}
+	if renew <= 0 {
+		renew = retry
+	}
+	if renew < 30*time.Second {
+		renew = 30 * time.Second
+	}
+	return renew
+}
+
+// discoverPortMapping 按 Protocols 的顺序尝试各协议, 返回第一个映射成功的.
+func discoverPortMapping(lease time.Duration) (portmap.Mapper, *portmap.Mapping, net.IP, net.IP, error) {
+	cfg := config.Config.Box.Network.PortMap
+	timeout := time.Duration(cfg.TimeoutSec) * time.Second
+	if timeout <= 0 {
+		timeout = 3 * time.Second
+	}
+	_, gateway, err := util_network.DefaultIpv4Gateway()
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	internalIP, err := portmap.LocalIPFor(gateway)
+	if err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("failed to get local ip for gateway %v, err:%v", gateway, err)
+	}
+
+	errs := make([]string, 0)
+	for _, protocol := range strings.Split(cfg.Protocols, ",") {
+		var mapper portmap.Mapper
+		switch strings.TrimSpace(protocol) {
+		case portmap.Protocol_Upnp:
+			if len(cfg.UpnpRootDescUrl) > 0 {
+				mapper, err = portmap.NewUpnpMapperByURL(cfg.UpnpRootDescUrl, portMapDescription)
+			} else {
+				mapper, err = portmap.DiscoverUpnp(portMapDescription)
+			}
+		case portmap.Protocol_NatPmp:
+			mapper = portmap.NewNatPmpMapper(gateway, timeout)
+		case portmap.Protocol_Pcp:
+			mapper = portmap.NewPcpMapper(gateway, timeout)
+		default:
+			continue
+		}
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%v: %v", protocol, err))
+			continue
+		}
+		mapping, err := mapper.AddMapping(portmap.Transport_TCP, internalIP, int(config.Config.GateWay.TlsLanPort), cfg.ExternalPort, lease)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%v: %v", protocol, err))
+			continue
+		}
+		logger.AppLogger().Infof("discoverPortMapping, mapped by %v, gateway:%v, mapping:%+v", protocol, gateway, mapping)
+		return mapper, mapping, gateway, internalIP, nil
+	}
+	return nil, nil, nil, nil, fmt.Errorf("no port mapping protocol available, %v", strings.Join(errs, "; "))
+}
+
+var (
+	lastDirectAddressMtx  sync.Mutex
+	lastDirectAddress     string
+	lastDirectAddressSent bool
+)
+
+// updateDirectAddress 直连地址变化时通知网关, 通知失败时下次刷新再发.
+func updateDirectAddress(address string, available bool) {
+	lastDirectAddressMtx.Lock()
+	defer lastDirectAddressMtx.Unlock()
+	if lastDirectAddressSent && lastDirectAddress == address {
+		return
+	}
+	if err := notification.OnDirectAddressChanged(address, available); err != nil {
+		logger.AppLogger().Warnf("updateDirectAddress, OnDirectAddressChanged err:%v", err)
+		return
+	}
+	lastDirectAddress, lastDirectAddressSent = address, true
+}
+
+///////////////////////////////////////////////////////////////////////////////
+
+func NewGetPortMappingService() *GetPortMappingService {
+	svc := new(GetPortMappingService)
+	return svc
+}
+
+type GetPortMappingService struct {
+	base.BaseService
+}
+
+func (svc *GetPortMappingService) Process() dto.BaseRspStr {
+	logger.AppLogger().Debugf("GetPortMappingService")
+	svc.Rsp = PortMappingStatus()
+	return svc.BaseService.Process()
+}
@@ -0,0 +1,161 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"agent/biz/model/dto"
+	"agent/biz/model/dto/network"
+	"agent/biz/model/gt"
+	"agent/biz/service/base"
+	"fmt"
+	"os"
+
+	"agent/utils/logger"
+)
+
+// loadGTConfig 读取 gt client 配置, 未绑定空间(配置文件不存在)时返回错误响应
+func loadGTConfig() (*gt.Config, *dto.BaseRspStr) {
+	conf, err := gt.Load()
+	if os.IsNotExist(err) {
+		return nil, &dto.BaseRspStr{Code: dto.AgentCodeBadReqStr, Message: "gt client is not configured"}
+	}
+	if err != nil {
+		return nil, &dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, Message: err.Error()}
+	}
+	return conf, nil
+}
+
+type GetTunnelConfigService struct {
+	base.BaseService
+}
+
+func (svc *GetTunnelConfigService) Process() dto.BaseRspStr {
+	logger.AppLogger().Debugf("GetTunnelConfigService")
+	conf, errRsp := loadGTConfig()
+	if errRsp != nil {
+		return *errRsp
+	}
+
+	rsp := network.TunnelConfigRsp{Services: []*network.TunnelService{}, Status: tunnelStatus()}
+	for _, s := range conf.Services {
+		rsp.Services = append(rsp.Services, &network.TunnelService{Local: s.Local, HostPrefix: s.HostPrefix,
+			Default: conf.IsDefaultService(s.HostPrefix)})
+	}
+	rsp.Options = network.TunnelOptions{RemoteConnections: conf.Options.RemoteConnections,
+		ReconnectDelay: conf.Options.ReconnectDelay, LocalTimeout: conf.Options.LocalTimeout,
+		RemoteTimeout: conf.Options.RemoteTimeout, LogLevel: conf.Options.LogLevel,
+		WebrtcMinPort: conf.Options.WebrtcMinPort, WebrtcMaxPort: conf.Options.WebrtcMaxPort}
+	svc.Rsp = rsp
+	return svc.BaseService.Process()
+}
+
+type SetTunnelServiceService struct {
+	base.BaseService
+}
+
+func (svc *SetTunnelServiceService) Process() dto.BaseRspStr {
+	req := svc.Req.(*network.TunnelServiceReq)
+	logger.AppLogger().Debugf("SetTunnelServiceService, req:%+v", req)
+	gtConfigMtx.Lock()
+	defer gtConfigMtx.Unlock()
+	conf, errRsp := loadGTConfig()
+	if errRsp != nil {
+		return *errRsp
+	}
+
+	service := gt.Service{Local: req.Local, HostPrefix: req.HostPrefix}
+	if err := service.Validate(); err != nil {
+		return dto.BaseRspStr{Code: dto.AgentCodeBadReqStr, Message: err.Error()}
+	}
+	if conf.IsDefaultService(req.HostPrefix) {
+		return dto.BaseRspStr{Code: dto.AgentCodeBadReqStr, Message: "default service can not be modified"}
+	}
+	conf.SetService(service)
+	return applyTunnelConfig(&svc.BaseService, conf)
+}
+
+type RemoveTunnelServiceService struct {
+	base.BaseService
+}
+
+func (svc *RemoveTunnelServiceService) Process() dto.BaseRspStr {
+	req := svc.Req.(*network.TunnelServiceRemoveReq)
+	logger.AppLogger().Debugf("RemoveTunnelServiceService, req:%+v", req)
+	gtConfigMtx.Lock()
+	defer gtConfigMtx.Unlock()
+	conf, errRsp := loadGTConfig()
+	if errRsp != nil {
+		return *errRsp
+	}
+
+	if conf.IsDefaultService(req.HostPrefix) {
+		return dto.BaseRspStr{Code: dto.AgentCodeBadReqStr, Message: "default service can not be removed"}
+	}
+	if !conf.DeleteService(req.HostPrefix) {
+		return dto.BaseRspStr{Code: dto.AgentCodeBadReqStr, Message: fmt.Sprintf("service %v not found", req.HostPrefix)}
+	}
+	return applyTunnelConfig(&svc.BaseService, conf)
+}
+
+type SetTunnelOptionsService struct {
+	base.BaseService
+}
+
+func (svc *SetTunnelOptionsService) Process() dto.BaseRspStr {
+	req := svc.Req.(*network.TunnelOptions)
+	logger.AppLogger().Debugf("SetTunnelOptionsService, req:%+v", req)
+	gtConfigMtx.Lock()
+	defer gtConfigMtx.Unlock()
+	conf, errRsp := loadGTConfig()
+	if errRsp != nil {
+		return *errRsp
+	}
+
+	opt := &conf.Options
+	if req.RemoteConnections != 0 {
+		opt.RemoteConnections = req.RemoteConnections
+	}
+	if len(req.ReconnectDelay) > 0 {
+		opt.ReconnectDelay = req.ReconnectDelay
+	}
+	if len(req.LocalTimeout) > 0 {
+		opt.LocalTimeout = req.LocalTimeout
+	}
+	if len(req.RemoteTimeout) > 0 {
+		opt.RemoteTimeout = req.RemoteTimeout
+	}
+	if len(req.LogLevel) > 0 {
+		opt.LogLevel = req.LogLevel
+	}
+	if req.WebrtcMinPort != 0 {
+		opt.WebrtcMinPort = req.WebrtcMinPort
+	}
+	if req.WebrtcMaxPort != 0 {
+		opt.WebrtcMaxPort = req.WebrtcMaxPort
+	}
+	if err := opt.Validate(); err != nil {
+		return dto.BaseRspStr{Code: dto.AgentCodeBadReqStr, Message: err.Error()}
+	}
+	return applyTunnelConfig(&svc.BaseService, conf)
+}
+
+// applyTunnelConfig 写入配置并重载 gt client, 调用方需持有 gtConfigMtx
+func applyTunnelConfig(svc *base.BaseService, conf *gt.Config) dto.BaseRspStr {
+	if err := applyGTConfig(conf); err != nil {
+		logger.AppLogger().Warnf("applyTunnelConfig, applyGTConfig err:%v", err)
+		return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, Message: err.Error()}
+	}
+	return svc.Process()
+}
@@ -0,0 +1,128 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"agent/biz/notification"
+	"agent/biz/service/certificate"
+	"agent/biz/service/mdns"
+	"agent/biz/service/pair"
+	"agent/config"
+	util_network "agent/utils/network"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"agent/utils/logger"
+)
+
+var (
+	watcher *util_network.Watcher
+
+	lanNetworksMtx  sync.Mutex
+	lastLanNetworks []string
+)
+
+// StartNetworkWatcher 监听网卡、地址和默认路由变化, 局域网地址变化后更新 mDNS、局域网证书(并重载 nginx)、
+// 网关使用的局域网地址, 并重新下发网卡的 dns 设置. 其他模块可用 util_network.SubscribeAsyncNetworkChange 订阅.
+func StartNetworkWatcher() {
+	cfg := config.Config.Box.Network
+	if cfg.WatchPollIntervalSec <= 0 {
+		cfg.WatchPollIntervalSec = 10
+	}
+	ignore := make([]string, 0)
+	for _, s := range strings.Split(cfg.WatchIgnoreIfaces, ",") {
+		if s = strings.TrimSpace(s); len(s) > 0 {
+			ignore = append(ignore, s)
+		}
+	}
+
+	util_network.SubscribeAsyncNetworkChange(refreshMdns)
+	util_network.SubscribeAsyncNetworkChange(refreshLanCert)
+	util_network.SubscribeAsyncNetworkChange(refreshGatewayLanAddress)
+	util_network.SubscribeAsyncNetworkChange(reapplyResolvedLinks)
+
+	watcher = util_network.NewWatcher(time.Duration(cfg.WatchPollIntervalSec)*time.Second,
+		time.Duration(cfg.WatchDebounceMs)*time.Millisecond, ignore)
+	watcher.Start()
+
+	lanNetworksMtx.Lock()
+	lastLanNetworks = lanNetworkKeys()
+	lanNetworksMtx.Unlock()
+}
+
+// lanAddressChanged 是否有影响局域网访问地址的事件. 默认路由变化不改变本机地址, 不需要处理.
+func lanAddressChanged(events []*util_network.NetEvent) bool {
+	for _, ev := range events {
+		switch ev.Type {
+		case util_network.NetEvent_LinkUp, util_network.NetEvent_LinkDown,
+			util_network.NetEvent_AddrAdded, util_network.NetEvent_AddrRemoved:
+			return true
+		}
+	}
+	return false
+}
+
+// refreshMdns 更新 mDNS 广播. 由 avahi 广播时重启 avahi.
+func refreshMdns(events []*util_network.NetEvent) {
+	if lanAddressChanged(events) {
+		mdns.OnNetworkChange()
+	}
+}
+
+// refreshLanCert 局域网证书的 SAN 包含局域网 IP, IP 变化后重新签发并重载 nginx.
+func refreshLanCert(events []*util_network.NetEvent) {
+	if !lanAddressChanged(events) {
+		return
+	}
+	reissued, err := certificate.EnsureLanCert()
+	if err != nil {
+		logger.AppLogger().Warnf("refreshLanCert, EnsureLanCert err:%v", err)
+		return
+	}
+	if reissued {
+		certificate.ReloadNginx()
+	}
+}
+
+// refreshGatewayLanAddress 局域网地址列表变化时推送给网关.
+func refreshGatewayLanAddress(events []*util_network.NetEvent) {
+	if !lanAddressChanged(events) {
+		return
+	}
+	keys := lanNetworkKeys()
+	lanNetworksMtx.Lock()
+	changed := !reflect.DeepEqual(keys, lastLanNetworks)
+	lanNetworksMtx.Unlock()
+	if !changed {
+		return
+	}
+	if err := notification.OnLanAddressChanged(pair.GetConnectedNetwork()); err != nil {
+		logger.AppLogger().Warnf("refreshGatewayLanAddress, OnLanAddressChanged err:%v", err)
+		return
+	}
+	lanNetworksMtx.Lock()
+	lastLanNetworks = keys
+	lanNetworksMtx.Unlock()
+}
+
+func lanNetworkKeys() []string {
+	keys := make([]string, 0)
+	for _, n := range pair.GetConnectedNetwork() {
+		keys = append(keys, n.Ip+"/"+n.WifiName)
+	}
+	return keys
+}
@@ -0,0 +1,166 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"agent/biz/model/device_ability"
+	"agent/biz/model/dto"
+	"agent/biz/model/dto/network"
+	"agent/biz/service/base"
+	"errors"
+	"fmt"
+
+	util_network "agent/utils/network"
+
+	"agent/utils/logger"
+)
+
+// wifiProfileUnsupported 没有 wifi 网卡管理能力(如容器中运行)时返回错误响应
+func wifiProfileUnsupported() *dto.BaseRspStr {
+	if !device_ability.GetAbilityModel().InnerDiskSupport {
+		return &dto.BaseRspStr{Code: dto.AgentCodeUnsupportedFunction, Message: "unsupported function"}
+	}
+	return nil
+}
+
+type ListWifiProfilesService struct {
+	base.BaseService
+}
+
+func (svc *ListWifiProfilesService) Process() dto.BaseRspStr {
+	logger.AppLogger().Debugf("ListWifiProfilesService")
+	if rsp := wifiProfileUnsupported(); rsp != nil {
+		return *rsp
+	}
+
+	profiles, err := util_network.Backend().WifiProfiles()
+	if err != nil {
+		logger.AppLogger().Warnf("ListWifiProfilesService, WifiProfiles err:%v", err)
+		return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, Message: err.Error()}
+	}
+	rsp := make([]*network.WifiProfileRsp, 0, len(profiles))
+	for _, p := range profiles {
+		rsp = append(rsp, &network.WifiProfileRsp{Uuid: p.Uuid, Ssid: p.Ssid, Hidden: p.Hidden, Security: p.Security,
+			EapMethod: p.EapMethod, Identity: p.Identity, Priority: p.Priority, AutoConnect: p.AutoConnect, Active: p.Active})
+	}
+	svc.Rsp = rsp
+	return svc.BaseService.Process()
+}
+
+type SaveWifiProfileService struct {
+	base.BaseService
+}
+
+func wifiProfileConfigOf(req *network.WifiProfileSaveReq) util_network.WifiProfileConfig {
+	cfg := util_network.WifiProfileConfig{Ssid: req.Ssid, Hidden: req.Hidden, Security: req.Security,
+		Password: req.Password, Priority: req.Priority, AutoConnect: true}
+	if req.AutoConnect != nil {
+		cfg.AutoConnect = *req.AutoConnect
+	}
+	if len(cfg.Security) < 1 {
+		cfg.Security = util_network.WifiSecurity_WpaPsk
+		if len(req.Password) < 1 && req.Eap == nil {
+			cfg.Security = util_network.WifiSecurity_None
+		}
+	}
+	if req.Eap != nil {
+		cfg.Eap = util_network.WifiEapConfig{Method: req.Eap.Method, Phase2Auth: req.Eap.Phase2Auth,
+			Identity: req.Eap.Identity, Password: req.Eap.Password, AnonymousIdentity: req.Eap.AnonymousIdentity,
+			CaCertPath: req.Eap.CaCertPath, DomainSuffixMatch: req.Eap.DomainSuffixMatch, NoServerCertCheck: req.Eap.NoServerCertCheck}
+	}
+	return cfg
+}
+
+func (svc *SaveWifiProfileService) Process() dto.BaseRspStr {
+	logger.AppLogger().Debugf("SaveWifiProfileService")
+	if rsp := wifiProfileUnsupported(); rsp != nil {
+		return *rsp
+	}
+
+	req := svc.Req.(*network.WifiProfileSaveReq)
+	logger.AppLogger().Debugf("SaveWifiProfileService, ssid:%v, hidden:%v, security:%v, priority:%v",
+		req.Ssid, req.Hidden, req.Security, req.Priority)
+	cfg := wifiProfileConfigOf(req)
+	if err := cfg.Validate(); err != nil {
+		return dto.BaseRspStr{Code: dto.AgentCodeBadReqStr, Message: err.Error()}
+	}
+	conUuid, err := util_network.Backend().SaveWifiProfile(cfg)
+	if errors.Is(err, util_network.ErrWifiPasswordRequired) {
+		return dto.BaseRspStr{Code: dto.AgentCodeBadReqStr, Message: err.Error()}
+	} else if err != nil {
+		logger.AppLogger().Warnf("SaveWifiProfileService, SaveWifiProfile err:%v", err)
+		return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, Message: err.Error()}
+	}
+
+	rsp := network.WifiProfileSaveRsp{Uuid: conUuid}
+	if req.Connect {
+		if err := util_network.Backend().ActivateConnection(conUuid); err != nil {
+			logger.AppLogger().Warnf("SaveWifiProfileService, ActivateConnection err:%v", err)
+			return dto.BaseRspStr{Code: dto.AgentCodeConnectWifiFailedStr,
+				Message: fmt.Sprintf("profile %v saved, but failed to connect, err:%v", conUuid, err)}
+		}
+		rsp.Connected = true
+	}
+	svc.Rsp = rsp
+	return svc.BaseService.Process()
+}
+
+type SetWifiProfilePriorityService struct {
+	base.BaseService
+}
+
+func (svc *SetWifiProfilePriorityService) Process() dto.BaseRspStr {
+	logger.AppLogger().Debugf("SetWifiProfilePriorityService")
+	if rsp := wifiProfileUnsupported(); rsp != nil {
+		return *rsp
+	}
+
+	req := svc.Req.(*network.WifiProfilePriorityReq)
+	logger.AppLogger().Debugf("SetWifiProfilePriorityService, req:%+v", req)
+	if err := util_network.Backend().SetWifiPriority(req.Uuid, req.Priority, req.AutoConnect); err != nil {
+		logger.AppLogger().Warnf("SetWifiProfilePriorityService, SetWifiPriority err:%v", err)
+		return wifiProfileErrRsp(err)
+	}
+	return svc.BaseService.Process()
+}
+
+type ForgetWifiProfileService struct {
+	base.BaseService
+}
+
+func (svc *ForgetWifiProfileService) Process() dto.BaseRspStr {
+	logger.AppLogger().Debugf("ForgetWifiProfileService")
+	if rsp := wifiProfileUnsupported(); rsp != nil {
+		return *rsp
+	}
+
+	req := svc.Req.(*network.WifiProfileForgetReq)
+	logger.AppLogger().Debugf("ForgetWifiProfileService, req:%+v", req)
+	if len(req.Uuid) < 1 {
+		return dto.BaseRspStr{Code: dto.AgentCodeBadReqStr, Message: "uuid is empty"}
+	}
+	if err := util_network.Backend().DeleteConnection(req.Uuid); err != nil {
+		logger.AppLogger().Warnf("ForgetWifiProfileService, DeleteConnection err:%v", err)
+		return wifiProfileErrRsp(err)
+	}
+	return svc.BaseService.Process()
+}
+
+func wifiProfileErrRsp(err error) dto.BaseRspStr {
+	if errors.Is(err, util_network.ErrConnectionNotFound) {
+		return dto.BaseRspStr{Code: dto.AgentCodeBadReqStr, Message: err.Error()}
+	}
+	return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, Message: err.Error()}
+}
@@ -0,0 +1,97 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"errors"
+	"testing"
+
+	"agent/biz/model/dto/network"
+	util_network "agent/utils/network"
+)
+
+func TestWifiProfileConfigOf(t *testing.T) {
+	// 未指定 security 时按是否有密码判断, 兼容只传 ssid/password 的旧客户端
+	cfg := wifiProfileConfigOf(&network.WifiProfileSaveReq{Ssid: "home", Password: "12345678"})
+	if cfg.Security != util_network.WifiSecurity_WpaPsk || !cfg.AutoConnect {
+		t.Errorf("psk %+v", cfg)
+	}
+	if cfg := wifiProfileConfigOf(&network.WifiProfileSaveReq{Ssid: "cafe"}); cfg.Security != util_network.WifiSecurity_None {
+		t.Errorf("open %+v", cfg)
+	}
+
+	autoConnect := false
+	cfg = wifiProfileConfigOf(&network.WifiProfileSaveReq{Ssid: "corp", Hidden: true, Security: util_network.WifiSecurity_Enterprise,
+		Priority: 5, AutoConnect: &autoConnect, Eap: &network.WifiEapReq{Method: "ttls", Phase2Auth: "pap", Identity: "alice",
+			DomainSuffixMatch: "corp.example.com"}})
+	if cfg.AutoConnect || !cfg.Hidden || cfg.Priority != 5 || cfg.Eap.Method != util_network.WifiEap_Ttls ||
+		cfg.Eap.Phase2Auth != util_network.WifiPhase2_Pap || cfg.Eap.Identity != "alice" || cfg.Eap.DomainSuffixMatch != "corp.example.com" {
+		t.Errorf("enterprise %+v", cfg)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("enterprise validate err:%v", err)
+	}
+}
+
+func TestWifiProfilesWithFakeBackend(t *testing.T) {
+	fake := util_network.NewFakeBackend()
+	fake.DevicesList = []*util_network.Device{{Interface: "wlan0", Type: util_network.DevStatus_Type_Wireless,
+		State: util_network.DevState_Disconnected}}
+	old := util_network.SetBackend(fake)
+	defer util_network.SetBackend(old)
+
+	home, err := util_network.Backend().SaveWifiProfile(wifiProfileConfigOf(&network.WifiProfileSaveReq{Ssid: "home",
+		Security: util_network.WifiSecurity_Sae, Password: "secret", Priority: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hidden, err := util_network.Backend().SaveWifiProfile(wifiProfileConfigOf(&network.WifiProfileSaveReq{Ssid: "attic",
+		Hidden: true, Password: "12345678"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 新增配置必须传密码
+	if _, err := util_network.Backend().SaveWifiProfile(wifiProfileConfigOf(&network.WifiProfileSaveReq{Ssid: "office",
+		Security: util_network.WifiSecurity_Sae})); !errors.Is(err, util_network.ErrWifiPasswordRequired) {
+		t.Errorf("new sae without password, err:%v", err)
+	}
+	// 修改已有配置时不传密码则保留原密码
+	if again, err := util_network.Backend().SaveWifiProfile(wifiProfileConfigOf(&network.WifiProfileSaveReq{Ssid: "home",
+		Security: util_network.WifiSecurity_Sae, Priority: 1})); err != nil || again != home || fake.WifiConfigs[home].Password != "secret" {
+		t.Errorf("update %v, err:%v, cfg:%+v", again, err, fake.WifiConfigs[home])
+	}
+	if err := util_network.Backend().SetWifiPriority(hidden, 10, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := util_network.Backend().ActivateConnection(hidden); err != nil {
+		t.Fatal(err)
+	}
+
+	profiles, err := util_network.Backend().WifiProfiles()
+	if err != nil || len(profiles) != 2 {
+		t.Fatalf("profiles %v, err:%v", profiles, err)
+	}
+	if profiles[0].Uuid != hidden || !profiles[0].Hidden || !profiles[0].Active || profiles[0].Priority != 10 ||
+		profiles[1].Uuid != home || profiles[1].Security != util_network.WifiSecurity_Sae || profiles[1].Active {
+		t.Errorf("profiles %+v %+v", profiles[0], profiles[1])
+	}
+
+	if err := util_network.Backend().DeleteConnection(hidden); err != nil {
+		t.Fatal(err)
+	}
+	if profiles, _ := util_network.Backend().WifiProfiles(); len(profiles) != 1 || fake.DevicesList[0].IsConnected() {
+		t.Errorf("after forget %+v, device %+v", profiles, fake.DevicesList[0])
+	}
+}
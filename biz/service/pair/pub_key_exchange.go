@@ -28,6 +28,7 @@ import (
 	"agent/biz/model/device_ability"
 	"agent/biz/model/dto"
 	dtopair "agent/biz/model/dto/pair"
+	"agent/biz/model/lanca"
 	"agent/biz/service/encwrapper"
 	"fmt"
 
@@ -104,7 +105,8 @@ func ServicePubKeyExchange(req *dtopair.PubKeyExchangeReq) (dto.BaseRspStr, erro
 	}
 
 	results := &dtopair.PubKeyExchangeRsp{BoxPubKey: string(device.GetDevicePubKey()),
-		SignedBtid: b64SignedBtid}
+		SignedBtid:           b64SignedBtid,
+		LanRootCAFingerprint: lanca.RootFingerprint()}
 
 	rsp := dto.BaseRspStr{Code: dto.AgentCodeOkStr,
 		Message: "OK",
@@ -26,6 +26,7 @@ import (
 	"agent/biz/model/dto"
 	dtopair "agent/biz/model/dto/pair"
 	"agent/biz/service/call"
+	"agent/biz/service/did/document/deactivate"
 	"agent/biz/service/encwrapper"
 	"agent/config"
 
@@ -82,5 +83,11 @@ func doRevoke(password string, clientUUID string) (dto.BaseRspStr, error) {
 		return dto.BaseRspStr{Code: dto.AgentCodeCallServiceFailedStr, Message: err.Error()},
 			err
 	}
+	if results.Code == dto.GatewayCodeOkStr || results.Code == dto.AccountCodeOkStr {
+		// 解绑成功, 注销所有 DID. 账号已解绑, 注销失败只记录日志
+		if _, err := deactivate.DeactivateAll(); err != nil {
+			logger.AppLogger().Errorf("failed DeactivateAll, err:%v", err)
+		}
+	}
 	return encwrapper.Enc(results)
 }
@@ -17,10 +17,9 @@ package pair
 import (
 	dtopair "agent/biz/model/dto/pair"
 	"agent/config"
-	"agent/utils/rpi/network"
-	"fmt"
+	"agent/utils/network"
+	rpi_network "agent/utils/rpi/network"
 	"sort"
-	"strconv"
 	"strings"
 
 	"agent/utils/logger"
@@ -30,23 +29,11 @@ import (
 
 var lastWifiList []*dtopair.WifiListRsp
 
-func sortWifiList(ret []*network.ListWifiInfo) []*network.ListWifiInfo {
+func sortWifiList(ret []*network.AccessPoint) []*network.AccessPoint {
 
-	// slice 按照信号强度升序排序.
+	// slice 按照信号强度降序排序.
 	sort.SliceStable(ret, func(i, j int) bool {
-
-		iSig, err := strconv.Atoi(ret[i].SIGNAL)
-		if err != nil {
-			logger.AppLogger().Warnf("failed strconv.Atoi, ret[i].SIGNAL=%v, err:%v", ret[i].SIGNAL, err)
-			return false
-		}
-		jSig, err := strconv.Atoi(ret[j].SIGNAL)
-		if err != nil {
-			logger.AppLogger().Warnf("failed strconv.Atoi, ret[j].SIGNAL=%v, err:%v", ret[j].SIGNAL, err)
-			return false
-		}
-
-		return iSig > jSig
+		return ret[i].Strength > ret[j].Strength
 	})
 	logger.AppLogger().Debugf("sortWifiList, SliceStable len(ret):%+v", len(ret))
 
@@ -54,36 +41,20 @@ func sortWifiList(ret []*network.ListWifiInfo) []*network.ListWifiInfo {
 }
 
 // https://pm.eulix.xyz/bug-view-164.html
-func removeDuplicatedWifi(wifi []*network.ListWifiInfo) []*network.ListWifiInfo {
+func removeDuplicatedWifi(wifi []*network.AccessPoint) []*network.AccessPoint {
 	logger.AppLogger().Debugf("removeDuplicatedWifi, len(wifi):%+v", len(wifi))
 
 	// 把重复的 wifiname 去掉, 同一个名称的wifi 只保留信号强度最高的.
-	mapName := make(map[string]*network.ListWifiInfo)
+	mapName := make(map[string]*network.AccessPoint)
 	for _, info := range wifi {
-		if val, ok := mapName[info.SSID]; ok {
-
-			infoSig, err := strconv.Atoi(info.SIGNAL)
-			if err != nil {
-				logger.AppLogger().Warnf("failed strconv.Atoi, info.SIGNAL=%v, err:%v", info.SIGNAL, err)
-				continue
-			}
-			valSig, err := strconv.Atoi(val.SIGNAL)
-			if err != nil {
-				logger.AppLogger().Warnf("failed strconv.Atoi, val.SIGNAL=%v, err:%v", val.SIGNAL, err)
-				continue
-			}
-
-			if infoSig > valSig {
-				mapName[info.SSID] = info
-			}
-		} else {
-			mapName[info.SSID] = info
+		if val, ok := mapName[info.Ssid]; !ok || info.Strength > val.Strength {
+			mapName[info.Ssid] = info
 		}
 	}
 	logger.AppLogger().Debugf("removeDuplicatedWifi, len(mapName):%+v", len(mapName))
 
 	// map 放入 slice
-	ret := []*network.ListWifiInfo{}
+	ret := []*network.AccessPoint{}
 	for _, v := range mapName {
 		ret = append(ret, v)
 	}
@@ -94,40 +65,39 @@ func removeDuplicatedWifi(wifi []*network.ListWifiInfo) []*network.ListWifiInfo
 
 func GetWifiList() []*dtopair.WifiListRsp {
 	logger.AppLogger().Debugf("GetWifiList")
-	// var err error
-	lst, err := network.ListWifi()
+	lst, err := network.Backend().ListWifi(true)
 	if err != nil {
 		logger.AppLogger().Warnf("failed ListWifi, err:%v", err)
 		return []*dtopair.WifiListRsp{}
-	} else {
-		// for i, v := range lst {
-		// logger.AppLogger().Debugf("getWList, lst[%v] = %+v", i, v)
-		// }
 	}
-	// logger.AppLogger().Debugf("getWList, lst:%+v", lst)
 
 	// 按照信号强度来排序，并且去掉重新的wifi 名称.
 	// https://pm.eulix.xyz/bug-view-164.html
 	wifi := removeDuplicatedWifi(lst)
-	// logger.AppLogger().Debugf("getWList, wifi:%+v", wifi)
-
-	// for i, v := range wifi {
-	// 	logger.AppLogger().Debugf("getWList, after removeDuplicatedWifi, wifi[%v] = %+v", i, v)
-	// }
 
 	wifiList := make([]*dtopair.WifiListRsp, 0)
 	for _, v := range wifi {
-		sig, err := strconv.Atoi(v.SIGNAL)
-		if err != nil {
-			logger.AppLogger().Warnf("failed strconv.Atoi, v.SIGNAL=%v, err:%v", v.SIGNAL, err)
-		}
-		wifiList = append(wifiList, &dtopair.WifiListRsp{Name: v.SSID, Addr: v.BSSID, Signal: int8(sig)})
+		wifiList = append(wifiList, &dtopair.WifiListRsp{Name: v.Ssid, Addr: v.Bssid, Signal: int8(v.Strength)})
 	}
 
 	lastWifiList = wifiList
 
 	return wifiList
-	// logger.AppLogger().Debugf("getWList, wifiList:%+v", wifiList)
+}
+
+// connectedDevices 返回已连接的有线和无线网卡
+func connectedDevices() ([]*network.Device, error) {
+	devices, err := network.Backend().Devices()
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]*network.Device, 0)
+	for _, dev := range devices {
+		if dev.IsEthernetAndWifi() && dev.IsConnected() {
+			ret = append(ret, dev)
+		}
+	}
+	return ret, nil
 }
 
 func GetLocalIpBySSID(ssid string) (string, string) {
@@ -154,46 +124,34 @@ func GetLocalIpBySSID(ssid string) (string, string) {
 	name = wifiName
 	logger.AppLogger().Debugf("GetLocalIpBySSID, ssid=%v, wifiName=%+v", ssid, wifiName)
 
-	deviceInfos, err := network.GetIpAddress()
+	devices, err := connectedDevices()
 	if err != nil {
-		logger.AppLogger().Warnf("GetLocalIpBySSID, failed GetIpAddress, err:%v", err)
+		logger.AppLogger().Warnf("GetLocalIpBySSID, failed connectedDevices, err:%v", err)
 		return name, ip
 	}
 
-	// 去掉ip地址最后的 "/"
-	for i, v := range deviceInfos {
-		logger.AppLogger().Debugf("GetLocalIpBySSID, deviceInfos[%d]: %+v", i, v)
-
-		arr := strings.Split(v.Ip4Address, "/")
-		if len(arr) > 1 {
-			logger.AppLogger().Debugf("GetLocalIpBySSID, v.GENERALCONNECTION=%v, wifiName=%+v",
-				v.GeneralConnection, wifiName)
-			if v.GeneralConnection == wifiName {
-				ip = arr[0]
-				logger.AppLogger().Debugf("GetLocalIpBySSID, arr[0]=%v", arr[0])
-				break
-			}
+	for i, v := range devices {
+		logger.AppLogger().Debugf("GetLocalIpBySSID, devices[%d]: %+v", i, v)
+		if len(v.Ipv4Address()) > 0 && v.ConnectionId == wifiName {
+			ip = v.Ipv4Address()
+			break
 		}
 	}
 	return name, ip
 }
 
 func GetLocalIp() []string {
-	deviceInfos, err := network.GetIpAddress()
+	devices, err := connectedDevices()
 	if err != nil {
-		logger.AppLogger().Warnf("GetLocalIp, failed GetIpAddress, err:%v", err)
+		logger.AppLogger().Warnf("GetLocalIp, failed connectedDevices, err:%v", err)
 		return []string{}
 	}
-	for i, v := range deviceInfos {
-		logger.AppLogger().Debugf("GetLocalIp, deviceInfos[%d]: %+v", i, v)
-	}
 
-	// 去掉ip地址最后的 "/"
 	rt := make([]string, 0)
-	for _, v := range deviceInfos {
-		arr := strings.Split(v.Ip4Address, "/")
-		if len(arr) > 1 {
-			rt = append(rt, arr[0])
+	for i, v := range devices {
+		logger.AppLogger().Debugf("GetLocalIp, devices[%d]: %+v", i, v)
+		if ip := v.Ipv4Address(); len(ip) > 0 {
+			rt = append(rt, ip)
 		}
 	}
 	return rt
@@ -201,7 +159,7 @@ func GetLocalIp() []string {
 
 func IsNetworkConnected() (bool, error) {
 
-	ok, err := network.Ping(config.Config.Box.PingHost)
+	ok, err := rpi_network.Ping(config.Config.Box.PingHost)
 	if err != nil {
 		logger.AppLogger().Warnf("failed Ping, err:%v", err)
 		return false, err
@@ -213,25 +171,19 @@ func IsNetworkConnected() (bool, error) {
 func ConnectToWifi(BSSID, PWD string) error {
 	logger.AppLogger().Debugf("connectToWifi, BSSID:%+v, PWD:%+v", BSSID, PWD)
 
-	succ, err := network.ConnectWifi(BSSID, PWD)
-	if err != nil {
+	if err := network.Backend().ConnectWifi(BSSID, PWD); err != nil {
 		logger.AppLogger().Warnf("failed ConnectWifi, err:%v", err)
 		return err
 	}
-	logger.AppLogger().Debugf("ConnectWifi result:%v\n", succ)
-	if !succ {
-		return fmt.Errorf("ConnectWifi return false")
-	}
-
 	return nil
 }
 
 func GetConnectedNetwork() []*dtopair.Network {
 	logger.AppLogger().Debugf("GetConnectedNetwork")
 
-	deviceInfos, err := network.GetIpAddress()
+	devices, err := connectedDevices()
 	if err != nil {
-		logger.AppLogger().Warnf("GetConnectedNetwork, failed GetIpAddress, err:%v", err)
+		logger.AppLogger().Warnf("GetConnectedNetwork, failed connectedDevices, err:%v", err)
 
 		if fileutil.IsFileExist(config.Config.Box.HostIpFile) {
 			logger.AppLogger().Debugf("GetConnectedNetwork, IsFileExist, HostIpFile:%v", config.Config.Box.HostIpFile)
@@ -257,28 +209,22 @@ func GetConnectedNetwork() []*dtopair.Network {
 
 		return []*dtopair.Network{}
 	}
-	for i, v := range deviceInfos {
-		logger.AppLogger().Debugf("GetConnectedNetwork, deviceInfos[%d]: %+v", i, v)
+	for i, v := range devices {
+		logger.AppLogger().Debugf("GetConnectedNetwork, devices[%d]: %+v", i, v)
 	}
 
 	rt := make([]*dtopair.Network, 0)
-	for _, v := range deviceInfos {
-
-		// 去掉ip地址最后的 "/"
-		ip := v.Ip4Address
-		arr := strings.Split(v.Ip4Address, "/")
-		if len(arr) > 1 {
-			ip = arr[0]
-		}
+	for _, v := range devices {
+		ip := v.Ipv4Address()
 
 		n := &dtopair.Network{Ip: ip, Wire: true,
-			WifiName: v.GeneralDevice,
+			WifiName: v.Interface,
 			Port:     config.Config.GateWay.LanPort,
 			TlsPort:  config.Config.GateWay.TlsLanPort}
 
-		if v.GeneralType == "wifi" {
+		if v.IsWireless() {
 			n = &dtopair.Network{Ip: ip, Wire: false,
-				WifiName: v.GeneralConnection,
+				WifiName: v.ConnectionId,
 				Port:     config.Config.GateWay.LanPort,
 				TlsPort:  config.Config.GateWay.TlsLanPort}
 		}
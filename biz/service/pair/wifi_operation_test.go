@@ -0,0 +1,77 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pair
+
+import (
+	"agent/utils/network"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func useFakeNetworkBackend(t *testing.T) *network.FakeBackend {
+	fake := network.NewFakeBackend()
+	old := network.SetBackend(fake)
+	t.Cleanup(func() { network.SetBackend(old) })
+	return fake
+}
+
+func TestGetWifiList(t *testing.T) {
+	fake := useFakeNetworkBackend(t)
+	fake.AccessPoints = []*network.AccessPoint{
+		{Ssid: "home:5G", Bssid: "DC:FE:18:19:AA:8B", Strength: 40},
+		{Ssid: "office", Bssid: "14:DE:39:A6:7C:48", Strength: 70},
+		{Ssid: "home:5G", Bssid: "DC:FE:18:19:AA:8C", Strength: 85},
+	}
+
+	got := GetWifiList()
+	if len(got) != 2 {
+		t.Fatalf("expected 2 wifi, got %+v", got)
+	}
+	if got[0].Name != "home:5G" || got[0].Addr != "DC:FE:18:19:AA:8C" || got[0].Signal != 85 {
+		t.Errorf("unexpected first wifi %+v", got[0])
+	}
+	if got[1].Name != "office" {
+		t.Errorf("unexpected second wifi %+v", got[1])
+	}
+}
+
+func TestConnectToWifiAndLocalIp(t *testing.T) {
+	fake := useFakeNetworkBackend(t)
+	fake.DevicesList = []*network.Device{
+		{Interface: "eth0", Type: network.DevStatus_Type_Wire, State: network.DevState_Connected,
+			ConnectionId: "Wired connection 1", Ip4Addresses: []string{"192.168.1.10/24"}},
+		{Interface: "wlan0", Type: network.DevStatus_Type_Wireless, State: network.DevState_Disconnected},
+		{Interface: "docker0", Type: "bridge", State: network.DevState_Connected, Ip4Addresses: []string{"172.17.0.1/16"}},
+	}
+	fake.AccessPoints = []*network.AccessPoint{{Ssid: "cafe 咖啡", Bssid: "40:FE:95:00:12:66", Strength: 60}}
+	fake.WifiPasswords["cafe 咖啡"] = "secret"
+
+	err := ConnectToWifi("40:FE:95:00:12:66", "wrong")
+	if !errors.Is(err, network.ErrWifiActivationFailed) {
+		t.Fatalf("expected ErrWifiActivationFailed, got %v", err)
+	}
+	if err := ConnectToWifi("40:FE:95:00:12:66", "secret"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := GetLocalIp(); !reflect.DeepEqual(got, []string{"192.168.1.10"}) {
+		t.Errorf("GetLocalIp got %v", got)
+	}
+	networks := GetConnectedNetwork()
+	if len(networks) != 2 || networks[1].Wire || networks[1].WifiName != "cafe 咖啡" {
+		t.Errorf("GetConnectedNetwork got %+v", networks)
+	}
+}
@@ -24,7 +24,11 @@ import (
 	"agent/biz/service/base"
 	"agent/biz/service/encwrapper"
 	"agent/config"
+	"agent/utils/reqsign"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/url"
 
 	"agent/utils/logger"
 
@@ -71,54 +75,29 @@ func (svc *PassthroughService) Process() dto.BaseRspStr {
 	newHeaders["btid"] = btid
 
 	//generate sign
-	if device_ability.GetAbilityModel().SecurityChipSupport {
-		if len(clientUUID) > 0 {
-			clientUuidSign, err := device.SignFromSecurityChip([]byte(clientUUID))
-			if err != nil {
-				logger.AppLogger().Warnf("%+v", clientUuidSign)
-				return dto.BaseRspStr{Code: dto.AgentCodeBadReqStr,
-					Message: err.Error()}
-			}
-			newHeaders["clientUuidSign"] = clientUuidSign
-		}
-
-		b64SignedBtid, err := device.SignFromSecurityChip([]byte(btid))
+	signer, err := deviceSigner()
+	if err != nil {
+		logger.AppLogger().Warnf("%+v", err)
+		return dto.BaseRspStr{Code: dto.AgentCodeBadReqStr,
+			Message: err.Error()}
+	}
+	// clientUuidSign、btidSign 只对固定值签名, 保留用于兼容未升级的网关.
+	if len(clientUUID) > 0 {
+		d, err := signer.Sign([]byte(clientUUID))
 		if err != nil {
-			logger.AppLogger().Warnf("%+v", b64SignedBtid)
+			logger.AppLogger().Warnf("%+v", err)
 			return dto.BaseRspStr{Code: dto.AgentCodeBadReqStr,
 				Message: err.Error()}
 		}
-		newHeaders["btidSign"] = b64SignedBtid
-
-	} else {
-		pri, err := encwrapper.GetPrivateKey(string(device.GetDevicePriKey()))
-		if err != nil {
-			err1 := fmt.Errorf("%+v", err)
-			logger.AppLogger().Warnf("%+v", err1)
-			return dto.BaseRspStr{Code: dto.AgentCodeBadReqStr,
-				Message: err1.Error()}
-		}
-
-		if len(clientUUID) > 0 {
-			d, err := encwrapper.Sign(pri, []byte(clientUUID))
-			if err != nil {
-				err1 := fmt.Errorf("%+v", err)
-				logger.AppLogger().Warnf("%+v", err1)
-				return dto.BaseRspStr{Code: dto.AgentCodeBadReqStr,
-					Message: err1.Error()}
-			}
-			newHeaders["clientUuidSign"] = encoding.Base64Encode(d)
-		}
-
-		d, err := encwrapper.Sign(pri, []byte(btid))
-		if err != nil {
-			err1 := fmt.Errorf("%+v", err)
-			logger.AppLogger().Warnf("%+v", err1)
-			return dto.BaseRspStr{Code: dto.AgentCodeBadReqStr,
-				Message: err1.Error()}
-		}
-		newHeaders["btidSign"] = encoding.Base64Encode(d)
+		newHeaders["clientUuidSign"] = encoding.Base64Encode(d)
+	}
+	d, err := signer.Sign([]byte(btid))
+	if err != nil {
+		logger.AppLogger().Warnf("%+v", err)
+		return dto.BaseRspStr{Code: dto.AgentCodeBadReqStr,
+			Message: err.Error()}
 	}
+	newHeaders["btidSign"] = encoding.Base64Encode(d)
 
 	newHeaders["Content-Type"] = "application/json"
 	if _, ok := newHeaders["Request-Id"]; !ok {
@@ -152,9 +131,24 @@ func (svc *PassthroughService) Process() dto.BaseRspStr {
 
 		url := config.Config.GateWay.APIRoot.Url + reqPath
 		logger.AppLogger().Debugf("---- ServicePassthrough, url:%+v", url)
+
+		// 对方法、路径、请求体、时间戳和 nonce 签名, 网关使用 utils/reqsign 校验并拒绝重放.
+		body, err := json.Marshal(req.Entity)
+		if err != nil {
+			return dto.BaseRspStr{Code: dto.AgentCodeBadReqStr, Message: err.Error()}
+		}
+		signHeaders, err := signRequest(signer, url, body, clientUUID, btid)
+		if err != nil {
+			logger.AppLogger().Warnf("%+v", err)
+			return dto.BaseRspStr{Code: dto.AgentCodeServerErrorStr, Message: err.Error()}
+		}
+		for k, v := range signHeaders {
+			newHeaders[k] = v
+		}
+
 		var callRsp interface{}
 		httpReq, httpRsp, rspBody, err1 := utilshttp.PostJsonWithHeaders(url,
-			req.Entity, newHeaders, callRsp)
+			json.RawMessage(body), newHeaders, callRsp)
 		if err1 != nil {
 			logger.AppLogger().Warnf("Failed CallServiceByPost, err:%v, @@httpReq:%+v, @@httpRsp:%+v, @@rspBody:%v", err1, httpReq, httpRsp, string(rspBody))
 			return dto.BaseRspStr{Code: dto.AgentCodeCallServiceFailedStr, Message: err1.Error()}
@@ -177,3 +171,34 @@ func (svc *PassthroughService) Process() dto.BaseRspStr {
 			Message: err1.Error()}
 	}
 }
+
+// deviceSigner 返回设备密钥签名器, 有加密芯片时使用芯片签名.
+func deviceSigner() (reqsign.Signer, error) {
+	if device_ability.GetAbilityModel().SecurityChipSupport {
+		return reqsign.SignerFunc(func(data []byte) ([]byte, error) {
+			sign, err := device.SignFromSecurityChip(data)
+			if err != nil {
+				return nil, err
+			}
+			return encoding.Base64Decode(sign)
+		}), nil
+	}
+
+	pri, err := encwrapper.GetPrivateKey(string(device.GetDevicePriKey()))
+	if err != nil {
+		return nil, err
+	}
+	return &reqsign.RSASigner{Key: pri}, nil
+}
+
+func signRequest(signer reqsign.Signer, rawUrl string, body []byte, clientUUID, btid string) (map[string]string, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return nil, err
+	}
+	return reqsign.Sign(signer, &reqsign.Params{Method: http.MethodPost,
+		Path:       u.RequestURI(),
+		Body:       body,
+		ClientUuid: clientUUID,
+		Btid:       btid})
+}
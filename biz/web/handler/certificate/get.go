@@ -25,8 +25,8 @@ import (
 )
 
 // GetLanCert godoc
-// @Summary get certificate(self sign) [for client /gateway]
-// @Description get certificate(self sign)
+// @Summary get LAN certificate and LAN root CA [for client /gateway]
+// @Description get LAN certificate issued by the per-box LAN root CA, with the root CA and its SHA256 fingerprint for pinning
 // @ID GetLanCert
 // @Tags cert
 // @Accept  plain
@@ -42,3 +42,17 @@ func GetLanCert(c *gin.Context) {
 		c.JSON(http.StatusOK, svc.InitLanService("", c.Request.Header, c).Enter(svc, nil))
 	}
 }
+
+// GetCertInventory godoc
+// @Summary get certificate inventory [for gateway]
+// @Description list certificates found on the box (LAN, ACME, internal CA, docker TLS, platform CA and compose volumes) with expiry, key type and SANs
+// @ID GetCertInventory
+// @Tags cert
+// @Accept  plain
+// @Produce  json
+// @Success 200 {object} dto.BaseRspStr{results=certificate.InventoryRsp} "code=AG-200 success;"
+// @Router /agent/v1/api/cert/inventory [GET]
+func GetCertInventory(c *gin.Context) {
+	svc := new(certificate.CertInventoryService)
+	c.JSON(http.StatusOK, svc.InitGatewayService("", c.Request.Header, c).Enter(svc, nil))
+}
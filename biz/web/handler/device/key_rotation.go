@@ -0,0 +1,42 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package device
+
+import (
+	dtodevice "agent/biz/model/dto/device"
+	deviceservice "agent/biz/service/device"
+	"net/http"
+
+	"agent/utils/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// RotateKey godoc
+// @Summary rotate device key [for gateway]
+// @Description rotate device key, reissue agent tokens and return proposals to rotate the device verification method of DID documents. Call again with the signed proposals to commit them.
+// @ID device.RotateKey
+// @Tags device
+// @Accept  json
+// @Produce  json
+// @Param   keyRotationReq      body dtodevice.KeyRotationReq true  "params"
+// @Success 200 {object} dto.BaseRspStr{results=dtodevice.KeyRotationRsp} "code=AG-200 成功."
+// @Router /agent/v1/api/device/key/rotate [POST]
+func RotateKey(c *gin.Context) {
+	logger.AppLogger().Debugf("RotateKey POST:%+v", c.Request)
+
+	var reqObject dtodevice.KeyRotationReq
+	svc := new(deviceservice.KeyRotationService)
+	c.JSON(http.StatusOK, svc.InitGatewayService("", c.Request.Header, c).Enter(svc, &reqObject))
+}
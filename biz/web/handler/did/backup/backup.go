@@ -0,0 +1,61 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package backup
+
+import (
+	backupservice "agent/biz/service/did/backup"
+	"net/http"
+
+	"agent/biz/model/dto/did/backup"
+	"agent/utils/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ExportBackup godoc
+// @Summary export did documents and keys as archive encrypted with recovery passphrase [for gateway]
+// @Description
+// @ID ExportBackup
+// @Tags did
+// @Produce  json
+// @Param   exportBackupReq      body backup.ExportBackupReq true  "params"
+// @Success 200 {object} dto.BaseRspStr{results=backup.ExportBackupRsp} "code=AG-200 成功."
+// @Router /agent/v1/api/did/backup/export [POST]
+func ExportBackup(c *gin.Context) {
+	logger.AppLogger().Debugf("ExportBackup POST")
+
+	var reqObject backup.ExportBackupReq
+
+	svc := backupservice.NewExportBackup()
+	c.JSON(http.StatusOK, svc.InitGatewayService("", c.Request.Header, c).Enter(svc, &reqObject))
+}
+
+// RestoreBackup godoc
+// @Summary validate and import did backup archive [for gateway]
+// @Description
+// @ID RestoreBackup
+// @Tags did
+// @Produce  json
+// @Param   restoreBackupReq      body backup.RestoreBackupReq true  "params"
+// @Success 200 {object} dto.BaseRspStr{results=backup.RestoreBackupRsp} "code=AG-200 成功."
+// @Router /agent/v1/api/did/backup/restore [POST]
+func RestoreBackup(c *gin.Context) {
+	logger.AppLogger().Debugf("RestoreBackup POST")
+
+	var reqObject backup.RestoreBackupReq
+
+	svc := backupservice.NewRestoreBackup()
+	c.JSON(http.StatusOK, svc.InitGatewayService("", c.Request.Header, c).Enter(svc, &reqObject))
+}
@@ -0,0 +1,79 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package credential
+
+import (
+	credentialservice "agent/biz/service/did/credential"
+	"net/http"
+
+	"agent/biz/model/dto/did/credential"
+	"agent/utils/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IssueCredential godoc
+// @Summary issue verifiable credential of space member or device binding [for gateway]
+// @Description member credential is issued by admin did, device credential is issued by did of aoId itself.
+// @ID IssueCredential
+// @Tags did
+// @Produce  json
+// @Param   issueCredentialReq      body credential.IssueCredentialReq true  "params"
+// @Success 200 {object} dto.BaseRspStr{results=credential.IssueCredentialRsp} "code=AG-200 成功."
+// @Router /agent/v1/api/did/credential/issue [POST]
+func IssueCredential(c *gin.Context) {
+	logger.AppLogger().Debugf("IssueCredential POST:%+v", c.Request)
+
+	var reqObject credential.IssueCredentialReq
+
+	svc := credentialservice.NewIssueCredential()
+	c.JSON(http.StatusOK, svc.InitGatewayService("", c.Request.Header, c).Enter(svc, &reqObject))
+}
+
+// VerifyCredential godoc
+// @Summary verify verifiable credential offline [for gateway]
+// @Description
+// @ID VerifyCredential
+// @Tags did
+// @Produce  json
+// @Param   verifyCredentialReq      body credential.VerifyCredentialReq true  "params"
+// @Success 200 {object} dto.BaseRspStr{results=credential.VerifyCredentialRsp} "code=AG-200 成功."
+// @Router /agent/v1/api/did/credential/verify [POST]
+func VerifyCredential(c *gin.Context) {
+	logger.AppLogger().Debugf("VerifyCredential POST:%+v", c.Request)
+
+	var reqObject credential.VerifyCredentialReq
+
+	svc := credentialservice.NewVerifyCredential()
+	c.JSON(http.StatusOK, svc.InitGatewayService("", c.Request.Header, c).Enter(svc, &reqObject))
+}
+
+// VerifyPresentation godoc
+// @Summary verify verifiable presentation offline [for gateway]
+// @Description
+// @ID VerifyPresentation
+// @Tags did
+// @Produce  json
+// @Param   verifyPresentationReq      body credential.VerifyPresentationReq true  "params"
+// @Success 200 {object} dto.BaseRspStr{results=credential.VerifyPresentationRsp} "code=AG-200 成功."
+// @Router /agent/v1/api/did/presentation/verify [POST]
+func VerifyPresentation(c *gin.Context) {
+	logger.AppLogger().Debugf("VerifyPresentation POST:%+v", c.Request)
+
+	var reqObject credential.VerifyPresentationReq
+
+	svc := credentialservice.NewVerifyPresentation()
+	c.JSON(http.StatusOK, svc.InitGatewayService("", c.Request.Header, c).Enter(svc, &reqObject))
+}
@@ -0,0 +1,43 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package deactivate
+
+import (
+	deactivateservice "agent/biz/service/did/document/deactivate"
+	"net/http"
+
+	"agent/biz/model/dto/did/document/deactivate"
+	"agent/utils/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+// DeactivateDocument godoc
+// @Summary deactivate did document when user removed or box reset [for gateway]
+// @Description
+// @ID DeactivateDocument
+// @Tags did
+// @Produce  json
+// @Param   deactivateDocumentReq      body deactivate.DeactivateDocumentReq true  "params"
+// @Success 200 {object} dto.BaseRspStr{results=deactivate.DeactivateDocumentRsp} "code=AG-200 成功."
+// @Router /agent/v1/api/did/document/deactivate [POST]
+func DeactivateDocument(c *gin.Context) {
+	logger.AppLogger().Debugf("DeactivateDocument POST:%+v", c.Request)
+
+	var reqObject deactivate.DeactivateDocumentReq
+
+	svc := deactivateservice.NewDeactivateDocument()
+	c.JSON(http.StatusOK, svc.InitGatewayService("", c.Request.Header, c).Enter(svc, &reqObject))
+}
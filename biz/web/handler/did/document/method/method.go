@@ -28,7 +28,7 @@ import (
 
 // UpdateDocumentMethod godoc
 // @Summary get UpdateDocumentMethod [for gateway]
-// @Description
+// @Description Two steps: without proposalId returns the proposed document and signingInput; then submit proposalId with signatures satisfying capabilityInvocation of the document. code=AG-472 when not authorized.
 // @ID UpdateDocumentMethod
 // @Tags did
 // @Produce  json
@@ -28,12 +28,12 @@ import (
 
 // UpdateDocumentPassword godoc
 // @Summary get UpdateDocumentPassword [client call through gateway ,for gateway]
-// @Description
+// @Description Two steps: without proposalId returns the proposed document and signingInput; then submit proposalId with signatures satisfying capabilityInvocation of the document. code=AG-472 when not authorized.
 // @ID UpdateDocumentPassword
 // @Tags did
 // @Produce  json
 // @Param   updateDocumentPasswordReq      body password.UpdateDocumentPasswordReq true  "params"
-// @Success 200 {object} dto.BaseRspStr "code=AG-200 success."
+// @Success 200 {object} dto.BaseRspStr{results=password.UpdateDocumentPasswordRsp} "code=AG-200 success."
 // @Router /agent/v1/api/did/document/password [PUT]
 func UpdateDocumentPassword(c *gin.Context) {
 	logger.AppLogger().Debugf("GetDIDDoc GET:%+v", c.Request)
@@ -0,0 +1,60 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package resolve
+
+import (
+	"agent/biz/model/dto/did/resolve"
+	resolveservice "agent/biz/service/did/resolve"
+	"agent/utils/logger"
+	"encoding/json"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ResolveDID godoc
+// @Summary resolve did document, following W3C DID Resolution
+// @Description
+// @ID ResolveDID
+// @Tags did
+// @Produce  json
+// @Param   did          path  string true  "did, eg: did:aospace:xxx"
+// @Param   versionId    query string false "version id"
+// @Param   versionTime  query string false "version time, RFC3339"
+// @Success 200 {object} resolve.ResolutionResult "DID Resolution Result"
+// @Failure 400 {object} resolve.ResolutionResult "invalidDid, invalidOptions"
+// @Failure 501 {object} resolve.ResolutionResult "methodNotSupported"
+// @Failure 404 {object} resolve.ResolutionResult "notFound"
+// @Failure 410 {object} resolve.ResolutionResult "deactivated"
+// @Router /agent/v1/api/did/resolve/{did} [GET]
+func ResolveDID(c *gin.Context) {
+	logger.AppLogger().Debugf("ResolveDID GET:%+v", c.Request)
+
+	var req resolve.ResolveReq
+	var status int
+	var result *resolve.ResolutionResult
+	if err := c.ShouldBindQuery(&req); err != nil {
+		logger.AppLogger().Debugf("ResolveDID, ShouldBindQuery err:%v", err)
+		status, result = resolveservice.InvalidOptions(err)
+	} else {
+		status, result = resolveservice.Resolve(c.Param("did"), &req)
+	}
+	b, err := json.Marshal(result)
+	if err != nil {
+		c.String(http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Data(status, resolve.ContentTypeResolutionResult, b)
+}
@@ -32,7 +32,7 @@ import (
 // @Accept  json
 // @Produce  json
 // @Param   networkConfigReq body network.NetworkConfigReq true  "网络配置参数".
-// @Success 200 {object} dto.BaseRspStr "code=AG-200 成功."
+// @Success 200 {object} dto.BaseRspStr{results=network.NetworkConfigApplyRsp} "code=AG-200 开始应用, 需调用确认接口; AG-402 上次的配置还在应用或等待确认."
 // @Router /agent/v1/api/network/config [POST]
 func PostNetworkConfig(c *gin.Context) {
 	logger.AppLogger().Debugf("NetworkConfig POST:%+v", c.Request)
@@ -65,3 +65,44 @@ func GetNetworkConfig(c *gin.Context) {
 		c.JSON(http.StatusOK, svc.InitLanService("", c.Request.Header, c).Enter(svc, nil))
 	}
 }
+
+// ConfirmNetworkConfig godoc
+// @Summary confirm network config applied by POST /network/config, otherwise it is rolled back after timeout [for client LAN/Call]
+// @Description the client should call it over the new network path within confirmTimeoutSec seconds, AG-402 means the config is still being applied
+// @ID ConfirmNetworkConfig
+// @Tags network
+// @Accept  json
+// @Produce  json
+// @Param   networkConfigConfirmReq body network.NetworkConfigConfirmReq true  "params"
+// @Success 200 {object} dto.BaseRspStr "code=AG-200 success."
+// @Router /agent/v1/api/network/config/confirm [POST]
+func ConfirmNetworkConfig(c *gin.Context) {
+	logger.AppLogger().Debugf("ConfirmNetworkConfig POST:%+v", c.Request)
+
+	var reqObject network.NetworkConfigConfirmReq
+	svc := new(networkservice.ConfirmNetworkConfigService)
+	if c.Request.Host == config.Config.Web.DockerLocalListenAddr {
+		c.JSON(http.StatusOK, svc.InitGatewayService("", c.Request.Header, c).Enter(svc, &reqObject))
+	} else {
+		c.JSON(http.StatusOK, svc.InitLanService("", c.Request.Header, c).Enter(svc, &reqObject))
+	}
+}
+
+// GetPortMapping godoc
+// @Summary get port mapping status on the home router (UPnP IGD / NAT-PMP / PCP) [for gateway and client LAN/Call]
+// @Description the gateway advertises directAddress only when directAvailable is true, otherwise clients keep using the tunnel
+// @ID GetPortMapping
+// @Tags network
+// @Produce  json
+// @Success 200 {object} dto.BaseRspStr{results=network.PortMappingStatusRsp} "code=AG-200 success."
+// @Router /agent/v1/api/network/portmap [GET]
+func GetPortMapping(c *gin.Context) {
+	logger.AppLogger().Debugf("GetPortMapping GET:%+v", c.Request)
+
+	svc := networkservice.NewGetPortMappingService()
+	if c.Request.Host == config.Config.Web.DockerLocalListenAddr {
+		c.JSON(http.StatusOK, svc.InitGatewayService("", c.Request.Header, c).Enter(svc, nil))
+	} else {
+		c.JSON(http.StatusOK, svc.InitLanService("", c.Request.Header, c).Enter(svc, nil))
+	}
+}
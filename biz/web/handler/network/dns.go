@@ -0,0 +1,66 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"agent/biz/model/dto/network"
+	networkservice "agent/biz/service/network"
+	"agent/config"
+	"net/http"
+
+	"agent/utils/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// GetDnsConfig godoc
+// @Summary get systemd-resolved dns config, including DNS-over-TLS, DNSSEC, search domains and per-interface servers [for client LAN/Call]
+// @Description
+// @ID GetDnsConfig
+// @Tags network
+// @Produce  json
+// @Success 200 {object} dto.BaseRspStr{results=network.DnsConfig} "code=AG-200 success."
+// @Router /agent/v1/api/network/dns [GET]
+func GetDnsConfig(c *gin.Context) {
+	logger.AppLogger().Debugf("GetDnsConfig GET:%+v", c.Request)
+
+	svc := new(networkservice.GetDnsConfigService)
+	if c.Request.Host == config.Config.Web.DockerLocalListenAddr {
+		c.JSON(http.StatusOK, svc.InitGatewayService("", c.Request.Header, c).Enter(svc, nil))
+	} else {
+		c.JSON(http.StatusOK, svc.InitLanService("", c.Request.Header, c).Enter(svc, nil))
+	}
+}
+
+// SetDnsConfig godoc
+// @Summary set systemd-resolved dns config [for client LAN/Call]
+// @Description the config is rolled back if the platform hosts can not be resolved with it
+// @ID SetDnsConfig
+// @Tags network
+// @Accept  json
+// @Produce  json
+// @Param   dnsConfig body network.DnsConfig true  "params"
+// @Success 200 {object} dto.BaseRspStr "code=AG-200 success; AG-500 failed and rolled back."
+// @Router /agent/v1/api/network/dns [POST]
+func SetDnsConfig(c *gin.Context) {
+	logger.AppLogger().Debugf("SetDnsConfig POST:%+v", c.Request)
+
+	var reqObject network.DnsConfig
+	svc := new(networkservice.SetDnsConfigService)
+	if c.Request.Host == config.Config.Web.DockerLocalListenAddr {
+		c.JSON(http.StatusOK, svc.InitGatewayService("", c.Request.Header, c).Enter(svc, &reqObject))
+	} else {
+		c.JSON(http.StatusOK, svc.InitLanService("", c.Request.Header, c).Enter(svc, &reqObject))
+	}
+}
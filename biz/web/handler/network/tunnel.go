@@ -0,0 +1,110 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"agent/biz/model/dto/network"
+	networkservice "agent/biz/service/network"
+	"agent/config"
+	"net/http"
+
+	"agent/utils/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// GetTunnelConfig godoc
+// @Summary get gt client exposed services, options and live status [for client LAN/Call]
+// @Description the secret is not returned
+// @ID GetTunnelConfig
+// @Tags network
+// @Produce  json
+// @Success 200 {object} dto.BaseRspStr{results=network.TunnelConfigRsp} "code=AG-200 success; AG-400 gt client is not configured."
+// @Router /agent/v1/api/network/tunnel [GET]
+func GetTunnelConfig(c *gin.Context) {
+	logger.AppLogger().Debugf("GetTunnelConfig GET:%+v", c.Request)
+
+	svc := new(networkservice.GetTunnelConfigService)
+	if c.Request.Host == config.Config.Web.DockerLocalListenAddr {
+		c.JSON(http.StatusOK, svc.InitGatewayService("", c.Request.Header, c).Enter(svc, nil))
+	} else {
+		c.JSON(http.StatusOK, svc.InitLanService("", c.Request.Header, c).Enter(svc, nil))
+	}
+}
+
+// SetTunnelService godoc
+// @Summary expose a local service on a subdomain through gt client, or change its local address [for gateway, mutual TLS required]
+// @Description the config is validated before gt client is reloaded, and restored if reloading fails
+// @ID SetTunnelService
+// @Tags network
+// @Accept  json
+// @Produce  json
+// @Param   tunnelServiceReq body network.TunnelServiceReq true  "params"
+// @Success 200 {object} dto.BaseRspStr "code=AG-200 success."
+// @Router /agent/v1/api/network/tunnel/service [POST]
+func SetTunnelService(c *gin.Context) {
+	logger.AppLogger().Debugf("SetTunnelService POST:%+v", c.Request)
+
+	var reqObject network.TunnelServiceReq
+	svc := new(networkservice.SetTunnelServiceService)
+	if c.Request.Host == config.Config.Web.DockerLocalListenAddr {
+		c.JSON(http.StatusOK, svc.InitGatewayService("", c.Request.Header, c).Enter(svc, &reqObject))
+	} else {
+		c.JSON(http.StatusOK, svc.InitLanService("", c.Request.Header, c).Enter(svc, &reqObject))
+	}
+}
+
+// RemoveTunnelService godoc
+// @Summary stop exposing a local service through gt client [for gateway, mutual TLS required]
+// @Description the default service of the box can not be removed
+// @ID RemoveTunnelService
+// @Tags network
+// @Accept  json
+// @Produce  json
+// @Param   tunnelServiceRemoveReq body network.TunnelServiceRemoveReq true  "params"
+// @Success 200 {object} dto.BaseRspStr "code=AG-200 success."
+// @Router /agent/v1/api/network/tunnel/service/remove [POST]
+func RemoveTunnelService(c *gin.Context) {
+	logger.AppLogger().Debugf("RemoveTunnelService POST:%+v", c.Request)
+
+	var reqObject network.TunnelServiceRemoveReq
+	svc := new(networkservice.RemoveTunnelServiceService)
+	if c.Request.Host == config.Config.Web.DockerLocalListenAddr {
+		c.JSON(http.StatusOK, svc.InitGatewayService("", c.Request.Header, c).Enter(svc, &reqObject))
+	} else {
+		c.JSON(http.StatusOK, svc.InitLanService("", c.Request.Header, c).Enter(svc, &reqObject))
+	}
+}
+
+// SetTunnelOptions godoc
+// @Summary set gt client reconnect, timeout and log options [for gateway, mutual TLS required]
+// @Description zero or empty fields are left unchanged
+// @ID SetTunnelOptions
+// @Tags network
+// @Accept  json
+// @Produce  json
+// @Param   tunnelOptions body network.TunnelOptions true  "params"
+// @Success 200 {object} dto.BaseRspStr "code=AG-200 success."
+// @Router /agent/v1/api/network/tunnel/options [POST]
+func SetTunnelOptions(c *gin.Context) {
+	logger.AppLogger().Debugf("SetTunnelOptions POST:%+v", c.Request)
+
+	var reqObject network.TunnelOptions
+	svc := new(networkservice.SetTunnelOptionsService)
+	if c.Request.Host == config.Config.Web.DockerLocalListenAddr {
+		c.JSON(http.StatusOK, svc.InitGatewayService("", c.Request.Header, c).Enter(svc, &reqObject))
+	} else {
+		c.JSON(http.StatusOK, svc.InitLanService("", c.Request.Header, c).Enter(svc, &reqObject))
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"agent/biz/model/dto/network"
+	networkservice "agent/biz/service/network"
+	"agent/config"
+	"net/http"
+
+	"agent/utils/logger"
+	"github.com/gin-gonic/gin"
+)
+
+// ListWifiProfiles godoc
+// @Summary list saved Wi-Fi networks, ordered by auto-connect priority [for client LAN/Call]
+// @Description passwords are not returned
+// @ID ListWifiProfiles
+// @Tags network
+// @Produce  json
+// @Success 200 {object} dto.BaseRspStr{results=[]network.WifiProfileRsp} "code=AG-200 success."
+// @Router /agent/v1/api/network/wifi/profiles [GET]
+func ListWifiProfiles(c *gin.Context) {
+	logger.AppLogger().Debugf("ListWifiProfiles GET:%+v", c.Request)
+
+	svc := new(networkservice.ListWifiProfilesService)
+	if c.Request.Host == config.Config.Web.DockerLocalListenAddr {
+		c.JSON(http.StatusOK, svc.InitGatewayService("", c.Request.Header, c).Enter(svc, nil))
+	} else {
+		c.JSON(http.StatusOK, svc.InitLanService("", c.Request.Header, c).Enter(svc, nil))
+	}
+}
+
+// SaveWifiProfile godoc
+// @Summary add or update a saved Wi-Fi network, including hidden SSIDs, WPA3-SAE and WPA2-Enterprise (PEAP/TTLS) [for client LAN/Call]
+// @Description one profile per SSID. empty password keeps the saved one. connect=true activates it after saving
+// @ID SaveWifiProfile
+// @Tags network
+// @Accept  json
+// @Produce  json
+// @Param   wifiProfileSaveReq body network.WifiProfileSaveReq true  "params"
+// @Success 200 {object} dto.BaseRspStr{results=network.WifiProfileSaveRsp} "code=AG-200 success; AG-561 saved but failed to connect."
+// @Router /agent/v1/api/network/wifi/profile [POST]
+func SaveWifiProfile(c *gin.Context) {
+	logger.AppLogger().Debugf("SaveWifiProfile POST:%+v", c.Request)
+
+	var reqObject network.WifiProfileSaveReq
+	svc := new(networkservice.SaveWifiProfileService)
+	if c.Request.Host == config.Config.Web.DockerLocalListenAddr {
+		c.JSON(http.StatusOK, svc.InitGatewayService("", c.Request.Header, c).Enter(svc, &reqObject))
+	} else {
+		c.JSON(http.StatusOK, svc.InitLanService("", c.Request.Header, c).Enter(svc, &reqObject))
+	}
+}
+
+// SetWifiProfilePriority godoc
+// @Summary set auto-connect priority of a saved Wi-Fi network [for client LAN/Call]
+// @Description higher priority is connected first
+// @ID SetWifiProfilePriority
+// @Tags network
+// @Accept  json
+// @Produce  json
+// @Param   wifiProfilePriorityReq body network.WifiProfilePriorityReq true  "params"
+// @Success 200 {object} dto.BaseRspStr "code=AG-200 success."
+// @Router /agent/v1/api/network/wifi/profile/priority [POST]
+func SetWifiProfilePriority(c *gin.Context) {
+	logger.AppLogger().Debugf("SetWifiProfilePriority POST:%+v", c.Request)
+
+	var reqObject network.WifiProfilePriorityReq
+	svc := new(networkservice.SetWifiProfilePriorityService)
+	if c.Request.Host == config.Config.Web.DockerLocalListenAddr {
+		c.JSON(http.StatusOK, svc.InitGatewayService("", c.Request.Header, c).Enter(svc, &reqObject))
+	} else {
+		c.JSON(http.StatusOK, svc.InitLanService("", c.Request.Header, c).Enter(svc, &reqObject))
+	}
+}
+
+// ForgetWifiProfile godoc
+// @Summary forget a saved Wi-Fi network [for client LAN/Call]
+// @Description disconnects it if it is in use
+// @ID ForgetWifiProfile
+// @Tags network
+// @Accept  json
+// @Produce  json
+// @Param   wifiProfileForgetReq body network.WifiProfileForgetReq true  "params"
+// @Success 200 {object} dto.BaseRspStr "code=AG-200 success."
+// @Router /agent/v1/api/network/wifi/profile/forget [POST]
+func ForgetWifiProfile(c *gin.Context) {
+	logger.AppLogger().Debugf("ForgetWifiProfile POST:%+v", c.Request)
+
+	var reqObject network.WifiProfileForgetReq
+	svc := new(networkservice.ForgetWifiProfileService)
+	if c.Request.Host == config.Config.Web.DockerLocalListenAddr {
+		c.JSON(http.StatusOK, svc.InitGatewayService("", c.Request.Header, c).Enter(svc, &reqObject))
+	} else {
+		c.JSON(http.StatusOK, svc.InitLanService("", c.Request.Header, c).Enter(svc, &reqObject))
+	}
+}
@@ -25,6 +25,7 @@ import (
 	"agent/biz/docker"
 	"agent/biz/model/device"
 	"agent/biz/model/device_ability"
+	"agent/biz/model/did/leveldb"
 	"agent/biz/model/dto"
 	"agent/biz/model/dto/status"
 	"agent/config"
@@ -73,6 +74,8 @@ func Info(c *gin.Context) {
 		}
 	}
 
+	result.DIDStore = leveldb.GetMaintenanceStatus()
+
 	abilityModel := device_ability.GetAbilityModel()
 	if abilityModel.RunInDocker {
 		err := fileutil.WriteToFile(config.Config.Box.HostIpFile, []byte(c.Request.Host), true)
@@ -0,0 +1,79 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package routers
+
+import (
+	"agent/biz/model/dto"
+	"agent/biz/model/internalca"
+	"agent/utils/logger"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 内部接口调用方身份(客户端证书 CN, 即容器名).
+const (
+	callerGateway = "aospace-gateway"
+	callerNginx   = "aospace-nginx"
+	callerUpgrade = "aospace-upgrade"
+	callerFileapi = "aospace-fileapi"
+)
+
+// allowInternalCallers 按客户端证书身份对内部接口鉴权. 未启用双向 TLS 时不做限制.
+// callers 为空表示允许任意持有本地 CA 签发证书的调用方.
+func allowInternalCallers(callers ...string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !internalca.Enabled() {
+			c.Next()
+			return
+		}
+
+		identity := internalca.PeerIdentity(c.Request.TLS)
+		if len(identity) < 1 {
+			abortInternalForbidden(c, "", "missing verified client certificate")
+			return
+		}
+		if len(callers) < 1 {
+			c.Next()
+			return
+		}
+		for _, caller := range callers {
+			if caller == identity {
+				c.Next()
+				return
+			}
+		}
+		abortInternalForbidden(c, identity, "caller not allowed")
+	}
+}
+
+// requireInternalMTLS 用于导出密钥、修改身份等敏感的内部接口: 未启用双向 TLS 时直接拒绝,
+// 不依赖 docker 网桥隔离, 网桥上的任意容器都能访问内部接口. 调用方身份仍由 allowInternalCallers 校验.
+func requireInternalMTLS() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !internalca.Enabled() {
+			abortInternalForbidden(c, "", "mutual TLS is required")
+			return
+		}
+		c.Next()
+	}
+}
+
+func abortInternalForbidden(c *gin.Context, identity, reason string) {
+	err := fmt.Errorf("internal api %v %v rejected, identity:%q, %v", c.Request.Method, c.Request.URL.Path, identity, reason)
+	logger.AppLogger().Warnf("%v", err)
+	c.AbortWithStatusJSON(http.StatusForbidden, dto.BaseRspStr{Code: dto.AgentCodeBadReqStr, Message: err.Error()})
+}
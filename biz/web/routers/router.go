@@ -24,9 +24,13 @@ import (
 	"agent/biz/web/handler/bind/space/create"
 	"agent/biz/web/handler/certificate"
 	"agent/biz/web/handler/device"
+	"agent/biz/web/handler/did/backup"
+	"agent/biz/web/handler/did/credential"
 	"agent/biz/web/handler/did/document"
+	"agent/biz/web/handler/did/document/deactivate"
 	"agent/biz/web/handler/did/document/method"
 	did_document_password "agent/biz/web/handler/did/document/password"
+	"agent/biz/web/handler/did/resolve"
 	"agent/biz/web/handler/network"
 	"agent/biz/web/handler/pair"
 	pairadmin "agent/biz/web/handler/pair/admin"
@@ -106,8 +110,18 @@ func ExternalRouter() *gin.Engine {
 				networkGroup := api.Group("/network")
 				{
 					networkGroup.POST("/config", network.PostNetworkConfig)
+					networkGroup.POST("/config/confirm", network.ConfirmNetworkConfig)
 					networkGroup.GET("/config", network.GetNetworkConfig)
 					networkGroup.POST("/ignore", network.NetworkIgnore)
+					networkGroup.GET("/portmap", network.GetPortMapping)
+					networkGroup.GET("/wifi/profiles", network.ListWifiProfiles)
+					networkGroup.POST("/wifi/profile", network.SaveWifiProfile)
+					networkGroup.POST("/wifi/profile/priority", network.SetWifiProfilePriority)
+					networkGroup.POST("/wifi/profile/forget", network.ForgetWifiProfile)
+					networkGroup.GET("/dns", network.GetDnsConfig)
+					networkGroup.POST("/dns", network.SetDnsConfig)
+					// 修改隧道配置只通过内部接口(双向 TLS)
+					networkGroup.GET("/tunnel", network.GetTunnelConfig)
 				}
 
 				api.POST("/passthrough", passthrough.Passthrough)
@@ -124,6 +138,9 @@ func ExternalRouter() *gin.Engine {
 					did.GET("/document", document.GetDIDDocument)
 					did.PUT("/document/password", did_document_password.UpdateDocumentPassword)
 					did.PUT("/document/method", method.UpdateDocumentMethod)
+					did.GET("/resolve/:did", resolve.ResolveDID)
+					did.POST("/credential/verify", credential.VerifyCredential)
+					did.POST("/presentation/verify", credential.VerifyPresentation)
 				}
 			}
 		}
@@ -142,20 +159,23 @@ func ExternalRouter() *gin.Engine {
 func InternalRouter() *gin.Engine {
 	router := gin.Default()
 
-	v1 := router.Group("/agent/v1/api")
+	// 启用双向 TLS 时, 所有内部接口都要求本地 CA 签发的客户端证书, 各分组再按调用方身份限制.
+	v1 := router.Group("/agent/v1/api", allowInternalCallers())
 	{
 
-		deviceGroup := v1.Group("/device")
+		deviceGroup := v1.Group("/device", allowInternalCallers(callerGateway, callerUpgrade, callerFileapi))
 		{
 			deviceGroup.GET("/info", device.Info)
 			deviceGroup.GET("/version", device.Version)
 			deviceGroup.GET("/ability", device.Ability)
 
-			deviceGroup.GET("/localips", pairnet.LocalIpsDevice)
-			deviceGroup.GET("/netconfig", pairnet.NetConfigDevice)
+			deviceGroup.GET("/localips", allowInternalCallers(callerGateway), pairnet.LocalIpsDevice)
+			deviceGroup.GET("/netconfig", allowInternalCallers(callerGateway), pairnet.NetConfigDevice)
+
+			deviceGroup.POST("/key/rotate", requireInternalMTLS(), allowInternalCallers(callerGateway), device.RotateKey)
 		}
 
-		upgradeApp := v1.Group("/upgrade")
+		upgradeApp := v1.Group("/upgrade", allowInternalCallers(callerGateway, callerUpgrade))
 		{
 			upgradeApp.GET("/config", upgrade.GetUpgradeConfig)
 			upgradeApp.POST("/config", upgrade.SetUpgradeConfig)
@@ -164,34 +184,54 @@ func InternalRouter() *gin.Engine {
 			upgradeApp.GET("/status", upgrade.GetTaskStatus)
 		}
 
-		networkGroup := v1.Group("/network")
+		networkGroup := v1.Group("/network", allowInternalCallers(callerGateway))
 		{
 			networkGroup.POST("/config", network.PostNetworkConfig)
+			networkGroup.POST("/config/confirm", network.ConfirmNetworkConfig)
 			networkGroup.GET("/config", network.GetNetworkConfig)
 			networkGroup.POST("/ignore", network.NetworkIgnore)
+			networkGroup.GET("/portmap", network.GetPortMapping)
+			networkGroup.GET("/wifi/profiles", network.ListWifiProfiles)
+			networkGroup.POST("/wifi/profile", network.SaveWifiProfile)
+			networkGroup.POST("/wifi/profile/priority", network.SetWifiProfilePriority)
+			networkGroup.POST("/wifi/profile/forget", network.ForgetWifiProfile)
+			networkGroup.GET("/dns", network.GetDnsConfig)
+			networkGroup.POST("/dns", network.SetDnsConfig)
+			networkGroup.GET("/tunnel", network.GetTunnelConfig)
+			networkGroup.POST("/tunnel/service", requireInternalMTLS(), network.SetTunnelService)
+			networkGroup.POST("/tunnel/service/remove", requireInternalMTLS(), network.RemoveTunnelService)
+			networkGroup.POST("/tunnel/options", requireInternalMTLS(), network.SetTunnelOptions)
 		}
 
-		systemGroup := v1.Group("/system")
+		systemGroup := v1.Group("/system", allowInternalCallers(callerGateway))
 		{
 			systemGroup.POST("/shutdown", system.SystemShutdown)
 			systemGroup.POST("/reboot", system.SystemReboot)
 		}
-		certGroup := v1.Group("/cert")
+		certGroup := v1.Group("/cert", allowInternalCallers(callerGateway, callerNginx))
 		{
 			certGroup.GET("/get", certificate.GetLanCert)
+			certGroup.GET("/inventory", allowInternalCallers(callerGateway), certificate.GetCertInventory)
 		}
 
-		bindGroup := v1.Group("/bind")
+		bindGroup := v1.Group("/bind", allowInternalCallers(callerGateway))
 		{
 			bindGroup.POST("/internet/service/config", internetserviceconfig.PostConfig)
 			bindGroup.GET("/internet/service/config", internetserviceconfig.GetConfig)
 		}
 
-		did := v1.Group("/did")
+		did := v1.Group("/did", allowInternalCallers(callerGateway))
 		{
 			did.GET("/document", document.GetDIDDocument)
 			did.PUT("/document/password", did_document_password.UpdateDocumentPassword)
 			did.PUT("/document/method", method.UpdateDocumentMethod)
+			did.POST("/document/deactivate", requireInternalMTLS(), deactivate.DeactivateDocument)
+			did.GET("/resolve/:did", resolve.ResolveDID)
+			did.POST("/credential/issue", requireInternalMTLS(), credential.IssueCredential)
+			did.POST("/credential/verify", credential.VerifyCredential)
+			did.POST("/presentation/verify", credential.VerifyPresentation)
+			did.POST("/backup/export", requireInternalMTLS(), backup.ExportBackup)
+			did.POST("/backup/restore", requireInternalMTLS(), backup.RestoreBackup)
 		}
 
 	}
@@ -17,12 +17,14 @@ package routers
 import (
 	"agent/biz/docker"
 	"agent/biz/model/device_ability"
+	"agent/biz/model/internalca"
 	"agent/config"
 	"agent/utils/logger"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	ginSwagger "github.com/swaggo/gin-swagger"
 	"github.com/swaggo/gin-swagger/swaggerFiles"
+	"net/http"
 	"os"
 )
 
@@ -69,8 +71,13 @@ func (w *InternalWebServer) Start() {
 		localListenAddr = config.Config.Web.DockerLocalListenAddrRunInDocker
 	}
 
-	logger.AppLogger().Debugf("startWebServerDockerLocal, using %v ", localListenAddr)
-	err := w.Router.Run(localListenAddr)
+	logger.AppLogger().Debugf("startWebServerDockerLocal, using %v, mtls:%v", localListenAddr, internalca.Enabled())
+	var err error
+	if internalca.Enabled() {
+		err = w.runTLS(localListenAddr)
+	} else {
+		err = w.Router.Run(localListenAddr)
+	}
 	if err != nil {
 		err1 := fmt.Errorf("Failed startWebServerDockerLocal using %v, err: %v", localListenAddr, err)
 		fmt.Printf("%+v\n", err1)
@@ -81,3 +88,17 @@ func (w *InternalWebServer) Start() {
 		return
 	}
 }
+
+// runTLS 以双向 TLS 方式启动内部 web server, 客户端须持有本地 CA 签发的证书.
+func (w *InternalWebServer) runTLS(localListenAddr string) error {
+	tlsConfig, err := internalca.ServerTLSConfig(localListenAddr)
+	if err != nil {
+		return fmt.Errorf("failed to prepare internal mtls config, err: %v", err)
+	}
+	server := &http.Server{
+		Addr:      localListenAddr,
+		Handler:   w.Router,
+		TLSConfig: tlsConfig,
+	}
+	return server.ListenAndServeTLS("", "")
+}
@@ -132,16 +132,69 @@ var Config = struct {
 		DnsConfigFile                    string `default:"/etc/systemd/resolved.conf"`
 		DnsConfigFileBackup              string `default:"/etc/systemd/resolved.conf.backup"`
 
+		// 网络配置变更先做快照, 应用后客户端需在 ApplyConfirmSeconds 内从新的网络路径确认, 否则自动回滚
+		Network struct {
+			ConnectionDir       string `default:"/etc/NetworkManager/system-connections"` // NetworkManager 连接配置文件目录
+			ApplySnapshotDir    string `default:"/etc/ao-space/network/apply-snapshot"`
+			ApplyConfirmSeconds int    `default:"120"` // 最长 600 秒
+
+			// 网络变化监听. netlink 通知不可用时只靠定时轮询
+			WatchPollIntervalSec int    `default:"10"`
+			WatchDebounceMs      int    `default:"1500"`               // DHCP 续租等会连续产生多个变化, 合并后再通知
+			WatchIgnoreIfaces    string `default:"lo,docker,br-,veth"` // 忽略的网卡名前缀, 逗号分隔
+
+			// 在家庭路由器上自动映射 GateWay.TlsLanPort, 用于外网直连. 映射失败时客户端继续走隧道
+			PortMap struct {
+				Enable           bool   `default:"false"`
+				Protocols        string `default:"upnp,natpmp,pcp"` // 依次尝试的协议, 逗号分隔
+				ExternalPort     int    `default:"0"`               // 建议的外部端口, 0 表示与内部端口相同
+				LeaseSeconds     int    `default:"3600"`            // 到期前一半时间续租
+				RetryIntervalSec int    `default:"300"`             // 映射失败后的重试间隔
+				TimeoutSec       int    `default:"3"`               // 单次 NAT-PMP/PCP 请求的超时时间
+				UpnpRootDescUrl  string `default:""`                // 非空时不做 SSDP 发现, 直接使用该 IGD 设备描述地址
+			}
+
+			// 链路故障切换: 有线优先, 当前链路断开或连续 FailThreshold 次探测不到互联网时切换到下一条链路,
+			// 更优先的链路持续健康 FailbackStableSec 后切回. 探测使用 NetworkCheck 的 CloudHost 和 ThirdPartyHost.
+			// 会修改网卡路由度量值, 默认关闭, 需要时在配置文件中开启
+			Failover struct {
+				Enable            bool `default:"false"`
+				CheckIntervalSec  int  `default:"15"`
+				FailThreshold     int  `default:"3"`
+				FailbackStableSec int  `default:"120"`
+				MaxTransitions    int  `default:"50"` // /network/config 中返回的切换记录条数
+			}
+
+			// systemd-resolved 配置. 全局设置写入 DnsConfigFile, 各网卡的设置通过 D-Bus 下发并保存在 LinkConfigFile,
+			// 网卡重新连接后再次下发. 应用后在 ValidateTimeoutSec 内解析不了平台域名则回滚
+			Resolved struct {
+				LinkConfigFile     string `default:"/etc/ao-space/network/resolved-links.json"`
+				ValidateTimeoutSec int    `default:"10"`
+			}
+		}
+
 		SecurityChipAgentSockAddr string `default:"/opt/tmp/eulixspace-security-agent.sock"`
 
 		SecurityChipAgentHttpAddr      string `default:"http://172.17.0.1:9200/security/v1/api"`
 		SecurityChipAgentHttpLocalAddr string `default:"http://172.17.0.1:9200/security/v1/api"`
 
+		SecurityChipEmulator struct {
+			Enable         bool   `default:"false"`                                      // 无加密芯片时启用软件模拟的加密芯片, 供开发测试及虚拟机/容器部署使用
+			SealedKeyFile  string `default:"/etc/ao-space/security-chip/sealed_key.bin"` // 模拟芯片的密钥文件(使用机器密钥加密保存)
+			HttpListenAddr string `default:""`                                           // 同时以 http 方式提供接口的监听地址, 为空时只在 127.0.0.1 的随机端口监听, 供 agent 签发 token
+		}
+
 		BoxKey struct {
 			RsaKeyFile    string `default:"/etc/ao-space/box_key.pem"`
 			RsaPubKeyFile string `default:"/etc/ao-space/box_key_pub.pem"`
+
+			PreviousKeyInfoFile string `default:"/etc/ao-space/box_key_previous.json"` // 密钥轮换后旧密钥信息, 宽限期内旧密钥仍然有效
+			RotationGraceHours  uint32 `default:"168"`                                 // 密钥轮换后旧密钥的宽限期(小时)
+			EnforceAgentToken   bool   `default:"false"`                               // 是否校验请求中的 agent token. 开启后不携带有效 token 的旧客户端请求会被拒绝
 		}
 
+		AgentTokenRecordFile string `default:"/etc/ao-space/agent_token_record.json"` // 已签发的 agent token 记录, 设备密钥轮换时重新签发
+
 		Disk struct {
 			DiskInitialInfoFile  string `default:"/etc/ao-space/disk/disk_initial_info.json"`
 			DeviceUuidRecordFile string `default:"/etc/ao-space/disk/disk_uuid_record.json"`
@@ -172,6 +225,14 @@ var Config = struct {
 			SharedSecret  string `default:"/etc/ao-space/shared_secret.key"`
 		}
 
+		Keystore struct {
+			Enable        bool `default:"true"`  // 客户端私钥、共享密钥、DID 空间私钥加密保存, 已有的明文文件读取时自动迁移
+			SealDeviceKey bool `default:"false"` // 设备私钥 box_key.pem 加密保存. aospace-gateway 直接读取 box_key.pem, 网关支持前不要开启
+			// 容器中运行时是否也加密保存. 容器内的 machine-id 随镜像固定或重建容器后改变, cpuid 文件也保存在数据目录中,
+			// 机器密钥不能绑定宿主机, 重建容器后可能无法解开, 因此默认关闭. 已加密的数据仍然可以读取
+			EnableInDocker bool `default:"false"`
+		}
+
 		UpgradeConfig struct {
 			SettingsFile string `default:"/etc/ao-space/upgrade/settings.json"`
 			// AutoDownload bool   `default:"true" json:"autoDownload"`
@@ -179,14 +240,18 @@ var Config = struct {
 		}
 
 		Avahi struct {
-			BtIdHashPlaceHolder     string `default:"placeholdercccccc"`
-			BtIdHashPrefix          string `default:"eulixspace-"`
-			BtIdHashXmlConfigPrefix string `default:"btidhash"`
-			DeviceModelPlaceHolder  string `default:"placeholdermodel"`
-			SSLPort                 string `default:"443"`
-			WebPort                 string `default:"80"`
-			AvahiServiceName        string `default:"avahi-daemon"`
-			BtIdHashLen             uint16 `default:"6"`
+			BtIdHashPrefix   string `default:"eulixspace-"`
+			SSLPort          string `default:"443"`
+			WebPort          string `default:"80"`
+			AvahiServiceName string `default:"avahi-daemon"` // 5353 端口被占用时仍由 avahi 广播
+			BtIdHashLen      uint16 `default:"6"`
+		}
+
+		// 进程内的 mDNS/DNS-SD 广播, 服务实例名为 InstancePrefix + btidhash 的前 Avahi.BtIdHashLen 位
+		Mdns struct {
+			Enable             bool   `default:"true"`
+			InstancePrefix     string `default:"eulixspace-"`
+			RefreshIntervalSec int    `default:"10"` // 检查 TXT 记录(配对状态等)是否需要更新的间隔
 		}
 
 		Loki struct {
@@ -201,12 +266,49 @@ var Config = struct {
 		Cert struct {
 			CertDir           string `default:"/etc/ao-space/certs/"`
 			ACMERegisterEmail string `default:"service@ao.space"`
+
+			// ACME 证书(DNS-01 验证), 证书写入 CertDir/acme/live/fullchain.pem 和 privkey.pem.
+			// CertDir 挂载到 nginx 容器的 /etc/nginx/certs, 启用时通过 aospace-nginx.env 的 ACME_CERT_FILE、ACME_KEY_FILE
+			// 告知 nginx 容器内的路径, nginx 配置需要引用这两个文件. 替换证书后执行 nginx -t 和 nginx -s reload
+			ACME struct {
+				Enable                bool   `default:"false"`
+				DirectoryURL          string `default:"https://acme-v02.api.letsencrypt.org/directory"`
+				RenewBeforeDays       int    `default:"30"`       // 距离过期不足该天数时续期
+				RenewCron             string `default:"'@daily'"` // 检查续期. 默认值按 yaml 解析, @ 开头需要加引号
+				DNSPropagationSeconds int    `default:"120"`      // 等待 TXT 记录生效的最长时间
+			}
+
+			// 局域网根证书, 用于签发包含局域网 IP、mDNS 主机名和盒子域名的服务端证书
+			LanCA struct {
+				RootKeyFile      string `default:"/etc/ao-space/lanca/root.key"` // 按 Keystore 配置加密保存. 不放在 CertDir 下, CertDir 挂载到 nginx 容器
+				RootCertFile     string `default:"/etc/ao-space/certs/lanca/root.pem"`
+				RootValidYears   int    `default:"20"`
+				LeafValidDays    int    `default:"397"`
+				LeafRenewDays    int    `default:"30"`          // 距离过期不足该天数时重新签发
+				ReissueCheckCron string `default:"'@every 1m'"` // 检查 IP 等是否变化. 默认值按 yaml 解析, @ 开头需要加引号
+			}
+
+			// 证书清单及过期提醒, 覆盖局域网证书、ACME 证书、内部 CA、docker TLS 证书、平台 CA 以及 compose 挂载的证书
+			Inventory struct {
+				DockerTLSDir       string `default:"/etc/docker/tls/"`                            // dockerd 启用 TLS 时的证书目录, 不存在则跳过
+				PlatformCABundle   string `default:"/etc/ao-space/certs/platform-ca.pem"`         // 访问平台时使用的 CA 证书包, 不存在则跳过
+				ExtraPaths         string `default:""`                                            // 其他证书文件或目录, 逗号分隔
+				ExpiryThresholds   string `default:"30,7,1"`                                      // 距离过期天数达到这些阈值时推送通知, 逗号分隔
+				CheckCron          string `default:"'@every 1h'"`                                 // 默认值按 yaml 解析, @ 开头需要加引号
+				NotifiedRecordFile string `default:"/etc/ao-space/certs/inventory_notified.json"` // 已推送过的阈值记录, 避免重复推送
+			}
 		}
 
 		DID struct {
 			RootPath string `default:"/etc/ao-space/did"`
 
 			DBFileName string `default:"did.leveldb"`
+
+			AutoRecover    bool   `default:"true"`                     // 打开时 manifest 损坏则自动执行 leveldb.Recover
+			CompactionCron string `default:"'@weekly'"`                // 定时压缩. 默认值按 yaml 解析, @ 开头需要加引号
+			BackupCron     string `default:"'@daily'"`                 // 定时在线备份
+			BackupDir      string `default:"/etc/ao-space/did/backup"` // 在线备份目录, 每次备份生成一个子目录
+			BackupKeep     int    `default:"3"`                        // 保留的备份个数
 		}
 
 		SnNumberModelLength  int    `default:"3"`   // sn 序号最前面表示型号的字符长度
@@ -217,6 +319,15 @@ var Config = struct {
 		DefaultListenAddr                string `default:":5678"`
 		DockerLocalListenAddr            string `default:"172.17.0.1:5680"` // TODO: 这里应该动态获取. 为了快速开发需要，暂时先固定这样. 多块 docker 网卡时可能会有问题.
 		DockerLocalListenAddrRunInDocker string `default:":5680"`           // 在容器中运行时，暴露给网关等容器调用。
+
+		InternalMTLS struct {
+			Enable          bool   `default:"false"`                                                                          // 内部接口(docker 网桥)是否启用双向 TLS 认证
+			CADir           string `default:"/etc/ao-space/internal-ca/"`                                                     // 本地 CA 及服务端证书存储目录
+			ClientCertDir   string `default:"/etc/ao-space/internal-ca/clients/"`                                             // 各容器客户端证书存储目录, 按容器名分子目录
+			ClientMountPath string `default:"/etc/ao-space-agent-client"`                                                     // 客户端证书挂载到容器内的目录
+			Clients         string `default:"aospace-gateway,aospace-nginx,aospace-fileapi,aonetwork-client,aospace-upgrade"` // 需要签发客户端证书的容器名, 逗号分隔
+			CertValidDays   int    `default:"365"`                                                                            // 签发证书的有效期(天)
+		}
 	}
 
 	NetworkCheck struct {
@@ -307,6 +418,12 @@ var Config = struct {
 		LatestVersionV2 struct {
 			Path string `default:"/v2/service/packages/box/latest"`
 		}
+		BoxPubKey struct {
+			Path string `default:"/v2/platform/boxes/{box_uuid}/pubkey"` // 设备密钥轮换后向平台重新登记公钥
+		}
+		DNSRecord struct {
+			Path string `default:"/v2/platform/boxes/{box_uuid}/dns-records"` // ACME DNS-01 验证时添加/删除 TXT 记录
+		}
 	}
 
 	GateWay struct {
@@ -371,6 +488,10 @@ var Config = struct {
 
 	GTClient struct {
 		ConfigPath string `default:"/etc/ao-space/gt/aonetwork-client.yml"`
+		// gt client 的状态接口, 返回 json {"connected": true}. 为空时只返回容器状态和流量, 不返回是否已连上服务器
+		StatusUrl string
+		// GET /network/config 返回的 gt client 状态缓存时间, 避免每次查询容器和流量. GET /network/tunnel 总是实时查询
+		StatusCacheSeconds int `default:"30"`
 	}
 
 	Docker struct {
@@ -453,6 +574,8 @@ func modifyConfigWhenRunInDocker() {
 	// 修改保存路径。
 	// 新增路径的配置项时，如果docker 中运行时, 需要在这里修改默认路径 !!!
 	if runInDocker {
+		Config.Box.Keystore.Enable = Config.Box.Keystore.Enable && Config.Box.Keystore.EnableInDocker
+
 		p := []*string{
 			&Config.Log.AoLogDirBase,
 			&Config.Log.Path,
@@ -472,6 +595,9 @@ func modifyConfigWhenRunInDocker() {
 			&Config.Box.PublicSharedInfoFile,
 			&Config.Box.BoxKey.RsaKeyFile,
 			&Config.Box.BoxKey.RsaPubKeyFile,
+			&Config.Box.SecurityChipEmulator.SealedKeyFile,
+			&Config.Box.BoxKey.PreviousKeyInfoFile,
+			&Config.Box.AgentTokenRecordFile,
 			&Config.Box.Disk.DiskInitialInfoFile,
 			&Config.Box.Disk.DeviceUuidRecordFile,
 			&Config.Box.Disk.DiskSharedInfoFile,
@@ -480,6 +606,8 @@ func modifyConfigWhenRunInDocker() {
 			&Config.Box.ClientKey.SharedSecret,
 			&Config.Box.UpgradeConfig.SettingsFile,
 			&Config.Box.Cert.CertDir,
+			&Config.Web.InternalMTLS.CADir,
+			&Config.Web.InternalMTLS.ClientCertDir,
 			&Config.Docker.ComposeFile,
 			&Config.Docker.CustomComposeFile,
 			&Config.RunTime.BasePath,
@@ -488,7 +616,14 @@ func modifyConfigWhenRunInDocker() {
 			&Config.Box.Disk.NoDisksFileStoragePath,
 			&Config.Box.Disk.NoDisksFileStoragePathDockerDeploy,
 			&Config.GTClient.ConfigPath,
-			&Config.Box.DID.RootPath}
+			&Config.Box.DID.RootPath,
+			&Config.Box.DID.BackupDir,
+			&Config.Box.Cert.LanCA.RootKeyFile,
+			&Config.Box.Cert.LanCA.RootCertFile,
+			&Config.Box.Cert.Inventory.PlatformCABundle,
+			&Config.Box.Cert.Inventory.NotifiedRecordFile,
+			&Config.Box.Network.ApplySnapshotDir,
+			&Config.Box.Network.Resolved.LinkConfigFile}
 
 		for _, v := range p {
 			*v = SpaceMountPath + *v
@@ -0,0 +1,192 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package did
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+const (
+	TypeVerifiableCredential   = "VerifiableCredential"
+	TypeVerifiablePresentation = "VerifiablePresentation"
+
+	ProofTypeRsaSignature2018   = "RsaSignature2018"
+	ProofPurposeAssertionMethod = "assertionMethod"
+	ProofPurposeAuthentication  = "authentication"
+)
+
+// jws 头(RFC 7797 detached payload). RsaSignature2018 规范建议 PS256,
+// 这里使用 RS256(RSA PKCS#1 v1.5 + SHA256), 与设备密钥、加密芯片的签名方式一致.
+var jwsHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"RS256","b64":false,"crit":["b64"]}`))
+
+// Proof Linked Data Proof.
+type Proof struct {
+	Type               string `json:"type"`
+	Created            string `json:"created"`
+	VerificationMethod string `json:"verificationMethod"`
+	ProofPurpose       string `json:"proofPurpose"`
+	Challenge          string `json:"challenge,omitempty"`
+	Domain             string `json:"domain,omitempty"`
+	JWS                string `json:"jws,omitempty"`
+}
+
+// Credential W3C Verifiable Credential.
+type Credential struct {
+	Context           []interface{}          `json:"@context"`
+	ID                string                 `json:"id,omitempty"`
+	Type              []string               `json:"type"`
+	Issuer            string                 `json:"issuer"`
+	IssuanceDate      string                 `json:"issuanceDate"`
+	ExpirationDate    string                 `json:"expirationDate,omitempty"`
+	CredentialSubject map[string]interface{} `json:"credentialSubject"`
+	Proof             *Proof                 `json:"proof,omitempty"`
+}
+
+// Presentation W3C Verifiable Presentation.
+type Presentation struct {
+	Context              []interface{} `json:"@context"`
+	ID                   string        `json:"id,omitempty"`
+	Type                 []string      `json:"type"`
+	Holder               string        `json:"holder,omitempty"`
+	VerifiableCredential []*Credential `json:"verifiableCredential,omitempty"`
+	Proof                *Proof        `json:"proof,omitempty"`
+}
+
+// SignFunc 签名函数, 对 data 计算 SHA256 后做 RSA PKCS#1 v1.5 签名.
+type SignFunc func(data []byte) ([]byte, error)
+
+// Sign 生成 proof. proof 中除 JWS 外的字段由调用方填写.
+func (c *Credential) Sign(proof *Proof, sign SignFunc) error {
+	c.Proof = nil
+	jws, err := createJWS(c, proof, sign)
+	if err != nil {
+		return err
+	}
+	proof.JWS = jws
+	c.Proof = proof
+	return nil
+}
+
+// Sign 生成 proof. 包含的凭证需要已经签名.
+func (p *Presentation) Sign(proof *Proof, sign SignFunc) error {
+	p.Proof = nil
+	jws, err := createJWS(p, proof, sign)
+	if err != nil {
+		return err
+	}
+	proof.JWS = jws
+	p.Proof = proof
+	return nil
+}
+
+// SplitProof 从 JSON-LD 文档(凭证或展示)中取出 proof, 返回 proof 和去掉 proof 的文档.
+func SplitProof(doc map[string]interface{}) (*Proof, map[string]interface{}, error) {
+	v, ok := doc["proof"]
+	if !ok {
+		return nil, nil, fmt.Errorf("proof not found")
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, nil, err
+	}
+	proof := &Proof{}
+	if err := json.Unmarshal(b, proof); err != nil {
+		return nil, nil, fmt.Errorf("invalid proof, err:%v", err)
+	}
+	unsigned := make(map[string]interface{}, len(doc))
+	for k, v := range doc {
+		if k != "proof" {
+			unsigned[k] = v
+		}
+	}
+	return proof, unsigned, nil
+}
+
+// VerifyProof 使用公钥校验 proof.
+func VerifyProof(unsigned interface{}, proof *Proof, pub *rsa.PublicKey) error {
+	if proof.Type != ProofTypeRsaSignature2018 {
+		return fmt.Errorf("unsupported proof type %v", proof.Type)
+	}
+	parts := strings.Split(proof.JWS, ".")
+	if len(parts) != 3 || len(parts[1]) > 0 {
+		return fmt.Errorf("invalid jws")
+	}
+	if parts[0] != jwsHeader {
+		return fmt.Errorf("unsupported jws header")
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("invalid jws signature, err:%v", err)
+	}
+	data, err := verifyData(unsigned, proof)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(append([]byte(jwsHeader+"."), data...))
+	if err := rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig); err != nil {
+		return fmt.Errorf("invalid signature, err:%v", err)
+	}
+	return nil
+}
+
+func createJWS(unsigned interface{}, proof *Proof, sign SignFunc) (string, error) {
+	data, err := verifyData(unsigned, proof)
+	if err != nil {
+		return "", err
+	}
+	sig, err := sign(append([]byte(jwsHeader+"."), data...))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign, err:%v", err)
+	}
+	return jwsHeader + ".." + base64.RawURLEncoding.EncodeToString(sig), nil
+}
+
+// verifyData 按 Linked Data Proofs 计算待签名数据: SHA256(规范化的 proof 选项) || SHA256(规范化的文档).
+func verifyData(unsigned interface{}, proof *Proof) ([]byte, error) {
+	options := *proof
+	options.JWS = ""
+	b, err := json.Marshal(&options)
+	if err != nil {
+		return nil, err
+	}
+	optionsDoc := make(map[string]interface{})
+	if err := json.Unmarshal(b, &optionsDoc); err != nil {
+		return nil, err
+	}
+	optionsDoc["@context"] = CredentialsContext
+
+	normalizedOptions, err := normalize(optionsDoc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to normalize proof options, err:%v", err)
+	}
+	normalizedDoc, err := normalize(unsigned)
+	if err != nil {
+		return nil, fmt.Errorf("failed to normalize document, err:%v", err)
+	}
+	// 没有 @context 或者上下文无法识别时规范化结果为空, 签名将不覆盖任何内容.
+	if len(normalizedDoc) < 1 || len(normalizedOptions) < 1 {
+		return nil, fmt.Errorf("empty normalized document")
+	}
+
+	h1 := sha256.Sum256(normalizedOptions)
+	h2 := sha256.Sum256(normalizedDoc)
+	return append(h1[:], h2[:]...), nil
+}
@@ -342,6 +342,18 @@ func (ol *offlineLoader) init() {
 		ContextURL:  extV1Context,
 		Document:    extCtx,
 	}
+	credentials, _ := ld.DocumentFromReader(bytes.NewReader([]byte(credentialsV1)))
+	ol.list[CredentialsContext] = &ld.RemoteDocument{
+		DocumentURL: CredentialsContext,
+		ContextURL:  CredentialsContext,
+		Document:    credentials,
+	}
+	aospaceCredentials, _ := ld.DocumentFromReader(bytes.NewReader([]byte(aospaceCredentialsV1)))
+	ol.list[AOSpaceCredentialsContext] = &ld.RemoteDocument{
+		DocumentURL: AOSpaceCredentialsContext,
+		ContextURL:  AOSpaceCredentialsContext,
+		Document:    aospaceCredentials,
+	}
 }
 
 func (ol *offlineLoader) LoadDocument(u string) (*ld.RemoteDocument, error) {
@@ -0,0 +1,123 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"agent/biz/model/did/leveldb"
+	backupservice "agent/biz/service/did/backup"
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const envBackupPassphrase = "AOSPACE_BACKUP_PASSPHRASE"
+
+var backupFile string
+var backupPassphraseFile string
+var backupOverwrite bool
+
+// DidBackupCmd 导出、恢复 DID 备份. leveldb 同时只能被一个进程打开, 需要先停止 system-agent 服务.
+var DidBackupCmd = &cobra.Command{
+	Use:   "did-backup",
+	Short: "export or restore encrypted backup of did documents and keys",
+	Run: func(cmd *cobra.Command, args []string) {
+		cmd.Help()
+		GracefullExit()
+	},
+}
+
+var didBackupExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "export did documents and keys to --file",
+	Run: func(cmd *cobra.Command, args []string) {
+		passphrase := readBackupPassphrase()
+		openDidStore()
+		archive, count, err := backupservice.Export(passphrase)
+		leveldb.CloseDB()
+		if err != nil {
+			fmt.Printf("failed to export, err:%v\n", err)
+			os.Exit(1)
+		}
+		if err := os.WriteFile(backupFile, archive, 0600); err != nil {
+			fmt.Printf("failed to write %v, err:%v\n", backupFile, err)
+			os.Exit(1)
+		}
+		fmt.Printf("exported %v dids to %v\n", count, backupFile)
+		GracefullExit()
+	},
+}
+
+var didBackupRestoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "validate and import did backup from --file",
+	Run: func(cmd *cobra.Command, args []string) {
+		archive, err := os.ReadFile(backupFile)
+		if err != nil {
+			fmt.Printf("failed to read %v, err:%v\n", backupFile, err)
+			os.Exit(1)
+		}
+		passphrase := readBackupPassphrase()
+		openDidStore()
+		dids, err := backupservice.Restore(archive, passphrase, backupOverwrite)
+		leveldb.CloseDB()
+		if err != nil {
+			fmt.Printf("failed to restore, err:%v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("restored dids: %v\n", strings.Join(dids, ", "))
+		GracefullExit()
+	},
+}
+
+// readBackupPassphrase 依次从 --passphrase-file、环境变量、标准输入读取恢复口令.
+func readBackupPassphrase() string {
+	if len(backupPassphraseFile) > 0 {
+		b, err := os.ReadFile(backupPassphraseFile)
+		if err != nil {
+			fmt.Printf("failed to read %v, err:%v\n", backupPassphraseFile, err)
+			os.Exit(1)
+		}
+		return strings.TrimRight(string(b), "\r\n")
+	}
+	if passphrase := os.Getenv(envBackupPassphrase); len(passphrase) > 0 {
+		return passphrase
+	}
+	fmt.Print("recovery passphrase: ")
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && len(line) < 1 {
+		fmt.Printf("\nfailed to read passphrase, err:%v\n", err)
+		os.Exit(1)
+	}
+	return strings.TrimRight(line, "\r\n")
+}
+
+func openDidStore() {
+	if err := leveldb.OpenDB(); err != nil {
+		fmt.Printf("failed to open did store (is system-agent running?), err:%v\n", err)
+		os.Exit(1)
+	}
+}
+
+func init() {
+	DidBackupCmd.PersistentFlags().StringVar(&backupFile, "file", "did-backup.json", "backup archive file")
+	DidBackupCmd.PersistentFlags().StringVar(&backupPassphraseFile, "passphrase-file", "",
+		"file containing recovery passphrase, otherwise read from $"+envBackupPassphrase+" or stdin")
+	didBackupRestoreCmd.Flags().BoolVar(&backupOverwrite, "overwrite", false, "replace dids already on this device")
+	DidBackupCmd.AddCommand(didBackupExportCmd, didBackupRestoreCmd)
+	AgentCmd.AddCommand(DidBackupCmd)
+}
@@ -30,10 +30,16 @@ import (
 	"agent/biz/model/clientinfo"
 	"agent/biz/model/device"
 	"agent/biz/model/did/leveldb"
+	"agent/biz/service/certificate"
+	deviceservice "agent/biz/service/device"
+	didmaintenance "agent/biz/service/did/maintenance"
+	"agent/biz/service/mdns"
+	networkservice "agent/biz/service/network"
 	"agent/biz/service/platform"
 	"agent/biz/service/upgrade"
 	"agent/biz/web"
 	"agent/utils/logger"
+	"agent/utils/securitychip"
 	"fmt"
 	"os"
 	"os/signal"
@@ -60,12 +66,29 @@ func main() {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	// 重启前未确认的网络配置需先回滚, 之后再获取局域网 ip 等信息
+	networkservice.RecoverNetworkApply()
+	// 局域网证书需要在生成配对二维码(附带根证书指纹)之前准备好
+	certificate.InitCert()
 	device.InitDeviceInfo()
+	if config.Config.Box.SecurityChipEmulator.Enable {
+		if err := securitychip.Start(); err != nil {
+			logger.AppLogger().Errorf("failed to start security chip emulator, err:%v", err)
+		}
+	}
 	device.InitDeviceKey()
 	clientinfo.InitClientInfo()
 	go platform.InitPlatformAbility()
 	serviceswithplatform.RetryUnfinishedStatus()
 	upgrade.CronForUpgrade()
+
+	// 在 web 服务启动之前打开 DID 数据库, 避免请求访问到未打开的数据库
+	if err := leveldb.OpenDB(); err != nil {
+		fmt.Printf("\nFailed leveldb.OpenDB, err:%v\n", err)
+		os.Exit(0)
+	}
+	didmaintenance.Start()
+
 	// 启动 web/http api 服务
 	web.Start()
 
@@ -79,10 +102,14 @@ func main() {
 	// 日志目录监控
 	log_dir_monitor.Start()
 
-	if err := leveldb.OpenDB(); err != nil {
-		fmt.Printf("\nFailed leveldb.OpenDB, err:%v\n", err)
-		os.Exit(0)
-	}
+	deviceservice.CronForKeyRotation()
+	certificate.CronForLanCert()
+	certificate.CronForACME()
+	certificate.CronForCertInventory()
+	mdns.Start()
+	networkservice.StartNetworkWatcher()
+	networkservice.StartPortMapping()
+	networkservice.StartFailover()
 
 	quitChan := make(chan os.Signal)
 	signal.Notify(quitChan, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM,
@@ -76,9 +76,8 @@ func GetContentUpgradeComposeFile() []byte {
 	return current_yml_content
 }
 
-func disposeDockerComposeWhenRunInDocker(content_docker_compose []byte) []byte {
-
-	// 从环境变量中获取 docker-compose.yml 中的 volumes 宿主机的挂载目录.
+// getHostDataPath 从环境变量中获取 docker-compose.yml 中的 volumes 宿主机的挂载目录.
+func getHostDataPath() string {
 	hostDataPath := "/run/desktop/mnt/host/c/aospace" // 默认目录, macOS/Linux 必须要用户传入.
 	envkey := config.Config.Box.RunInDocker.AoSpaceDataDirEnv
 	dataDir := os.Getenv(envkey)
@@ -86,7 +85,35 @@ func disposeDockerComposeWhenRunInDocker(content_docker_compose []byte) []byte {
 		dataDir = strings.ReplaceAll(dataDir, "\\", "/")
 		hostDataPath = dataDir
 	}
-	hostDataPath = fileutil.AddPathSepIfNeed(hostDataPath)
+	return fileutil.AddPathSepIfNeed(hostDataPath)
+}
+
+// GetVolumeHostPath 返回 agent 可见的路径 p 在 docker-compose.yml volumes 中对应的宿主机路径.
+// 容器中运行时, agent 中的路径带有 config.SpaceMountPath 前缀, 需要换成宿主机的数据目录.
+func GetVolumeHostPath(p string) string {
+	if !device_ability.GetAbilityModel().RunInDocker {
+		return p
+	}
+	p = strings.TrimPrefix(p, config.SpaceMountPath)
+	return getHostDataPath() + strings.TrimPrefix(p, "/")
+}
+
+// GetVolumeAgentPath 是 GetVolumeHostPath 的逆过程, 返回 docker-compose.yml volumes 中宿主机路径 p 在 agent 中可见的路径.
+// 不在宿主机数据目录下的路径 agent 无法访问, 原样返回.
+func GetVolumeAgentPath(p string) string {
+	if !device_ability.GetAbilityModel().RunInDocker {
+		return p
+	}
+	hostDataPath := getHostDataPath()
+	if !strings.HasPrefix(p, hostDataPath) {
+		return p
+	}
+	return config.SpaceMountPath + "/" + strings.TrimPrefix(p, hostDataPath)
+}
+
+func disposeDockerComposeWhenRunInDocker(content_docker_compose []byte) []byte {
+
+	hostDataPath := getHostDataPath()
 	isWindowsHost := strings.Contains(hostDataPath, "/run/desktop/mnt/host")
 
 	// 挂载目录修改
@@ -0,0 +1,56 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"agent/config"
+	"agent/utils/securitychip"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+var emulatorSockAddr string
+var emulatorKeyFile string
+
+// SecurityChipEmulatorCmd 以独立进程方式运行软件加密芯片, 例如在虚拟机或容器中代替 eulixspace-security-agent.
+var SecurityChipEmulatorCmd = &cobra.Command{
+	Use:   "security-chip-emulator",
+	Short: "run software security chip on a unix socket",
+	Run: func(cmd *cobra.Command, args []string) {
+		secret, err := securitychip.MachineSecret()
+		if err != nil {
+			fmt.Printf("failed MachineSecret, err:%v\n", err)
+			os.Exit(1)
+		}
+		e, err := securitychip.NewEmulator(emulatorKeyFile, secret)
+		if err != nil {
+			fmt.Printf("failed NewEmulator, err:%v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("security chip emulator listening on %v\n", emulatorSockAddr)
+		if err := e.ServeUnix(emulatorSockAddr); err != nil {
+			fmt.Printf("failed ServeUnix, err:%v\n", err)
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	SecurityChipEmulatorCmd.Flags().StringVar(&emulatorSockAddr, "sock", config.Config.Box.SecurityChipAgentSockAddr, "unix socket to listen on")
+	SecurityChipEmulatorCmd.Flags().StringVar(&emulatorKeyFile, "key", config.Config.Box.SecurityChipEmulator.SealedKeyFile, "sealed key file")
+	AgentCmd.AddCommand(SecurityChipEmulatorCmd)
+}
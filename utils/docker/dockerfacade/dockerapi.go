@@ -96,6 +96,10 @@ func (dock *DockerFacade) RestartContainer(containerName string) error {
 	return dengineapi.RestartContainer(containerName)
 }
 
+func (dock *DockerFacade) ContainerStatus(containerId string) (*dockermodel.ContainerStatus, error) {
+	return dengineapi.ContainerStatus(containerId)
+}
+
 func (dock *DockerFacade) CreateNetwork(networkName string) error {
 	stdOutput, errOutput := dock.ChansReader()
 	return dcomposeapi.CreateNetwork(networkName, stdOutput, errOutput)
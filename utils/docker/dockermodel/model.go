@@ -69,3 +69,12 @@ type DockerContainer struct {
 	Names      []string
 	Created    int64
 }
+
+// ContainerStatus 容器运行状态和网络流量
+type ContainerStatus struct {
+	State        string // running, restarting, exited ...
+	StartedAt    string
+	RestartCount int
+	RxBytes      uint64 // 所有网卡接收字节数之和
+	TxBytes      uint64
+}
@@ -16,7 +16,9 @@ package dengineapi
 
 import (
 	"agent/utils/docker/dockermodel"
+	"bytes"
 	"context"
+	"encoding/json"
 	"fmt"
 	"github.com/docker/docker/api/types/filters"
 	"strings"
@@ -27,9 +29,12 @@ import (
 	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
+	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
 )
 
+const execTimeout = 60 * time.Second
+
 func ListContainers(cli *client.Client) ([]*dockermodel.DockerContainer, error) {
 
 	var err error
@@ -113,6 +118,7 @@ func CreateContainer(cli *client.Client, req *CreateContainerReq) (string, error
 	return body.ID, nil
 }
 
+// Exec 在容器中执行命令并等待结束, 退出码不为 0 时返回错误, 错误信息包含命令输出.
 func Exec(cli *client.Client, containerId string, cmd []string) error {
 	var err error
 	if cli == nil {
@@ -122,19 +128,41 @@ func Exec(cli *client.Client, containerId string, cmd []string) error {
 		}
 		defer cli.Close()
 	}
-	execId, err := cli.ContainerExecCreate(context.Background(), containerId, types.ExecConfig{
-		Cmd: cmd,
+	ctx, cancel := context.WithTimeout(context.Background(), execTimeout)
+	defer cancel()
+
+	execId, err := cli.ContainerExecCreate(ctx, containerId, types.ExecConfig{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
 	})
 	if err != nil {
 		return err
 	}
-	err = cli.ContainerExecStart(context.Background(), execId.ID, types.ExecStartCheck{
+	resp, err := cli.ContainerExecAttach(ctx, execId.ID, types.ExecStartCheck{
 		Detach: false,
 		Tty:    false,
 	})
 	if err != nil {
 		return err
 	}
+	defer resp.Close()
+
+	// 读到 EOF 即命令结束
+	var output bytes.Buffer
+	if _, err := stdcopy.StdCopy(&output, &output, resp.Reader); err != nil {
+		return fmt.Errorf("failed to read output of %v, err:%v", cmd, err)
+	}
+	inspect, err := cli.ContainerExecInspect(ctx, execId.ID)
+	if err != nil {
+		return err
+	}
+	if inspect.Running {
+		return fmt.Errorf("%v still running", cmd)
+	}
+	if inspect.ExitCode != 0 {
+		return fmt.Errorf("%v exit code %v, output:%v", cmd, inspect.ExitCode, strings.TrimSpace(output.String()))
+	}
 	return nil
 }
 
@@ -196,3 +224,42 @@ func RestartContainer(containerId string) error {
 
 	return nil
 }
+
+// ContainerStatus 查询容器状态, 容器运行时再查询网络流量
+func ContainerStatus(containerId string) (*dockermodel.ContainerStatus, error) {
+	cli, err := NewClient()
+	if err != nil {
+		return nil, fmt.Errorf("failed NewClient, err:%v", err)
+	}
+	defer cli.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	info, err := cli.ContainerInspect(ctx, containerId)
+	if err != nil {
+		return nil, err
+	}
+	status := &dockermodel.ContainerStatus{RestartCount: info.RestartCount}
+	if info.State != nil {
+		status.State = info.State.Status
+		status.StartedAt = info.State.StartedAt
+	}
+	if info.State == nil || !info.State.Running {
+		return status, nil
+	}
+
+	stats, err := cli.ContainerStats(ctx, containerId, false)
+	if err != nil {
+		return nil, err
+	}
+	defer stats.Body.Close()
+	var s types.StatsJSON
+	if err := json.NewDecoder(stats.Body).Decode(&s); err != nil {
+		return nil, fmt.Errorf("failed to decode container stats, err:%v", err)
+	}
+	for _, n := range s.Networks {
+		status.RxBytes += n.RxBytes
+		status.TxBytes += n.TxBytes
+	}
+	return status, nil
+}
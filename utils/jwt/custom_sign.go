@@ -16,6 +16,12 @@ package jwt
 
 import (
 	"crypto"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	utilshttp "agent/utils/network/http"
 
 	"github.com/dungeonsnd/gocom/encrypt/encoding"
 	"github.com/golang-jwt/jwt/v5"
@@ -79,6 +85,9 @@ func signFromSecurityChip(data []byte) (string, error) {
 		// fmt.Printf("enc failed, err:%v \n", err)
 		return "", err
 	}
+	if len(rsp.Results.Output) < 1 {
+		return "", fmt.Errorf("security chip sign failed, message:%v", rsp.Message)
+	}
 	return rsp.Results.Output, nil
 }
 
@@ -90,22 +99,39 @@ func verifyFromSecurityChip(data []byte, signature string) error {
 		Signature string `json:"signature"`
 	}
 
-	type Result struct {
-		Output string `json:"output"`
+	parms := &Request{Input: encoding.Base64Encode(data), Signature: encoding.Base64Encode([]byte(signature))}
+	var rsp verifyResponse
+	_, httpRsp, _, err := utilshttp.SendJsonWithHeaders("POST", url, parms, nil, &rsp)
+	if err != nil {
+		return fmt.Errorf("security chip verify request failed, err:%v", err)
 	}
+	return rsp.check(httpRsp.StatusCode)
+}
 
-	type Response struct {
-		RequestId string `json:"requestId, omitempty"`
-		Message   string `json:"message, omitempty"`
-		Results   Result `json:"results, omitempty"`
-	}
+type verifyResponse struct {
+	RequestId string `json:"requestId"`
+	Message   string `json:"message"`
+	Results   struct {
+		Output json.RawMessage `json:"output"`
+	} `json:"results"`
+}
 
-	parms := &Request{Input: encoding.Base64Encode(data), Signature: encoding.Base64Encode([]byte(signature))}
-	var rsp Response
-	err := PostHttpRequest(url, parms, nil, &rsp)
-	if err != nil {
-		// fmt.Printf("enc failed, err:%v \n", err)
-		return err
+// check 判断加密芯片的校验结果. output 可能是布尔值, 也可能是字符串 "true"/"false"(模拟芯片), 两种格式都解析.
+// 只有 http 状态码为 200 且 output 明确为 true 时才认为校验通过, 其他情况(包括 output 为空)都视为失败.
+func (rsp *verifyResponse) check(statusCode int) error {
+	if statusCode != http.StatusOK {
+		return fmt.Errorf("security chip verify failed, status:%v, message:%v", statusCode, rsp.Message)
+	}
+	var ok bool
+	if err := json.Unmarshal(rsp.Results.Output, &ok); err != nil {
+		var s string
+		if err := json.Unmarshal(rsp.Results.Output, &s); err != nil {
+			return fmt.Errorf("security chip verify failed, invalid output %s, message:%v", rsp.Results.Output, rsp.Message)
+		}
+		ok = strings.EqualFold(strings.TrimSpace(s), "true")
+	}
+	if !ok {
+		return fmt.Errorf("security chip verify failed, output:%s, message:%v", rsp.Results.Output, rsp.Message)
 	}
 	return nil
 }
@@ -0,0 +1,56 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package jwt
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVerifyFromSecurityChipResponse(t *testing.T) {
+	cases := []struct {
+		name   string
+		status int
+		body   string
+		ok     bool
+	}{
+		{"chip bool true", http.StatusOK, `{"requestId":"1","message":"OK","results":{"output":true}}`, true},
+		{"chip bool false", http.StatusOK, `{"requestId":"1","message":"verify failed","results":{"output":false}}`, false},
+		{"emulator string true", http.StatusOK, `{"requestId":"1","message":"OK","results":{"output":"true"}}`, true},
+		{"emulator string false", http.StatusBadRequest, `{"requestId":"1","message":"verify failed","results":{"output":"false"}}`, false},
+		{"empty output", http.StatusOK, `{"requestId":"1","message":"OK","results":{"output":""}}`, false},
+		{"missing output", http.StatusOK, `{"requestId":"1","message":"OK"}`, false},
+		{"error status", http.StatusInternalServerError, `{"requestId":"1","message":"chip error","results":{"output":true}}`, false},
+	}
+	for _, c := range cases {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != verifyReqUrl {
+				t.Errorf("%v: unexpected path %v", c.name, r.URL.Path)
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(c.status)
+			w.Write([]byte(c.body))
+		}))
+		old := host
+		SetSignHost(srv.URL)
+		err := verifyFromSecurityChip([]byte("data"), "sig")
+		SetSignHost(old)
+		srv.Close()
+		if (err == nil) != c.ok {
+			t.Errorf("%v: err:%v", c.name, err)
+		}
+	}
+}
@@ -0,0 +1,230 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package keystore 密钥材料的加密存储.
+// 有加密芯片时由芯片对固定标签的签名派生加密密钥, 否则使用机器密钥. 数据复制到其他设备后无法解开.
+// 读取到旧版本保存的明文时原样返回, 并可按需重新加密保存(透明迁移).
+//
+// 容器中运行时机器密钥不绑定宿主机(见 MachineSecret), 默认不加密保存. 开启后如果重建容器导致无法解开,
+// DID 空间私钥需通过 /did/backup/restore 从备份恢复, 客户端私钥和共享密钥需要客户端重新配对.
+package keystore
+
+import (
+	"agent/config"
+	"agent/utils/logger"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// 加密数据格式: magic(4) | 密钥源(1) | Seal 的输出.
+var envelopeMagic = []byte{'A', 'O', 'K', '1'}
+
+const (
+	keystoreInfo    = "aospace-keystore"
+	chipSecretLabel = "aospace-keystore-chip-secret-v1"
+
+	sourceMachine byte = 'm'
+	sourceChip    byte = 'c'
+)
+
+const (
+	chipRetryMinInterval = 5 * time.Second
+	chipRetryMaxInterval = 5 * time.Minute
+)
+
+var (
+	chipSigner     func(data []byte) ([]byte, error) // 已验证可用的芯片签名函数
+	chipSignerLock sync.RWMutex
+
+	// 芯片暂时不可用时保存候选签名函数, 使用时按退避间隔重试, 芯片就绪后切换到芯片派生的密钥.
+	chipCandidate    func(data []byte) ([]byte, error)
+	chipRetryAt      time.Time
+	chipRetryBackoff time.Duration
+)
+
+// Enabled 是否加密保存密钥材料.
+func Enabled() bool {
+	return config.Config.Box.Keystore.Enable
+}
+
+// SetChipSigner 设置加密芯片签名函数, 之后新加密的数据使用芯片派生的密钥.
+// 芯片签名必须是确定性的(如 RSA PKCS#1 v1.5), 否则无法再次派生出相同的密钥, 此时继续使用机器密钥.
+// 芯片暂时不可用(签名失败)时返回错误, 之后每次加解密时按退避间隔重试, 不会一直使用机器密钥.
+func SetChipSigner(signer func(data []byte) ([]byte, error)) error {
+	chipSignerLock.Lock()
+	defer chipSignerLock.Unlock()
+	chipSigner, chipCandidate = nil, signer
+	chipRetryAt, chipRetryBackoff = time.Time{}, 0
+	return tryChipCandidate()
+}
+
+// tryChipCandidate 验证候选签名函数, 调用方需持有 chipSignerLock 写锁.
+func tryChipCandidate() error {
+	signer := chipCandidate
+	s1, err := signer([]byte(chipSecretLabel))
+	if err == nil {
+		var s2 []byte
+		if s2, err = signer([]byte(chipSecretLabel)); err == nil {
+			same := bytes.Equal(s1, s2)
+			Zeroize(s2)
+			if !same {
+				Zeroize(s1)
+				chipCandidate = nil // 不是确定性签名, 重试也没有用
+				return fmt.Errorf("security chip signature is not deterministic")
+			}
+		}
+		Zeroize(s1)
+	}
+	if err != nil {
+		chipRetryBackoff *= 2
+		if chipRetryBackoff < chipRetryMinInterval {
+			chipRetryBackoff = chipRetryMinInterval
+		} else if chipRetryBackoff > chipRetryMaxInterval {
+			chipRetryBackoff = chipRetryMaxInterval
+		}
+		chipRetryAt = time.Now().Add(chipRetryBackoff)
+		return fmt.Errorf("failed to sign with security chip, retry after %v, err:%v", chipRetryBackoff, err)
+	}
+
+	chipSigner, chipCandidate = signer, nil
+	logger.AppLogger().Infof("keystore, using security chip")
+	return nil
+}
+
+// activeChipSigner 返回可用的芯片签名函数. 芯片尚未就绪且已到重试时间时再次尝试.
+func activeChipSigner() func(data []byte) ([]byte, error) {
+	chipSignerLock.RLock()
+	signer, candidate, retryAt := chipSigner, chipCandidate, chipRetryAt
+	chipSignerLock.RUnlock()
+	if signer != nil || candidate == nil || time.Now().Before(retryAt) {
+		return signer
+	}
+
+	chipSignerLock.Lock()
+	defer chipSignerLock.Unlock()
+	if chipSigner == nil && chipCandidate != nil && !time.Now().Before(chipRetryAt) {
+		if err := tryChipCandidate(); err != nil {
+			logger.AppLogger().Warnf("keystore, security chip not ready, err:%v", err)
+		}
+	}
+	return chipSigner
+}
+
+func currentSource() byte {
+	if activeChipSigner() != nil {
+		return sourceChip
+	}
+	return sourceMachine
+}
+
+func secretOf(source byte) ([]byte, error) {
+	switch source {
+	case sourceMachine:
+		return MachineSecret()
+	case sourceChip:
+		signer := activeChipSigner()
+		if signer == nil {
+			return nil, fmt.Errorf("data sealed by security chip, but security chip not available")
+		}
+		return signer([]byte(chipSecretLabel))
+	default:
+		return nil, fmt.Errorf("unknown keystore source %q", source)
+	}
+}
+
+// IsProtected 判断 data 是否为 Protect 的输出.
+func IsProtected(data []byte) bool {
+	return len(data) > len(envelopeMagic) && bytes.Equal(data[:len(envelopeMagic)], envelopeMagic)
+}
+
+// Protect 加密 plain.
+func Protect(plain []byte) ([]byte, error) {
+	source := currentSource()
+	secret, err := secretOf(source)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := Seal(secret, keystoreInfo, plain)
+	Zeroize(secret)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(envelopeMagic)+1+len(sealed))
+	out = append(out, envelopeMagic...)
+	out = append(out, source)
+	return append(out, sealed...), nil
+}
+
+// Open 解密 Protect 的输出. data 不是加密数据(旧版本保存的明文)时原样返回, protected 为 false.
+func Open(data []byte) (plain []byte, protected bool, err error) {
+	if !IsProtected(data) {
+		return data, false, nil
+	}
+	secret, err := secretOf(data[len(envelopeMagic)])
+	if err != nil {
+		return nil, true, err
+	}
+	plain, err = Unseal(secret, keystoreInfo, data[len(envelopeMagic)+1:])
+	Zeroize(secret)
+	return plain, true, err
+}
+
+// WriteFile 保存 plain 到文件. protect 为 true 时加密保存.
+func WriteFile(path string, plain []byte, protect bool) error {
+	data := plain
+	if protect {
+		var err error
+		if data, err = Protect(plain); err != nil {
+			return fmt.Errorf("failed to protect %v, err:%v", path, err)
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return fmt.Errorf("failed to write %v, err:%v", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to rename %v, err:%v", tmp, err)
+	}
+	return nil
+}
+
+// ReadFile 读取 WriteFile 保存的文件. 文件为明文且 protect 为 true 时重新加密保存.
+func ReadFile(path string, protect bool) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	plain, protected, err := Open(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %v, err:%v", path, err)
+	}
+	if !protected && protect {
+		if err := WriteFile(path, plain, true); err != nil {
+			logger.AppLogger().Warnf("keystore, failed to migrate plaintext file %v, err:%v", path, err)
+		} else {
+			logger.AppLogger().Infof("keystore, plaintext file %v migrated", path)
+		}
+	}
+	return plain, nil
+}
@@ -0,0 +1,127 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keystore
+
+import (
+	"crypto/rand"
+	"fmt"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	KDFArgon2id = "argon2id"
+	KDFScrypt   = "scrypt"
+
+	passphraseKeyLen = 32
+
+	// 解密时参数的上限, 避免伪造的参数耗尽内存或 CPU.
+	maxArgon2Memory = 1024 * 1024 // KiB
+	maxArgon2Time   = 16
+	maxScryptN      = 1 << 20
+)
+
+// PassphraseKDF 由口令派生密钥的算法和参数, 与密文一起保存.
+type PassphraseKDF struct {
+	Name    string `json:"name"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time,omitempty"`   // argon2id
+	Memory  uint32 `json:"memory,omitempty"` // argon2id, KiB
+	Threads uint8  `json:"threads,omitempty"`
+	N       int    `json:"n,omitempty"` // scrypt
+	R       int    `json:"r,omitempty"`
+	P       int    `json:"p,omitempty"`
+}
+
+// PassphraseSealed 口令加密的数据, 密文为 AES-256-GCM.
+type PassphraseSealed struct {
+	KDF        PassphraseKDF `json:"kdf"`
+	Cipher     string        `json:"cipher"`
+	Nonce      []byte        `json:"nonce"`
+	Ciphertext []byte        `json:"ciphertext"`
+}
+
+// DefaultArgon2idKDF 返回使用新随机 salt 的默认 argon2id 参数.
+func DefaultArgon2idKDF() (PassphraseKDF, error) {
+	salt := make([]byte, sealSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return PassphraseKDF{}, err
+	}
+	return PassphraseKDF{Name: KDFArgon2id, Salt: salt, Time: 3, Memory: 64 * 1024, Threads: 4}, nil
+}
+
+func (k *PassphraseKDF) deriveKey(passphrase []byte) ([]byte, error) {
+	if len(k.Salt) < sealSaltLen {
+		return nil, fmt.Errorf("salt too short")
+	}
+	switch k.Name {
+	case KDFArgon2id:
+		if k.Time < 1 || k.Time > maxArgon2Time || k.Memory < 8 || k.Memory > maxArgon2Memory || k.Threads < 1 {
+			return nil, fmt.Errorf("invalid argon2id parameters")
+		}
+		return argon2.IDKey(passphrase, k.Salt, k.Time, k.Memory, k.Threads, passphraseKeyLen), nil
+	case KDFScrypt:
+		if k.N < 2 || k.N > maxScryptN || k.R < 1 || k.P < 1 {
+			return nil, fmt.Errorf("invalid scrypt parameters")
+		}
+		return scrypt.Key(passphrase, k.Salt, k.N, k.R, k.P, passphraseKeyLen)
+	default:
+		return nil, fmt.Errorf("unsupported kdf %v", k.Name)
+	}
+}
+
+// SealWithPassphrase 使用口令加密 plain, aad 为需要认证但不加密的数据(例如文件头).
+func SealWithPassphrase(kdf PassphraseKDF, passphrase, aad, plain []byte) (*PassphraseSealed, error) {
+	key, err := kdf.deriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	Zeroize(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	return &PassphraseSealed{KDF: kdf, Cipher: "AES-256-GCM", Nonce: nonce,
+		Ciphertext: aead.Seal(nil, nonce, plain, aad)}, nil
+}
+
+// OpenWithPassphrase 解密 SealWithPassphrase 的输出. 口令错误或数据被篡改时返回错误.
+func OpenWithPassphrase(s *PassphraseSealed, passphrase, aad []byte) ([]byte, error) {
+	if s.Cipher != "AES-256-GCM" {
+		return nil, fmt.Errorf("unsupported cipher %v", s.Cipher)
+	}
+	key, err := s.KDF.deriveKey(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	Zeroize(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(s.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce")
+	}
+	plain, err := aead.Open(nil, s.Nonce, s.Ciphertext, aad)
+	if err != nil {
+		return nil, fmt.Errorf("wrong passphrase or corrupted data")
+	}
+	return plain, nil
+}
@@ -0,0 +1,138 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package keystore
+
+import (
+	"agent/config"
+	"agent/utils/deviceid"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+// 密封数据格式: magic(4) | salt(16) | nonce(12) | AES-256-GCM 密文.
+// 加密密钥由密钥源(机器密钥或加密芯片)和 salt 经 HKDF-SHA256 派生, info 区分不同用途.
+var sealMagic = []byte{'A', 'O', 'S', '1'}
+
+const (
+	sealSaltLen = 16
+
+	machineIdFile = "/etc/machine-id"
+)
+
+// MachineSecret 返回本机的机器密钥, 由 /etc/machine-id 和设备 cpuid 组成.
+// 密封的文件复制到其他机器后无法解开. 容器中的 machine-id 来自镜像或容器本身, cpuid 文件与密封数据
+// 保存在同一数据目录中, 只能起到混淆作用.
+func MachineSecret() ([]byte, error) {
+	var secret []byte
+	if b, err := os.ReadFile(machineIdFile); err == nil {
+		secret = append(secret, []byte(strings.TrimSpace(string(b)))...)
+	}
+	productId, err := deviceid.GetProductId(config.Config.Box.CpuIdStoreFile)
+	if err != nil && len(secret) < 1 {
+		return nil, fmt.Errorf("failed to get machine secret, err:%v", err)
+	}
+	secret = append(secret, []byte(productId)...)
+	return secret, nil
+}
+
+func sealKey(secret, salt []byte, info string) ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(info)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// Seal 使用 secret 加密 plain.
+func Seal(secret []byte, info string, plain []byte) ([]byte, error) {
+	salt := make([]byte, sealSaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	key, err := sealKey(secret, salt, info)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	Zeroize(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	out := make([]byte, 0, len(sealMagic)+len(salt)+len(nonce)+len(plain)+aead.Overhead())
+	out = append(out, sealMagic...)
+	out = append(out, salt...)
+	out = append(out, nonce...)
+	return aead.Seal(out, nonce, plain, sealMagic), nil
+}
+
+// Unseal 使用 secret 解密 Seal 的输出.
+func Unseal(secret []byte, info string, sealed []byte) ([]byte, error) {
+	if !IsSealed(sealed) {
+		return nil, fmt.Errorf("invalid sealed data")
+	}
+	salt := sealed[len(sealMagic) : len(sealMagic)+sealSaltLen]
+	key, err := sealKey(secret, salt, info)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newGCM(key)
+	Zeroize(key)
+	if err != nil {
+		return nil, err
+	}
+	rest := sealed[len(sealMagic)+sealSaltLen:]
+	if len(rest) < aead.NonceSize() {
+		return nil, fmt.Errorf("invalid sealed data")
+	}
+	plain, err := aead.Open(nil, rest[:aead.NonceSize()], rest[aead.NonceSize():], sealMagic)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unseal, err:%v", err)
+	}
+	return plain, nil
+}
+
+// IsSealed 判断 data 是否为 Seal 的输出.
+func IsSealed(data []byte) bool {
+	return len(data) >= len(sealMagic)+sealSaltLen && bytes.Equal(data[:len(sealMagic)], sealMagic)
+}
+
+// Zeroize 清零内存中的密钥材料.
+func Zeroize(b []byte) {
+	for i := range b {
+		b[i] = 0
+	}
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,78 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"errors"
+	"sync"
+)
+
+// NetworkBackend 网络管理后端. 默认通过 D-Bus 调用 NetworkManager, 测试时可用 SetBackend 替换为 FakeBackend.
+type NetworkBackend interface {
+	// Devices 返回所有网卡及其当前激活的连接和 ip 信息
+	Devices() ([]*Device, error)
+	// Connection 返回 uuid 对应的连接配置
+	Connection(uuid string) (*Connection, error)
+	// ListWifi 返回附近的 wifi 热点, rescan 为 true 时先重新扫描
+	ListWifi(rescan bool) ([]*AccessPoint, error)
+	// ConnectWifi 连接 wifi, target 为 SSID 或 BSSID. 已保存同名连接时就地更新密码, 否则新建连接.
+	// 激活失败(如密码错误)时返回 ErrWifiActivationFailed, 并恢复原连接或删除新建的连接
+	ConnectWifi(target, password string) error
+	// SetWiredIp 删除有线网卡 iface 上原有的同名连接, 以 ipv4/ipv6 设置新建名为 iface 的连接并激活.
+	// ipv6.Method 为空时 ipv6 使用 Ipv6Method_Auto.
+	SetWiredIp(iface string, ipv4 Ipv4Config, ipv6 Ipv6Config) error
+	// SetConnectionIp 修改已有连接(如 wifi 连接)的 ip 设置并重新激活, 不影响 wifi 账号/密码.
+	// ipv6.Method 为空时保留连接原有的 ipv6 设置.
+	SetConnectionIp(uuid string, ipv4 Ipv4Config, ipv6 Ipv6Config) error
+	// DeleteConnection 删除名称或 uuid 为 idOrUuid 的连接
+	DeleteConnection(idOrUuid string) error
+	// ActivateConnection 激活 uuid 对应的连接
+	ActivateConnection(uuid string) error
+	// ReloadConnections 重新加载磁盘上的连接配置文件
+	ReloadConnections() error
+	// WifiProfiles 返回已保存的 wifi 配置, 按优先级从高到低排序
+	WifiProfiles() ([]*WifiProfile, error)
+	// SaveWifiProfile 新增或修改 SSID 对应的 wifi 配置, 不激活. 返回连接 uuid
+	SaveWifiProfile(cfg WifiProfileConfig) (string, error)
+	// SetWifiPriority 修改 wifi 配置的自动连接优先级和是否自动连接
+	SetWifiPriority(uuid string, priority int32, autoConnect bool) error
+	// SetDeviceRouteMetric 修改网卡当前使用的 ipv4/ipv6 路由度量值, -1 表示恢复默认.
+	// 只修改网卡已应用的配置, 不保存到连接配置中, 连接重新激活后恢复.
+	SetDeviceRouteMetric(iface string, metric int64) error
+}
+
+var (
+	ErrWifiActivationFailed = errors.New("wifi connection activation failed")
+	ErrConnectionNotFound   = errors.New("connection not found")
+	ErrWifiPasswordRequired = errors.New("wifi password is required")
+
+	backendMtx sync.RWMutex
+	backend    NetworkBackend = NewNMDBusBackend()
+)
+
+func Backend() NetworkBackend {
+	backendMtx.RLock()
+	defer backendMtx.RUnlock()
+	return backend
+}
+
+// SetBackend 替换网络管理后端, 返回原来的后端.
+func SetBackend(b NetworkBackend) NetworkBackend {
+	backendMtx.Lock()
+	defer backendMtx.Unlock()
+	old := backend
+	backend = b
+	return old
+}
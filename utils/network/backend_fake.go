@@ -0,0 +1,366 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+// FakeBackend 内存中的网络管理后端, 供测试使用. 各字段可在测试中直接设置和检查.
+type FakeBackend struct {
+	mtx sync.Mutex
+
+	DevicesList   []*Device
+	Connections   map[string]*Connection       // key 为 uuid
+	Ipv4Configs   map[string]Ipv4Config        // key 为连接 uuid, 记录设置过的 ipv4
+	Ipv6Configs   map[string]Ipv6Config        // key 为连接 uuid, 记录设置过的 ipv6
+	WifiConfigs   map[string]WifiProfileConfig // key 为连接 uuid, 记录 SaveWifiProfile/SetWifiPriority 保存的配置
+	RouteMetrics  map[string]int64             // key 为网卡名, 记录 SetDeviceRouteMetric 设置的非默认值
+	AccessPoints  []*AccessPoint
+	WifiPasswords map[string]string // SSID 对应的正确密码, 未设置的 SSID 任意密码都能连接
+	Activated     []string          // 依次激活过的连接 uuid
+	Reloaded      int               // ReloadConnections 的调用次数
+}
+
+func NewFakeBackend() *FakeBackend {
+	return &FakeBackend{
+		Connections:   map[string]*Connection{},
+		Ipv4Configs:   map[string]Ipv4Config{},
+		Ipv6Configs:   map[string]Ipv6Config{},
+		WifiConfigs:   map[string]WifiProfileConfig{},
+		RouteMetrics:  map[string]int64{},
+		WifiPasswords: map[string]string{},
+	}
+}
+
+func (f *FakeBackend) Devices() ([]*Device, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	devices := make([]*Device, 0, len(f.DevicesList))
+	for _, d := range f.DevicesList {
+		dev := *d
+		devices = append(devices, &dev)
+	}
+	return devices, nil
+}
+
+func (f *FakeBackend) Connection(conUuid string) (*Connection, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	con, ok := f.Connections[conUuid]
+	if !ok {
+		return nil, fmt.Errorf("%w: %v", ErrConnectionNotFound, conUuid)
+	}
+	c := *con
+	return &c, nil
+}
+
+func (f *FakeBackend) ListWifi(rescan bool) ([]*AccessPoint, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	aps := make([]*AccessPoint, 0, len(f.AccessPoints))
+	for _, ap := range f.AccessPoints {
+		a := *ap
+		aps = append(aps, &a)
+	}
+	return aps, nil
+}
+
+func (f *FakeBackend) ConnectWifi(target, password string) error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	var ap *AccessPoint
+	for _, a := range f.AccessPoints {
+		if a.Ssid == target || strings.EqualFold(a.Bssid, target) {
+			ap = a
+			break
+		}
+	}
+	if ap == nil {
+		return fmt.Errorf("wifi %v not found", target)
+	}
+	if pwd, ok := f.WifiPasswords[ap.Ssid]; ok && pwd != password {
+		return fmt.Errorf("%w, ssid:%v", ErrWifiActivationFailed, ap.Ssid)
+	}
+	dev := f.deviceOfType(DevStatus_Type_Wireless)
+	if dev == nil {
+		return fmt.Errorf("no wifi device")
+	}
+
+	f.deleteConnections(ap.Ssid)
+	con := &Connection{Id: ap.Ssid, Uuid: uuid.New().String(), Type: nmWifiType,
+		Ipv4Method: Ipv4Method_Auto, Ipv6Method: Ipv6Method_Auto, Ssid: ap.Ssid, SeenBssids: []string{ap.Bssid}}
+	f.Connections[con.Uuid] = con
+	for _, a := range f.AccessPoints {
+		a.InUse = a == ap
+	}
+	f.activate(dev, con)
+	return nil
+}
+
+func (f *FakeBackend) SetWiredIp(iface string, ipv4 Ipv4Config, ipv6 Ipv6Config) error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	var dev *Device
+	for _, d := range f.DevicesList {
+		if d.Interface == iface {
+			dev = d
+		}
+	}
+	if dev == nil {
+		return fmt.Errorf("device %v not found", iface)
+	}
+	f.deleteConnections(iface)
+	con := &Connection{Id: iface, Uuid: uuid.New().String(), Type: "802-3-ethernet", InterfaceName: iface}
+	f.Connections[con.Uuid] = con
+	if len(ipv6.Method) < 1 {
+		ipv6.Method = Ipv6Method_Auto
+	}
+	f.setIp(con, ipv4, ipv6)
+	f.activate(dev, con)
+	return nil
+}
+
+func (f *FakeBackend) SetConnectionIp(conUuid string, ipv4 Ipv4Config, ipv6 Ipv6Config) error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	con, ok := f.Connections[conUuid]
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrConnectionNotFound, conUuid)
+	}
+	f.setIp(con, ipv4, ipv6)
+	for _, d := range f.DevicesList {
+		if d.ConnectionUuid == conUuid {
+			f.activate(d, con)
+		}
+	}
+	return nil
+}
+
+func (f *FakeBackend) DeleteConnection(idOrUuid string) error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	if !f.deleteConnections(idOrUuid) {
+		return fmt.Errorf("%w: %v", ErrConnectionNotFound, idOrUuid)
+	}
+	return nil
+}
+
+func (f *FakeBackend) ActivateConnection(conUuid string) error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	con, ok := f.Connections[conUuid]
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrConnectionNotFound, conUuid)
+	}
+	var dev *Device
+	for _, d := range f.DevicesList {
+		if d.ConnectionUuid == conUuid || (len(con.InterfaceName) > 0 && d.Interface == con.InterfaceName) {
+			dev = d
+		}
+	}
+	if dev == nil && len(con.Ssid) > 0 {
+		dev = f.deviceOfType(DevStatus_Type_Wireless)
+	} else if dev == nil {
+		dev = f.deviceOfType(DevStatus_Type_Wire)
+	}
+	if dev == nil {
+		return fmt.Errorf("no device for connection %v", conUuid)
+	}
+	f.activate(dev, con)
+	return nil
+}
+
+func (f *FakeBackend) ReloadConnections() error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	f.Reloaded++
+	return nil
+}
+
+func (f *FakeBackend) WifiProfiles() ([]*WifiProfile, error) {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	profiles := make([]*WifiProfile, 0)
+	for _, con := range f.Connections {
+		if con.Type != nmWifiType {
+			continue
+		}
+		profile := &WifiProfile{Uuid: con.Uuid, Ssid: con.Ssid, Security: WifiSecurity_None, AutoConnect: true}
+		if cfg, ok := f.WifiConfigs[con.Uuid]; ok {
+			profile.Hidden, profile.Security, profile.Priority, profile.AutoConnect = cfg.Hidden, cfg.Security, cfg.Priority, cfg.AutoConnect
+			if cfg.Security == WifiSecurity_Enterprise {
+				profile.EapMethod, profile.Identity = cfg.Eap.Method, cfg.Eap.Identity
+			}
+		} else if _, ok := f.WifiPasswords[con.Ssid]; ok {
+			profile.Security = WifiSecurity_WpaPsk
+		}
+		for _, d := range f.DevicesList {
+			if d.ConnectionUuid == con.Uuid && d.IsConnected() {
+				profile.Active = true
+			}
+		}
+		profiles = append(profiles, profile)
+	}
+	sortWifiProfiles(profiles)
+	return profiles, nil
+}
+
+func (f *FakeBackend) SaveWifiProfile(cfg WifiProfileConfig) (string, error) {
+	if err := cfg.Validate(); err != nil {
+		return "", err
+	}
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	for _, con := range f.Connections {
+		if con.Type == nmWifiType && con.Ssid == cfg.Ssid {
+			old := f.WifiConfigs[con.Uuid]
+			if err := cfg.validateSecret(old.Security, len(old.Password) > 0 || len(old.Eap.Password) > 0); err != nil {
+				return "", err
+			}
+			if len(cfg.Password) < 1 && old.Security == cfg.Security {
+				cfg.Password = old.Password
+			}
+			if len(cfg.Eap.Password) < 1 {
+				cfg.Eap.Password = old.Eap.Password
+			}
+			f.WifiConfigs[con.Uuid] = cfg
+			return con.Uuid, nil
+		}
+	}
+	if err := cfg.validateSecret("", false); err != nil {
+		return "", err
+	}
+	con := &Connection{Id: cfg.Ssid, Uuid: uuid.New().String(), Type: nmWifiType,
+		Ipv4Method: Ipv4Method_Auto, Ipv6Method: Ipv6Method_Auto, Ssid: cfg.Ssid}
+	f.Connections[con.Uuid] = con
+	f.WifiConfigs[con.Uuid] = cfg
+	return con.Uuid, nil
+}
+
+func (f *FakeBackend) SetWifiPriority(conUuid string, priority int32, autoConnect bool) error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	con, ok := f.Connections[conUuid]
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrConnectionNotFound, conUuid)
+	}
+	if con.Type != nmWifiType {
+		return fmt.Errorf("connection %v is not wifi", conUuid)
+	}
+	cfg, ok := f.WifiConfigs[conUuid]
+	if !ok {
+		cfg = WifiProfileConfig{Ssid: con.Ssid, Security: WifiSecurity_None}
+		if pwd, ok := f.WifiPasswords[con.Ssid]; ok {
+			cfg.Security, cfg.Password = WifiSecurity_WpaPsk, pwd
+		}
+	}
+	cfg.Priority, cfg.AutoConnect = priority, autoConnect
+	f.WifiConfigs[conUuid] = cfg
+	return nil
+}
+
+func (f *FakeBackend) SetDeviceRouteMetric(iface string, metric int64) error {
+	f.mtx.Lock()
+	defer f.mtx.Unlock()
+	for _, d := range f.DevicesList {
+		if d.Interface != iface {
+			continue
+		}
+		if !d.IsConnected() {
+			return fmt.Errorf("device %v has no active connection", iface)
+		}
+		if metric < 0 {
+			delete(f.RouteMetrics, iface)
+		} else {
+			f.RouteMetrics[iface] = metric
+		}
+		return nil
+	}
+	return fmt.Errorf("device %v not found", iface)
+}
+
+func (f *FakeBackend) deviceOfType(t string) *Device {
+	for _, d := range f.DevicesList {
+		if d.Type == t {
+			return d
+		}
+	}
+	return nil
+}
+
+// deleteConnections 删除名称或 uuid 匹配的连接, 使用这些连接的网卡变为未连接.
+func (f *FakeBackend) deleteConnections(idOrUuid string) bool {
+	deleted := false
+	for id, con := range f.Connections {
+		if con.Id != idOrUuid && con.Uuid != idOrUuid {
+			continue
+		}
+		delete(f.Connections, id)
+		delete(f.WifiConfigs, id)
+		deleted = true
+		for _, d := range f.DevicesList {
+			if d.ConnectionUuid == con.Uuid {
+				d.State, d.ConnectionId, d.ConnectionUuid = DevState_Disconnected, "", ""
+				delete(f.RouteMetrics, d.Interface)
+				d.Ip4Addresses, d.Ip4Gateway, d.Ip4Dns = nil, "", nil
+				d.Ip6Addresses, d.Ip6Gateway, d.Ip6Dns = nil, "", nil
+			}
+		}
+	}
+	return deleted
+}
+
+func (f *FakeBackend) setIp(con *Connection, ipv4 Ipv4Config, ipv6 Ipv6Config) {
+	con.Ipv4Method = ipv4.Method
+	if len(con.Ipv4Method) < 1 {
+		con.Ipv4Method = Ipv4Method_Auto
+	}
+	f.Ipv4Configs[con.Uuid] = ipv4
+	if len(ipv6.Method) > 0 {
+		con.Ipv6Method, con.Ipv6Privacy = ipv6.Method, ipv6.Privacy
+		f.Ipv6Configs[con.Uuid] = ipv6
+	}
+}
+
+func (f *FakeBackend) activate(dev *Device, con *Connection) {
+	delete(f.RouteMetrics, dev.Interface)
+	dev.State, dev.ConnectionId, dev.ConnectionUuid = DevState_Connected, con.Id, con.Uuid
+	if cfg, ok := f.Ipv4Configs[con.Uuid]; ok && cfg.Method == Ipv4Method_Manual {
+		dev.Ip4Addresses, dev.Ip4Gateway = []string{cfg.Address}, cfg.Gateway
+		dev.Ip4Dns = nil
+		for _, d := range cfg.Dns {
+			if len(d) > 0 {
+				dev.Ip4Dns = append(dev.Ip4Dns, d)
+			}
+		}
+	}
+	if cfg, ok := f.Ipv6Configs[con.Uuid]; ok {
+		if cfg.Method == Ipv6Method_Manual {
+			dev.Ip6Addresses, dev.Ip6Gateway = append([]string{}, cfg.Addresses...), cfg.Gateway
+		}
+		dev.Ip6Dns = nil
+		for _, d := range cfg.Dns {
+			if len(d) > 0 {
+				dev.Ip6Dns = append(dev.Ip6Dns, d)
+			}
+		}
+	}
+	f.Activated = append(f.Activated, con.Uuid)
+}
@@ -0,0 +1,866 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"agent/utils/logger"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	nmDest             = "org.freedesktop.NetworkManager"
+	nmPath             = dbus.ObjectPath("/org/freedesktop/NetworkManager")
+	nmSettingsPath     = dbus.ObjectPath("/org/freedesktop/NetworkManager/Settings")
+	nmIface            = "org.freedesktop.NetworkManager"
+	nmDeviceIface      = nmIface + ".Device"
+	nmWiredIface       = nmIface + ".Device.Wired"
+	nmWirelessIface    = nmIface + ".Device.Wireless"
+	nmActiveIface      = nmIface + ".Connection.Active"
+	nmIp4ConfigIface   = nmIface + ".IP4Config"
+	nmIp6ConfigIface   = nmIface + ".IP6Config"
+	nmAccessPointIface = nmIface + ".AccessPoint"
+	nmSettingsIface    = nmIface + ".Settings"
+	nmConnectionIface  = nmIface + ".Settings.Connection"
+
+	dbusPropertiesGetAll = "org.freedesktop.DBus.Properties.GetAll"
+
+	nmDeviceTypeEthernet = 1
+	nmDeviceTypeWifi     = 2
+
+	nmActiveStateActivated    = 2
+	nmActiveStateDeactivating = 3
+
+	nmApFlagsPrivacy    = 0x1
+	nmApSecKeyMgmtPSK   = 0x100
+	nmApSecKeyMgmt8021X = 0x200
+	nmApSecKeyMgmtSAE   = 0x400
+)
+
+// nmDeviceTypes NM_DEVICE_TYPE 到 nmcli 中类型名称的映射, 只列出常见的类型
+var nmDeviceTypes = map[uint32]string{
+	nmDeviceTypeEthernet: DevStatus_Type_Wire,
+	nmDeviceTypeWifi:     DevStatus_Type_Wireless,
+	5:                    "bt",
+	10:                   "bond",
+	11:                   "vlan",
+	13:                   "bridge",
+	14:                   "generic",
+	16:                   "tun",
+	20:                   "veth",
+	29:                   "wireguard",
+	32:                   "loopback",
+}
+
+type nmSettings map[string]map[string]dbus.Variant
+
+// NMDBusBackend 通过 D-Bus 调用 NetworkManager. 不依赖 nmcli 的输出格式, SSID 中的冒号、
+// 本地化输出等都不会影响解析.
+type NMDBusBackend struct {
+	ActivateTimeout time.Duration // 等待连接激活的最长时间
+	ScanTimeout     time.Duration // 等待 wifi 扫描完成的最长时间
+}
+
+func NewNMDBusBackend() *NMDBusBackend {
+	return &NMDBusBackend{ActivateTimeout: 45 * time.Second, ScanTimeout: 10 * time.Second}
+}
+
+func (b *NMDBusBackend) Devices() ([]*Device, error) {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect system bus, err:%v", err)
+	}
+	var paths []dbus.ObjectPath
+	if err := conn.Object(nmDest, nmPath).Call(nmIface+".GetDevices", 0).Store(&paths); err != nil {
+		return nil, fmt.Errorf("failed to get devices, err:%v", err)
+	}
+	devices := make([]*Device, 0, len(paths))
+	for _, p := range paths {
+		dev, err := b.device(conn, p)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, dev)
+	}
+	return devices, nil
+}
+
+func (b *NMDBusBackend) device(conn *dbus.Conn, p dbus.ObjectPath) (*Device, error) {
+	props, err := getAllProps(conn, p, nmDeviceIface)
+	if err != nil {
+		return nil, err
+	}
+	dev := &Device{
+		Interface: props.str("Interface"),
+		Type:      nmDeviceTypes[props.u32("DeviceType")],
+		State:     nmDeviceState(props.u32("State")),
+		HwAddress: props.str("HwAddress"), // NetworkManager 1.24 及以上
+	}
+	if len(dev.Type) < 1 {
+		dev.Type = "unknown"
+	}
+	if len(dev.HwAddress) < 1 && dev.IsEthernetAndWifi() {
+		iface := nmWiredIface
+		if dev.IsWireless() {
+			iface = nmWirelessIface
+		}
+		if v, err := conn.Object(nmDest, p).GetProperty(iface + ".HwAddress"); err == nil {
+			dev.HwAddress, _ = v.Value().(string)
+		}
+	}
+
+	if active := props.path("ActiveConnection"); isValidPath(active) {
+		if ap, err := getAllProps(conn, active, nmActiveIface); err == nil {
+			dev.ConnectionId = ap.str("Id")
+			dev.ConnectionUuid = ap.str("Uuid")
+		}
+	}
+	if p4 := props.path("Ip4Config"); isValidPath(p4) {
+		if ip, err := getAllProps(conn, p4, nmIp4ConfigIface); err == nil {
+			dev.Ip4Addresses = ip.addressData("AddressData")
+			dev.Ip4Gateway = ip.str("Gateway")
+			for _, ns := range ip.dicts("NameserverData") {
+				if s, ok := ns["address"].Value().(string); ok {
+					dev.Ip4Dns = append(dev.Ip4Dns, s)
+				}
+			}
+		}
+	}
+	if p6 := props.path("Ip6Config"); isValidPath(p6) {
+		if ip, err := getAllProps(conn, p6, nmIp6ConfigIface); err == nil {
+			dev.Ip6Addresses = ip.addressData("AddressData")
+			dev.Ip6Gateway = ip.str("Gateway")
+		}
+	}
+	return dev, nil
+}
+
+func nmDeviceState(state uint32) string {
+	switch {
+	case state == 10:
+		return DevState_Unmanaged
+	case state == 20:
+		return DevState_Unavailable
+	case state == 30:
+		return DevState_Disconnected
+	case state >= 40 && state <= 90:
+		return DevState_Connecting
+	case state == 100:
+		return DevState_Connected
+	case state == 120:
+		return DevState_Failed
+	}
+	return "unknown"
+}
+
+func (b *NMDBusBackend) Connection(conUuid string) (*Connection, error) {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect system bus, err:%v", err)
+	}
+	p, err := connectionPathByUuid(conn, conUuid)
+	if err != nil {
+		return nil, err
+	}
+	settings, err := connectionSettings(conn, p)
+	if err != nil {
+		return nil, err
+	}
+	return connectionOf(settings), nil
+}
+
+func connectionOf(settings nmSettings) *Connection {
+	con := &Connection{
+		Id:            variantStr(settings["connection"]["id"]),
+		Uuid:          variantStr(settings["connection"]["uuid"]),
+		Type:          variantStr(settings["connection"]["type"]),
+		InterfaceName: variantStr(settings["connection"]["interface-name"]),
+		Ipv4Method:    variantStr(settings["ipv4"]["method"]),
+		Ipv6Method:    variantStr(settings["ipv6"]["method"]),
+	}
+	if privacy, ok := settings["ipv6"]["ip6-privacy"].Value().(int32); ok {
+		con.Ipv6Privacy = nmIpv6PrivacyNames[privacy]
+	}
+	if wireless, ok := settings["802-11-wireless"]; ok {
+		ssid, _ := wireless["ssid"].Value().([]byte)
+		con.Ssid = string(ssid)
+		con.SeenBssids, _ = wireless["seen-bssids"].Value().([]string)
+	}
+	return con
+}
+
+func (b *NMDBusBackend) ListWifi(rescan bool) ([]*AccessPoint, error) {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect system bus, err:%v", err)
+	}
+	wifiDevices, err := devicePathsOfType(conn, nmDeviceTypeWifi)
+	if err != nil {
+		return nil, err
+	}
+	aps := make([]*AccessPoint, 0)
+	for _, dp := range wifiDevices {
+		if rescan {
+			b.scan(conn, dp)
+		}
+		found, err := accessPoints(conn, dp)
+		if err != nil {
+			return nil, err
+		}
+		for _, ap := range found {
+			aps = append(aps, ap.AccessPoint)
+		}
+	}
+	return aps, nil
+}
+
+// scan 请求扫描并等待 LastScan 更新. 扫描过于频繁时 NetworkManager 会拒绝, 此时直接使用已有结果.
+func (b *NMDBusBackend) scan(conn *dbus.Conn, dp dbus.ObjectPath) {
+	obj := conn.Object(nmDest, dp)
+	lastScan := func() int64 {
+		v, err := obj.GetProperty(nmWirelessIface + ".LastScan")
+		if err != nil {
+			return 0
+		}
+		t, _ := v.Value().(int64)
+		return t
+	}
+	before := lastScan()
+	if err := obj.Call(nmWirelessIface+".RequestScan", 0, map[string]dbus.Variant{}).Err; err != nil {
+		logger.AppLogger().Debugf("RequestScan %v, err:%v", dp, err)
+		return
+	}
+	for deadline := time.Now().Add(b.ScanTimeout); time.Now().Before(deadline); {
+		time.Sleep(500 * time.Millisecond)
+		if lastScan() != before {
+			return
+		}
+	}
+	logger.AppLogger().Debugf("RequestScan %v, timeout", dp)
+}
+
+type dbusAccessPoint struct {
+	*AccessPoint
+	path   dbus.ObjectPath
+	device dbus.ObjectPath
+	secure bool
+	sae    bool // 只支持 WPA3
+}
+
+func accessPoints(conn *dbus.Conn, dp dbus.ObjectPath) ([]*dbusAccessPoint, error) {
+	obj := conn.Object(nmDest, dp)
+	var paths []dbus.ObjectPath
+	if err := obj.Call(nmWirelessIface+".GetAllAccessPoints", 0).Store(&paths); err != nil {
+		return nil, fmt.Errorf("failed to get access points of %v, err:%v", dp, err)
+	}
+	var active dbus.ObjectPath
+	if v, err := obj.GetProperty(nmWirelessIface + ".ActiveAccessPoint"); err == nil {
+		active, _ = v.Value().(dbus.ObjectPath)
+	}
+
+	aps := make([]*dbusAccessPoint, 0, len(paths))
+	for _, p := range paths {
+		props, err := getAllProps(conn, p, nmAccessPointIface)
+		if err != nil { // 扫描过程中热点可能已消失
+			continue
+		}
+		ssid := string(props.bytes("Ssid"))
+		if len(ssid) < 1 { // 隐藏网络
+			continue
+		}
+		flags, wpa, rsn := props.u32("Flags"), props.u32("WpaFlags"), props.u32("RsnFlags")
+		security := make([]string, 0)
+		if flags&nmApFlagsPrivacy != 0 && wpa == 0 && rsn == 0 {
+			security = append(security, "WEP")
+		}
+		if wpa != 0 {
+			security = append(security, "WPA1")
+		}
+		if rsn&(nmApSecKeyMgmtPSK|nmApSecKeyMgmt8021X) != 0 {
+			security = append(security, "WPA2")
+		}
+		if rsn&nmApSecKeyMgmtSAE != 0 {
+			security = append(security, "WPA3")
+		}
+		aps = append(aps, &dbusAccessPoint{
+			AccessPoint: &AccessPoint{
+				Ssid:      ssid,
+				Bssid:     props.str("HwAddress"),
+				Frequency: props.u32("Frequency"),
+				Strength:  int(props.byte("Strength")),
+				Security:  strings.Join(security, " "),
+				InUse:     p == active,
+			},
+			path:   p,
+			device: dp,
+			secure: len(security) > 0,
+			sae:    rsn&nmApSecKeyMgmtSAE != 0 && rsn&nmApSecKeyMgmtPSK == 0 && wpa == 0,
+		})
+	}
+	return aps, nil
+}
+
+func (b *NMDBusBackend) ConnectWifi(target, password string) error {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return fmt.Errorf("failed to connect system bus, err:%v", err)
+	}
+	ap, err := b.findAccessPoint(conn, target, false)
+	if err == nil && ap == nil {
+		ap, err = b.findAccessPoint(conn, target, true)
+	}
+	if err != nil {
+		return err
+	}
+	if ap == nil {
+		return fmt.Errorf("wifi %v not found", target)
+	}
+
+	// 已保存的同名连接就地更新密码, 保留优先级、ip 等设置, 不删除其他连接
+	p, old, err := wifiConnectionBySsid(conn, ap.Ssid)
+	if err != nil {
+		return err
+	}
+	if old != nil {
+		return b.reconnectWifi(conn, ap, p, old, password)
+	}
+
+	settings := nmSettings{
+		"connection": {
+			"id":   dbus.MakeVariant(ap.Ssid),
+			"uuid": dbus.MakeVariant(uuid.New().String()),
+			"type": dbus.MakeVariant("802-11-wireless"),
+		},
+		"802-11-wireless": {
+			"ssid": dbus.MakeVariant([]byte(ap.Ssid)),
+			"mode": dbus.MakeVariant("infrastructure"),
+		},
+	}
+	if security := wifiSecuritySettings(ap, password); security != nil {
+		settings["802-11-wireless-security"] = security
+	}
+
+	var connPath, activePath dbus.ObjectPath
+	err = conn.Object(nmDest, nmPath).Call(nmIface+".AddAndActivateConnection", 0, settings, ap.device, ap.path).
+		Store(&connPath, &activePath)
+	if err != nil {
+		return fmt.Errorf("failed to add wifi connection %v, err:%v", ap.Ssid, err)
+	}
+	if err := b.waitActivated(conn, activePath); err != nil {
+		// 与 nmcli dev wifi connect 一致, 激活失败时删除新建的连接
+		if err1 := conn.Object(nmDest, connPath).Call(nmConnectionIface+".Delete", 0).Err; err1 != nil {
+			logger.AppLogger().Warnf("ConnectWifi, delete connection %v, err:%v", connPath, err1)
+		}
+		return fmt.Errorf("%w, ssid:%v, err:%v", ErrWifiActivationFailed, ap.Ssid, err)
+	}
+	return nil
+}
+
+// reconnectWifi 更新已保存连接 p 的密码并激活. 激活失败时恢复原来的设置.
+func (b *NMDBusBackend) reconnectWifi(conn *dbus.Conn, ap *dbusAccessPoint, p dbus.ObjectPath, old nmSettings, password string) error {
+	if err := mergeSecrets(conn, p, old); err != nil {
+		return err
+	}
+	settings := wifiReconnectSettings(old, ap, password)
+	if err := conn.Object(nmDest, p).Call(nmConnectionIface+".Update", 0, settings).Err; err != nil {
+		return fmt.Errorf("failed to update wifi connection %v, err:%v", ap.Ssid, err)
+	}
+
+	var activePath dbus.ObjectPath
+	err := conn.Object(nmDest, nmPath).Call(nmIface+".ActivateConnection", 0, p, ap.device, ap.path).Store(&activePath)
+	if err == nil {
+		err = b.waitActivated(conn, activePath)
+	}
+	if err != nil {
+		if err1 := conn.Object(nmDest, p).Call(nmConnectionIface+".Update", 0, old).Err; err1 != nil {
+			logger.AppLogger().Warnf("ConnectWifi, restore connection %v, err:%v", p, err1)
+		}
+		return fmt.Errorf("%w, ssid:%v, err:%v", ErrWifiActivationFailed, ap.Ssid, err)
+	}
+	return nil
+}
+
+// wifiSecuritySettings 按热点的加密方式生成 802-11-wireless-security 设置, 开放网络返回 nil.
+func wifiSecuritySettings(ap *dbusAccessPoint, password string) map[string]dbus.Variant {
+	if !ap.secure {
+		return nil
+	}
+	keyMgmt := "wpa-psk"
+	if ap.sae {
+		keyMgmt = "sae"
+	}
+	return map[string]dbus.Variant{
+		"key-mgmt": dbus.MakeVariant(keyMgmt),
+		"psk":      dbus.MakeVariant(password),
+	}
+}
+
+// wifiReconnectSettings 在已保存连接的设置上替换加密设置, 其他设置保持不变, 不修改 old.
+func wifiReconnectSettings(old nmSettings, ap *dbusAccessPoint, password string) nmSettings {
+	settings := make(nmSettings, len(old))
+	for name, values := range old {
+		if name == "802-11-wireless-security" || name == "802-1x" {
+			continue
+		}
+		settings[name] = values
+	}
+	if security := wifiSecuritySettings(ap, password); security != nil {
+		settings["802-11-wireless-security"] = security
+	}
+	return settings
+}
+
+// findAccessPoint 按 SSID 或 BSSID 查找信号最强的热点, 找不到时返回 nil.
+func (b *NMDBusBackend) findAccessPoint(conn *dbus.Conn, target string, rescan bool) (*dbusAccessPoint, error) {
+	wifiDevices, err := devicePathsOfType(conn, nmDeviceTypeWifi)
+	if err != nil {
+		return nil, err
+	}
+	if len(wifiDevices) < 1 {
+		return nil, fmt.Errorf("no wifi device")
+	}
+	var best *dbusAccessPoint
+	for _, dp := range wifiDevices {
+		if rescan {
+			b.scan(conn, dp)
+		}
+		aps, err := accessPoints(conn, dp)
+		if err != nil {
+			return nil, err
+		}
+		for _, ap := range aps {
+			if ap.Ssid != target && !strings.EqualFold(ap.Bssid, target) {
+				continue
+			}
+			if best == nil || ap.Strength > best.Strength {
+				best = ap
+			}
+		}
+	}
+	return best, nil
+}
+
+func (b *NMDBusBackend) SetWiredIp(iface string, ipv4Cfg Ipv4Config, ipv6Cfg Ipv6Config) error {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return fmt.Errorf("failed to connect system bus, err:%v", err)
+	}
+	ipv4, err := ipv4Settings(ipv4Cfg)
+	if err != nil {
+		return err
+	}
+	if len(ipv6Cfg.Method) < 1 {
+		ipv6Cfg.Method = Ipv6Method_Auto
+	}
+	ipv6, err := ipv6Settings(ipv6Cfg)
+	if err != nil {
+		return err
+	}
+	var dp dbus.ObjectPath
+	if err := conn.Object(nmDest, nmPath).Call(nmIface+".GetDeviceByIpIface", 0, iface).Store(&dp); err != nil {
+		return fmt.Errorf("failed to get device %v, err:%v", iface, err)
+	}
+	// 直接修改的话原来的 ip 还在, 会导致有多个 ip. 所以还是先删除再创建比较好.
+	if err := deleteConnections(conn, func(c *Connection) bool { return c.Id == iface }); err != nil {
+		logger.AppLogger().Warnf("SetWiredIp, delete old connection %v, err:%v", iface, err)
+	}
+
+	settings := nmSettings{
+		"connection": {
+			"id":             dbus.MakeVariant(iface),
+			"uuid":           dbus.MakeVariant(uuid.New().String()),
+			"type":           dbus.MakeVariant("802-3-ethernet"),
+			"interface-name": dbus.MakeVariant(iface),
+		},
+		"ipv4": ipv4,
+		"ipv6": ipv6,
+	}
+	var connPath, activePath dbus.ObjectPath
+	err = conn.Object(nmDest, nmPath).Call(nmIface+".AddAndActivateConnection", 0, settings, dp, dbus.ObjectPath("/")).
+		Store(&connPath, &activePath)
+	if err != nil {
+		return fmt.Errorf("failed to add connection %v, err:%v", iface, err)
+	}
+	return b.waitActivated(conn, activePath)
+}
+
+func (b *NMDBusBackend) SetConnectionIp(conUuid string, ipv4Cfg Ipv4Config, ipv6Cfg Ipv6Config) error {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return fmt.Errorf("failed to connect system bus, err:%v", err)
+	}
+	ipv4, err := ipv4Settings(ipv4Cfg)
+	if err != nil {
+		return err
+	}
+	var ipv6 map[string]dbus.Variant
+	if len(ipv6Cfg.Method) > 0 {
+		if ipv6, err = ipv6Settings(ipv6Cfg); err != nil {
+			return err
+		}
+	}
+	p, err := connectionPathByUuid(conn, conUuid)
+	if err != nil {
+		return err
+	}
+	settings, err := connectionSettings(conn, p)
+	if err != nil {
+		return err
+	}
+	if err := mergeSecrets(conn, p, settings); err != nil {
+		return err
+	}
+	settings["ipv4"] = ipv4
+	if ipv6 != nil {
+		settings["ipv6"] = ipv6
+	}
+	if err := conn.Object(nmDest, p).Call(nmConnectionIface+".Update", 0, settings).Err; err != nil {
+		return fmt.Errorf("failed to update connection %v, err:%v", conUuid, err)
+	}
+	return b.activate(conn, p)
+}
+
+func (b *NMDBusBackend) DeleteConnection(idOrUuid string) error {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return fmt.Errorf("failed to connect system bus, err:%v", err)
+	}
+	deleted := false
+	err = deleteConnections(conn, func(c *Connection) bool {
+		match := c.Id == idOrUuid || c.Uuid == idOrUuid
+		deleted = deleted || match
+		return match
+	})
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return fmt.Errorf("%w: %v", ErrConnectionNotFound, idOrUuid)
+	}
+	return nil
+}
+
+func (b *NMDBusBackend) ActivateConnection(conUuid string) error {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return fmt.Errorf("failed to connect system bus, err:%v", err)
+	}
+	p, err := connectionPathByUuid(conn, conUuid)
+	if err != nil {
+		return err
+	}
+	return b.activate(conn, p)
+}
+
+func (b *NMDBusBackend) activate(conn *dbus.Conn, connPath dbus.ObjectPath) error {
+	var activePath dbus.ObjectPath
+	err := conn.Object(nmDest, nmPath).Call(nmIface+".ActivateConnection", 0,
+		connPath, dbus.ObjectPath("/"), dbus.ObjectPath("/")).Store(&activePath)
+	if err != nil {
+		return fmt.Errorf("failed to activate connection %v, err:%v", connPath, err)
+	}
+	return b.waitActivated(conn, activePath)
+}
+
+func (b *NMDBusBackend) SetDeviceRouteMetric(iface string, metric int64) error {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return fmt.Errorf("failed to connect system bus, err:%v", err)
+	}
+	var dp dbus.ObjectPath
+	if err := conn.Object(nmDest, nmPath).Call(nmIface+".GetDeviceByIpIface", 0, iface).Store(&dp); err != nil {
+		return fmt.Errorf("failed to get device %v, err:%v", iface, err)
+	}
+	var applied nmSettings
+	var version uint64
+	if err := conn.Object(nmDest, dp).Call(nmDeviceIface+".GetAppliedConnection", 0, uint32(0)).Store(&applied, &version); err != nil {
+		return fmt.Errorf("failed to get applied connection of %v, err:%v", iface, err)
+	}
+	for _, name := range []string{"ipv4", "ipv6"} {
+		if _, ok := applied[name]; !ok {
+			applied[name] = map[string]dbus.Variant{}
+		}
+		applied[name]["route-metric"] = dbus.MakeVariant(metric)
+	}
+	// version 不一致(期间配置被修改)时 NetworkManager 会拒绝
+	if err := conn.Object(nmDest, dp).Call(nmDeviceIface+".Reapply", 0, applied, version, uint32(0)).Err; err != nil {
+		return fmt.Errorf("failed to reapply %v, err:%v", iface, err)
+	}
+	return nil
+}
+
+func (b *NMDBusBackend) ReloadConnections() error {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return fmt.Errorf("failed to connect system bus, err:%v", err)
+	}
+	var ok bool
+	if err := conn.Object(nmDest, nmSettingsPath).Call(nmSettingsIface+".ReloadConnections", 0).Store(&ok); err != nil {
+		return fmt.Errorf("failed to reload connections, err:%v", err)
+	}
+	return nil
+}
+
+// waitActivated 等待激活连接进入 activated 状态. 激活失败时 NetworkManager 会删除该对象.
+func (b *NMDBusBackend) waitActivated(conn *dbus.Conn, activePath dbus.ObjectPath) error {
+	obj := conn.Object(nmDest, activePath)
+	for deadline := time.Now().Add(b.ActivateTimeout); time.Now().Before(deadline); time.Sleep(500 * time.Millisecond) {
+		v, err := obj.GetProperty(nmActiveIface + ".State")
+		if err != nil {
+			return fmt.Errorf("activation of %v failed, err:%v", activePath, err)
+		}
+		state, _ := v.Value().(uint32)
+		if state == nmActiveStateActivated {
+			return nil
+		}
+		if state >= nmActiveStateDeactivating {
+			return fmt.Errorf("activation of %v failed, state:%v", activePath, state)
+		}
+	}
+	return fmt.Errorf("activation of %v timeout", activePath)
+}
+
+func devicePathsOfType(conn *dbus.Conn, deviceType uint32) ([]dbus.ObjectPath, error) {
+	var paths []dbus.ObjectPath
+	if err := conn.Object(nmDest, nmPath).Call(nmIface+".GetDevices", 0).Store(&paths); err != nil {
+		return nil, fmt.Errorf("failed to get devices, err:%v", err)
+	}
+	ret := make([]dbus.ObjectPath, 0)
+	for _, p := range paths {
+		v, err := conn.Object(nmDest, p).GetProperty(nmDeviceIface + ".DeviceType")
+		if err != nil {
+			continue
+		}
+		if t, _ := v.Value().(uint32); t == deviceType {
+			ret = append(ret, p)
+		}
+	}
+	return ret, nil
+}
+
+func connectionPathByUuid(conn *dbus.Conn, conUuid string) (dbus.ObjectPath, error) {
+	var p dbus.ObjectPath
+	err := conn.Object(nmDest, nmSettingsPath).Call(nmSettingsIface+".GetConnectionByUuid", 0, conUuid).Store(&p)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v, err:%v", ErrConnectionNotFound, conUuid, err)
+	}
+	return p, nil
+}
+
+func connectionSettings(conn *dbus.Conn, p dbus.ObjectPath) (nmSettings, error) {
+	var settings nmSettings
+	if err := conn.Object(nmDest, p).Call(nmConnectionIface+".GetSettings", 0).Store(&settings); err != nil {
+		return nil, fmt.Errorf("failed to get settings of %v, err:%v", p, err)
+	}
+	return settings, nil
+}
+
+// mergeSecrets GetSettings 不返回密码, 不合并回去的话 Update 后 wifi 密码会丢失.
+func mergeSecrets(conn *dbus.Conn, p dbus.ObjectPath, settings nmSettings) error {
+	for _, name := range []string{"802-11-wireless-security", "802-1x"} {
+		if _, ok := settings[name]; !ok {
+			continue
+		}
+		var secrets nmSettings
+		if err := conn.Object(nmDest, p).Call(nmConnectionIface+".GetSecrets", 0, name).Store(&secrets); err != nil {
+			return fmt.Errorf("failed to get secrets of %v, err:%v", p, err)
+		}
+		for k, v := range secrets[name] {
+			settings[name][k] = v
+		}
+	}
+	return nil
+}
+
+// deleteConnections 删除 match 返回 true 的所有连接.
+func deleteConnections(conn *dbus.Conn, match func(c *Connection) bool) error {
+	var paths []dbus.ObjectPath
+	if err := conn.Object(nmDest, nmSettingsPath).Call(nmSettingsIface+".ListConnections", 0).Store(&paths); err != nil {
+		return fmt.Errorf("failed to list connections, err:%v", err)
+	}
+	for _, p := range paths {
+		settings, err := connectionSettings(conn, p)
+		if err != nil {
+			continue
+		}
+		if !match(connectionOf(settings)) {
+			continue
+		}
+		if err := conn.Object(nmDest, p).Call(nmConnectionIface+".Delete", 0).Err; err != nil {
+			return fmt.Errorf("failed to delete connection %v, err:%v", p, err)
+		}
+	}
+	return nil
+}
+
+// ipv4Settings 生成连接配置中的 ipv4 部分.
+func ipv4Settings(cfg Ipv4Config) (map[string]dbus.Variant, error) {
+	if cfg.Method != Ipv4Method_Manual {
+		return map[string]dbus.Variant{"method": dbus.MakeVariant(Ipv4Method_Auto)}, nil
+	}
+	ip, ipNet, err := net.ParseCIDR(cfg.Address)
+	if err != nil || ip.To4() == nil {
+		return nil, fmt.Errorf("invalid ipv4 address %v", cfg.Address)
+	}
+	prefix, _ := ipNet.Mask.Size()
+	ipv4 := map[string]dbus.Variant{
+		"method": dbus.MakeVariant(Ipv4Method_Manual),
+		"address-data": dbus.MakeVariant([]map[string]dbus.Variant{{
+			"address": dbus.MakeVariant(ip.String()),
+			"prefix":  dbus.MakeVariant(uint32(prefix)),
+		}}),
+	}
+	if len(cfg.Gateway) > 0 {
+		if gw := net.ParseIP(cfg.Gateway); gw == nil || gw.To4() == nil {
+			return nil, fmt.Errorf("invalid ipv4 gateway %v", cfg.Gateway)
+		}
+		ipv4["gateway"] = dbus.MakeVariant(cfg.Gateway)
+	}
+	dns := make([]uint32, 0)
+	for _, d := range cfg.Dns {
+		if len(d) < 1 {
+			continue
+		}
+		ip := net.ParseIP(d).To4()
+		if ip == nil {
+			return nil, fmt.Errorf("invalid ipv4 dns %v", d)
+		}
+		// NetworkManager 的 ipv4.dns 为网络字节序的 uint32, D-Bus 按主机字节序(小端)传输
+		dns = append(dns, binary.LittleEndian.Uint32(ip))
+	}
+	if len(dns) > 0 {
+		ipv4["dns"] = dbus.MakeVariant(dns)
+	}
+	return ipv4, nil
+}
+
+// nmIpv6Privacy Ipv6Privacy_* 到 NetworkManager ipv6.ip6-privacy 的映射, -1 表示使用全局默认值
+var nmIpv6Privacy = map[string]int32{
+	Ipv6Privacy_Default:      -1,
+	Ipv6Privacy_Disabled:     0,
+	Ipv6Privacy_PreferPublic: 1,
+	Ipv6Privacy_PreferTemp:   2,
+}
+
+var nmIpv6PrivacyNames = map[int32]string{
+	0: Ipv6Privacy_Disabled,
+	1: Ipv6Privacy_PreferPublic,
+	2: Ipv6Privacy_PreferTemp,
+}
+
+// ipv6Settings 生成连接配置中的 ipv6 部分.
+func ipv6Settings(cfg Ipv6Config) (map[string]dbus.Variant, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	ipv6 := map[string]dbus.Variant{"method": dbus.MakeVariant(cfg.Method)}
+	switch cfg.Method {
+	case Ipv6Method_LinkLocal, Ipv6Method_Ignore, Ipv6Method_Disabled:
+		return ipv6, nil
+	case Ipv6Method_Manual:
+		addrs := make([]map[string]dbus.Variant, 0, len(cfg.Addresses))
+		for _, a := range cfg.Addresses {
+			ip, ipNet, _ := net.ParseCIDR(a)
+			prefix, _ := ipNet.Mask.Size()
+			addrs = append(addrs, map[string]dbus.Variant{
+				"address": dbus.MakeVariant(ip.String()),
+				"prefix":  dbus.MakeVariant(uint32(prefix)),
+			})
+		}
+		ipv6["address-data"] = dbus.MakeVariant(addrs)
+		if len(cfg.Gateway) > 0 {
+			ipv6["gateway"] = dbus.MakeVariant(cfg.Gateway)
+		}
+	}
+	ipv6["ip6-privacy"] = dbus.MakeVariant(nmIpv6Privacy[cfg.Privacy])
+	dns := make([][]byte, 0)
+	for _, d := range cfg.Dns {
+		if len(d) > 0 {
+			dns = append(dns, []byte(net.ParseIP(d).To16()))
+		}
+	}
+	if len(dns) > 0 {
+		ipv6["dns"] = dbus.MakeVariant(dns)
+	}
+	return ipv6, nil
+}
+
+func isValidPath(p dbus.ObjectPath) bool {
+	return len(p) > 1 && p.IsValid()
+}
+
+type dbusProps map[string]dbus.Variant
+
+func getAllProps(conn *dbus.Conn, p dbus.ObjectPath, iface string) (dbusProps, error) {
+	props := dbusProps{}
+	if err := conn.Object(nmDest, p).Call(dbusPropertiesGetAll, 0, iface).Store(&props); err != nil {
+		return nil, fmt.Errorf("failed to get properties of %v %v, err:%v", p, iface, err)
+	}
+	return props, nil
+}
+
+func variantStr(v dbus.Variant) string {
+	s, _ := v.Value().(string)
+	return s
+}
+
+func (props dbusProps) str(k string) string {
+	return variantStr(props[k])
+}
+
+func (props dbusProps) u32(k string) uint32 {
+	u, _ := props[k].Value().(uint32)
+	return u
+}
+
+func (props dbusProps) byte(k string) byte {
+	u, _ := props[k].Value().(byte)
+	return u
+}
+
+func (props dbusProps) bytes(k string) []byte {
+	b, _ := props[k].Value().([]byte)
+	return b
+}
+
+func (props dbusProps) path(k string) dbus.ObjectPath {
+	p, _ := props[k].Value().(dbus.ObjectPath)
+	return p
+}
+
+func (props dbusProps) dicts(k string) []map[string]dbus.Variant {
+	d, _ := props[k].Value().([]map[string]dbus.Variant)
+	return d
+}
+
+// addressData 把 IP4Config/IP6Config 的 AddressData 转为 address/prefix 形式
+func (props dbusProps) addressData(k string) []string {
+	addrs := make([]string, 0)
+	for _, d := range props.dicts(k) {
+		addr, _ := d["address"].Value().(string)
+		prefix, _ := d["prefix"].Value().(uint32)
+		if len(addr) > 0 {
+			addrs = append(addrs, fmt.Sprintf("%v/%v", addr, prefix))
+		}
+	}
+	return addrs
+}
@@ -0,0 +1,210 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+)
+
+func TestIpv4Settings(t *testing.T) {
+	auto, err := ipv4Settings(Ipv4Config{Method: Ipv4Method_Auto, Address: "192.168.0.2/24"})
+	if err != nil || len(auto) != 1 || auto["method"].Value() != Ipv4Method_Auto {
+		t.Fatalf("auto settings %v, err:%v", auto, err)
+	}
+
+	manual, err := ipv4Settings(Ipv4Config{Method: Ipv4Method_Manual, Address: "192.168.0.213/24",
+		Gateway: "192.168.0.1", Dns: []string{"8.8.8.8", "", "1.2.3.4"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs := manual["address-data"].Value().([]map[string]dbus.Variant)
+	if len(addrs) != 1 || addrs[0]["address"].Value() != "192.168.0.213" || addrs[0]["prefix"].Value() != uint32(24) {
+		t.Errorf("address-data %v", addrs)
+	}
+	if manual["gateway"].Value() != "192.168.0.1" {
+		t.Errorf("gateway %v", manual["gateway"])
+	}
+	dns := manual["dns"].Value().([]uint32)
+	if len(dns) != 2 || dns[0] != 0x08080808 || dns[1] != 0x04030201 {
+		t.Errorf("dns %x", dns)
+	}
+
+	for _, cfg := range []Ipv4Config{
+		{Method: Ipv4Method_Manual, Address: "192.168.0.213"},
+		{Method: Ipv4Method_Manual, Address: "fe80::1/64"},
+		{Method: Ipv4Method_Manual, Address: "192.168.0.213/24", Gateway: "gw"},
+		{Method: Ipv4Method_Manual, Address: "192.168.0.213/24", Dns: []string{"dns.example"}},
+	} {
+		if _, err := ipv4Settings(cfg); err == nil {
+			t.Errorf("expected error for %+v", cfg)
+		}
+	}
+}
+
+func TestIpv6Settings(t *testing.T) {
+	slaac, err := ipv6Settings(Ipv6Config{Method: Ipv6Method_Auto, Privacy: Ipv6Privacy_PreferTemp,
+		Dns: []string{"2001:4860:4860::8888"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slaac["method"].Value() != Ipv6Method_Auto || slaac["ip6-privacy"].Value() != int32(2) {
+		t.Errorf("slaac settings %v", slaac)
+	}
+	if dns := slaac["dns"].Value().([][]byte); len(dns) != 1 || len(dns[0]) != 16 || dns[0][0] != 0x20 {
+		t.Errorf("dns %x", dns)
+	}
+
+	manual, err := ipv6Settings(Ipv6Config{Method: Ipv6Method_Manual,
+		Addresses: []string{"2001:db8::10/64", "fd00::10/64"}, Gateway: "fe80::1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	addrs := manual["address-data"].Value().([]map[string]dbus.Variant)
+	if len(addrs) != 2 || addrs[1]["address"].Value() != "fd00::10" || addrs[1]["prefix"].Value() != uint32(64) {
+		t.Errorf("address-data %v", addrs)
+	}
+	if manual["gateway"].Value() != "fe80::1" || manual["ip6-privacy"].Value() != int32(-1) {
+		t.Errorf("manual settings %v", manual)
+	}
+
+	for _, cfg := range []Ipv6Config{
+		{Method: "slaac"},
+		{Method: Ipv6Method_Manual},
+		{Method: Ipv6Method_Manual, Addresses: []string{"192.168.0.2/24"}},
+		{Method: Ipv6Method_Manual, Addresses: []string{"2001:db8::10/64"}, Gateway: "192.168.0.1"},
+		{Method: Ipv6Method_Dhcp, Dns: []string{"8.8.8.8"}},
+		{Method: Ipv6Method_Auto, Privacy: "on"},
+	} {
+		if _, err := ipv6Settings(cfg); err == nil {
+			t.Errorf("expected error for %+v", cfg)
+		}
+	}
+}
+
+func TestWifiProfileSettings(t *testing.T) {
+	sae := wifiProfileSettings(WifiProfileConfig{Ssid: "home", Hidden: true, Security: WifiSecurity_Sae,
+		Password: "secret", Priority: 10, AutoConnect: true}, "uuid-1")
+	if sae["802-11-wireless-security"]["key-mgmt"].Value() != "sae" || sae["802-11-wireless-security"]["psk"].Value() != "secret" {
+		t.Errorf("sae security %v", sae["802-11-wireless-security"])
+	}
+	profile := wifiProfileOf(sae)
+	if profile.Uuid != "uuid-1" || profile.Ssid != "home" || !profile.Hidden || profile.Security != WifiSecurity_Sae ||
+		profile.Priority != 10 || !profile.AutoConnect {
+		t.Errorf("sae profile %+v", profile)
+	}
+
+	// 修改配置时未传密码, 不写入 psk
+	if _, ok := wifiProfileSettings(WifiProfileConfig{Ssid: "home", Security: WifiSecurity_WpaPsk}, "uuid-1")["802-11-wireless-security"]["psk"]; ok {
+		t.Errorf("empty psk should not be set")
+	}
+
+	peap := wifiProfileSettings(WifiProfileConfig{Ssid: "corp", Security: WifiSecurity_Enterprise,
+		Eap: WifiEapConfig{Method: WifiEap_Peap, Identity: "alice", Password: "pwd", CaCertPath: "/etc/ca.pem"}}, "uuid-2")
+	eap := peap["802-1x"]
+	if methods := eap["eap"].Value().([]string); len(methods) != 1 || methods[0] != "peap" {
+		t.Errorf("eap %v", methods)
+	}
+	if eap["phase2-auth"].Value() != WifiPhase2_Mschapv2 || eap["password"].Value() != "pwd" ||
+		string(eap["ca-cert"].Value().([]byte)) != "file:///etc/ca.pem\x00" {
+		t.Errorf("802-1x %v", eap)
+	}
+	if _, ok := peap["802-1x"]["anonymous-identity"]; ok {
+		t.Errorf("empty anonymous-identity should not be set")
+	}
+	profile = wifiProfileOf(peap)
+	if profile.Security != WifiSecurity_Enterprise || profile.EapMethod != WifiEap_Peap || profile.Identity != "alice" || profile.AutoConnect {
+		t.Errorf("peap profile %+v", profile)
+	}
+
+	open := wifiProfileOf(nmSettings{"connection": {"uuid": dbus.MakeVariant("uuid-3")},
+		nmWifiType: {"ssid": dbus.MakeVariant([]byte("cafe"))}})
+	if open.Security != WifiSecurity_None || !open.AutoConnect || open.Priority != 0 {
+		t.Errorf("open profile %+v", open)
+	}
+
+	for _, cfg := range []WifiProfileConfig{
+		{Ssid: "", Security: WifiSecurity_None},
+		{Ssid: "home", Security: "wep"},
+		{Ssid: "home", Security: WifiSecurity_WpaPsk, Password: "short"},
+		{Ssid: "corp", Security: WifiSecurity_Enterprise, Eap: WifiEapConfig{Method: "tls", Identity: "alice"}},
+		{Ssid: "corp", Security: WifiSecurity_Enterprise, Eap: WifiEapConfig{Method: WifiEap_Ttls}},
+		{Ssid: "corp", Security: WifiSecurity_Enterprise, Eap: WifiEapConfig{Method: WifiEap_Ttls, Identity: "a", CaCertPath: "ca.pem"}},
+		// 不校验服务器证书必须明确指定
+		{Ssid: "corp", Security: WifiSecurity_Enterprise, Eap: WifiEapConfig{Method: WifiEap_Peap, Identity: "a"}},
+		{Ssid: "home", Security: WifiSecurity_Sae, Password: strings.Repeat("a", 129)},
+	} {
+		if err := cfg.Validate(); err == nil {
+			t.Errorf("expected error for %+v", cfg)
+		}
+	}
+	for _, cfg := range []WifiProfileConfig{
+		{Ssid: "home", Security: WifiSecurity_Sae, Password: "short"},
+		{Ssid: "corp", Security: WifiSecurity_Enterprise, Eap: WifiEapConfig{Method: WifiEap_Peap, Identity: "a", DomainSuffixMatch: "corp.example.com"}},
+		{Ssid: "corp", Security: WifiSecurity_Enterprise, Eap: WifiEapConfig{Method: WifiEap_Peap, Identity: "a", NoServerCertCheck: true}},
+	} {
+		if err := cfg.Validate(); err != nil {
+			t.Errorf("%+v, err:%v", cfg, err)
+		}
+	}
+
+	// 新增配置或修改了安全类型时必须传密码
+	psk := WifiProfileConfig{Ssid: "home", Security: WifiSecurity_WpaPsk}
+	if err := psk.validateSecret("", false); !errors.Is(err, ErrWifiPasswordRequired) {
+		t.Errorf("new psk without password, err:%v", err)
+	}
+	if err := psk.validateSecret(WifiSecurity_Sae, true); !errors.Is(err, ErrWifiPasswordRequired) {
+		t.Errorf("security changed without password, err:%v", err)
+	}
+	if err := psk.validateSecret(WifiSecurity_WpaPsk, true); err != nil {
+		t.Errorf("keep old password, err:%v", err)
+	}
+	eapCfg := WifiProfileConfig{Ssid: "corp", Security: WifiSecurity_Enterprise}
+	if err := eapCfg.validateSecret("", false); !errors.Is(err, ErrWifiPasswordRequired) {
+		t.Errorf("new eap without password, err:%v", err)
+	}
+	if err := (&WifiProfileConfig{Ssid: "cafe", Security: WifiSecurity_None}).validateSecret("", false); err != nil {
+		t.Errorf("open, err:%v", err)
+	}
+}
+
+func TestWifiReconnectSettings(t *testing.T) {
+	old := wifiProfileSettings(WifiProfileConfig{Ssid: "home", Security: WifiSecurity_WpaPsk,
+		Password: "old-secret", Priority: 10, AutoConnect: true}, "uuid-1")
+	old["ipv4"] = map[string]dbus.Variant{"method": dbus.MakeVariant("manual")}
+
+	ap := &dbusAccessPoint{AccessPoint: &AccessPoint{Ssid: "home"}, secure: true, sae: true}
+	settings := wifiReconnectSettings(old, ap, "new-secret")
+	security := settings["802-11-wireless-security"]
+	if security["key-mgmt"].Value() != "sae" || security["psk"].Value() != "new-secret" {
+		t.Errorf("security %v", security)
+	}
+	profile := wifiProfileOf(settings)
+	if profile.Uuid != "uuid-1" || profile.Priority != 10 || settings["ipv4"]["method"].Value() != "manual" {
+		t.Errorf("settings not kept, profile %+v, ipv4 %v", profile, settings["ipv4"])
+	}
+	if old["802-11-wireless-security"]["psk"].Value() != "old-secret" {
+		t.Errorf("old settings modified")
+	}
+
+	// 热点改为开放网络时去掉加密设置
+	open := wifiReconnectSettings(old, &dbusAccessPoint{AccessPoint: &AccessPoint{Ssid: "home"}}, "")
+	if _, ok := open["802-11-wireless-security"]; ok {
+		t.Errorf("security should be removed for open network")
+	}
+}
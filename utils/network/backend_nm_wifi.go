@@ -0,0 +1,253 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/google/uuid"
+)
+
+const nmWifiType = "802-11-wireless"
+
+func (b *NMDBusBackend) WifiProfiles() ([]*WifiProfile, error) {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect system bus, err:%v", err)
+	}
+	devices, err := b.Devices()
+	if err != nil {
+		return nil, err
+	}
+	active := map[string]bool{}
+	for _, dev := range devices {
+		if dev.IsWireless() && dev.IsConnected() {
+			active[dev.ConnectionUuid] = true
+		}
+	}
+
+	var paths []dbus.ObjectPath
+	if err := conn.Object(nmDest, nmSettingsPath).Call(nmSettingsIface+".ListConnections", 0).Store(&paths); err != nil {
+		return nil, fmt.Errorf("failed to list connections, err:%v", err)
+	}
+	profiles := make([]*WifiProfile, 0)
+	for _, p := range paths {
+		settings, err := connectionSettings(conn, p)
+		if err != nil || variantStr(settings["connection"]["type"]) != nmWifiType {
+			continue
+		}
+		profile := wifiProfileOf(settings)
+		profile.Active = active[profile.Uuid]
+		profiles = append(profiles, profile)
+	}
+	sortWifiProfiles(profiles)
+	return profiles, nil
+}
+
+func (b *NMDBusBackend) SaveWifiProfile(cfg WifiProfileConfig) (string, error) {
+	if err := cfg.Validate(); err != nil {
+		return "", err
+	}
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return "", fmt.Errorf("failed to connect system bus, err:%v", err)
+	}
+	p, old, err := wifiConnectionBySsid(conn, cfg.Ssid)
+	if err != nil {
+		return "", err
+	}
+	if old == nil {
+		if err := cfg.validateSecret("", false); err != nil {
+			return "", err
+		}
+		settings := wifiProfileSettings(cfg, uuid.New().String())
+		var connPath dbus.ObjectPath
+		if err := conn.Object(nmDest, nmSettingsPath).Call(nmSettingsIface+".AddConnection", 0, settings).Store(&connPath); err != nil {
+			return "", fmt.Errorf("failed to add wifi profile %v, err:%v", cfg.Ssid, err)
+		}
+		return variantStr(settings["connection"]["uuid"]), nil
+	}
+
+	conUuid := variantStr(old["connection"]["uuid"])
+	if err := mergeSecrets(conn, p, old); err != nil {
+		return "", err
+	}
+	_, hasPsk := old["802-11-wireless-security"]["psk"]
+	_, hasEapPassword := old["802-1x"]["password"]
+	if err := cfg.validateSecret(variantStr(old["802-11-wireless-security"]["key-mgmt"]), hasPsk || hasEapPassword); err != nil {
+		return "", err
+	}
+	settings := wifiProfileSettings(cfg, conUuid)
+	// 未传密码时保留原密码, ip 设置保持不变
+	if len(cfg.Password) < 1 && variantStr(old["802-11-wireless-security"]["key-mgmt"]) == cfg.Security {
+		if psk, ok := old["802-11-wireless-security"]["psk"]; ok && settings["802-11-wireless-security"] != nil {
+			settings["802-11-wireless-security"]["psk"] = psk
+		}
+	}
+	if len(cfg.Eap.Password) < 1 && settings["802-1x"] != nil {
+		if pwd, ok := old["802-1x"]["password"]; ok {
+			settings["802-1x"]["password"] = pwd
+		}
+	}
+	for _, name := range []string{"ipv4", "ipv6"} {
+		if s, ok := old[name]; ok {
+			settings[name] = s
+		}
+	}
+	if err := conn.Object(nmDest, p).Call(nmConnectionIface+".Update", 0, settings).Err; err != nil {
+		return "", fmt.Errorf("failed to update wifi profile %v, err:%v", cfg.Ssid, err)
+	}
+	return conUuid, nil
+}
+
+func (b *NMDBusBackend) SetWifiPriority(conUuid string, priority int32, autoConnect bool) error {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return fmt.Errorf("failed to connect system bus, err:%v", err)
+	}
+	p, err := connectionPathByUuid(conn, conUuid)
+	if err != nil {
+		return err
+	}
+	settings, err := connectionSettings(conn, p)
+	if err != nil {
+		return err
+	}
+	if variantStr(settings["connection"]["type"]) != nmWifiType {
+		return fmt.Errorf("connection %v is not wifi", conUuid)
+	}
+	if err := mergeSecrets(conn, p, settings); err != nil {
+		return err
+	}
+	settings["connection"]["autoconnect"] = dbus.MakeVariant(autoConnect)
+	settings["connection"]["autoconnect-priority"] = dbus.MakeVariant(priority)
+	if err := conn.Object(nmDest, p).Call(nmConnectionIface+".Update", 0, settings).Err; err != nil {
+		return fmt.Errorf("failed to update connection %v, err:%v", conUuid, err)
+	}
+	return nil
+}
+
+// wifiConnectionBySsid 返回 SSID 对应的 wifi 连接, 没有时 settings 为 nil.
+func wifiConnectionBySsid(conn *dbus.Conn, ssid string) (dbus.ObjectPath, nmSettings, error) {
+	var paths []dbus.ObjectPath
+	if err := conn.Object(nmDest, nmSettingsPath).Call(nmSettingsIface+".ListConnections", 0).Store(&paths); err != nil {
+		return "", nil, fmt.Errorf("failed to list connections, err:%v", err)
+	}
+	for _, p := range paths {
+		settings, err := connectionSettings(conn, p)
+		if err != nil || variantStr(settings["connection"]["type"]) != nmWifiType {
+			continue
+		}
+		if s, _ := settings[nmWifiType]["ssid"].Value().([]byte); string(s) == ssid {
+			return p, settings, nil
+		}
+	}
+	return "", nil, nil
+}
+
+// wifiProfileSettings 生成 wifi 连接配置. 空密码不写入, 由调用者决定是否保留原密码.
+func wifiProfileSettings(cfg WifiProfileConfig, conUuid string) nmSettings {
+	settings := nmSettings{
+		"connection": {
+			"id":                   dbus.MakeVariant(cfg.Ssid),
+			"uuid":                 dbus.MakeVariant(conUuid),
+			"type":                 dbus.MakeVariant(nmWifiType),
+			"autoconnect":          dbus.MakeVariant(cfg.AutoConnect),
+			"autoconnect-priority": dbus.MakeVariant(cfg.Priority),
+		},
+		nmWifiType: {
+			"ssid":   dbus.MakeVariant([]byte(cfg.Ssid)),
+			"mode":   dbus.MakeVariant("infrastructure"),
+			"hidden": dbus.MakeVariant(cfg.Hidden),
+		},
+	}
+	switch cfg.Security {
+	case WifiSecurity_WpaPsk, WifiSecurity_Sae:
+		security := map[string]dbus.Variant{"key-mgmt": dbus.MakeVariant(cfg.Security)}
+		if len(cfg.Password) > 0 {
+			security["psk"] = dbus.MakeVariant(cfg.Password)
+		}
+		settings["802-11-wireless-security"] = security
+	case WifiSecurity_Enterprise:
+		settings["802-11-wireless-security"] = map[string]dbus.Variant{"key-mgmt": dbus.MakeVariant(cfg.Security)}
+		phase2 := cfg.Eap.Phase2Auth
+		if len(phase2) < 1 {
+			phase2 = WifiPhase2_Mschapv2
+		}
+		eap := map[string]dbus.Variant{
+			"eap":         dbus.MakeVariant([]string{cfg.Eap.Method}),
+			"identity":    dbus.MakeVariant(cfg.Eap.Identity),
+			"phase2-auth": dbus.MakeVariant(phase2),
+		}
+		if len(cfg.Eap.Password) > 0 {
+			eap["password"] = dbus.MakeVariant(cfg.Eap.Password)
+		}
+		if len(cfg.Eap.AnonymousIdentity) > 0 {
+			eap["anonymous-identity"] = dbus.MakeVariant(cfg.Eap.AnonymousIdentity)
+		}
+		if len(cfg.Eap.CaCertPath) > 0 {
+			// NetworkManager 的证书路径格式为 file:// 开头并以 \0 结尾的字节串
+			eap["ca-cert"] = dbus.MakeVariant([]byte("file://" + cfg.Eap.CaCertPath + "\x00"))
+		}
+		if len(cfg.Eap.DomainSuffixMatch) > 0 {
+			eap["domain-suffix-match"] = dbus.MakeVariant(cfg.Eap.DomainSuffixMatch)
+		}
+		settings["802-1x"] = eap
+	}
+	return settings
+}
+
+// wifiProfileOf 从连接配置中取出 wifi 配置, 不包含 Active.
+func wifiProfileOf(settings nmSettings) *WifiProfile {
+	ssid, _ := settings[nmWifiType]["ssid"].Value().([]byte)
+	hidden, _ := settings[nmWifiType]["hidden"].Value().(bool)
+	priority, _ := settings["connection"]["autoconnect-priority"].Value().(int32)
+	profile := &WifiProfile{
+		Uuid:        variantStr(settings["connection"]["uuid"]),
+		Ssid:        string(ssid),
+		Hidden:      hidden,
+		Security:    WifiSecurity_None,
+		Priority:    priority,
+		AutoConnect: true, // 未设置时 NetworkManager 默认自动连接
+	}
+	if autoConnect, ok := settings["connection"]["autoconnect"].Value().(bool); ok {
+		profile.AutoConnect = autoConnect
+	}
+	if security, ok := settings["802-11-wireless-security"]; ok {
+		if keyMgmt := variantStr(security["key-mgmt"]); len(keyMgmt) > 0 {
+			profile.Security = keyMgmt
+		}
+	}
+	if eap, ok := settings["802-1x"]; ok {
+		if methods, _ := eap["eap"].Value().([]string); len(methods) > 0 {
+			profile.EapMethod = methods[0]
+		}
+		profile.Identity = variantStr(eap["identity"])
+	}
+	return profile
+}
+
+// sortWifiProfiles 按优先级从高到低排序, 优先级相同时按 SSID 排序
+func sortWifiProfiles(profiles []*WifiProfile) {
+	sort.SliceStable(profiles, func(i, j int) bool {
+		if profiles[i].Priority != profiles[j].Priority {
+			return profiles[i].Priority > profiles[j].Priority
+		}
+		return strings.Compare(profiles[i].Ssid, profiles[j].Ssid) < 0
+	})
+}
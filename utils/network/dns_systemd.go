@@ -16,47 +16,65 @@ package network
 
 import (
 	"agent/config"
-	"strings"
 
 	"agent/utils/logger"
 	"github.com/dungeonsnd/gocom/file/fileutil"
 )
 
+// GetSystemdDns 返回 resolved.conf 中 DNS= 的第一个 ipv4 地址和 FallbackDNS= 中的 ipv4 地址.
 func GetSystemdDns() (string, []string, error) {
-
-	f := config.Config.Box.DnsConfigFile
-	content, err := fileutil.ReadFromFile(f)
+	dns, fallback, err := readSystemdDns()
 	if err != nil {
 		return "", nil, err
 	}
-	s := string(content)
-
 	DNS := ""
-	k1 := "DNS="
-	i := strings.Index(s, k1)
-	if i > 0 {
-		m := strings.Index(s[i+len(k1):], "\n")
-		DNS = s[i+len(k1):][:m]
+	if v4, _ := splitDnsByFamily(dns); len(v4) > 0 {
+		DNS = v4[0]
+	}
+	DNS2, _ := splitDnsByFamily(fallback)
+	return DNS, DNS2, nil
+}
+
+// GetSystemdDnsIpv6 返回 resolved.conf 中 DNS= 和 FallbackDNS= 里的 ipv6 地址, DNS= 中的在前.
+func GetSystemdDnsIpv6() ([]string, error) {
+	dns, fallback, err := readSystemdDns()
+	if err != nil {
+		return nil, err
 	}
+	_, v6 := splitDnsByFamily(dns)
+	_, fallbackV6 := splitDnsByFamily(fallback)
+	return append(v6, fallbackV6...), nil
+}
 
-	FallbackDNS := ""
-	k2 := "FallbackDNS="
-	j := strings.Index(s, k2)
-	if j > 0 {
-		m := strings.Index(s[j+len(k2):], "\n")
-		FallbackDNS = s[j+len(k2):][:m]
+func readSystemdDns() ([]string, []string, error) {
+	content, err := fileutil.ReadFromFile(config.Config.Box.DnsConfigFile)
+	if err != nil {
+		return nil, nil, err
 	}
+	cfg := ParseResolvedConf(string(content))
+	return cfg.Dns, cfg.FallbackDns, nil
+}
 
-	DNS2 := []string{}
-	arr := strings.Split(FallbackDNS, " ")
-	for _, ele := range arr {
-		if len(ele) > 6 {
-			DNS2 = append(DNS2, ele)
+// splitDnsByFamily 把 dns 地址按 ipv4/ipv6 分开, 忽略空串和无法解析的地址.
+func splitDnsByFamily(dns []string) ([]string, []string) {
+	v4, v6 := []string{}, []string{}
+	for _, d := range dns {
+		// resolved.conf 中可以带端口或 SNI, 如 1.1.1.1#cloudflare-dns.com
+		server, err := ParseResolvedDns(d)
+		if err != nil {
+			continue
+		}
+		if server.IP.To4() != nil {
+			v4 = append(v4, d)
+		} else {
+			v6 = append(v6, d)
 		}
 	}
-	return DNS, DNS2, nil
+	return v4, v6
 }
 
+// SetSystemdDnsManual 设置 dns, 可同时包含 ipv4 和 ipv6 地址. 第一个 ipv4 和第一个 ipv6 地址写入 DNS=,
+// 其余追加到 FallbackDNS=.
 func SetSystemdDnsManual(dns ...string) error {
 	f := config.Config.Box.DnsConfigFile
 	fBackup := config.Config.Box.DnsConfigFileBackup
@@ -84,24 +102,20 @@ func SetSystemdDnsManual(dns ...string) error {
 	}
 
 	// 修改 dns
-	if len(dns) > 0 {
-		s := string(content)
-
-		i := strings.Index(s, "DNS=")
-		if i > 0 {
-			m := strings.Index(s[i:], "\n")
-			oldDNSLine := s[i:][:m]
-			s = strings.ReplaceAll(s, oldDNSLine, "DNS="+dns[0])
-		}
-
-		j := strings.Index(s, "FallbackDNS=")
-		if j > 0 {
-			m := strings.Index(s[j:], "\n")
-			oldFallbackDNSLine := s[j:][:m]
-			s = strings.ReplaceAll(s, oldFallbackDNSLine, oldFallbackDNSLine+" "+strings.Join(dns[1:], " "))
+	v4, v6 := splitDnsByFamily(dns)
+	if len(v4)+len(v6) > 0 {
+		primary, others := []string{}, []string{}
+		for _, family := range [][]string{v4, v6} {
+			if len(family) > 0 {
+				primary = append(primary, family[0])
+				others = append(others, family[1:]...)
+			}
 		}
 
-		if err = fileutil.WriteToFile(f, []byte(s), true); err != nil {
+		cfg := ParseResolvedConf(string(content))
+		cfg.Dns = primary
+		cfg.FallbackDns = append(cfg.FallbackDns, others...)
+		if err = fileutil.WriteToFile(f, []byte(FormatResolvedConf(string(content), cfg)), true); err != nil {
 			return err
 		}
 
@@ -133,7 +147,7 @@ func restartSystemdResolved() error {
 	// systemctl restart systemd-resolved
 	params := []string{"restart", "systemd-resolved"}
 	if err := runCmd2("systemctl", params); err != nil {
-		logger.AppLogger().Warnf("SetWirelessIpAuto, clear original ipv4.addresses failed. err:%v", err)
+		logger.AppLogger().Warnf("restart systemd-resolved failed. err:%v", err)
 		return err
 	}
 	return nil
@@ -0,0 +1,298 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"agent/utils/logger"
+)
+
+const (
+	Failover_Reason_Initial      = "initial"       // 启动后第一次选出链路
+	Failover_Reason_LinkDown     = "link_down"     // 原链路断开(如拔掉网线)
+	Failover_Reason_InternetLost = "internet_lost" // 原链路连续多次探测不到互联网
+	Failover_Reason_Failback     = "failback"      // 更优先的链路恢复并稳定一段时间后切回
+	Failover_Reason_Recovered    = "recovered"     // 一段时间没有可用链路后有链路恢复
+
+	// FailoverDemotedMetric 非当前链路的路由度量值, 大于 NetworkManager 默认的有线 100、无线 600
+	FailoverDemotedMetric = 20000
+)
+
+// LinkHealth 一条链路(网卡)的健康状态
+type LinkHealth struct {
+	Interface           string    `json:"interface"`
+	Type                string    `json:"type"` // DevStatus_Type_Wire, DevStatus_Type_Wireless
+	ConnectionId        string    `json:"connectionId"`
+	Connected           bool      `json:"connected"`
+	Healthy             bool      `json:"healthy"` // 已连接且能访问互联网
+	ConsecutiveFailures int       `json:"consecutiveFailures"`
+	HealthySince        time.Time `json:"healthySince"`
+	LastProbe           time.Time `json:"lastProbe"`
+}
+
+// FailoverTransition 一次链路切换, From/To 为网卡名, 空串表示没有可用链路
+type FailoverTransition struct {
+	Time   time.Time `json:"time"`
+	From   string    `json:"from"`
+	To     string    `json:"to"`
+	Reason string    `json:"reason"` // Failover_Reason_*
+}
+
+// FailoverEngine 链路选择策略: 有线优先于无线; 当前链路断开或连续 FailThreshold 次探测失败时切换到下一条健康的链路,
+// 没有健康链路时按优先级激活已保存的 wifi; 更优先的链路恢复后需持续健康 FailbackStable 才切回.
+// 切换通过调整路由度量值实现, 不断开其他链路, 局域网访问不受影响.
+type FailoverEngine struct {
+	Prober         func(iface string) bool // 通过指定网卡探测互联网是否可达
+	FailThreshold  int
+	FailbackStable time.Duration
+	MaxTransitions int // 保留的切换记录条数
+	Now            func() time.Time
+
+	mtx         sync.Mutex
+	started     bool // 是否已选出过链路
+	active      string
+	links       map[string]*LinkHealth
+	demoted     map[string]bool      // 已调高路由度量值的网卡
+	wifiAttempt map[string]time.Time // 连接 uuid -> 上次主动激活的时间
+	transitions []*FailoverTransition
+}
+
+func NewFailoverEngine(prober func(iface string) bool, failThreshold int, failbackStable time.Duration, maxTransitions int) *FailoverEngine {
+	if failThreshold < 1 {
+		failThreshold = 1
+	}
+	return &FailoverEngine{Prober: prober, FailThreshold: failThreshold, FailbackStable: failbackStable,
+		MaxTransitions: maxTransitions, Now: time.Now, links: map[string]*LinkHealth{}, demoted: map[string]bool{},
+		wifiAttempt: map[string]time.Time{}}
+}
+
+// Status 返回当前链路、各链路状态(按优先级排序)和切换记录(从旧到新)
+func (e *FailoverEngine) Status() (string, []LinkHealth, []FailoverTransition) {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	links := make([]LinkHealth, 0, len(e.links))
+	for _, l := range e.rankedLinks() {
+		links = append(links, *l)
+	}
+	transitions := make([]FailoverTransition, 0, len(e.transitions))
+	for _, t := range e.transitions {
+		transitions = append(transitions, *t)
+	}
+	return e.active, links, transitions
+}
+
+// Evaluate 探测所有已连接的链路并在需要时切换. 由调用者定时或在网络变化时调用, 不能并发调用.
+func (e *FailoverEngine) Evaluate() error {
+	devices, err := Backend().Devices()
+	if err != nil {
+		return err
+	}
+	// 探测和激活 wifi 都较慢, 不持有锁
+	probes := map[string]bool{}
+	for _, dev := range devices {
+		if dev.IsEthernetAndWifi() && dev.IsConnected() {
+			probes[dev.Interface] = e.Prober(dev.Interface)
+		}
+	}
+	if !e.evaluate(devices, probes) {
+		e.activateWifi(devices)
+	}
+	return nil
+}
+
+// evaluate 更新链路状态并选出当前链路, 没有健康链路时返回 false.
+func (e *FailoverEngine) evaluate(devices []*Device, probes map[string]bool) bool {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	now := e.Now()
+	e.updateLinks(devices, probes, now)
+	ranked := e.rankedLinks()
+
+	current := e.links[e.active]
+	var target *LinkHealth
+	for _, l := range ranked {
+		if !l.Connected || !l.Healthy {
+			continue
+		}
+		// 当前链路仍健康时, 更优先的链路需稳定一段时间才切回
+		if current != nil && l != current && current.Healthy && now.Sub(l.HealthySince) < e.FailbackStable {
+			continue
+		}
+		target = l
+		break
+	}
+
+	if target == nil {
+		if len(e.active) > 0 {
+			reason := Failover_Reason_InternetLost
+			if current == nil || !current.Connected {
+				reason = Failover_Reason_LinkDown
+			}
+			e.record(&FailoverTransition{Time: now, From: e.active, To: "", Reason: reason})
+			e.active = ""
+		}
+		return false
+	}
+	if target != current {
+		reason := Failover_Reason_Failback
+		switch {
+		case !e.started:
+			reason = Failover_Reason_Initial
+		case current == nil:
+			reason = Failover_Reason_Recovered
+		case !current.Connected:
+			reason = Failover_Reason_LinkDown
+		case !current.Healthy:
+			reason = Failover_Reason_InternetLost
+		}
+		e.record(&FailoverTransition{Time: now, From: e.active, To: target.Interface, Reason: reason})
+		e.active, e.started = target.Interface, true
+	}
+	e.applyMetrics(ranked)
+	return true
+}
+
+func (e *FailoverEngine) updateLinks(devices []*Device, probes map[string]bool, now time.Time) {
+	seen := map[string]bool{}
+	for _, dev := range devices {
+		if !dev.IsEthernetAndWifi() {
+			continue
+		}
+		seen[dev.Interface] = true
+		l, ok := e.links[dev.Interface]
+		if !ok {
+			l = &LinkHealth{Interface: dev.Interface}
+			e.links[dev.Interface] = l
+		}
+		l.Type, l.ConnectionId, l.Connected = dev.Type, dev.ConnectionId, dev.IsConnected()
+		if !l.Connected {
+			l.Healthy, l.ConsecutiveFailures, l.HealthySince = false, 0, time.Time{}
+			// 重新激活后 NetworkManager 使用连接配置中的度量值
+			delete(e.demoted, dev.Interface)
+			continue
+		}
+		l.LastProbe = now
+		if probes[dev.Interface] {
+			l.ConsecutiveFailures = 0
+			if !l.Healthy {
+				l.Healthy, l.HealthySince = true, now
+			}
+			continue
+		}
+		l.ConsecutiveFailures++
+		if l.ConsecutiveFailures >= e.FailThreshold {
+			l.Healthy, l.HealthySince = false, time.Time{}
+		}
+	}
+	for name := range e.links {
+		if !seen[name] {
+			delete(e.links, name)
+			delete(e.demoted, name)
+		}
+	}
+}
+
+// rankedLinks 有线优先, 同类型按网卡名排序
+func (e *FailoverEngine) rankedLinks() []*LinkHealth {
+	ranked := make([]*LinkHealth, 0, len(e.links))
+	for _, l := range e.links {
+		ranked = append(ranked, l)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		wi, wj := ranked[i].Type == DevStatus_Type_Wire, ranked[j].Type == DevStatus_Type_Wire
+		if wi != wj {
+			return wi
+		}
+		return ranked[i].Interface < ranked[j].Interface
+	})
+	return ranked
+}
+
+// applyMetrics 当前链路恢复默认路由度量值, 其他已连接的链路调高度量值, 使默认路由走当前链路.
+func (e *FailoverEngine) applyMetrics(ranked []*LinkHealth) {
+	if len(e.active) < 1 {
+		return
+	}
+	for _, l := range ranked {
+		if !l.Connected {
+			continue
+		}
+		demote := l.Interface != e.active
+		if demote == e.demoted[l.Interface] {
+			continue
+		}
+		metric := int64(-1)
+		if demote {
+			metric = FailoverDemotedMetric
+		}
+		if err := Backend().SetDeviceRouteMetric(l.Interface, metric); err != nil {
+			logger.AppLogger().Warnf("failover, SetDeviceRouteMetric %v %v, err:%v", l.Interface, metric, err)
+			continue
+		}
+		e.demoted[l.Interface] = demote
+	}
+}
+
+// activateWifi 没有健康链路且 wifi 网卡空闲时, 按优先级激活一个已保存且允许自动连接的 wifi.
+// 同一配置在 FailbackStable 内只尝试一次, 避免反复激活.
+func (e *FailoverEngine) activateWifi(devices []*Device) {
+	idle := false
+	for _, dev := range devices {
+		if dev.IsWireless() && !dev.IsConnected() && dev.State != DevState_Unavailable && dev.State != DevState_Unmanaged {
+			idle = true
+		}
+	}
+	if !idle {
+		return
+	}
+	profiles, err := Backend().WifiProfiles()
+	if err != nil {
+		logger.AppLogger().Warnf("failover, WifiProfiles err:%v", err)
+		return
+	}
+	for _, p := range profiles {
+		if !p.AutoConnect || p.Active || !e.tryWifi(p.Uuid) {
+			continue
+		}
+		logger.AppLogger().Infof("failover, activating wifi %v", p.Ssid)
+		if err := Backend().ActivateConnection(p.Uuid); err != nil {
+			logger.AppLogger().Warnf("failover, ActivateConnection %v, err:%v", p.Ssid, err)
+			continue
+		}
+		return
+	}
+}
+
+func (e *FailoverEngine) tryWifi(conUuid string) bool {
+	e.mtx.Lock()
+	defer e.mtx.Unlock()
+	now := e.Now()
+	if t, ok := e.wifiAttempt[conUuid]; ok && now.Sub(t) < e.FailbackStable {
+		return false
+	}
+	e.wifiAttempt[conUuid] = now
+	return true
+}
+
+func (e *FailoverEngine) record(t *FailoverTransition) {
+	logger.AppLogger().Infof("failover, %v -> %v, reason:%v", t.From, t.To, t.Reason)
+	e.transitions = append(e.transitions, t)
+	if e.MaxTransitions > 0 && len(e.transitions) > e.MaxTransitions {
+		e.transitions = e.transitions[len(e.transitions)-e.MaxTransitions:]
+	}
+}
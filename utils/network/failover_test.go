@@ -0,0 +1,102 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFailoverEngine(t *testing.T) {
+	fake := NewFakeBackend()
+	fake.DevicesList = []*Device{
+		{Interface: "eth0", Type: DevStatus_Type_Wire, State: DevState_Connected, ConnectionId: "eth0", ConnectionUuid: "wired"},
+		{Interface: "wlan0", Type: DevStatus_Type_Wireless, State: DevState_Disconnected},
+	}
+	fake.Connections["wired"] = &Connection{Id: "eth0", Uuid: "wired", Type: "802-3-ethernet", InterfaceName: "eth0"}
+	old := SetBackend(fake)
+	defer SetBackend(old)
+	home, err := fake.SaveWifiProfile(WifiProfileConfig{Ssid: "home", Security: WifiSecurity_WpaPsk, Password: "12345678",
+		Priority: 5, AutoConnect: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	online := map[string]bool{"eth0": true, "wlan0": true}
+	now := time.Unix(1700000000, 0)
+	e := NewFailoverEngine(func(iface string) bool { return online[iface] }, 2, time.Minute, 10)
+	e.Now = func() time.Time { return now }
+	step := func() {
+		now = now.Add(15 * time.Second)
+		if err := e.Evaluate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := func(active string, reasons ...string) {
+		t.Helper()
+		a, _, transitions := e.Status()
+		if a != active || len(transitions) != len(reasons) {
+			t.Fatalf("active %v, transitions %+v", a, transitions)
+		}
+		for i, r := range reasons {
+			if transitions[i].Reason != r {
+				t.Fatalf("transition %v %+v, want %v", i, transitions[i], r)
+			}
+		}
+	}
+
+	step()
+	expect("eth0", Failover_Reason_Initial)
+
+	// 拔掉网线: 没有健康链路, 激活已保存的 wifi
+	fake.DevicesList[0].State, fake.DevicesList[0].ConnectionUuid = DevState_Unavailable, ""
+	step()
+	expect("", Failover_Reason_Initial, Failover_Reason_LinkDown)
+	if fake.DevicesList[1].ConnectionUuid != home {
+		t.Fatalf("wifi not activated, %+v", fake.DevicesList[1])
+	}
+	step()
+	expect("wlan0", Failover_Reason_Initial, Failover_Reason_LinkDown, Failover_Reason_Recovered)
+
+	// 插回网线: 稳定 FailbackStable 后才切回, 期间有线链路被调高度量值
+	fake.DevicesList[0].State, fake.DevicesList[0].ConnectionUuid = DevState_Connected, "wired"
+	step()
+	expect("wlan0", Failover_Reason_Initial, Failover_Reason_LinkDown, Failover_Reason_Recovered)
+	if fake.RouteMetrics["eth0"] != FailoverDemotedMetric {
+		t.Errorf("eth0 should be demoted, metrics %v", fake.RouteMetrics)
+	}
+	for i := 0; i < 4; i++ {
+		step()
+	}
+	expect("eth0", Failover_Reason_Initial, Failover_Reason_LinkDown, Failover_Reason_Recovered, Failover_Reason_Failback)
+	if _, ok := fake.RouteMetrics["eth0"]; ok || fake.RouteMetrics["wlan0"] != FailoverDemotedMetric {
+		t.Errorf("metrics after failback %v", fake.RouteMetrics)
+	}
+
+	// 有线链路连续 2 次探测失败后切到 wifi
+	online["eth0"] = false
+	step()
+	expect("eth0", Failover_Reason_Initial, Failover_Reason_LinkDown, Failover_Reason_Recovered, Failover_Reason_Failback)
+	step()
+	expect("wlan0", Failover_Reason_Initial, Failover_Reason_LinkDown, Failover_Reason_Recovered, Failover_Reason_Failback,
+		Failover_Reason_InternetLost)
+	if _, ok := fake.RouteMetrics["wlan0"]; ok || fake.RouteMetrics["eth0"] != FailoverDemotedMetric {
+		t.Errorf("metrics after failover %v", fake.RouteMetrics)
+	}
+	_, links, _ := e.Status()
+	if len(links) != 2 || links[0].Interface != "eth0" || links[0].Healthy || links[0].ConsecutiveFailures != 2 || !links[1].Healthy {
+		t.Errorf("links %+v", links)
+	}
+}
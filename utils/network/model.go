@@ -15,6 +15,8 @@
 package network
 
 import (
+	"fmt"
+	"net"
 	"strconv"
 	"strings"
 )
@@ -22,84 +24,190 @@ import (
 const (
 	DevStatus_Type_Wire     = "ethernet"
 	DevStatus_Type_Wireless = "wifi"
+
+	DevState_Unmanaged    = "unmanaged"
+	DevState_Unavailable  = "unavailable"
+	DevState_Disconnected = "disconnected"
+	DevState_Connecting   = "connecting"
+	DevState_Connected    = "connected"
+	DevState_Failed       = "failed"
+
+	Ipv4Method_Auto   = "auto"
+	Ipv4Method_Manual = "manual"
+
+	Ipv6Method_Auto      = "auto"   // SLAAC, 路由通告中带 M/O 标志时同时使用 DHCPv6
+	Ipv6Method_Dhcp      = "dhcp"   // 只使用 DHCPv6(有状态)
+	Ipv6Method_Manual    = "manual" // 静态地址
+	Ipv6Method_LinkLocal = "link-local"
+	Ipv6Method_Ignore    = "ignore" // 不由 NetworkManager 配置 ipv6
+	Ipv6Method_Disabled  = "disabled"
+
+	Ipv6Privacy_Default      = ""              // 使用系统默认设置
+	Ipv6Privacy_Disabled     = "disabled"      // 不使用临时地址
+	Ipv6Privacy_PreferPublic = "prefer-public" // 生成临时地址, 但优先使用公共地址
+	Ipv6Privacy_PreferTemp   = "prefer-temp"   // 生成临时地址并优先使用
 )
 
-type DevInfo struct {
-	GENERALDEVICE     string `json:"GENERALDEVICE"`     // GENERAL.DEVICE:wlan0, GENERAL.DEVICE:eth0
-	GENERALTYPE       string `json:"GENERALTYPE"`       // GENERAL.TYPE:wifi, GENERAL.TYPE:ethernet
-	GENERALHWADDR     string `json:"GENERALHWADDR"`     // GENERAL.HWADDR:AE:FA:BF:E4:C7:26, GENERAL.HWADDR:10:2C:6B:7F:B1:78
-	GENERALCONUUID    string `json:"GENERALCONUUID"`    // GENERAL.CON-UUID:3962b85f-3d69-496e-8974-6072229edfa2, GENERAL.CON-UUID:
-	CAPABILITIESSPEED string `json:"CAPABILITIESSPEED"` // CAPABILITIES.SPEED:1000 Mb/s, CAPABILITIES.SPEED:unknown
+// Device 网卡及其当前激活的连接
+type Device struct {
+	Interface      string   `json:"interface"`      // eth0, wlan0
+	Type           string   `json:"type"`           // ethernet, wifi, bridge ...
+	State          string   `json:"state"`          // DevState_*
+	HwAddress      string   `json:"hwAddress"`      // 10:2C:6B:7F:B1:78
+	ConnectionId   string   `json:"connectionId"`   // 激活连接的名称, 如 Wired connection 1, wifi 时一般为 SSID
+	ConnectionUuid string   `json:"connectionUuid"` // 激活连接的 uuid
+	Ip4Addresses   []string `json:"ip4Addresses"`   // 192.168.124.112/24
+	Ip4Gateway     string   `json:"ip4Gateway"`
+	Ip4Dns         []string `json:"ip4Dns"`
+	Ip6Addresses   []string `json:"ip6Addresses"` // fe80::9a44:b614:b787:83a0/64
+	Ip6Gateway     string   `json:"ip6Gateway"`
+	Ip6Dns         []string `json:"ip6Dns"`
+}
+
+func (dev *Device) IsEthernetAndWifi() bool {
+	return dev.IsWire() || dev.IsWireless()
 }
 
-type DevStatus struct {
-	DEVICE     string `json:"DEVICE"`     // DEVICE:eth1, wlan0
-	TYPE       string `json:"TYPE"`       // TYPE:ethernet, wifi, bridge
-	STATE      string `json:"STATE"`      // STATE:connected, disconnected, unavailable
-	CONNECTION string `json:"CONNECTION"` // CONNECTION:Wired connection 1
-	CONUUID    string `json:"CONUUID"`    // CON-UUID:ddf82224-fcb2-3f61-88f8-4896ddd8f8f1
+func (dev *Device) IsWire() bool {
+	return dev.Type == DevStatus_Type_Wire
 }
 
-func (devStatus *DevStatus) IsEthernetAndWifi() bool {
-	return devStatus.IsWire() || devStatus.IsWireless()
+func (dev *Device) IsWireless() bool {
+	return dev.Type == DevStatus_Type_Wireless
 }
 
-func (devStatus *DevStatus) IsWire() bool {
-	return strings.Contains(devStatus.TYPE, DevStatus_Type_Wire)
+func (dev *Device) IsConnected() bool {
+	return dev.State == DevState_Connected
 }
 
-func (devStatus *DevStatus) IsWireless() bool {
-	return strings.Contains(devStatus.TYPE, DevStatus_Type_Wireless)
+// Ipv4Address 第一个 ipv4 地址, 不带前缀长度
+func (dev *Device) Ipv4Address() string {
+	if len(dev.Ip4Addresses) < 1 {
+		return ""
+	}
+	return strings.Split(dev.Ip4Addresses[0], "/")[0]
 }
 
-func (devStatus *DevStatus) IsConnected() bool {
-	return strings.EqualFold(devStatus.STATE, "connected")
+// Ipv4NetMask 第一个 ipv4 地址的子网掩码, 如 255.255.255.0
+func (dev *Device) Ipv4NetMask() string {
+	if len(dev.Ip4Addresses) < 1 {
+		return ""
+	}
+	arr := strings.Split(dev.Ip4Addresses[0], "/")
+	if len(arr) < 2 {
+		return ""
+	}
+	l, err := strconv.Atoi(arr[1])
+	if err != nil {
+		return ""
+	}
+	return LenToSubNetMask(l)
 }
 
-type ConInfo struct {
-	ConnectionId            string `json:"connectionId"`            // connection.id:Wired connection 1
-	ConnectionUuid          string `json:"connectionUuid"`          // connection.uuid:ddf82224-fcb2-3f61-88f8-4896ddd8f8f1
-	ConnectionInterfaceName string `json:"connectionInterfaceName"` // connection.interface-name:eth1
-	ConnectionAutoconnect   string `json:"connectionAutoconnect"`   // connection.autoconnect:yes
-	Ipv4Method              string `json:"ipv4Method"`              // ipv4.method:auto, ipv4.method:manual (none)
-	Ipv6Method              string `json:"ipv6Method"`              // ipv6.method:auto
-
-	IP4ADDRESS string `json:"iP4ADDRESS"` // IP4.ADDRESS[1]:192.168.124.112/24
-	IP4GATEWAY string `json:"iP4GATEWAY"` // IP4.GATEWAY:192.168.124.1
-	IP4DNS1    string `json:"iP4DNS1"`    // IP4.DNS[1]:192.168.124.1
-	IP4DNS2    string `json:"iP4DNS2"`    // IP4.DNS[2]:8.8.4.4
-	IP6ADDRESS string `json:"iP6ADDRESS"` // IP6.ADDRESS[1]:fe80::9a44:b614:b787:83a0/64
-	IP6GATEWAY string `json:"iP6GATEWAY"` // IP6.GATEWAY:
-
-	SeenBssids  string `json:"seenBssids"`  // 802-11-wireless.seen-bssids:DC:FE:18:19:AA:8B
-	GENERALNAME string `json:"generalName"` // GENERAL.NAME:JefEnterprise_5G
+// Connection NetworkManager 中保存的连接配置
+type Connection struct {
+	Id            string   `json:"id"`
+	Uuid          string   `json:"uuid"`
+	Type          string   `json:"type"` // 802-3-ethernet, 802-11-wireless ...
+	InterfaceName string   `json:"interfaceName"`
+	Ipv4Method    string   `json:"ipv4Method"` // auto, manual ...
+	Ipv6Method    string   `json:"ipv6Method"`
+	Ipv6Privacy   string   `json:"ipv6Privacy"` // Ipv6Privacy_*
+	Ssid          string   `json:"ssid"`
+	SeenBssids    []string `json:"seenBssids"`
 }
 
-func (conInfo *ConInfo) UseDhcp() bool {
-	return strings.EqualFold(conInfo.Ipv4Method, "auto")
+func (con *Connection) UseDhcp() bool {
+	return strings.EqualFold(con.Ipv4Method, Ipv4Method_Auto)
 }
 
-func (conInfo *ConInfo) UseDhcpIpv6() bool {
-	return strings.EqualFold(conInfo.Ipv6Method, "auto")
+func (con *Connection) UseDhcpIpv6() bool {
+	return strings.EqualFold(con.Ipv6Method, Ipv6Method_Auto) || strings.EqualFold(con.Ipv6Method, Ipv6Method_Dhcp)
 }
 
-func (conInfo *ConInfo) Ipv4Address() string {
-	arr := strings.Split(conInfo.IP4ADDRESS, "/")
-	if len(arr) < 2 || len(arr[0]) < 1 || len(arr[1]) < 1 {
-		return ""
+// AccessPoint 扫描到的 wifi 热点
+type AccessPoint struct {
+	Ssid      string `json:"ssid"`
+	Bssid     string `json:"bssid"`
+	Frequency uint32 `json:"frequency"` // MHz
+	Strength  int    `json:"strength"`  // 信号强度 0~100
+	Security  string `json:"security"`  // 如 WPA2, WPA1 WPA2, WPA3, WEP, 开放网络为空
+	InUse     bool   `json:"inUse"`
+}
+
+// Ipv4Config 网卡 ipv4 设置. 自动获取时只需要 Method.
+type Ipv4Config struct {
+	Method  string   // Ipv4Method_Auto, Ipv4Method_Manual
+	Address string   // 192.168.0.213/24
+	Gateway string   // 192.168.0.1
+	Dns     []string // 空串会被忽略
+}
+
+// Ipv6Config 网卡 ipv6 设置. Method 为空时表示不修改连接原有的 ipv6 设置.
+type Ipv6Config struct {
+	Method    string   // Ipv6Method_*
+	Addresses []string // 静态地址, 如 2001:db8::10/64, 只在 Ipv6Method_Manual 时使用
+	Gateway   string   // 只在 Ipv6Method_Manual 时使用
+	Dns       []string // 空串会被忽略
+	Privacy   string   // Ipv6Privacy_*, 即 RFC 4941 隐私扩展
+}
+
+// Validate 检查 Method、Privacy 和各地址的格式.
+func (cfg *Ipv6Config) Validate() error {
+	switch cfg.Privacy {
+	case Ipv6Privacy_Default, Ipv6Privacy_Disabled, Ipv6Privacy_PreferPublic, Ipv6Privacy_PreferTemp:
+	default:
+		return fmt.Errorf("invalid ipv6 privacy %v", cfg.Privacy)
+	}
+	switch cfg.Method {
+	case Ipv6Method_Auto, Ipv6Method_Dhcp, Ipv6Method_LinkLocal, Ipv6Method_Ignore, Ipv6Method_Disabled:
+	case Ipv6Method_Manual:
+		if len(cfg.Addresses) < 1 {
+			return fmt.Errorf("no ipv6 address for manual method")
+		}
+		for _, a := range cfg.Addresses {
+			if ip, _, err := net.ParseCIDR(a); err != nil || ip.To4() != nil {
+				return fmt.Errorf("invalid ipv6 address %v", a)
+			}
+		}
+		if len(cfg.Gateway) > 0 {
+			if gw := net.ParseIP(cfg.Gateway); gw == nil || gw.To4() != nil {
+				return fmt.Errorf("invalid ipv6 gateway %v", cfg.Gateway)
+			}
+		}
+	default:
+		return fmt.Errorf("invalid ipv6 method %v", cfg.Method)
 	}
-	return arr[0]
+	for _, d := range cfg.Dns {
+		if len(d) < 1 {
+			continue
+		}
+		if ip := net.ParseIP(d); ip == nil || ip.To4() != nil {
+			return fmt.Errorf("invalid ipv6 dns %v", d)
+		}
+	}
+	return nil
 }
 
-func (conInfo *ConInfo) Ipv4NetMask() string {
-	arr := strings.Split(conInfo.IP4ADDRESS, "/")
-	if len(arr) < 2 || len(arr[0]) < 1 || len(arr[1]) < 1 {
+const (
+	Ipv6Scope_Global    = "global"
+	Ipv6Scope_Ula       = "ula"        // 唯一本地地址 fc00::/7
+	Ipv6Scope_LinkLocal = "link-local" // fe80::/10
+)
+
+// Ipv6Scope 返回 ipv6 地址(可带前缀长度)的类型, 不是 ipv6 单播地址时返回空串.
+func Ipv6Scope(addr string) string {
+	ip := net.ParseIP(strings.Split(addr, "/")[0])
+	if ip == nil || ip.To4() != nil {
 		return ""
 	}
-	l, err := strconv.Atoi(arr[1])
-	if err != nil {
-		return ""
+	switch {
+	case ip.IsLinkLocalUnicast():
+		return Ipv6Scope_LinkLocal
+	case ip.IsPrivate():
+		return Ipv6Scope_Ula
+	case ip.IsGlobalUnicast():
+		return Ipv6Scope_Global
 	}
-
-	return LenToSubNetMask(l)
+	return ""
 }
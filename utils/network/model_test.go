@@ -14,22 +14,19 @@
 
 package network
 
-// nmcli con up static2
-// or
-// nmcli con up eth1
-// or
-// nmcli con down b0764f9d-0dbc-4f66-a2af-e3ff2465027c
-func SetNetworkDeviceUp(device string) error {
-	params := []string{"con", "up", device}
-	return runCmd(params)
-}
+import "testing"
 
-// nmcli con down static2
-// or
-// nmcli con down eth1
-// or
-// nmcli con up b0764f9d-0dbc-4f66-a2af-e3ff2465027c
-func SetNetworkDeviceDown(device string) error {
-	params := []string{"con", "down", device}
-	return runCmd(params)
+func TestIpv6Scope(t *testing.T) {
+	for addr, scope := range map[string]string{
+		"2001:db8::10/64":           Ipv6Scope_Global,
+		"240e:3b7::1":               Ipv6Scope_Global,
+		"fd12:3456::1/64":           Ipv6Scope_Ula,
+		"fe80::9a44:b614:b787:83a0": Ipv6Scope_LinkLocal,
+		"::1":                       "",
+		"192.168.0.2/24":            "",
+	} {
+		if s := Ipv6Scope(addr); s != scope {
+			t.Errorf("Ipv6Scope(%v) = %v, want %v", addr, s, scope)
+		}
+	}
 }
@@ -0,0 +1,262 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	DnsOverTls_No            = "no"
+	DnsOverTls_Opportunistic = "opportunistic" // 服务器支持时使用 TLS, 否则降级为明文
+	DnsOverTls_Yes           = "yes"
+
+	Dnssec_No             = "no"
+	Dnssec_AllowDowngrade = "allow-downgrade" // 上游不支持时降级
+	Dnssec_Yes            = "yes"
+)
+
+// ResolvedLinkConfig 单个网卡的 dns 设置, 为空的字段不修改(沿用 NetworkManager 下发的或全局设置).
+type ResolvedLinkConfig struct {
+	Interface  string   `json:"interface"`
+	Dns        []string `json:"dns"`
+	Domains    []string `json:"domains"` // ~ 开头表示只用于按域名选择 dns 服务器, 如 ~corp.example.com, ~. 表示该网卡为默认 dns 路由
+	DnsOverTls string   `json:"dnsOverTls"`
+	Dnssec     string   `json:"dnssec"`
+}
+
+// ResolvedConfig systemd-resolved 的配置. Dns 等为全局设置, 写入 resolved.conf 的 [Resolve] 段; Links 为各网卡的设置.
+// dns 服务器格式为 ip[#sni], ipv4:port[#sni] 或 [ipv6]:port[#sni], sni 用于 DNS-over-TLS 校验服务器证书.
+type ResolvedConfig struct {
+	Dns         []string              `json:"dns"`
+	FallbackDns []string              `json:"fallbackDns"` // 为空时使用 systemd 编译时的默认值
+	Domains     []string              `json:"domains"`     // 搜索域
+	DnsOverTls  string                `json:"dnsOverTls"`  // DnsOverTls_*, 为空表示系统默认
+	Dnssec      string                `json:"dnssec"`      // Dnssec_*, 为空表示系统默认
+	Links       []*ResolvedLinkConfig `json:"links"`
+}
+
+// ResolvedDnsServer 解析后的 dns 服务器地址
+type ResolvedDnsServer struct {
+	IP   net.IP
+	Port uint16 // 0 表示默认端口
+	Sni  string
+}
+
+// ParseResolvedDns 解析 resolved.conf 格式的 dns 服务器地址.
+func ParseResolvedDns(s string) (*ResolvedDnsServer, error) {
+	server := &ResolvedDnsServer{}
+	addr := s
+	if i := strings.Index(s, "#"); i >= 0 {
+		addr, server.Sni = s[:i], s[i+1:]
+		if len(server.Sni) < 1 {
+			return nil, fmt.Errorf("invalid dns server %v, empty server name", s)
+		}
+	}
+	host, port := addr, ""
+	if strings.HasPrefix(addr, "[") {
+		end := strings.Index(addr, "]")
+		if end < 0 {
+			return nil, fmt.Errorf("invalid dns server %v", s)
+		}
+		host, port = addr[1:end], strings.TrimPrefix(addr[end+1:], ":")
+		if end+1 < len(addr) && addr[end+1] != ':' {
+			return nil, fmt.Errorf("invalid dns server %v", s)
+		}
+	} else if strings.Count(addr, ":") == 1 {
+		host, port = addr[:strings.Index(addr, ":")], addr[strings.Index(addr, ":")+1:]
+	}
+	server.IP = net.ParseIP(host)
+	if server.IP == nil {
+		return nil, fmt.Errorf("invalid dns server %v", s)
+	}
+	if len(port) > 0 {
+		p, err := strconv.ParseUint(port, 10, 16)
+		if err != nil || p == 0 {
+			return nil, fmt.Errorf("invalid dns server port %v", s)
+		}
+		server.Port = uint16(p)
+	}
+	return server, nil
+}
+
+// Validate 检查各 dns 地址、域名和模式.
+func (cfg *ResolvedConfig) Validate() error {
+	if err := validateResolvedSettings(cfg.Dns, cfg.Domains, cfg.DnsOverTls, cfg.Dnssec); err != nil {
+		return err
+	}
+	for _, d := range cfg.FallbackDns {
+		if _, err := ParseResolvedDns(d); err != nil {
+			return err
+		}
+	}
+	seen := map[string]bool{}
+	for _, link := range cfg.Links {
+		if len(link.Interface) < 1 {
+			return fmt.Errorf("empty interface name in link dns config")
+		}
+		if seen[link.Interface] {
+			return fmt.Errorf("duplicate link dns config for %v", link.Interface)
+		}
+		seen[link.Interface] = true
+		if err := validateResolvedSettings(link.Dns, link.Domains, link.DnsOverTls, link.Dnssec); err != nil {
+			return fmt.Errorf("%v: %v", link.Interface, err)
+		}
+	}
+	return nil
+}
+
+func validateResolvedSettings(dns, domains []string, dnsOverTls, dnssec string) error {
+	for _, d := range dns {
+		if _, err := ParseResolvedDns(d); err != nil {
+			return err
+		}
+	}
+	for _, d := range domains {
+		name := strings.TrimPrefix(d, "~")
+		if len(name) < 1 || len(name) > 253 || strings.ContainsAny(name, " \t/\\#") {
+			return fmt.Errorf("invalid domain %v", d)
+		}
+	}
+	switch dnsOverTls {
+	case "", DnsOverTls_No, DnsOverTls_Opportunistic, DnsOverTls_Yes:
+	default:
+		return fmt.Errorf("invalid DNSOverTLS mode %v", dnsOverTls)
+	}
+	switch dnssec {
+	case "", Dnssec_No, Dnssec_AllowDowngrade, Dnssec_Yes:
+	default:
+		return fmt.Errorf("invalid DNSSEC mode %v", dnssec)
+	}
+	return nil
+}
+
+// ParseResolvedConf 读取 resolved.conf 中 [Resolve] 段的全局设置, 不包含 Links.
+// 与 systemd 一致, 列表类设置可出现多次并累加, 空值清空之前的设置.
+func ParseResolvedConf(content string) ResolvedConfig {
+	cfg := ResolvedConfig{Dns: []string{}, FallbackDns: []string{}, Domains: []string{}}
+	inResolve := false
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "[") {
+			inResolve = line == "[Resolve]"
+			continue
+		}
+		if !inResolve || len(line) < 1 || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			continue
+		}
+		key, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		switch key {
+		case "DNS":
+			cfg.Dns = appendResolvedList(cfg.Dns, value)
+		case "FallbackDNS":
+			cfg.FallbackDns = appendResolvedList(cfg.FallbackDns, value)
+		case "Domains":
+			cfg.Domains = appendResolvedList(cfg.Domains, value)
+		case "DNSOverTLS":
+			cfg.DnsOverTls = value
+		case "DNSSEC":
+			cfg.Dnssec = value
+		}
+	}
+	return cfg
+}
+
+func appendResolvedList(list []string, value string) []string {
+	if len(value) < 1 {
+		return []string{}
+	}
+	return append(list, strings.Fields(value)...)
+}
+
+var resolvedConfKeys = []string{"DNS", "FallbackDNS", "Domains", "DNSOverTLS", "DNSSEC"}
+
+// FormatResolvedConf 把 cfg 的全局设置写入 content 的 [Resolve] 段, 其他段、其他设置和注释保持不变.
+// 空的设置不写, 使用系统默认值.
+func FormatResolvedConf(content string, cfg ResolvedConfig) string {
+	values := map[string]string{
+		"DNS":         strings.Join(cfg.Dns, " "),
+		"FallbackDNS": strings.Join(cfg.FallbackDns, " "),
+		"Domains":     strings.Join(cfg.Domains, " "),
+		"DNSOverTLS":  cfg.DnsOverTls,
+		"DNSSEC":      cfg.Dnssec,
+	}
+	managed := []string{}
+	for _, k := range resolvedConfKeys {
+		if len(values[k]) > 0 {
+			managed = append(managed, k+"="+values[k])
+		}
+	}
+
+	lines := strings.Split(strings.TrimRight(content, "\n"), "\n")
+	if len(content) < 1 {
+		lines = []string{}
+	}
+	out := make([]string, 0, len(lines)+len(managed)+1)
+	section, insertAt, sectionEnd, found := "", -1, -1, false
+	for _, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") {
+			if section == "[Resolve]" && sectionEnd < 0 {
+				sectionEnd = len(out)
+			}
+			section = trimmed
+			out = append(out, line)
+			found = found || section == "[Resolve]"
+			continue
+		}
+		if section == "[Resolve]" && !strings.HasPrefix(trimmed, "#") && !strings.HasPrefix(trimmed, ";") {
+			if i := strings.Index(trimmed, "="); i > 0 && isResolvedConfKey(strings.TrimSpace(trimmed[:i])) {
+				if insertAt < 0 {
+					insertAt = len(out)
+				}
+				continue
+			}
+		}
+		out = append(out, line)
+	}
+	if !found {
+		out = append(out, "[Resolve]")
+		return strings.Join(append(out, managed...), "\n") + "\n"
+	}
+	if insertAt < 0 {
+		insertAt = sectionEnd
+		if insertAt < 0 {
+			insertAt = len(out)
+		}
+		// 放在段末尾的空行之前
+		for insertAt > 0 && len(strings.TrimSpace(out[insertAt-1])) < 1 {
+			insertAt--
+		}
+	}
+	result := append(append(append([]string{}, out[:insertAt]...), managed...), out[insertAt:]...)
+	return strings.Join(result, "\n") + "\n"
+}
+
+func isResolvedConfKey(key string) bool {
+	for _, k := range resolvedConfKeys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,355 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"agent/config"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+
+	"agent/utils/logger"
+	"github.com/dungeonsnd/gocom/file/fileutil"
+	"github.com/godbus/dbus/v5"
+)
+
+const (
+	resolvedDest    = "org.freedesktop.resolve1"
+	resolvedPath    = dbus.ObjectPath("/org/freedesktop/resolve1")
+	resolvedManager = "org.freedesktop.resolve1.Manager"
+)
+
+// resolvedRestartDelay 重启 systemd-resolved 后等待其重新注册 D-Bus 以及 NetworkManager 重新下发网卡 dns 的时间
+var resolvedRestartDelay = time.Second
+
+var resolvedLock sync.Mutex
+
+type resolvedDnsEx struct {
+	Family  int32
+	Address []byte
+	Port    uint16
+	Name    string
+}
+
+type resolvedDns struct {
+	Family  int32
+	Address []byte
+}
+
+type resolvedDomain struct {
+	Domain    string
+	RouteOnly bool
+}
+
+// ReadResolvedConfig 读取当前 resolved.conf 中的全局设置以及保存的各网卡设置.
+func ReadResolvedConfig() (*ResolvedConfig, error) {
+	content, err := fileutil.ReadFromFile(config.Config.Box.DnsConfigFile)
+	if err != nil && fileutil.IsFileExist(config.Config.Box.DnsConfigFile) {
+		return nil, err
+	}
+	cfg := ParseResolvedConf(string(content))
+	cfg.Links = loadResolvedLinks()
+	return &cfg, nil
+}
+
+// ApplyResolvedConfig 写入全局设置并重启 systemd-resolved, 再通过 D-Bus 下发各网卡设置, 然后在 timeout 内
+// 逐个解析 hosts 验证. 任一步失败则恢复原来的 resolved.conf 和网卡设置.
+func ApplyResolvedConfig(cfg *ResolvedConfig, hosts []string, timeout time.Duration) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	resolvedLock.Lock()
+	defer resolvedLock.Unlock()
+
+	f := config.Config.Box.DnsConfigFile
+	oldContent, err := fileutil.ReadFromFile(f)
+	if err != nil && fileutil.IsFileExist(f) {
+		return err
+	}
+	oldLinks := loadResolvedLinks()
+	logger.AppLogger().Infof("ApplyResolvedConfig, dns:%v, fallbackDns:%v, domains:%v, dnsOverTls:%v, dnssec:%v, links:%v",
+		cfg.Dns, cfg.FallbackDns, cfg.Domains, cfg.DnsOverTls, cfg.Dnssec, len(cfg.Links))
+
+	err = writeResolvedConf(string(oldContent), FormatResolvedConf(string(oldContent), *cfg))
+	if err == nil {
+		err = applyResolvedLinks(cfg.Links, oldLinks)
+	}
+	if err == nil {
+		err = validateResolved(hosts, timeout)
+	}
+	if err != nil {
+		logger.AppLogger().Warnf("ApplyResolvedConfig failed, rollback. err:%v", err)
+		current, _ := fileutil.ReadFromFile(f)
+		if e := writeResolvedConf(string(current), string(oldContent)); e != nil {
+			logger.AppLogger().Warnf("ApplyResolvedConfig, failed to restore %v, err:%v", f, e)
+		}
+		if e := applyResolvedLinks(oldLinks, cfg.Links); e != nil {
+			logger.AppLogger().Warnf("ApplyResolvedConfig, failed to restore link dns, err:%v", e)
+		}
+		return fmt.Errorf("failed to apply dns config, rolled back, err:%v", err)
+	}
+	if err := fileutil.WriteToFileAsJson(config.Config.Box.Network.Resolved.LinkConfigFile, cfg.Links, "  ", true); err != nil {
+		return fmt.Errorf("failed to save link dns config, err:%v", err)
+	}
+	return nil
+}
+
+// ReapplyResolvedLinks 重新下发保存的各网卡设置. 网卡重新连接后 NetworkManager 会覆盖网卡的 dns, 需要再次下发.
+func ReapplyResolvedLinks() error {
+	resolvedLock.Lock()
+	defer resolvedLock.Unlock()
+	return applyResolvedLinks(loadResolvedLinks(), nil)
+}
+
+func loadResolvedLinks() []*ResolvedLinkConfig {
+	links := []*ResolvedLinkConfig{}
+	f := config.Config.Box.Network.Resolved.LinkConfigFile
+	if !fileutil.IsFileExist(f) {
+		return links
+	}
+	if err := fileutil.ReadFileJsonToObject(f, &links); err != nil {
+		logger.AppLogger().Warnf("failed to read %v, err:%v", f, err)
+		return []*ResolvedLinkConfig{}
+	}
+	return links
+}
+
+// writeResolvedConf 内容有变化时写入 resolved.conf 并重启 systemd-resolved
+func writeResolvedConf(oldContent, content string) error {
+	if oldContent == content {
+		return nil
+	}
+	if err := fileutil.WriteToFile(config.Config.Box.DnsConfigFile, []byte(content), true); err != nil {
+		return err
+	}
+	if err := restartSystemdResolved(); err != nil {
+		return err
+	}
+	time.Sleep(resolvedRestartDelay)
+	return nil
+}
+
+// applyResolvedLinks 下发 links, 并还原 previous 中有而 links 中没有的网卡. 不存在的网卡跳过, 等其出现后由
+// ReapplyResolvedLinks 下发.
+func applyResolvedLinks(links, previous []*ResolvedLinkConfig) error {
+	current := map[string]bool{}
+	for _, link := range links {
+		current[link.Interface] = true
+	}
+	for _, link := range previous {
+		if current[link.Interface] {
+			continue
+		}
+		if _, err := net.InterfaceByName(link.Interface); err != nil {
+			continue
+		}
+		if err := revertResolvedLink(link.Interface); err != nil {
+			return err
+		}
+	}
+	for _, link := range links {
+		if _, err := net.InterfaceByName(link.Interface); err != nil {
+			logger.AppLogger().Debugf("applyResolvedLinks, skip %v, err:%v", link.Interface, err)
+			continue
+		}
+		if err := setResolvedLink(link); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setResolvedLink(link *ResolvedLinkConfig) error {
+	ifi, err := net.InterfaceByName(link.Interface)
+	if err != nil {
+		return err
+	}
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		logger.AppLogger().Warnf("failed to connect system bus, use resolvectl. err:%v", err)
+		return setResolvedLinkByCmd(link)
+	}
+	obj := conn.Object(resolvedDest, resolvedPath)
+	idx := int32(ifi.Index)
+
+	if len(link.Dns) > 0 {
+		servers := make([]resolvedDnsEx, 0, len(link.Dns))
+		for _, d := range link.Dns {
+			server, err := ParseResolvedDns(d)
+			if err != nil {
+				return err
+			}
+			servers = append(servers, resolvedDnsExOf(server))
+		}
+		if err := obj.Call(resolvedManager+".SetLinkDNSEx", 0, idx, servers).Err; err != nil {
+			// systemd 246 之前没有 SetLinkDNSEx, 不支持端口和 SNI
+			if !isDbusUnknownMethod(err) {
+				return fmt.Errorf("failed to set dns of %v, err:%v", link.Interface, err)
+			}
+			plain := make([]resolvedDns, 0, len(servers))
+			for _, s := range servers {
+				if s.Port != 0 || len(s.Name) > 0 {
+					return fmt.Errorf("systemd-resolved does not support dns server port or name, %v", link.Interface)
+				}
+				plain = append(plain, resolvedDns{Family: s.Family, Address: s.Address})
+			}
+			if err := obj.Call(resolvedManager+".SetLinkDNS", 0, idx, plain).Err; err != nil {
+				return fmt.Errorf("failed to set dns of %v, err:%v", link.Interface, err)
+			}
+		}
+	}
+	if len(link.Domains) > 0 {
+		domains := make([]resolvedDomain, 0, len(link.Domains))
+		for _, d := range link.Domains {
+			if len(d) > 1 && d[0] == '~' {
+				domains = append(domains, resolvedDomain{Domain: d[1:], RouteOnly: true})
+			} else {
+				domains = append(domains, resolvedDomain{Domain: d})
+			}
+		}
+		if err := obj.Call(resolvedManager+".SetLinkDomains", 0, idx, domains).Err; err != nil {
+			return fmt.Errorf("failed to set domains of %v, err:%v", link.Interface, err)
+		}
+	}
+	if len(link.DnsOverTls) > 0 {
+		if err := obj.Call(resolvedManager+".SetLinkDNSOverTLS", 0, idx, link.DnsOverTls).Err; err != nil {
+			return fmt.Errorf("failed to set DNSOverTLS of %v, err:%v", link.Interface, err)
+		}
+	}
+	if len(link.Dnssec) > 0 {
+		if err := obj.Call(resolvedManager+".SetLinkDNSSEC", 0, idx, link.Dnssec).Err; err != nil {
+			return fmt.Errorf("failed to set DNSSEC of %v, err:%v", link.Interface, err)
+		}
+	}
+	return nil
+}
+
+func setResolvedLinkByCmd(link *ResolvedLinkConfig) error {
+	if len(link.Dns) > 0 {
+		if err := runCmd2("resolvectl", append([]string{"dns", link.Interface}, link.Dns...)); err != nil {
+			return err
+		}
+	}
+	if len(link.Domains) > 0 {
+		if err := runCmd2("resolvectl", append([]string{"domain", link.Interface}, link.Domains...)); err != nil {
+			return err
+		}
+	}
+	if len(link.DnsOverTls) > 0 {
+		if err := runCmd2("resolvectl", []string{"dnsovertls", link.Interface, link.DnsOverTls}); err != nil {
+			return err
+		}
+	}
+	if len(link.Dnssec) > 0 {
+		if err := runCmd2("resolvectl", []string{"dnssec", link.Interface, link.Dnssec}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revertResolvedLink 清除网卡上的 dns 设置, 之后由 NetworkManager 在网卡重新连接时下发.
+func revertResolvedLink(iface string) error {
+	ifi, err := net.InterfaceByName(iface)
+	if err != nil {
+		return err
+	}
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return runCmd2("resolvectl", []string{"revert", iface})
+	}
+	if err := conn.Object(resolvedDest, resolvedPath).Call(resolvedManager+".RevertLink", 0, int32(ifi.Index)).Err; err != nil {
+		return fmt.Errorf("failed to revert dns of %v, err:%v", iface, err)
+	}
+	return nil
+}
+
+// validateResolved 在 timeout 内逐个解析 hosts, 有一个始终解析不了则返回错误.
+// 先清除 systemd-resolved 的缓存, 否则新的 dns 不可用时也能从缓存中解析成功.
+func validateResolved(hosts []string, timeout time.Duration) error {
+	if err := flushResolvedCaches(); err != nil {
+		logger.AppLogger().Warnf("validateResolved, flushResolvedCaches err:%v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	for _, host := range hosts {
+		for {
+			err := resolveHostname(ctx, host)
+			if err == nil {
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("failed to resolve %v, err:%v", host, err)
+			case <-time.After(500 * time.Millisecond):
+			}
+		}
+	}
+	return nil
+}
+
+// flushResolvedCaches 清除 systemd-resolved 的 dns 缓存.
+// 不使用 ResolveHostname 的 SD_RESOLVED_NO_CACHE 标志, 旧版本 systemd-resolved 不认识的标志会直接报错.
+func flushResolvedCaches() error {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		return runCmd2("resolvectl", []string{"flush-caches"})
+	}
+	if err := conn.Object(resolvedDest, resolvedPath).Call(resolvedManager+".FlushCaches", 0).Err; err != nil {
+		return fmt.Errorf("failed to flush dns caches, err:%v", err)
+	}
+	return nil
+}
+
+// resolveHostname 通过 systemd-resolved 解析 host, 连接不上 D-Bus 时使用系统解析器.
+func resolveHostname(ctx context.Context, host string) error {
+	conn, err := dbus.SystemBus()
+	if err != nil {
+		_, err := net.DefaultResolver.LookupHost(ctx, host)
+		return err
+	}
+	var addresses []struct {
+		Ifindex int32
+		Family  int32
+		Address []byte
+	}
+	var canonical string
+	var flags uint64
+	call := conn.Object(resolvedDest, resolvedPath).CallWithContext(ctx, resolvedManager+".ResolveHostname", 0,
+		int32(0), host, int32(syscall.AF_UNSPEC), uint64(0))
+	if err := call.Store(&addresses, &canonical, &flags); err != nil {
+		return err
+	}
+	if len(addresses) < 1 {
+		return fmt.Errorf("no address for %v", host)
+	}
+	return nil
+}
+
+func resolvedDnsExOf(server *ResolvedDnsServer) resolvedDnsEx {
+	if ip4 := server.IP.To4(); ip4 != nil {
+		return resolvedDnsEx{Family: syscall.AF_INET, Address: ip4, Port: server.Port, Name: server.Sni}
+	}
+	return resolvedDnsEx{Family: syscall.AF_INET6, Address: server.IP.To16(), Port: server.Port, Name: server.Sni}
+}
+
+func isDbusUnknownMethod(err error) bool {
+	var dbusErr dbus.Error
+	return errors.As(err, &dbusErr) && dbusErr.Name == "org.freedesktop.DBus.Error.UnknownMethod"
+}
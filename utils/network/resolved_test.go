@@ -0,0 +1,123 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseResolvedDns(t *testing.T) {
+	for s, want := range map[string]ResolvedDnsServer{
+		"1.1.1.1":                                {Port: 0},
+		"1.1.1.1#cloudflare-dns.com":             {Sni: "cloudflare-dns.com"},
+		"9.9.9.9:853#dns.quad9.net":              {Port: 853, Sni: "dns.quad9.net"},
+		"2606:4700:4700::1111":                   {},
+		"[2606:4700:4700::1111]:853#one.one.one": {Port: 853, Sni: "one.one.one"},
+	} {
+		server, err := ParseResolvedDns(s)
+		if err != nil {
+			t.Errorf("ParseResolvedDns(%v) failed, err:%v", s, err)
+			continue
+		}
+		if server.IP == nil || server.Port != want.Port || server.Sni != want.Sni {
+			t.Errorf("ParseResolvedDns(%v) = %+v, want %+v", s, server, want)
+		}
+	}
+	for _, s := range []string{"", "dns.google", "1.1.1.1:0", "1.1.1.1:dns", "1.1.1.1#", "[2606:4700::1111", "[::1]853"} {
+		if _, err := ParseResolvedDns(s); err == nil {
+			t.Errorf("ParseResolvedDns(%v) should fail", s)
+		}
+	}
+}
+
+func TestResolvedConfigValidate(t *testing.T) {
+	cfg := &ResolvedConfig{Dns: []string{"1.1.1.1#cloudflare-dns.com"}, Domains: []string{"lan"}, DnsOverTls: DnsOverTls_Yes,
+		Links: []*ResolvedLinkConfig{{Interface: "eth0", Domains: []string{"~corp.example.com"}, Dnssec: Dnssec_AllowDowngrade}}}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("Validate failed, err:%v", err)
+	}
+	for _, bad := range []func(c *ResolvedConfig){
+		func(c *ResolvedConfig) { c.DnsOverTls = "strict" },
+		func(c *ResolvedConfig) { c.Dnssec = "true" },
+		func(c *ResolvedConfig) { c.FallbackDns = []string{"dns.google"} },
+		func(c *ResolvedConfig) { c.Domains = []string{"~"} },
+		func(c *ResolvedConfig) { c.Links = append(c.Links, &ResolvedLinkConfig{Interface: "eth0"}) },
+		func(c *ResolvedConfig) { c.Links = []*ResolvedLinkConfig{{Dns: []string{"1.1.1.1"}}} },
+	} {
+		c := *cfg
+		bad(&c)
+		if err := c.Validate(); err == nil {
+			t.Errorf("Validate should fail, %+v", c)
+		}
+	}
+}
+
+const testResolvedConf = `#  This file is part of systemd.
+
+[Resolve]
+# Some examples of DNS servers which may be used for DNS= and FallbackDNS=:
+#DNS=
+DNS=114.114.114.114
+FallbackDNS=8.8.8.8 8.8.4.4
+FallbackDNS=223.5.5.5
+#Domains=
+DNSSEC=no
+#DNSOverTLS=no
+Cache=yes
+
+[Other]
+DNS=not-managed
+`
+
+func TestParseResolvedConf(t *testing.T) {
+	cfg := ParseResolvedConf(testResolvedConf)
+	if !reflect.DeepEqual(cfg.Dns, []string{"114.114.114.114"}) ||
+		!reflect.DeepEqual(cfg.FallbackDns, []string{"8.8.8.8", "8.8.4.4", "223.5.5.5"}) ||
+		len(cfg.Domains) != 0 || cfg.Dnssec != Dnssec_No || cfg.DnsOverTls != "" {
+		t.Errorf("ParseResolvedConf = %+v", cfg)
+	}
+	if cfg := ParseResolvedConf("[Resolve]\nDNS=1.1.1.1\nDNS=\nDNS=9.9.9.9\n"); !reflect.DeepEqual(cfg.Dns, []string{"9.9.9.9"}) {
+		t.Errorf("empty assignment should reset the list, %v", cfg.Dns)
+	}
+}
+
+func TestFormatResolvedConf(t *testing.T) {
+	cfg := ResolvedConfig{Dns: []string{"1.1.1.1#cloudflare-dns.com", "2606:4700:4700::1111#cloudflare-dns.com"},
+		Domains: []string{"lan"}, DnsOverTls: DnsOverTls_Opportunistic}
+	s := FormatResolvedConf(testResolvedConf, cfg)
+	if got := ParseResolvedConf(s); !reflect.DeepEqual(got.Dns, cfg.Dns) || !reflect.DeepEqual(got.Domains, cfg.Domains) ||
+		len(got.FallbackDns) != 0 || got.DnsOverTls != cfg.DnsOverTls || got.Dnssec != "" {
+		t.Errorf("FormatResolvedConf round trip = %+v, content:\n%v", got, s)
+	}
+	for _, keep := range []string{"#  This file is part of systemd.", "#DNS=", "#DNSOverTLS=no", "Cache=yes", "[Other]\nDNS=not-managed"} {
+		if !strings.Contains(s, keep) {
+			t.Errorf("FormatResolvedConf dropped %q, content:\n%v", keep, s)
+		}
+	}
+	if FormatResolvedConf(s, cfg) != s {
+		t.Errorf("FormatResolvedConf is not idempotent")
+	}
+
+	s = FormatResolvedConf("", ResolvedConfig{Dns: []string{"1.1.1.1"}})
+	if s != "[Resolve]\nDNS=1.1.1.1\n" {
+		t.Errorf("FormatResolvedConf on empty content = %q", s)
+	}
+	s = FormatResolvedConf("[Resolve]\n#DNS=\n\n[Other]\nA=b\n", ResolvedConfig{Dnssec: Dnssec_Yes})
+	if s != "[Resolve]\n#DNS=\nDNSSEC=yes\n\n[Other]\nA=b\n" {
+		t.Errorf("FormatResolvedConf without managed keys = %q", s)
+	}
+}
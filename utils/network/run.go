@@ -22,19 +22,6 @@ import (
 	"github.com/dungeonsnd/gocom/sys/run"
 )
 
-func runCmd(params []string) error {
-	cmd := "nmcli"
-	logger.AppLogger().Debugf("will run cmd: %v %v", cmd, strings.Join(params, " "))
-	stdOutput, errOutput, err := run.RunExe(cmd, params)
-	if err != nil {
-		return fmt.Errorf("failed run %v %v, err is :%v, stdOutput is :%v, errOutput is :%v",
-			cmd, params, err, string(stdOutput), string(errOutput))
-	}
-	logger.AppLogger().Debugf("run cmd return, %v %v, stdOutput is :%v, errOutput is :%v",
-		cmd, strings.Join(params, " "), string(stdOutput), string(errOutput))
-	return nil
-}
-
 func runCmd2(cmd string, params []string) error {
 	logger.AppLogger().Debugf("will run cmd: %v %v\n", cmd, strings.Join(params, " "))
 	stdOutput, errOutput, err := run.RunExe(cmd, params)
@@ -46,16 +33,3 @@ func runCmd2(cmd string, params []string) error {
 		cmd, strings.Join(params, " "), string(stdOutput), string(errOutput))
 	return nil
 }
-
-func runCmdOutput(params []string) ([]byte, error) {
-	cmd := "nmcli"
-	logger.AppLogger().Debugf("will run cmd: %v %v", cmd, strings.Join(params, " "))
-	stdOutput, errOutput, err := run.RunExe(cmd, params)
-	if err != nil {
-		return nil, fmt.Errorf("failed run %v %v, err is :%v, stdOutput is :%v, errOutput is :%v",
-			cmd, params, err, string(stdOutput), string(errOutput))
-	}
-	logger.AppLogger().Debugf("run cmd return, %v %v, stdOutput is :%v, errOutput is :%v",
-		cmd, strings.Join(params, " "), string(stdOutput), string(errOutput))
-	return stdOutput, nil
-}
@@ -0,0 +1,139 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"agent/config"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"agent/utils/logger"
+	"github.com/dungeonsnd/gocom/file/fileutil"
+)
+
+const (
+	snapshotConnectionsDir = "connections"
+	snapshotResolvedFile   = "resolved.conf"
+	snapshotActiveFile     = "active.json"
+)
+
+// TakeSnapshot 把 NetworkManager 的连接配置文件、resolved.conf 以及当前激活的连接保存到 dir.
+// dir 中原有的内容会被清除.
+func TakeSnapshot(dir string) error {
+	logger.AppLogger().Debugf("TakeSnapshot, dir:%v", dir)
+	if err := os.RemoveAll(dir); err != nil {
+		return fmt.Errorf("failed to clear %v, err:%v", dir, err)
+	}
+	connDir := filepath.Join(dir, snapshotConnectionsDir)
+	if err := os.MkdirAll(connDir, 0700); err != nil {
+		return fmt.Errorf("failed to create %v, err:%v", connDir, err)
+	}
+
+	entries, err := os.ReadDir(config.Config.Box.Network.ConnectionDir)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read %v, err:%v", config.Config.Box.Network.ConnectionDir, err)
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if err := copyFile(filepath.Join(config.Config.Box.Network.ConnectionDir, e.Name()),
+			filepath.Join(connDir, e.Name())); err != nil {
+			return err
+		}
+	}
+
+	if fileutil.IsFileExist(config.Config.Box.DnsConfigFile) {
+		if err := copyFile(config.Config.Box.DnsConfigFile, filepath.Join(dir, snapshotResolvedFile)); err != nil {
+			return err
+		}
+	}
+
+	active := []string{}
+	devices, err := Backend().Devices()
+	if err != nil {
+		return err
+	}
+	for _, dev := range devices {
+		if dev.IsEthernetAndWifi() && dev.IsConnected() && len(dev.ConnectionUuid) > 0 {
+			active = append(active, dev.ConnectionUuid)
+		}
+	}
+	return fileutil.WriteToFileAsJson(filepath.Join(dir, snapshotActiveFile), active, "  ", true)
+}
+
+// RestoreSnapshot 用 TakeSnapshot 保存的内容恢复网络配置: 删除之后新增的连接, 还原原有连接配置文件和
+// resolved.conf, 再重新激活快照时处于激活状态的连接. 尽量恢复全部内容, 返回遇到的第一个错误.
+func RestoreSnapshot(dir string) error {
+	logger.AppLogger().Infof("RestoreSnapshot, dir:%v", dir)
+	connDir := filepath.Join(dir, snapshotConnectionsDir)
+	saved, err := os.ReadDir(connDir)
+	if err != nil {
+		return fmt.Errorf("failed to read %v, err:%v", connDir, err)
+	}
+	savedNames := map[string]bool{}
+	for _, e := range saved {
+		savedNames[e.Name()] = true
+	}
+
+	var firstErr error
+	keep := func(err error) {
+		if err != nil {
+			logger.AppLogger().Warnf("RestoreSnapshot, err:%v", err)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}
+	}
+
+	current, err := os.ReadDir(config.Config.Box.Network.ConnectionDir)
+	keep(err)
+	for _, e := range current {
+		if !e.IsDir() && !savedNames[e.Name()] {
+			keep(os.Remove(filepath.Join(config.Config.Box.Network.ConnectionDir, e.Name())))
+		}
+	}
+	for name := range savedNames {
+		// NetworkManager 只加载属主为 root 且权限为 0600 的连接文件
+		keep(copyFile(filepath.Join(connDir, name), filepath.Join(config.Config.Box.Network.ConnectionDir, name)))
+	}
+	keep(Backend().ReloadConnections())
+
+	resolved := filepath.Join(dir, snapshotResolvedFile)
+	if fileutil.IsFileExist(resolved) {
+		keep(copyFile(resolved, config.Config.Box.DnsConfigFile))
+		keep(os.Chmod(config.Config.Box.DnsConfigFile, 0644))
+		keep(restartSystemdResolved())
+	}
+
+	active := []string{}
+	keep(fileutil.ReadFileJsonToObject(filepath.Join(dir, snapshotActiveFile), &active))
+	for _, conUuid := range active {
+		keep(Backend().ActivateConnection(conUuid))
+	}
+	return firstErr
+}
+
+func copyFile(src, dst string) error {
+	content, err := os.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("failed to read %v, err:%v", src, err)
+	}
+	if err := os.WriteFile(dst, content, 0600); err != nil {
+		return fmt.Errorf("failed to write %v, err:%v", dst, err)
+	}
+	return os.Chmod(dst, 0600)
+}
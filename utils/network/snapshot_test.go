@@ -0,0 +1,83 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"agent/config"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSnapshotRestore(t *testing.T) {
+	connDir, snapDir := t.TempDir(), filepath.Join(t.TempDir(), "snapshot")
+	oldConnDir, oldDns := config.Config.Box.Network.ConnectionDir, config.Config.Box.DnsConfigFile
+	config.Config.Box.Network.ConnectionDir = connDir
+	config.Config.Box.DnsConfigFile = filepath.Join(t.TempDir(), "resolved.conf") // 不存在, 不重启 systemd-resolved
+	defer func() {
+		config.Config.Box.Network.ConnectionDir, config.Config.Box.DnsConfigFile = oldConnDir, oldDns
+	}()
+
+	fake := NewFakeBackend()
+	fake.DevicesList = []*Device{
+		{Interface: "eth0", Type: DevStatus_Type_Wire, State: DevState_Connected, ConnectionUuid: "wired"},
+		{Interface: "wlan0", Type: DevStatus_Type_Wireless, State: DevState_Disconnected},
+	}
+	fake.Connections["wired"] = &Connection{Id: "eth0", Uuid: "wired", Type: "802-3-ethernet", InterfaceName: "eth0"}
+	old := SetBackend(fake)
+	defer SetBackend(old)
+
+	wired := filepath.Join(connDir, "eth0.nmconnection")
+	if err := os.WriteFile(wired, []byte("method=auto"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := TakeSnapshot(snapDir); err != nil {
+		t.Fatal(err)
+	}
+
+	// 快照之后修改原有连接并新增连接
+	if err := os.WriteFile(wired, []byte("method=manual"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	added := filepath.Join(connDir, "home.nmconnection")
+	if err := os.WriteFile(added, []byte("ssid=home"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RestoreSnapshot(snapDir); err != nil {
+		t.Fatal(err)
+	}
+	if content, err := os.ReadFile(wired); err != nil || string(content) != "method=auto" {
+		t.Errorf("wired content %q, err:%v", content, err)
+	}
+	if info, err := os.Stat(wired); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("wired mode %v, err:%v", info, err)
+	}
+	if _, err := os.Stat(added); !os.IsNotExist(err) {
+		t.Errorf("added connection not removed, err:%v", err)
+	}
+	if fake.Reloaded != 1 || len(fake.Activated) != 1 || fake.Activated[0] != "wired" {
+		t.Errorf("reloaded %v, activated %v", fake.Reloaded, fake.Activated)
+	}
+	if _, err := os.Stat(config.Config.Box.DnsConfigFile); !os.IsNotExist(err) {
+		t.Errorf("resolved.conf should not be created, err:%v", err)
+	}
+}
+
+func TestRestoreSnapshotMissing(t *testing.T) {
+	if err := RestoreSnapshot(filepath.Join(t.TempDir(), "none")); err == nil {
+		t.Errorf("expected error for missing snapshot")
+	}
+}
@@ -0,0 +1,333 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"net"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"agent/utils/logger"
+
+	"github.com/asaskevich/EventBus"
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	NetEvent_LinkUp              = "link_up"
+	NetEvent_LinkDown            = "link_down"
+	NetEvent_AddrAdded           = "addr_added"
+	NetEvent_AddrRemoved         = "addr_removed"
+	NetEvent_DefaultRouteChanged = "default_route_changed"
+
+	Family_Ipv4 = "ipv4"
+	Family_Ipv6 = "ipv6"
+)
+
+// NetEvent 网络变化事件
+type NetEvent struct {
+	Type         string    `json:"type"`      // NetEvent_*
+	Interface    string    `json:"interface"` // 默认路由被删除时为空
+	Wireless     bool      `json:"wireless"`
+	Family       string    `json:"family,omitempty"`       // 地址和默认路由事件: Family_Ipv4, Family_Ipv6
+	Address      string    `json:"address,omitempty"`      // 地址事件: 192.168.1.5/24
+	Gateway      string    `json:"gateway,omitempty"`      // 默认路由事件: 新的网关, 默认路由被删除时为空
+	OldInterface string    `json:"oldInterface,omitempty"` // 默认路由事件: 原来的出口网卡
+	OldGateway   string    `json:"oldGateway,omitempty"`
+	Time         time.Time `json:"time"`
+}
+
+var busNetworkChange EventBus.Bus
+
+const (
+	signalNetworkChange = "busNetworkChange"
+)
+
+func init() {
+	busNetworkChange = EventBus.New()
+}
+
+func PublishNetworkChange(events []*NetEvent) {
+	busNetworkChange.Publish(signalNetworkChange, events)
+}
+
+// SubscribeAsyncNetworkChange 订阅网络变化, 同一个 handler 串行调用. 同一时间窗口内的变化合并为一次回调.
+func SubscribeAsyncNetworkChange(handler func(events []*NetEvent)) {
+	busNetworkChange.SubscribeAsync(signalNetworkChange, handler, true)
+}
+
+func UnsubscribeNetworkChange(handler func(events []*NetEvent)) {
+	busNetworkChange.Unsubscribe(signalNetworkChange, handler)
+}
+
+// Watcher 监听网卡、地址和默认路由的变化. netlink 通知只用来触发检查, 事件由前后两次状态比较得出,
+// 所以通知丢失或 netlink 不可用时定时轮询也能得到同样的事件.
+type Watcher struct {
+	PollInterval time.Duration
+	Debounce     time.Duration
+	IgnoreIfaces []string // 忽略的网卡名前缀, 如 docker 网桥和 veth
+
+	mtx   sync.Mutex
+	state *netState
+	stop  chan struct{}
+}
+
+func NewWatcher(pollInterval, debounce time.Duration, ignoreIfaces []string) *Watcher {
+	return &Watcher{PollInterval: pollInterval, Debounce: debounce, IgnoreIfaces: ignoreIfaces}
+}
+
+// Start 记录当前状态并开始监听, 之后的变化才会发布.
+func (w *Watcher) Start() {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.stop != nil {
+		return
+	}
+	w.state = w.snapshot()
+	w.stop = make(chan struct{})
+	go w.run(w.stop)
+}
+
+func (w *Watcher) Stop() {
+	w.mtx.Lock()
+	defer w.mtx.Unlock()
+	if w.stop != nil {
+		close(w.stop)
+		w.stop = nil
+	}
+}
+
+func (w *Watcher) run(stop chan struct{}) {
+	trigger := make(chan struct{}, 1)
+	w.subscribe(trigger, stop)
+
+	ticker := time.NewTicker(w.PollInterval)
+	defer ticker.Stop()
+	debounce := time.NewTimer(w.Debounce)
+	debounce.Stop()
+	defer debounce.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-trigger:
+			debounce.Reset(w.Debounce)
+		case <-debounce.C:
+			w.Check()
+		case <-ticker.C:
+			w.Check()
+		}
+	}
+}
+
+// subscribe 订阅 netlink 的网卡、地址和路由通知, 失败时只靠轮询.
+func (w *Watcher) subscribe(trigger chan struct{}, stop chan struct{}) {
+	errCallback := func(err error) {
+		logger.AppLogger().Warnf("network watcher, netlink err:%v", err)
+	}
+	linkCh := make(chan netlink.LinkUpdate, 16)
+	addrCh := make(chan netlink.AddrUpdate, 16)
+	routeCh := make(chan netlink.RouteUpdate, 16)
+	if err := netlink.LinkSubscribeWithOptions(linkCh, stop, netlink.LinkSubscribeOptions{ErrorCallback: errCallback}); err != nil {
+		logger.AppLogger().Warnf("network watcher, failed LinkSubscribe, polling every %v, err:%v", w.PollInterval, err)
+		linkCh = nil
+	}
+	if err := netlink.AddrSubscribeWithOptions(addrCh, stop, netlink.AddrSubscribeOptions{ErrorCallback: errCallback}); err != nil {
+		logger.AppLogger().Warnf("network watcher, failed AddrSubscribe, polling every %v, err:%v", w.PollInterval, err)
+		addrCh = nil
+	}
+	if err := netlink.RouteSubscribeWithOptions(routeCh, stop, netlink.RouteSubscribeOptions{ErrorCallback: errCallback}); err != nil {
+		logger.AppLogger().Warnf("network watcher, failed RouteSubscribe, polling every %v, err:%v", w.PollInterval, err)
+		routeCh = nil
+	}
+
+	notify := func() {
+		select {
+		case trigger <- struct{}{}:
+		default:
+		}
+	}
+	go func() {
+		// 订阅出错时 netlink 会关闭对应的 channel
+		for linkCh != nil || addrCh != nil || routeCh != nil {
+			select {
+			case <-stop:
+				return
+			case _, ok := <-linkCh:
+				if !ok {
+					linkCh = nil
+				}
+				notify()
+			case _, ok := <-addrCh:
+				if !ok {
+					addrCh = nil
+				}
+				notify()
+			case _, ok := <-routeCh:
+				if !ok {
+					routeCh = nil
+				}
+				notify()
+			}
+		}
+		logger.AppLogger().Warnf("network watcher, netlink subscriptions closed, polling every %v", w.PollInterval)
+	}()
+}
+
+// Check 立即比较当前状态, 有变化时发布事件并返回.
+func (w *Watcher) Check() []*NetEvent {
+	w.mtx.Lock()
+	current := w.snapshot()
+	events := diffNetState(w.state, current, time.Now())
+	w.state = current
+	w.mtx.Unlock()
+
+	if len(events) > 0 {
+		for _, ev := range events {
+			logger.AppLogger().Infof("network watcher, event:%+v", ev)
+		}
+		PublishNetworkChange(events)
+	}
+	return events
+}
+
+type defaultRoute struct {
+	Interface string
+	Gateway   string
+}
+
+type netState struct {
+	links  map[string]bool            // 网卡 -> 是否已连接(IFF_UP 且 IFF_RUNNING)
+	addrs  map[string]map[string]bool // 网卡 -> ip/prefix 集合
+	routes map[string]defaultRoute    // Family_* -> 度量值最小的默认路由
+}
+
+func (w *Watcher) ignored(iface string) bool {
+	for _, prefix := range w.IgnoreIfaces {
+		if len(prefix) > 0 && strings.HasPrefix(iface, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (w *Watcher) snapshot() *netState {
+	state := &netState{links: map[string]bool{}, addrs: map[string]map[string]bool{}, routes: map[string]defaultRoute{}}
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		logger.AppLogger().Warnf("network watcher, failed Interfaces, err:%v", err)
+	}
+	for _, iface := range ifaces {
+		if w.ignored(iface.Name) || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		state.links[iface.Name] = iface.Flags&net.FlagUp != 0 && iface.Flags&net.FlagRunning != 0
+		state.addrs[iface.Name] = map[string]bool{}
+		addrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, a := range addrs {
+			state.addrs[iface.Name][a.String()] = true
+		}
+	}
+	if b, err := os.ReadFile("/proc/net/route"); err == nil {
+		if r, ok := parseIpv4DefaultRoute(string(b)); ok && !w.ignored(r.Interface) {
+			state.routes[Family_Ipv4] = r
+		}
+	}
+	if b, err := os.ReadFile("/proc/net/ipv6_route"); err == nil {
+		if r, ok := parseIpv6DefaultRoute(string(b)); ok && !w.ignored(r.Interface) {
+			state.routes[Family_Ipv6] = r
+		}
+	}
+	return state
+}
+
+// diffNetState 比较两次状态, 按网卡名排序生成事件.
+func diffNetState(old, cur *netState, now time.Time) []*NetEvent {
+	events := make([]*NetEvent, 0)
+	names := map[string]bool{}
+	for name := range old.links {
+		names[name] = true
+	}
+	for name := range cur.links {
+		names[name] = true
+	}
+	sorted := make([]string, 0, len(names))
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	for _, name := range sorted {
+		wireless := isWireless(name)
+		if oldUp, curUp := old.links[name], cur.links[name]; oldUp != curUp {
+			t := NetEvent_LinkDown
+			if curUp {
+				t = NetEvent_LinkUp
+			}
+			events = append(events, &NetEvent{Type: t, Interface: name, Wireless: wireless, Time: now})
+		}
+		for _, addr := range sortedKeys(old.addrs[name]) {
+			if !cur.addrs[name][addr] {
+				events = append(events, &NetEvent{Type: NetEvent_AddrRemoved, Interface: name, Wireless: wireless,
+					Family: addrFamily(addr), Address: addr, Time: now})
+			}
+		}
+		for _, addr := range sortedKeys(cur.addrs[name]) {
+			if !old.addrs[name][addr] {
+				events = append(events, &NetEvent{Type: NetEvent_AddrAdded, Interface: name, Wireless: wireless,
+					Family: addrFamily(addr), Address: addr, Time: now})
+			}
+		}
+	}
+
+	for _, family := range []string{Family_Ipv4, Family_Ipv6} {
+		oldRoute, curRoute := old.routes[family], cur.routes[family]
+		if oldRoute == curRoute {
+			continue
+		}
+		events = append(events, &NetEvent{Type: NetEvent_DefaultRouteChanged, Interface: curRoute.Interface,
+			Wireless: len(curRoute.Interface) > 0 && isWireless(curRoute.Interface), Family: family,
+			Gateway: curRoute.Gateway, OldInterface: oldRoute.Interface, OldGateway: oldRoute.Gateway, Time: now})
+	}
+	return events
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func addrFamily(addr string) string {
+	ip := net.ParseIP(strings.Split(addr, "/")[0])
+	if ip != nil && ip.To4() == nil {
+		return Family_Ipv6
+	}
+	return Family_Ipv4
+}
+
+func isWireless(iface string) bool {
+	_, err := os.Stat("/sys/class/net/" + iface + "/wireless")
+	return err == nil
+}
@@ -0,0 +1,100 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultIpv4Gateway 返回度量值最小的 ipv4 默认路由的网卡和网关.
+func DefaultIpv4Gateway() (string, net.IP, error) {
+	b, err := os.ReadFile("/proc/net/route")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read /proc/net/route, err:%v", err)
+	}
+	r, ok := parseIpv4DefaultRoute(string(b))
+	if !ok {
+		return "", nil, fmt.Errorf("no ipv4 default route")
+	}
+	return r.Interface, net.ParseIP(r.Gateway), nil
+}
+
+// parseIpv4DefaultRoute 从 /proc/net/route 中找出度量值最小的默认路由.
+// 各列为 Iface Destination Gateway Flags RefCnt Use Metric Mask ..., 地址为小端十六进制.
+func parseIpv4DefaultRoute(content string) (defaultRoute, bool) {
+	var best defaultRoute
+	bestMetric, found := uint64(0), false
+	for _, line := range strings.Split(content, "\n")[1:] {
+		fields := strings.Fields(line)
+		if len(fields) < 8 || fields[1] != "00000000" || fields[7] != "00000000" {
+			continue
+		}
+		flags, err := strconv.ParseUint(fields[3], 16, 32)
+		if err != nil || flags&0x1 == 0 { // RTF_UP
+			continue
+		}
+		metric, err := strconv.ParseUint(fields[6], 10, 32)
+		if err != nil {
+			continue
+		}
+		gw, err := strconv.ParseUint(fields[2], 16, 32)
+		if err != nil {
+			continue
+		}
+		if found && metric >= bestMetric {
+			continue
+		}
+		ip := make(net.IP, net.IPv4len)
+		binary.LittleEndian.PutUint32(ip, uint32(gw))
+		best, bestMetric, found = defaultRoute{Interface: fields[0], Gateway: ip.String()}, metric, true
+	}
+	return best, found
+}
+
+// parseIpv6DefaultRoute 从 /proc/net/ipv6_route 中找出度量值最小的默认路由.
+// 各列为 Destination DestPrefixLen Source SourcePrefixLen NextHop Metric RefCnt Use Flags Iface, 数值为十六进制.
+func parseIpv6DefaultRoute(content string) (defaultRoute, bool) {
+	var best defaultRoute
+	bestMetric, found := uint64(0), false
+	for _, line := range strings.Split(content, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 10 || fields[0] != strings.Repeat("0", 32) || fields[1] != "00" || fields[9] == "lo" {
+			continue
+		}
+		flags, err := strconv.ParseUint(fields[8], 16, 32)
+		if err != nil || flags&0x1 == 0 || flags&0x200 != 0 { // RTF_UP, RTF_REJECT
+			continue
+		}
+		metric, err := strconv.ParseUint(fields[5], 16, 32)
+		if err != nil {
+			continue
+		}
+		nextHop, err := hex.DecodeString(fields[4])
+		if err != nil || len(nextHop) != net.IPv6len {
+			continue
+		}
+		if found && metric >= bestMetric {
+			continue
+		}
+		best, bestMetric, found = defaultRoute{Interface: fields[9], Gateway: net.IP(nextHop).String()}, metric, true
+	}
+	return best, found
+}
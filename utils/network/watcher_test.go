@@ -0,0 +1,85 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDiffNetState(t *testing.T) {
+	old := &netState{
+		links: map[string]bool{"eth0": true, "wlan0": true},
+		addrs: map[string]map[string]bool{
+			"eth0":  {"192.168.1.5/24": true, "fe80::1/64": true},
+			"wlan0": {"192.168.2.8/24": true},
+		},
+		routes: map[string]defaultRoute{Family_Ipv4: {Interface: "eth0", Gateway: "192.168.1.1"}},
+	}
+	cur := &netState{
+		links: map[string]bool{"eth0": true, "wlan0": false},
+		addrs: map[string]map[string]bool{
+			"eth0":  {"192.168.1.9/24": true, "fe80::1/64": true},
+			"wlan0": {},
+		},
+		routes: map[string]defaultRoute{Family_Ipv4: {Interface: "eth0", Gateway: "192.168.1.1"},
+			Family_Ipv6: {Interface: "eth0", Gateway: "fe80::a"}},
+	}
+	if events := diffNetState(old, old, time.Now()); len(events) != 0 {
+		t.Fatalf("unexpected events %+v", events)
+	}
+
+	events := diffNetState(old, cur, time.Now())
+	want := []NetEvent{
+		{Type: NetEvent_AddrRemoved, Interface: "eth0", Family: Family_Ipv4, Address: "192.168.1.5/24"},
+		{Type: NetEvent_AddrAdded, Interface: "eth0", Family: Family_Ipv4, Address: "192.168.1.9/24"},
+		{Type: NetEvent_LinkDown, Interface: "wlan0"},
+		{Type: NetEvent_AddrRemoved, Interface: "wlan0", Family: Family_Ipv4, Address: "192.168.2.8/24"},
+		{Type: NetEvent_DefaultRouteChanged, Interface: "eth0", Family: Family_Ipv6, Gateway: "fe80::a"},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("events %+v", events)
+	}
+	for i, ev := range events {
+		if ev.Type != want[i].Type || ev.Interface != want[i].Interface || ev.Family != want[i].Family ||
+			ev.Address != want[i].Address || ev.Gateway != want[i].Gateway {
+			t.Errorf("event %v: %+v, want %+v", i, ev, want[i])
+		}
+	}
+}
+
+func TestParseDefaultRoute(t *testing.T) {
+	v4 := `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+wlan0	00000000	0102A8C0	0003	0	0	600	00000000	0	0	0
+eth0	00000000	0101A8C0	0003	0	0	100	00000000	0	0	0
+eth0	0001A8C0	00000000	0001	0	0	100	00FFFFFF	0	0	0
+`
+	r, ok := parseIpv4DefaultRoute(v4)
+	if !ok || r.Interface != "eth0" || r.Gateway != "192.168.1.1" {
+		t.Errorf("ipv4 default route %+v, %v", r, ok)
+	}
+
+	v6 := `00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000001 00000400 00000001 00000000 00000003     eth0
+fe800000000000000000000000000000 40 00000000000000000000000000000000 00 00000000000000000000000000000000 00000100 00000001 00000000 00000001     eth0
+00000000000000000000000000000000 00 00000000000000000000000000000000 00 00000000000000000000000000000000 ffffffff 00000001 00000000 00200200       lo
+`
+	r, ok = parseIpv6DefaultRoute(v6)
+	if !ok || r.Interface != "eth0" || r.Gateway != "fe80::1" {
+		t.Errorf("ipv6 default route %+v, %v", r, ok)
+	}
+	if _, ok := parseIpv6DefaultRoute(""); ok {
+		t.Errorf("expected no ipv6 default route")
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package network
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	WifiSecurity_None       = "none"
+	WifiSecurity_WpaPsk     = "wpa-psk" // WPA/WPA2 个人版
+	WifiSecurity_Sae        = "sae"     // WPA3 个人版
+	WifiSecurity_Enterprise = "wpa-eap" // WPA2/WPA3 企业版(802.1X)
+
+	WifiEap_Peap = "peap"
+	WifiEap_Ttls = "ttls"
+
+	WifiPhase2_Mschapv2 = "mschapv2"
+	WifiPhase2_Pap      = "pap"
+	WifiPhase2_Gtc      = "gtc"
+)
+
+// WifiEapConfig 企业版 wifi 的 802.1X 设置, 只支持 PEAP 和 TTLS 这两种用户名密码认证方式.
+type WifiEapConfig struct {
+	Method            string // WifiEap_Peap, WifiEap_Ttls
+	Phase2Auth        string // 内层认证, 默认 mschapv2
+	Identity          string
+	Password          string
+	AnonymousIdentity string // 外层明文身份, 为空时使用 Identity
+	CaCertPath        string // 服务器 CA 证书(PEM)路径
+	DomainSuffixMatch string // 校验服务器证书的域名后缀
+	// NoServerCertCheck 明确不校验服务器证书. 为 false 时 CaCertPath 和 DomainSuffixMatch 至少设置一个,
+	// 否则任何伪造的 AP 都能拿到内层认证的用户名密码
+	NoServerCertCheck bool
+}
+
+// WifiProfileConfig 新增或修改的 wifi 配置. 同一 SSID 只保存一个配置.
+type WifiProfileConfig struct {
+	Ssid        string
+	Hidden      bool   // 隐藏网络, 连接时主动探测该 SSID
+	Security    string // WifiSecurity_*
+	Password    string // wpa-psk/sae 的密码. 修改已有配置时为空表示保留原密码
+	Priority    int32  // 自动连接优先级, 越大越优先
+	AutoConnect bool
+	Eap         WifiEapConfig // 只在 WifiSecurity_Enterprise 时使用
+}
+
+// Validate 检查 SSID、安全类型和认证参数.
+func (cfg *WifiProfileConfig) Validate() error {
+	if len(cfg.Ssid) < 1 || len(cfg.Ssid) > 32 {
+		return fmt.Errorf("invalid ssid length %v", len(cfg.Ssid))
+	}
+	switch cfg.Security {
+	case WifiSecurity_None:
+	case WifiSecurity_WpaPsk:
+		// 修改已有配置时可不传密码
+		if len(cfg.Password) > 0 && (len(cfg.Password) < 8 || len(cfg.Password) > 63) {
+			return fmt.Errorf("invalid wpa-psk password length %v", len(cfg.Password))
+		}
+	case WifiSecurity_Sae:
+		// SAE 没有 WPA2 的 8-63 位限制, 但不能超过 wpa_supplicant 的 sae_password 长度
+		if len(cfg.Password) > 128 {
+			return fmt.Errorf("invalid sae password length %v", len(cfg.Password))
+		}
+	case WifiSecurity_Enterprise:
+		switch cfg.Eap.Method {
+		case WifiEap_Peap, WifiEap_Ttls:
+		default:
+			return fmt.Errorf("invalid eap method %v", cfg.Eap.Method)
+		}
+		switch cfg.Eap.Phase2Auth {
+		case "", WifiPhase2_Mschapv2, WifiPhase2_Pap, WifiPhase2_Gtc:
+		default:
+			return fmt.Errorf("invalid phase2 auth %v", cfg.Eap.Phase2Auth)
+		}
+		if len(cfg.Eap.Identity) < 1 {
+			return fmt.Errorf("no eap identity")
+		}
+		if len(cfg.Eap.CaCertPath) > 0 && !strings.HasPrefix(cfg.Eap.CaCertPath, "/") {
+			return fmt.Errorf("ca cert path %v is not absolute", cfg.Eap.CaCertPath)
+		}
+		if len(cfg.Eap.CaCertPath) < 1 && len(cfg.Eap.DomainSuffixMatch) < 1 && !cfg.Eap.NoServerCertCheck {
+			return fmt.Errorf("ca cert path or domain suffix match is required unless server cert check is disabled")
+		}
+	default:
+		return fmt.Errorf("invalid wifi security %v", cfg.Security)
+	}
+	return nil
+}
+
+// validateSecret 保存前检查是否有可用的密码. 只有原配置的安全类型相同且已有密码时才能不传密码,
+// 新增配置时 oldSecurity 为空.
+func (cfg *WifiProfileConfig) validateSecret(oldSecurity string, oldHasSecret bool) error {
+	keepOld := oldSecurity == cfg.Security && oldHasSecret
+	switch cfg.Security {
+	case WifiSecurity_WpaPsk, WifiSecurity_Sae:
+		if len(cfg.Password) < 1 && !keepOld {
+			return fmt.Errorf("%w: %v", ErrWifiPasswordRequired, cfg.Ssid)
+		}
+	case WifiSecurity_Enterprise:
+		if len(cfg.Eap.Password) < 1 && !keepOld {
+			return fmt.Errorf("%w: %v", ErrWifiPasswordRequired, cfg.Ssid)
+		}
+	}
+	return nil
+}
+
+// WifiProfile 已保存的 wifi 配置, 不包含密码
+type WifiProfile struct {
+	Uuid        string `json:"uuid"`
+	Ssid        string `json:"ssid"`
+	Hidden      bool   `json:"hidden"`
+	Security    string `json:"security"` // WifiSecurity_*
+	EapMethod   string `json:"eapMethod"`
+	Identity    string `json:"identity"`
+	Priority    int32  `json:"priority"`
+	AutoConnect bool   `json:"autoConnect"`
+	Active      bool   `json:"active"` // 当前是否已连接
+}
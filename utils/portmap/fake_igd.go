@@ -0,0 +1,171 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package portmap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+)
+
+const fakeIGDServiceType = "urn:schemas-upnp-org:service:WANIPConnection:1"
+
+const fakeIGDRootDesc = `<?xml version="1.0"?>
+<root xmlns="urn:schemas-upnp-org:device-1-0">
+  <specVersion><major>1</major><minor>0</minor></specVersion>
+  <device>
+    <deviceType>urn:schemas-upnp-org:device:InternetGatewayDevice:1</deviceType>
+    <friendlyName>Fake IGD</friendlyName>
+    <UDN>uuid:fake-igd-0000-0000-000000000001</UDN>
+    <deviceList><device>
+      <deviceType>urn:schemas-upnp-org:device:WANDevice:1</deviceType>
+      <UDN>uuid:fake-igd-0000-0000-000000000002</UDN>
+      <deviceList><device>
+        <deviceType>urn:schemas-upnp-org:device:WANConnectionDevice:1</deviceType>
+        <UDN>uuid:fake-igd-0000-0000-000000000003</UDN>
+        <serviceList><service>
+          <serviceType>` + fakeIGDServiceType + `</serviceType>
+          <serviceId>urn:upnp-org:serviceId:WANIPConn1</serviceId>
+          <SCPDURL>/WANIPCn.xml</SCPDURL>
+          <controlURL>/ctl/IPConn</controlURL>
+          <eventSubURL>/evt/IPConn</eventSubURL>
+        </service></serviceList>
+      </device></deviceList>
+    </device></deviceList>
+  </device>
+</root>`
+
+// FakeIGDMapping FakeIGD 上的一条映射
+type FakeIGDMapping struct {
+	InternalClient string
+	InternalPort   string
+	Description    string
+	LeaseDuration  string
+}
+
+// FakeIGD 本地的 UPnP IGD, 只实现 WANIPConnection:1 的 GetExternalIPAddress、AddPortMapping、DeletePortMapping,
+// 供测试使用. 用 NewUpnpMapperByURL(igd.Location(), ...) 连接.
+type FakeIGD struct {
+	ExternalIP          string
+	OnlyPermanentLeases bool // 为 true 时对非 0 租期返回 725 OnlyPermanentLeasesSupported
+
+	mtx      sync.Mutex
+	mappings map[string]FakeIGDMapping // key 为 TCP/443 形式
+	server   *httptest.Server
+}
+
+func NewFakeIGD(externalIP string) *FakeIGD {
+	igd := &FakeIGD{ExternalIP: externalIP, mappings: map[string]FakeIGDMapping{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/rootDesc.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/xml")
+		io.WriteString(w, fakeIGDRootDesc)
+	})
+	mux.HandleFunc("/ctl/IPConn", igd.handleControl)
+	igd.server = httptest.NewServer(mux)
+	return igd
+}
+
+func (igd *FakeIGD) Location() string {
+	return igd.server.URL + "/rootDesc.xml"
+}
+
+func (igd *FakeIGD) Close() {
+	igd.server.Close()
+}
+
+// Mapping 返回 transport(TCP/UDP) 和外部端口对应的映射
+func (igd *FakeIGD) Mapping(transport string, externalPort int) (FakeIGDMapping, bool) {
+	igd.mtx.Lock()
+	defer igd.mtx.Unlock()
+	m, ok := igd.mappings[fmt.Sprintf("%v/%v", strings.ToUpper(transport), externalPort)]
+	return m, ok
+}
+
+func (igd *FakeIGD) handleControl(w http.ResponseWriter, r *http.Request) {
+	action := strings.Trim(r.Header.Get("SOAPAction"), `"`)
+	action = action[strings.LastIndex(action, "#")+1:]
+	args := soapArgs(r.Body)
+
+	igd.mtx.Lock()
+	defer igd.mtx.Unlock()
+	switch action {
+	case "GetExternalIPAddress":
+		writeSoapResponse(w, action, "<NewExternalIPAddress>"+igd.ExternalIP+"</NewExternalIPAddress>")
+	case "AddPortMapping":
+		if igd.OnlyPermanentLeases && args["NewLeaseDuration"] != "0" {
+			writeSoapFault(w, 725, "OnlyPermanentLeasesSupported")
+			return
+		}
+		igd.mappings[args["NewProtocol"]+"/"+args["NewExternalPort"]] = FakeIGDMapping{InternalClient: args["NewInternalClient"],
+			InternalPort: args["NewInternalPort"], Description: args["NewPortMappingDescription"], LeaseDuration: args["NewLeaseDuration"]}
+		writeSoapResponse(w, action, "")
+	case "DeletePortMapping":
+		key := args["NewProtocol"] + "/" + args["NewExternalPort"]
+		if _, ok := igd.mappings[key]; !ok {
+			writeSoapFault(w, 714, "NoSuchEntryInArray")
+			return
+		}
+		delete(igd.mappings, key)
+		writeSoapResponse(w, action, "")
+	default:
+		writeSoapFault(w, 401, "Invalid Action")
+	}
+}
+
+// soapArgs 取出 SOAP 请求中各参数元素的文本
+func soapArgs(body io.Reader) map[string]string {
+	args := map[string]string{}
+	decoder := xml.NewDecoder(body)
+	name := ""
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return args
+		}
+		switch t := token.(type) {
+		case xml.StartElement:
+			name = t.Name.Local
+			args[name] = ""
+		case xml.CharData:
+			if len(name) > 0 {
+				args[name] = strings.TrimSpace(string(t))
+			}
+		case xml.EndElement:
+			name = ""
+		}
+	}
+}
+
+func writeSoapResponse(w http.ResponseWriter, action, body string) {
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	fmt.Fprintf(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" `+
+		`s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body><u:%vResponse xmlns:u="%v">%v</u:%vResponse>`+
+		`</s:Body></s:Envelope>`, action, fakeIGDServiceType, body, action)
+}
+
+func writeSoapFault(w http.ResponseWriter, code int, description string) {
+	w.Header().Set("Content-Type", `text/xml; charset="utf-8"`)
+	w.WriteHeader(http.StatusInternalServerError)
+	fmt.Fprintf(w, `<?xml version="1.0"?><s:Envelope xmlns:s="http://schemas.xmlsoap.org/soap/envelope/" `+
+		`s:encodingStyle="http://schemas.xmlsoap.org/soap/encoding/"><s:Body><s:Fault><faultcode>s:Client</faultcode>`+
+		`<faultstring>UPnPError</faultstring><detail><UPnPError xmlns="urn:schemas-upnp-org:control-1-0">`+
+		`<errorCode>%v</errorCode><errorDescription>%v</errorDescription></UPnPError></detail></s:Fault></s:Body></s:Envelope>`,
+		code, description)
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package portmap
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	natpmp "github.com/jackpal/go-nat-pmp"
+)
+
+// NatPmpMapper 通过 NAT-PMP(RFC 6886) 映射端口, 请求发往网关的 5351 端口.
+type NatPmpMapper struct {
+	client *natpmp.Client
+}
+
+func NewNatPmpMapper(gateway net.IP, timeout time.Duration) *NatPmpMapper {
+	return &NatPmpMapper{client: natpmp.NewClientWithTimeout(gateway, timeout)}
+}
+
+func (m *NatPmpMapper) Protocol() string {
+	return Protocol_NatPmp
+}
+
+func (m *NatPmpMapper) ExternalIP() (net.IP, error) {
+	res, err := m.client.GetExternalAddress()
+	if err != nil {
+		return nil, fmt.Errorf("failed GetExternalAddress, err:%v", err)
+	}
+	ip := res.ExternalIPAddress
+	return net.IPv4(ip[0], ip[1], ip[2], ip[3]), nil
+}
+
+func (m *NatPmpMapper) AddMapping(transport string, internalIP net.IP, internalPort, externalPort int, lease time.Duration) (*Mapping, error) {
+	if externalPort == 0 {
+		externalPort = internalPort
+	}
+	res, err := m.client.AddPortMapping(transport, internalPort, externalPort, int(lease/time.Second))
+	if err != nil {
+		return nil, fmt.Errorf("failed AddPortMapping %v %v->%v, err:%v", transport, externalPort, internalPort, err)
+	}
+	return &Mapping{Transport: transport, InternalIP: internalIP, InternalPort: internalPort,
+		ExternalPort: int(res.MappedExternalPort), Lease: time.Duration(res.PortMappingLifetimeInSeconds) * time.Second}, nil
+}
+
+// DeleteMapping 租期为 0 即删除映射.
+func (m *NatPmpMapper) DeleteMapping(mapping *Mapping) error {
+	if _, err := m.client.AddPortMapping(mapping.Transport, mapping.InternalPort, 0, 0); err != nil {
+		return fmt.Errorf("failed to delete mapping %v %v, err:%v", mapping.Transport, mapping.InternalPort, err)
+	}
+	return nil
+}
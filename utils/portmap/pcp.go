@@ -0,0 +1,213 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package portmap
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	pcpVersion     = 2
+	pcpOpMap       = 1
+	pcpResponseBit = 0x80
+	pcpMapSize     = 60 // 24 字节公共头 + 36 字节 MAP 操作数据
+
+	pcpProtoTCP = 6
+	pcpProtoUDP = 17
+)
+
+var pcpResultNames = map[byte]string{
+	1:  "UNSUPP_VERSION",
+	2:  "NOT_AUTHORIZED",
+	3:  "MALFORMED_REQUEST",
+	4:  "UNSUPP_OPCODE",
+	5:  "UNSUPP_OPTION",
+	6:  "MALFORMED_OPTION",
+	7:  "NETWORK_FAILURE",
+	8:  "NO_RESOURCES",
+	9:  "UNSUPP_PROTOCOL",
+	10: "USER_EX_QUOTA",
+	11: "CANNOT_PROVIDE_EXTERNAL",
+	12: "ADDRESS_MISMATCH",
+	13: "EXCESSIVE_REMOTE_PEERS",
+}
+
+// PcpMapper 通过 PCP(RFC 6887) 的 MAP 操作映射端口. 续租和删除需要使用同一个 nonce.
+type PcpMapper struct {
+	Server  *net.UDPAddr // 网关的 5351 端口
+	Timeout time.Duration
+
+	mtx        sync.Mutex
+	nonces     map[string][12]byte
+	externalIP net.IP
+}
+
+func NewPcpMapper(gateway net.IP, timeout time.Duration) *PcpMapper {
+	return &PcpMapper{Server: &net.UDPAddr{IP: gateway, Port: 5351}, Timeout: timeout, nonces: map[string][12]byte{}}
+}
+
+func (m *PcpMapper) Protocol() string {
+	return Protocol_Pcp
+}
+
+// ExternalIP PCP 没有单独查询外部地址的操作, 返回最近一次 MAP 响应中的地址.
+func (m *PcpMapper) ExternalIP() (net.IP, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	if m.externalIP == nil {
+		return nil, ErrExternalIPUnknown
+	}
+	return m.externalIP, nil
+}
+
+func (m *PcpMapper) AddMapping(transport string, internalIP net.IP, internalPort, externalPort int, lease time.Duration) (*Mapping, error) {
+	if externalPort == 0 {
+		externalPort = internalPort
+	}
+	mapping, err := m.request(transport, internalPort, externalPort, uint32(lease/time.Second))
+	if err != nil {
+		return nil, err
+	}
+	mapping.InternalIP = internalIP
+	m.mtx.Lock()
+	m.externalIP = mapping.ExternalIP
+	m.mtx.Unlock()
+	return mapping, nil
+}
+
+// DeleteMapping 租期为 0 的 MAP 请求即删除映射.
+func (m *PcpMapper) DeleteMapping(mapping *Mapping) error {
+	_, err := m.request(mapping.Transport, mapping.InternalPort, 0, 0)
+	if err == nil {
+		m.mtx.Lock()
+		delete(m.nonces, pcpNonceKey(mapping.Transport, mapping.InternalPort))
+		m.mtx.Unlock()
+	}
+	return err
+}
+
+func pcpNonceKey(transport string, internalPort int) string {
+	return fmt.Sprintf("%v/%v", transport, internalPort)
+}
+
+func (m *PcpMapper) nonce(transport string, internalPort int) ([12]byte, error) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+	key := pcpNonceKey(transport, internalPort)
+	nonce, ok := m.nonces[key]
+	if !ok {
+		if _, err := rand.Read(nonce[:]); err != nil {
+			return nonce, err
+		}
+		m.nonces[key] = nonce
+	}
+	return nonce, nil
+}
+
+func (m *PcpMapper) request(transport string, internalPort, externalPort int, lifetime uint32) (*Mapping, error) {
+	proto := byte(pcpProtoTCP)
+	if transport == Transport_UDP {
+		proto = pcpProtoUDP
+	}
+	nonce, err := m.nonce(transport, internalPort)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.DialUDP("udp", nil, m.Server)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial pcp server %v, err:%v", m.Server, err)
+	}
+	defer conn.Close()
+
+	req := encodePcpMap(conn.LocalAddr().(*net.UDPAddr).IP, nonce, proto, uint16(internalPort), uint16(externalPort), lifetime)
+	buf := make([]byte, 1100) // PCP 消息最大 1100 字节
+	// 按 RFC 6887 重传, 等待时间逐次加倍
+	wait := 250 * time.Millisecond
+	for deadline := time.Now().Add(m.Timeout); time.Now().Before(deadline); wait *= 2 {
+		if _, err := conn.Write(req); err != nil {
+			return nil, fmt.Errorf("failed to send pcp request, err:%v", err)
+		}
+		readDeadline := time.Now().Add(wait)
+		if readDeadline.After(deadline) {
+			readDeadline = deadline
+		}
+		conn.SetReadDeadline(readDeadline)
+		for {
+			n, err := conn.Read(buf)
+			if err != nil {
+				break // 超时后重传
+			}
+			mapping, err := decodePcpMap(buf[:n], nonce)
+			if err == errPcpNotOurs {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			mapping.Transport, mapping.InternalPort = transport, internalPort
+			return mapping, nil
+		}
+	}
+	return nil, fmt.Errorf("pcp request to %v timeout", m.Server)
+}
+
+// encodePcpMap 生成 MAP 请求. 地址字段统一为 16 字节, ipv4 使用 ::ffff:a.b.c.d 形式.
+func encodePcpMap(clientIP net.IP, nonce [12]byte, proto byte, internalPort, externalPort uint16, lifetime uint32) []byte {
+	b := make([]byte, pcpMapSize)
+	b[0] = pcpVersion
+	b[1] = pcpOpMap
+	binary.BigEndian.PutUint32(b[4:8], lifetime)
+	copy(b[8:24], clientIP.To16())
+	copy(b[24:36], nonce[:])
+	b[36] = proto
+	binary.BigEndian.PutUint16(b[40:42], internalPort)
+	binary.BigEndian.PutUint16(b[42:44], externalPort)
+	// 建议的外部地址: 全 0 的 ipv4 映射地址表示不指定
+	copy(b[44:60], net.IPv4zero.To16())
+	return b
+}
+
+var errPcpNotOurs = fmt.Errorf("not a response to our pcp request")
+
+func decodePcpMap(b []byte, nonce [12]byte) (*Mapping, error) {
+	if len(b) < 4 || b[1]&pcpResponseBit == 0 {
+		return nil, errPcpNotOurs
+	}
+	if len(b) >= pcpMapSize && !bytes.Equal(b[24:36], nonce[:]) {
+		return nil, errPcpNotOurs
+	}
+	if b[3] != 0 {
+		name, ok := pcpResultNames[b[3]]
+		if !ok {
+			name = fmt.Sprintf("result code %v", b[3])
+		}
+		// 只支持 NAT-PMP 的路由器会以版本 0 回复 UNSUPP_VERSION
+		return nil, fmt.Errorf("pcp request failed, %v", name)
+	}
+	if len(b) < pcpMapSize || b[0] != pcpVersion || b[1] != pcpOpMap|pcpResponseBit {
+		return nil, errPcpNotOurs
+	}
+	return &Mapping{
+		ExternalPort: int(binary.BigEndian.Uint16(b[42:44])),
+		ExternalIP:   net.IP(append([]byte{}, b[44:60]...)),
+		Lease:        time.Duration(binary.BigEndian.Uint32(b[4:8])) * time.Second,
+	}, nil
+}
@@ -0,0 +1,88 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package portmap
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+)
+
+// fakePcpServer 对每个 MAP 请求先回一个 nonce 不同的响应, 再回正确的响应.
+func fakePcpServer(t *testing.T, externalIP net.IP, result byte) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		buf := make([]byte, 1100)
+		for {
+			n, addr, err := conn.ReadFromUDP(buf)
+			if err != nil {
+				return
+			}
+			if n != pcpMapSize || buf[0] != pcpVersion || buf[1] != pcpOpMap {
+				continue
+			}
+			rsp := append([]byte{}, buf[:n]...)
+			rsp[1] |= pcpResponseBit
+			rsp[3] = result
+			binary.BigEndian.PutUint16(rsp[42:44], binary.BigEndian.Uint16(buf[42:44])+1)
+			copy(rsp[44:60], externalIP.To16())
+
+			other := append([]byte{}, rsp...)
+			other[24] ^= 0xff
+			conn.WriteToUDP(other, addr)
+			conn.WriteToUDP(rsp, addr)
+		}
+	}()
+	return conn
+}
+
+func TestPcpMapper(t *testing.T) {
+	server := fakePcpServer(t, net.ParseIP("198.51.100.9"), 0)
+	defer server.Close()
+
+	m := NewPcpMapper(net.IPv4(127, 0, 0, 1), 2*time.Second)
+	m.Server = server.LocalAddr().(*net.UDPAddr)
+	if _, err := m.ExternalIP(); err != ErrExternalIPUnknown {
+		t.Errorf("expected ErrExternalIPUnknown, got %v", err)
+	}
+	mapping, err := m.AddMapping(Transport_TCP, net.IPv4(127, 0, 0, 1), 443, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mapping.ExternalPort != 444 || mapping.Lease != time.Hour || !mapping.ExternalIP.Equal(net.ParseIP("198.51.100.9")) {
+		t.Errorf("mapping %+v", mapping)
+	}
+	if ip, err := m.ExternalIP(); err != nil || !ip.Equal(net.ParseIP("198.51.100.9")) {
+		t.Errorf("external ip %v, err:%v", ip, err)
+	}
+	if err := m.DeleteMapping(mapping); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPcpMapperError(t *testing.T) {
+	server := fakePcpServer(t, net.IPv4zero, 8)
+	defer server.Close()
+
+	m := NewPcpMapper(net.IPv4(127, 0, 0, 1), 2*time.Second)
+	m.Server = server.LocalAddr().(*net.UDPAddr)
+	if _, err := m.AddMapping(Transport_UDP, net.IPv4(127, 0, 0, 1), 443, 0, time.Hour); err == nil {
+		t.Errorf("expected NO_RESOURCES error")
+	}
+}
@@ -0,0 +1,72 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package portmap
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+const (
+	Protocol_Upnp   = "upnp"
+	Protocol_NatPmp = "natpmp"
+	Protocol_Pcp    = "pcp"
+
+	Transport_TCP = "tcp"
+	Transport_UDP = "udp"
+)
+
+var ErrExternalIPUnknown = errors.New("external ip unknown")
+
+// Mapping 路由器上的一条端口映射
+type Mapping struct {
+	Transport    string        // Transport_TCP, Transport_UDP
+	InternalIP   net.IP        // 盒子的局域网地址
+	InternalPort int           // 盒子上的端口
+	ExternalPort int           // 路由器实际分配的外部端口, 可能与请求的不同
+	ExternalIP   net.IP        // 映射响应中带的外部地址(PCP), 没有时为 nil
+	Lease        time.Duration // 路由器实际给的租期, 0 表示永久
+}
+
+// Mapper 路由器端口映射协议. 同一内部端口重复调用 AddMapping 即为续租.
+type Mapper interface {
+	Protocol() string
+	// ExternalIP 路由器的外部地址. 不支持单独查询时返回 ErrExternalIPUnknown, 使用 Mapping.ExternalIP.
+	ExternalIP() (net.IP, error)
+	// AddMapping 添加或续租映射, externalPort 为建议的外部端口, 0 表示与内部端口相同.
+	AddMapping(transport string, internalIP net.IP, internalPort, externalPort int, lease time.Duration) (*Mapping, error)
+	DeleteMapping(m *Mapping) error
+}
+
+var cgnatNet = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// IsPublicIP 外部地址是否可以从公网直接访问. 私有地址和运营商级 NAT(100.64.0.0/10)地址说明路由器外面还有一层 NAT.
+func IsPublicIP(ip net.IP) bool {
+	if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	return !cgnatNet.Contains(ip)
+}
+
+// LocalIPFor 返回访问 gateway 时使用的本机地址, 即端口映射的内部地址.
+func LocalIPFor(gateway net.IP) (net.IP, error) {
+	c, err := net.Dial("udp4", net.JoinHostPort(gateway.String(), "5351"))
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	return c.LocalAddr().(*net.UDPAddr).IP, nil
+}
@@ -0,0 +1,46 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package portmap
+
+import (
+	"net"
+	"testing"
+)
+
+func TestIsPublicIP(t *testing.T) {
+	cases := map[string]bool{
+		"203.0.113.7":   true,
+		"8.8.8.8":       true,
+		"2001:4860::1":  true,
+		"192.168.1.1":   false,
+		"10.0.0.1":      false,
+		"172.16.5.4":    false,
+		"100.64.0.1":    false,
+		"100.127.255.1": false,
+		"100.128.0.1":   true,
+		"127.0.0.1":     false,
+		"0.0.0.0":       false,
+		"fd00::1":       false,
+		"fe80::1":       false,
+	}
+	for s, want := range cases {
+		if got := IsPublicIP(net.ParseIP(s)); got != want {
+			t.Errorf("IsPublicIP(%v) = %v, want %v", s, got, want)
+		}
+	}
+	if IsPublicIP(nil) {
+		t.Errorf("IsPublicIP(nil) should be false")
+	}
+}
@@ -0,0 +1,122 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package portmap
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/huin/goupnp/dcps/internetgateway2"
+)
+
+// igdClient WANIPConnection1/2 和 WANPPPConnection1 共有的方法
+type igdClient interface {
+	GetExternalIPAddress() (string, error)
+	AddPortMapping(remoteHost string, externalPort uint16, protocol string, internalPort uint16,
+		internalClient string, enabled bool, description string, leaseDuration uint32) error
+	DeletePortMapping(remoteHost string, externalPort uint16, protocol string) error
+}
+
+// UpnpMapper 通过 UPnP IGD 的 WANIPConnection/WANPPPConnection 服务映射端口.
+type UpnpMapper struct {
+	Description string // 路由器管理页面中显示的映射说明
+	client      igdClient
+}
+
+// DiscoverUpnp 通过 SSDP 查找局域网中的 IGD, 依次尝试 WANIPConnection2、WANIPConnection1、WANPPPConnection1.
+func DiscoverUpnp(description string) (*UpnpMapper, error) {
+	if clients, _, err := internetgateway2.NewWANIPConnection2Clients(); err == nil && len(clients) > 0 {
+		return &UpnpMapper{Description: description, client: clients[0]}, nil
+	}
+	if clients, _, err := internetgateway2.NewWANIPConnection1Clients(); err == nil && len(clients) > 0 {
+		return &UpnpMapper{Description: description, client: clients[0]}, nil
+	}
+	clients, _, err := internetgateway2.NewWANPPPConnection1Clients()
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover upnp igd, err:%v", err)
+	}
+	if len(clients) < 1 {
+		return nil, fmt.Errorf("no upnp igd found")
+	}
+	return &UpnpMapper{Description: description, client: clients[0]}, nil
+}
+
+// NewUpnpMapperByURL 使用指定的 IGD 设备描述地址, 如 http://192.168.1.1:5000/rootDesc.xml.
+func NewUpnpMapperByURL(location string, description string) (*UpnpMapper, error) {
+	loc, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid igd location %v, err:%v", location, err)
+	}
+	if clients, err := internetgateway2.NewWANIPConnection2ClientsByURL(loc); err == nil && len(clients) > 0 {
+		return &UpnpMapper{Description: description, client: clients[0]}, nil
+	}
+	if clients, err := internetgateway2.NewWANIPConnection1ClientsByURL(loc); err == nil && len(clients) > 0 {
+		return &UpnpMapper{Description: description, client: clients[0]}, nil
+	}
+	clients, err := internetgateway2.NewWANPPPConnection1ClientsByURL(loc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load igd %v, err:%v", location, err)
+	}
+	if len(clients) < 1 {
+		return nil, fmt.Errorf("no wan connection service in igd %v", location)
+	}
+	return &UpnpMapper{Description: description, client: clients[0]}, nil
+}
+
+func (m *UpnpMapper) Protocol() string {
+	return Protocol_Upnp
+}
+
+func (m *UpnpMapper) ExternalIP() (net.IP, error) {
+	s, err := m.client.GetExternalIPAddress()
+	if err != nil {
+		return nil, fmt.Errorf("failed GetExternalIPAddress, err:%v", err)
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid external ip %q", s)
+	}
+	return ip, nil
+}
+
+func (m *UpnpMapper) AddMapping(transport string, internalIP net.IP, internalPort, externalPort int, lease time.Duration) (*Mapping, error) {
+	if externalPort == 0 {
+		externalPort = internalPort
+	}
+	seconds := uint32(lease / time.Second)
+	err := m.client.AddPortMapping("", uint16(externalPort), strings.ToUpper(transport), uint16(internalPort),
+		internalIP.String(), true, m.Description, seconds)
+	// 725 OnlyPermanentLeasesSupported, 部分路由器只支持永久映射
+	if err != nil && seconds > 0 && strings.Contains(err.Error(), "725") {
+		seconds = 0
+		err = m.client.AddPortMapping("", uint16(externalPort), strings.ToUpper(transport), uint16(internalPort),
+			internalIP.String(), true, m.Description, seconds)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed AddPortMapping %v %v->%v:%v, err:%v", transport, externalPort, internalIP, internalPort, err)
+	}
+	return &Mapping{Transport: transport, InternalIP: internalIP, InternalPort: internalPort, ExternalPort: externalPort,
+		Lease: time.Duration(seconds) * time.Second}, nil
+}
+
+func (m *UpnpMapper) DeleteMapping(mapping *Mapping) error {
+	if err := m.client.DeletePortMapping("", uint16(mapping.ExternalPort), strings.ToUpper(mapping.Transport)); err != nil {
+		return fmt.Errorf("failed DeletePortMapping %v %v, err:%v", mapping.Transport, mapping.ExternalPort, err)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package portmap
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestUpnpMapperWithFakeIGD(t *testing.T) {
+	igd := NewFakeIGD("203.0.113.7")
+	defer igd.Close()
+
+	m, err := NewUpnpMapperByURL(igd.Location(), "aospace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ip, err := m.ExternalIP()
+	if err != nil || ip.String() != "203.0.113.7" {
+		t.Fatalf("external ip %v, err:%v", ip, err)
+	}
+
+	mapping, err := m.AddMapping(Transport_TCP, net.ParseIP("192.168.1.5"), 443, 0, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mapping.ExternalPort != 443 || mapping.Lease != time.Hour {
+		t.Errorf("mapping %+v", mapping)
+	}
+	got, ok := igd.Mapping(Transport_TCP, 443)
+	if !ok || got.InternalClient != "192.168.1.5" || got.InternalPort != "443" || got.LeaseDuration != "3600" ||
+		got.Description != "aospace" {
+		t.Errorf("igd mapping %+v, %v", got, ok)
+	}
+
+	if err := m.DeleteMapping(mapping); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := igd.Mapping(Transport_TCP, 443); ok {
+		t.Errorf("mapping not deleted")
+	}
+}
+
+func TestUpnpMapperOnlyPermanentLeases(t *testing.T) {
+	igd := NewFakeIGD("203.0.113.7")
+	igd.OnlyPermanentLeases = true
+	defer igd.Close()
+
+	m, err := NewUpnpMapperByURL(igd.Location(), "aospace")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mapping, err := m.AddMapping(Transport_TCP, net.ParseIP("192.168.1.5"), 443, 8443, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mapping.ExternalPort != 8443 || mapping.Lease != 0 {
+		t.Errorf("mapping %+v", mapping)
+	}
+	if got, ok := igd.Mapping(Transport_TCP, 8443); !ok || got.LeaseDuration != "0" {
+		t.Errorf("igd mapping %+v, %v", got, ok)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package reqsign 透传请求签名, 签名方(system-agent)和验证方(网关等下游服务)共用.
+//
+// 待签名字符串(规范形式)由以下各行以 "\n" 连接, 末尾没有换行:
+//
+//	AOSPACE-SIGN-V1
+//	<HTTP 方法, 大写>
+//	<请求路径, 包含查询参数, 例如 /space/v1/api/user/info?x=1>
+//	<请求体 SHA256 的小写十六进制>
+//	<时间戳, Unix 秒>
+//	<nonce, 每个请求唯一>
+//	<clientUuid, 可为空>
+//	<btid>
+//
+// 签名算法为 RSA PKCS#1 v1.5 + SHA256(与设备密钥、加密芯片的签名一致), 结果 base64 编码后放在
+// HeaderSignature 中, 其余参数分别放在 HeaderTimestamp、HeaderNonce、HeaderContentSha256 中.
+// clientUuid、btid 沿用原有的 clientUuid、btid 请求头.
+//
+// 验证方检查时间戳偏差、请求体摘要和签名, 并拒绝时间窗口内重复的 nonce, 见 Verifier.
+package reqsign
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	Version = "AOSPACE-SIGN-V1"
+
+	HeaderVersion       = "X-Aospace-Sign-Version"
+	HeaderTimestamp     = "X-Aospace-Timestamp"
+	HeaderNonce         = "X-Aospace-Nonce"
+	HeaderContentSha256 = "X-Aospace-Content-Sha256"
+	HeaderSignature     = "X-Aospace-Signature"
+	HeaderClientUuid    = "clientUuid"
+	HeaderBtid          = "btid"
+)
+
+// Signer 签名接口, 可以由设备私钥或加密芯片实现.
+type Signer interface {
+	Sign(data []byte) ([]byte, error)
+}
+
+// SignerFunc 把函数适配为 Signer.
+type SignerFunc func(data []byte) ([]byte, error)
+
+func (f SignerFunc) Sign(data []byte) ([]byte, error) {
+	return f(data)
+}
+
+// RSASigner 使用 RSA 私钥签名.
+type RSASigner struct {
+	Key *rsa.PrivateKey
+}
+
+func (s *RSASigner) Sign(data []byte) ([]byte, error) {
+	sum := sha256.Sum256(data)
+	return rsa.SignPKCS1v15(rand.Reader, s.Key, crypto.SHA256, sum[:])
+}
+
+// Params 参与签名的请求参数.
+type Params struct {
+	Method     string
+	Path       string
+	Body       []byte
+	Timestamp  int64
+	Nonce      string
+	ClientUuid string
+	Btid       string
+}
+
+// BodyDigest 返回请求体 SHA256 的小写十六进制.
+func BodyDigest(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+// Canonical 返回待签名字符串.
+func (p *Params) Canonical() string {
+	return canonical(p, BodyDigest(p.Body))
+}
+
+func canonical(p *Params, bodyDigest string) string {
+	return strings.Join([]string{
+		Version,
+		strings.ToUpper(p.Method),
+		p.Path,
+		bodyDigest,
+		strconv.FormatInt(p.Timestamp, 10),
+		p.Nonce,
+		p.ClientUuid,
+		p.Btid,
+	}, "\n")
+}
+
+// Sign 对请求签名, 返回需要附加的请求头. Timestamp、Nonce 为空时自动生成.
+func Sign(signer Signer, p *Params) (map[string]string, error) {
+	if p.Timestamp == 0 {
+		p.Timestamp = time.Now().Unix()
+	}
+	if len(p.Nonce) < 1 {
+		nonce, err := newNonce()
+		if err != nil {
+			return nil, err
+		}
+		p.Nonce = nonce
+	}
+
+	digest := BodyDigest(p.Body)
+	sig, err := signer.Sign([]byte(canonical(p, digest)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign request, err:%v", err)
+	}
+	return map[string]string{
+		HeaderVersion:       Version,
+		HeaderTimestamp:     strconv.FormatInt(p.Timestamp, 10),
+		HeaderNonce:         p.Nonce,
+		HeaderContentSha256: digest,
+		HeaderSignature:     base64.StdEncoding.EncodeToString(sig),
+	}, nil
+}
+
+func newNonce() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reqsign
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte(`{"a":1}`)
+	headers, err := Sign(&RSASigner{Key: key}, &Params{Method: "POST", Path: "/space/v1/api/user?x=1",
+		Body: body, ClientUuid: "client", Btid: "btid"})
+	if err != nil {
+		t.Fatalf("failed Sign, err:%v", err)
+	}
+
+	req := httptest.NewRequest("POST", "http://gateway/space/v1/api/user?x=1", bytes.NewReader(body))
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	req.Header.Set(HeaderClientUuid, "client")
+	req.Header.Set(HeaderBtid, "btid")
+
+	v := &Verifier{PubKeys: []*rsa.PublicKey{&key.PublicKey}, Nonces: NewMemoryNonceStore()}
+	if _, err := v.VerifyRequest(req, body); err != nil {
+		t.Fatalf("failed VerifyRequest, err:%v", err)
+	}
+	if _, err := v.VerifyRequest(req, body); err != ErrReplayed {
+		t.Errorf("replayed request, err:%v", err)
+	}
+
+	v.Nonces = NewMemoryNonceStore()
+	if _, err := v.VerifyRequest(req, []byte(`{"a":2}`)); err != ErrBodyDigest {
+		t.Errorf("tampered body, err:%v", err)
+	}
+	req.Header.Set(HeaderBtid, "other")
+	if _, err := v.VerifyRequest(req, body); err != ErrBadSignature {
+		t.Errorf("tampered header, err:%v", err)
+	}
+	req.Header.Set(HeaderBtid, "btid")
+	v.Now = func() time.Time { return time.Now().Add(DefaultMaxSkew + time.Minute) }
+	if _, err := v.VerifyRequest(req, body); err != ErrExpired {
+		t.Errorf("expired request, err:%v", err)
+	}
+}
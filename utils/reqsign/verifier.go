@@ -0,0 +1,145 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package reqsign
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const DefaultMaxSkew = 5 * time.Minute
+
+var (
+	ErrUnsigned     = errors.New("request not signed")
+	ErrExpired      = errors.New("request timestamp out of range")
+	ErrBodyDigest   = errors.New("request body digest mismatch")
+	ErrBadSignature = errors.New("request signature invalid")
+	ErrReplayed     = errors.New("request nonce replayed")
+)
+
+// NonceStore 记录已使用的 nonce.
+type NonceStore interface {
+	// CheckAndStore nonce 未使用过时记录到 expiresAt 并返回 true, 否则返回 false.
+	CheckAndStore(nonce string, expiresAt time.Time) bool
+}
+
+// Verifier 校验 Sign 生成的请求签名.
+type Verifier struct {
+	PubKeys []*rsa.PublicKey // 任一公钥验证通过即可, 设备密钥轮换的宽限期内同时配置新旧公钥
+	MaxSkew time.Duration    // 允许的时间戳偏差, 为 0 时使用 DefaultMaxSkew
+	Nonces  NonceStore       // 为 nil 时不检查重放
+	Now     func() time.Time // 为 nil 时使用 time.Now
+}
+
+// VerifyRequest 校验 http 请求. body 为已读取的请求体.
+func (v *Verifier) VerifyRequest(r *http.Request, body []byte) (*Params, error) {
+	if r.Header.Get(HeaderVersion) != Version || len(r.Header.Get(HeaderSignature)) < 1 {
+		return nil, ErrUnsigned
+	}
+	ts, err := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %v, err:%v", HeaderTimestamp, err)
+	}
+	p := &Params{
+		Method:     r.Method,
+		Path:       r.URL.RequestURI(),
+		Body:       body,
+		Timestamp:  ts,
+		Nonce:      r.Header.Get(HeaderNonce),
+		ClientUuid: r.Header.Get(HeaderClientUuid),
+		Btid:       r.Header.Get(HeaderBtid),
+	}
+	if r.Header.Get(HeaderContentSha256) != BodyDigest(body) {
+		return nil, ErrBodyDigest
+	}
+	return p, v.Verify(p, r.Header.Get(HeaderSignature))
+}
+
+// Verify 校验参数和 base64 编码的签名.
+func (v *Verifier) Verify(p *Params, b64Signature string) error {
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+	maxSkew := v.MaxSkew
+	if maxSkew <= 0 {
+		maxSkew = DefaultMaxSkew
+	}
+	ts := time.Unix(p.Timestamp, 0)
+	if ts.Before(now.Add(-maxSkew)) || ts.After(now.Add(maxSkew)) {
+		return ErrExpired
+	}
+	if len(p.Nonce) < 1 {
+		return fmt.Errorf("empty nonce")
+	}
+
+	sig, err := base64.StdEncoding.DecodeString(b64Signature)
+	if err != nil {
+		return ErrBadSignature
+	}
+	sum := sha256.Sum256([]byte(p.Canonical()))
+	verified := false
+	for _, pub := range v.PubKeys {
+		if rsa.VerifyPKCS1v15(pub, crypto.SHA256, sum[:], sig) == nil {
+			verified = true
+			break
+		}
+	}
+	if !verified {
+		return ErrBadSignature
+	}
+
+	// 时间戳超出窗口的请求已被拒绝, nonce 只需保留到窗口结束.
+	if v.Nonces != nil && !v.Nonces.CheckAndStore(p.Nonce, ts.Add(maxSkew)) {
+		return ErrReplayed
+	}
+	return nil
+}
+
+// MemoryNonceStore 进程内的 NonceStore.
+type MemoryNonceStore struct {
+	mu     sync.Mutex
+	nonces map[string]time.Time
+	now    func() time.Time
+}
+
+func NewMemoryNonceStore() *MemoryNonceStore {
+	return &MemoryNonceStore{nonces: make(map[string]time.Time), now: time.Now}
+}
+
+func (s *MemoryNonceStore) CheckAndStore(nonce string, expiresAt time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	for k, exp := range s.nonces {
+		if now.After(exp) {
+			delete(s.nonces, k)
+		}
+	}
+	if _, ok := s.nonces[nonce]; ok {
+		return false
+	}
+	s.nonces[nonce] = expiresAt
+	return true
+}
@@ -0,0 +1,109 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package securitychip 软件模拟的加密芯片.
+// 实现与 eulixspace-security-agent 相同的 sign/verify/exportpubkey 接口, 密钥使用机器密钥加密保存在文件中.
+// 用于没有加密芯片的设备上开发、测试 SecurityChipSupport == true 的代码路径.
+package securitychip
+
+import (
+	"agent/utils/keystore"
+	"agent/utils/logger"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+const emulatorKeyBits = 2048
+
+// Emulator 软件加密芯片. 签名算法与 encwrapper.Sign 一致(RSA PKCS#1 v1.5 + SHA256).
+type Emulator struct {
+	key    *rsa.PrivateKey
+	pubPem []byte
+}
+
+// NewEmulator 从密封的密钥文件加载芯片密钥, 文件不存在时生成新密钥并密封保存.
+func NewEmulator(sealedKeyFile string, machineSecret []byte) (*Emulator, error) {
+	var key *rsa.PrivateKey
+	sealed, err := os.ReadFile(sealedKeyFile)
+	if err == nil {
+		der, err := Unseal(machineSecret, sealed)
+		if err != nil {
+			return nil, fmt.Errorf("failed to unseal %v, err:%v", sealedKeyFile, err)
+		}
+		k, err := x509.ParsePKCS8PrivateKey(der)
+		keystore.Zeroize(der)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse key in %v, err:%v", sealedKeyFile, err)
+		}
+		var ok bool
+		if key, ok = k.(*rsa.PrivateKey); !ok {
+			return nil, fmt.Errorf("unexpected key type %T in %v", k, sealedKeyFile)
+		}
+	} else if os.IsNotExist(err) {
+		logger.AppLogger().Infof("NewEmulator, %v not exist, generating new key", sealedKeyFile)
+		if key, err = rsa.GenerateKey(rand.Reader, emulatorKeyBits); err != nil {
+			return nil, fmt.Errorf("failed to generate key, err:%v", err)
+		}
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		if err != nil {
+			return nil, err
+		}
+		sealed, err = Seal(machineSecret, der)
+		keystore.Zeroize(der)
+		if err != nil {
+			return nil, err
+		}
+		if err := os.MkdirAll(filepath.Dir(sealedKeyFile), 0700); err != nil {
+			return nil, err
+		}
+		if err := os.WriteFile(sealedKeyFile, sealed, 0600); err != nil {
+			return nil, fmt.Errorf("failed to write %v, err:%v", sealedKeyFile, err)
+		}
+	} else {
+		return nil, fmt.Errorf("failed to read %v, err:%v", sealedKeyFile, err)
+	}
+
+	pubDer, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Emulator{
+		key:    key,
+		pubPem: pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pubDer}),
+	}, nil
+}
+
+// Sign 对 data 签名.
+func (e *Emulator) Sign(data []byte) ([]byte, error) {
+	sum := sha256.Sum256(data)
+	return rsa.SignPKCS1v15(rand.Reader, e.key, crypto.SHA256, sum[:])
+}
+
+// Verify 校验 data 的签名.
+func (e *Emulator) Verify(data, signature []byte) error {
+	sum := sha256.Sum256(data)
+	return rsa.VerifyPKCS1v15(&e.key.PublicKey, crypto.SHA256, sum[:], signature)
+}
+
+// PublicKeyPem 返回芯片公钥(PEM, PKIX 格式).
+func (e *Emulator) PublicKeyPem() []byte {
+	return e.pubPem
+}
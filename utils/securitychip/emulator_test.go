@@ -0,0 +1,122 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package securitychip
+
+import (
+	"agent/biz/model/device"
+	"agent/biz/model/device_ability"
+	"agent/config"
+	"agent/utils/jwt"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestEmulator(t *testing.T, keyFile string) *Emulator {
+	e, err := NewEmulator(keyFile, []byte("test-machine-secret"))
+	if err != nil {
+		t.Fatalf("failed NewEmulator, err:%v", err)
+	}
+	return e
+}
+
+func TestSealedKeyReload(t *testing.T) {
+	keyFile := filepath.Join(t.TempDir(), "sealed_key.bin")
+	e1 := newTestEmulator(t, keyFile)
+	e2 := newTestEmulator(t, keyFile)
+	if string(e1.PublicKeyPem()) != string(e2.PublicKeyPem()) {
+		t.Errorf("reloaded key differs from generated key")
+	}
+
+	if _, err := NewEmulator(keyFile, []byte("other-machine-secret")); err == nil {
+		t.Errorf("sealed key opened with wrong machine secret")
+	}
+}
+
+// TestSecurityChipPaths 通过 unix socket 和 http 调用模拟芯片, 覆盖 SecurityChipSupport == true 的代码路径.
+func TestSecurityChipPaths(t *testing.T) {
+	dir := t.TempDir()
+	e := newTestEmulator(t, filepath.Join(dir, "sealed_key.bin"))
+
+	sockAddr := filepath.Join(dir, "security-agent.sock")
+	l, err := ListenUnix(sockAddr)
+	if err != nil {
+		t.Fatalf("failed ListenUnix, err:%v", err)
+	}
+	go http.Serve(l, e.Handler())
+	defer l.Close()
+
+	config.Config.Box.SecurityChipAgentSockAddr = sockAddr
+	device_ability.GetAbilityModel().SecurityChipSupport = true
+
+	pubPem := device.GetDevicePubKey()
+	if string(pubPem) != string(e.PublicKeyPem()) {
+		t.Fatalf("GetDevicePubKey:%v, expected:%v", string(pubPem), string(e.PublicKeyPem()))
+	}
+	block, _ := pem.Decode(pubPem)
+	if block == nil {
+		t.Fatalf("failed pem.Decode")
+	}
+	pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed ParsePKIXPublicKey, err:%v", err)
+	}
+
+	data := []byte("btid-for-test")
+	b64Sig, err := device.SignFromSecurityChip(data)
+	if err != nil {
+		t.Fatalf("failed SignFromSecurityChip, err:%v", err)
+	}
+	sig, err := base64.StdEncoding.DecodeString(b64Sig)
+	if err != nil {
+		t.Fatalf("failed to decode signature, err:%v", err)
+	}
+	sum := sha256.Sum256(data)
+	if err := rsa.VerifyPKCS1v15(pub.(*rsa.PublicKey), crypto.SHA256, sum[:], sig); err != nil {
+		t.Errorf("signature does not verify with exported public key, err:%v", err)
+	}
+
+	srv := httptest.NewServer(e.Handler())
+	defer srv.Close()
+	jwt.SetSignHost(srv.URL + apiPrefix)
+	token, err := jwt.GenerateJWT("box", "access_token", []string{"client"}, time.Now().Add(time.Hour), nil, nil, nil)
+	if err != nil {
+		t.Fatalf("failed GenerateJWT, err:%v", err)
+	}
+	issuer, _, _, _, err := jwt.ParseJwt(token, nil)
+	if err != nil || issuer != "box" {
+		t.Errorf("failed ParseJwt, issuer:%v, err:%v", issuer, err)
+	}
+
+	// 篡改 payload 后签名校验必须失败
+	parts := strings.Split(token, ".")
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		t.Fatalf("failed to decode payload, err:%v", err)
+	}
+	parts[1] = base64.RawURLEncoding.EncodeToString([]byte(strings.Replace(string(payload), `"box"`, `"evil"`, 1)))
+	if _, _, _, _, err := jwt.ParseJwt(strings.Join(parts, "."), nil); err == nil {
+		t.Errorf("tampered token passed verification")
+	}
+}
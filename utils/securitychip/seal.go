@@ -0,0 +1,34 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package securitychip
+
+import "agent/utils/keystore"
+
+const sealInfo = "aospace-security-chip-emulator"
+
+// MachineSecret 返回本机的机器密钥, 见 keystore.MachineSecret.
+func MachineSecret() ([]byte, error) {
+	return keystore.MachineSecret()
+}
+
+// Seal 使用机器密钥加密 plain.
+func Seal(machineSecret, plain []byte) ([]byte, error) {
+	return keystore.Seal(machineSecret, sealInfo, plain)
+}
+
+// Unseal 使用机器密钥解密 Seal 的输出.
+func Unseal(machineSecret, sealed []byte) ([]byte, error) {
+	return keystore.Unseal(machineSecret, sealInfo, sealed)
+}
@@ -0,0 +1,215 @@
+// Copyright (c) 2022 Institute of Software, Chinese Academy of Sciences (ISCAS)
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package securitychip
+
+import (
+	"agent/config"
+	"agent/utils/jwt"
+	"agent/utils/keystore"
+	"agent/utils/logger"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/dungeonsnd/gocom/encrypt/random"
+)
+
+const (
+	apiPrefix = "/security/v1/api"
+
+	PathSign         = apiPrefix + "/crypto/sign"
+	PathVerify       = apiPrefix + "/crypto/verify"
+	PathExportPubKey = apiPrefix + "/crypto/exportpubkey"
+)
+
+type request struct {
+	Input     string `json:"input"`
+	Signature string `json:"signature,omitempty"`
+}
+
+type result struct {
+	Output string `json:"output"`
+}
+
+type response struct {
+	RequestId string `json:"requestId"`
+	Message   string `json:"message"`
+	Results   result `json:"results"`
+}
+
+// Handler 返回与 eulixspace-security-agent 相同的 http 接口.
+func (e *Emulator) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(PathSign, e.handleSign)
+	mux.HandleFunc(PathVerify, e.handleVerify)
+	mux.HandleFunc(PathExportPubKey, e.handleExportPubKey)
+	return mux
+}
+
+func (e *Emulator) handleSign(w http.ResponseWriter, r *http.Request) {
+	var req request
+	input, err := decodeRequest(r, &req)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+	sig, err := e.Sign(input)
+	if err != nil {
+		writeResponse(w, http.StatusInternalServerError, fmt.Sprintf("failed to sign, err:%v", err), "")
+		return
+	}
+	writeResponse(w, http.StatusOK, "OK", base64.StdEncoding.EncodeToString(sig))
+}
+
+func (e *Emulator) handleVerify(w http.ResponseWriter, r *http.Request) {
+	var req request
+	input, err := decodeRequest(r, &req)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, err.Error(), "")
+		return
+	}
+	sig, err := base64.StdEncoding.DecodeString(req.Signature)
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, fmt.Sprintf("invalid signature encoding, err:%v", err), "")
+		return
+	}
+	err = e.Verify(input, sig)
+	if err != nil {
+		// utils/jwt 的自定义签名方法把 sign 接口返回的 base64 字符串直接作为签名,
+		// 校验时再编码一次, 因此这里也接受两层 base64 编码的签名.
+		if inner, err1 := base64.StdEncoding.DecodeString(string(sig)); err1 == nil {
+			err = e.Verify(input, inner)
+		}
+	}
+	if err != nil {
+		writeResponse(w, http.StatusBadRequest, fmt.Sprintf("verify failed, err:%v", err), "false")
+		return
+	}
+	writeResponse(w, http.StatusOK, "OK", "true")
+}
+
+func (e *Emulator) handleExportPubKey(w http.ResponseWriter, r *http.Request) {
+	writeResponse(w, http.StatusOK, "OK", string(e.PublicKeyPem()))
+}
+
+func decodeRequest(r *http.Request, req *request) ([]byte, error) {
+	if r.Method != http.MethodPost {
+		return nil, fmt.Errorf("method %v not allowed", r.Method)
+	}
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		return nil, fmt.Errorf("invalid request body, err:%v", err)
+	}
+	input, err := base64.StdEncoding.DecodeString(req.Input)
+	if err != nil {
+		return nil, fmt.Errorf("invalid input encoding, err:%v", err)
+	}
+	return input, nil
+}
+
+func writeResponse(w http.ResponseWriter, status int, message, output string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(&response{RequestId: random.GenUUID(), Message: message, Results: result{Output: output}})
+}
+
+// ServeUnix 在 unix socket 上提供接口, 阻塞直到出错.
+func (e *Emulator) ServeUnix(sockAddr string) error {
+	l, err := ListenUnix(sockAddr)
+	if err != nil {
+		return err
+	}
+	return http.Serve(l, e.Handler())
+}
+
+// ListenUnix 监听 unix socket, 会删除遗留的 socket 文件.
+func ListenUnix(sockAddr string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(sockAddr), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.Remove(sockAddr); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to remove stale socket %v, err:%v", sockAddr, err)
+	}
+	l, err := net.Listen("unix", sockAddr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %v, err:%v", sockAddr, err)
+	}
+	if err := os.Chmod(sockAddr, 0660); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Start 按配置启动软件加密芯片: 监听 SecurityChipAgentSockAddr 和 http 接口, 并把 jwt 签名地址指向模拟芯片.
+// 监听成功后返回, 接口在后台协程中提供.
+func Start() error {
+	cfg := config.Config.Box.SecurityChipEmulator
+	secret, err := MachineSecret()
+	if err != nil {
+		return err
+	}
+	e, err := NewEmulator(cfg.SealedKeyFile, secret)
+	keystore.Zeroize(secret)
+	if err != nil {
+		return err
+	}
+
+	sockAddr := config.Config.Box.SecurityChipAgentSockAddr
+	l, err := ListenUnix(sockAddr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		if err := http.Serve(l, e.Handler()); err != nil {
+			logger.AppLogger().Errorf("security chip emulator on %v stopped, err:%v", sockAddr, err)
+		}
+	}()
+
+	// jwt 签名通过 http 调用加密芯片, 未配置 HttpListenAddr 时只在本机随机端口监听供 agent 自身使用
+	httpAddr := cfg.HttpListenAddr
+	if len(httpAddr) < 1 {
+		httpAddr = "127.0.0.1:0"
+	}
+	hl, err := net.Listen("tcp", httpAddr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %v, err:%v", httpAddr, err)
+	}
+	go func() {
+		if err := http.Serve(hl, e.Handler()); err != nil {
+			logger.AppLogger().Errorf("security chip emulator on %v stopped, err:%v", hl.Addr(), err)
+		}
+	}()
+	jwt.SetSignHost(signHostOf(hl.Addr()))
+	logger.AppLogger().Infof("security chip emulator started, sock:%v, http:%v", sockAddr, hl.Addr())
+	return nil
+}
+
+// signHostOf 返回 jwt 签名使用的接口地址, 监听在任意地址时使用本机回环地址.
+func signHostOf(addr net.Addr) string {
+	tcpAddr, ok := addr.(*net.TCPAddr)
+	if !ok {
+		return "http://" + addr.String() + apiPrefix
+	}
+	ip := tcpAddr.IP
+	if ip == nil || ip.IsUnspecified() {
+		ip = net.IPv4(127, 0, 0, 1)
+	}
+	return "http://" + net.JoinHostPort(ip.String(), strconv.Itoa(tcpAddr.Port)) + apiPrefix
+}